@@ -7,17 +7,27 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	wailsruntime "github.com/wailsapp/wails/v2/pkg/runtime"
 
 	"github.com/yuta/enque/backend/config"
+	"github.com/yuta/enque/backend/dedupe"
 	"github.com/yuta/enque/backend/detector"
 	"github.com/yuta/enque/backend/encoder"
 	"github.com/yuta/enque/backend/encoder/nvencc"
 	"github.com/yuta/enque/backend/events"
 	"github.com/yuta/enque/backend/logging"
+	"github.com/yuta/enque/backend/metrics"
+	"github.com/yuta/enque/backend/notify"
+	"github.com/yuta/enque/backend/probe"
 	"github.com/yuta/enque/backend/profile"
 	"github.com/yuta/enque/backend/queue"
+	"github.com/yuta/enque/backend/remote"
+	"github.com/yuta/enque/backend/rules"
+	"github.com/yuta/enque/backend/sample"
+	"github.com/yuta/enque/backend/watch"
 )
 
 // App is the main application struct exposed to Wails.
@@ -27,7 +37,17 @@ type App struct {
 	profileMgr *profile.Manager
 	registry   *encoder.Registry
 	queueMgr   *queue.Manager
+	emitter    *events.Emitter
+	notifier   *notify.Notifier
+	remote     *remote.Server
+	metrics    *metrics.Collector
+	metricsSrv *metrics.Server
+	watcher    *watch.Service
+	selector   *rules.Selector
 	logger     *logging.AppLogger
+
+	testMu     sync.Mutex
+	testCancel context.CancelFunc // of the running test encode
 }
 
 // New creates a new App instance.
@@ -49,19 +69,57 @@ func (a *App) Startup(ctx context.Context) {
 	if err := a.profileMgr.Load(); err != nil {
 		fmt.Printf("warning: failed to load profiles: %v\n", err)
 	}
+	a.profileMgr.SetChecker(a.registry)
 
 	logger, err := logging.NewAppLogger(config.LogsDir())
 	if err != nil {
 		fmt.Printf("warning: failed to init app logger: %v\n", err)
 	}
 	a.logger = logger
+	for _, w := range a.profileMgr.LoadWarnings() {
+		fmt.Printf("warning: %s\n", w)
+		if a.logger != nil {
+			a.logger.Warn("%s", w)
+		}
+	}
+
+	a.notifier = notify.NewNotifier(a.logger)
+	a.notifier.SetWebhooks(a.configMgr.Get().Webhooks)
+
+	// The collector is always fed so counters cover the whole process
+	// lifetime even if the endpoint is enabled later.
+	a.metrics = metrics.NewCollector()
+
+	a.emitter = events.NewEmitter(events.NewWailsSink(ctx), a.notifier, a.metrics)
+	a.queueMgr = queue.NewManager(a.registry, a.emitter, a.logger)
+	a.queueMgr.SetProfileResolver(a.profileMgr)
+	a.selector = &rules.Selector{Config: a.configMgr, Profiles: a.profileMgr}
+	a.queueMgr.SetProfileSelector(a.selector)
+	if ledger, err := dedupe.LoadLedger(config.EncodeLedgerPath()); err != nil {
+		if a.logger != nil {
+			a.logger.Error("duplicate input detection disabled: %v", err)
+		}
+	} else {
+		a.queueMgr.SetEncodeLedger(ledger)
+	}
 
-	emitter := events.NewEmitter(ctx)
-	a.queueMgr = queue.NewManager(a.registry, emitter, a.logger)
+	a.applyRemoteAPI(a.configMgr.Get())
+	a.applyMetrics(a.configMgr.Get())
+	a.startWatcher(a.configMgr.Get())
 }
 
 // Shutdown is called when the app is closing.
 func (a *App) Shutdown(ctx context.Context) {
+	if a.watcher != nil {
+		a.watcher.Stop()
+	}
+	a.stopRemoteAPI()
+	a.stopMetrics()
+	if a.notifier != nil {
+		waitCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		a.notifier.Wait(waitCtx)
+		cancel()
+	}
 	if a.logger != nil {
 		a.logger.Close()
 	}
@@ -124,7 +182,117 @@ func (a *App) SaveAppConfig(cfgJSON string) error {
 	if err := json.Unmarshal([]byte(cfgJSON), &cfg); err != nil {
 		return fmt.Errorf("%s: %w", encoder.ErrValidation, err)
 	}
-	return a.configMgr.Save(cfg)
+	prev := a.configMgr.Get()
+	if err := a.configMgr.Save(cfg); err != nil {
+		return err
+	}
+	a.notifier.SetWebhooks(cfg.Webhooks)
+	if prev.RemoteAPIEnabled != cfg.RemoteAPIEnabled || prev.RemoteAPIAddr != cfg.RemoteAPIAddr || prev.RemoteAPIToken != cfg.RemoteAPIToken {
+		a.applyRemoteAPI(cfg)
+	}
+	if prev.MetricsEnabled != cfg.MetricsEnabled || prev.MetricsAddr != cfg.MetricsAddr {
+		a.applyMetrics(cfg)
+	}
+	if a.watcher != nil {
+		a.watcher.SetFolders(cfg.WatchFolders)
+	}
+	return nil
+}
+
+// --- Remote API ---
+
+// applyRemoteAPI (re)starts or stops the remote HTTP API to match cfg.
+func (a *App) applyRemoteAPI(cfg config.AppConfig) {
+	a.stopRemoteAPI()
+	if !cfg.RemoteAPIEnabled {
+		return
+	}
+
+	srv := remote.NewServer(remote.Options{
+		Addr:     cfg.RemoteAPIAddr,
+		Token:    cfg.RemoteAPIToken,
+		Queue:    a.queueMgr,
+		Profiles: a.profileMgr,
+		Config:   a.configMgr,
+	})
+	if err := srv.Start(); err != nil {
+		if a.logger != nil {
+			a.logger.Error("remote API failed to start: %v", err)
+		}
+		return
+	}
+	a.emitter.AddSink(srv.Sink())
+	a.remote = srv
+	if a.logger != nil {
+		a.logger.Info("remote API listening on %s", srv.Addr())
+	}
+}
+
+func (a *App) stopRemoteAPI() {
+	if a.remote == nil {
+		return
+	}
+	a.emitter.RemoveSink(a.remote.Sink())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	a.remote.Stop(ctx)
+	a.remote = nil
+}
+
+// --- Metrics ---
+
+// applyMetrics (re)starts or stops the Prometheus endpoint to match cfg.
+func (a *App) applyMetrics(cfg config.AppConfig) {
+	a.stopMetrics()
+	if !cfg.MetricsEnabled {
+		return
+	}
+
+	srv := metrics.NewServer(cfg.MetricsAddr, a.metrics)
+	if err := srv.Start(); err != nil {
+		if a.logger != nil {
+			a.logger.Error("metrics endpoint failed to start: %v", err)
+		}
+		return
+	}
+	a.metricsSrv = srv
+	if a.logger != nil {
+		a.logger.Info("metrics endpoint listening on %s", srv.Addr())
+	}
+}
+
+func (a *App) stopMetrics() {
+	if a.metricsSrv == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	a.metricsSrv.Stop(ctx)
+	a.metricsSrv = nil
+}
+
+// --- Watch Folders ---
+
+// startWatcher starts polling the configured watch folders. The service
+// runs even with no folders so folders added later take effect at once.
+func (a *App) startWatcher(cfg config.AppConfig) {
+	ledger, err := watch.LoadLedger(config.WatchLedgerPath())
+	if err != nil {
+		if a.logger != nil {
+			a.logger.Error("watch folders disabled: %v", err)
+		}
+		return
+	}
+	a.watcher = watch.NewService(watch.Options{
+		Queue:    a.queueMgr,
+		Profiles: a.profileMgr,
+		Config:   a.configMgr,
+		Ledger:   ledger,
+		Logger:   a.logger,
+	})
+	a.watcher.SetFolders(cfg.WatchFolders)
+	a.emitter.AddSink(a.watcher)
+	a.watcher.Start()
 }
 
 // --- Profile CRUD ---
@@ -143,6 +311,37 @@ func (a *App) UpsertProfile(profileJSON string) error {
 	return a.profileMgr.Upsert(p)
 }
 
+// UpsertProfileWithNote is UpsertProfile with a note stored on the
+// revision it creates.
+func (a *App) UpsertProfileWithNote(profileJSON string, note string) error {
+	var p profile.Profile
+	if err := json.Unmarshal([]byte(profileJSON), &p); err != nil {
+		return fmt.Errorf("%s: %w", encoder.ErrValidation, err)
+	}
+	return a.profileMgr.UpsertWithNote(p, note)
+}
+
+// ListProfileRevisions returns the revision history of a profile, oldest
+// first.
+func (a *App) ListProfileRevisions(profileID string) ([]profile.Revision, error) {
+	return a.profileMgr.ListRevisions(profileID)
+}
+
+// DiffProfileRevisions returns the fields that changed between two
+// revisions of a profile.
+func (a *App) DiffProfileRevisions(profileID string, from int, to int) ([]profile.FieldChange, error) {
+	return a.profileMgr.DiffRevisions(profileID, from, to)
+}
+
+// RestoreProfileRevision makes an earlier revision current again.
+func (a *App) RestoreProfileRevision(profileID string, revision int, note string) (*profile.Profile, error) {
+	p, err := a.profileMgr.RestoreRevision(profileID, revision, note)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
 // DeleteProfile removes a profile by ID.
 func (a *App) DeleteProfile(profileID string) error {
 	return a.profileMgr.Delete(profileID)
@@ -167,6 +366,65 @@ func (a *App) SetDefaultProfile(profileID string) error {
 	return a.configMgr.Save(cfg)
 }
 
+// ExportProfiles writes the given profiles (all when ids is empty) to a
+// bundle file. When path is empty a save dialog is shown; an empty return
+// value means the user cancelled.
+func (a *App) ExportProfiles(ids []string, path string, stripMachine bool) (string, error) {
+	if path == "" {
+		var err error
+		path, err = wailsruntime.SaveFileDialog(a.ctx, wailsruntime.SaveDialogOptions{
+			Title:           "Export profiles",
+			DefaultFilename: "enque-profiles.json",
+			Filters:         []wailsruntime.FileFilter{{DisplayName: "Profile Bundle (*.json)", Pattern: "*.json"}},
+		})
+		if err != nil || path == "" {
+			return "", err
+		}
+	}
+	if err := a.profileMgr.ExportProfiles(ids, path, profile.ExportOptions{StripMachineFields: stripMachine}); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// ImportProfiles imports a bundle file. onConflict is "rename", "replace"
+// or "skip". When path is empty an open dialog is shown; a nil result
+// means the user cancelled.
+func (a *App) ImportProfiles(path string, onConflict string, stripMachine bool) (*profile.ImportResult, error) {
+	if path == "" {
+		var err error
+		path, err = wailsruntime.OpenFileDialog(a.ctx, wailsruntime.OpenDialogOptions{
+			Title:   "Import profiles",
+			Filters: []wailsruntime.FileFilter{{DisplayName: "Profile Bundle (*.json)", Pattern: "*.json"}},
+		})
+		if err != nil || path == "" {
+			return nil, err
+		}
+	}
+	res, err := a.profileMgr.ImportProfiles(path, profile.ImportOptions{
+		OnConflict:         profile.ConflictPolicy(onConflict),
+		StripMachineFields: stripMachine,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ImportNVEncCCommand converts an NVEncC command line (e.g. pasted from a
+// .bat file) into an unsaved profile. The caller saves it with
+// UpsertProfile after review.
+func (a *App) ImportNVEncCCommand(cmdline string) (*nvencc.CommandImport, error) {
+	imp, err := nvencc.ImportCommandLine(cmdline)
+	if err != nil {
+		return nil, err
+	}
+	if err := profile.Validate(imp.Profile); err != nil {
+		return nil, err
+	}
+	return &imp, nil
+}
+
 // --- GPU / Tool Detection ---
 
 // GetGPUInfo returns GPU information from NVEncC --check-device.
@@ -222,6 +480,161 @@ func (a *App) ResolveOverwrite(sessionID string, jobID string, decision string)
 	return a.queueMgr.ResolveOverwrite(sessionID, jobID, decision)
 }
 
+// ResolveCrop responds to a crop confirmation prompt. rect, when set,
+// adjusts the detected crop.
+func (a *App) ResolveCrop(sessionID string, jobID string, decision string, rect *profile.FilterRect) error {
+	return a.queueMgr.ResolveCrop(sessionID, jobID, decision, rect)
+}
+
+// DetectCrop samples an input with ffmpeg cropdetect and returns the
+// proposed crop, e.g. to confirm it before queueing the file.
+func (a *App) DetectCrop(inputPath string) (probe.Crop, error) {
+	cfg := a.configMgr.Get()
+	media, err := probe.New(cfg.FFprobePath).Probe(a.ctx, inputPath)
+	if err != nil {
+		return probe.Crop{}, err
+	}
+	return probe.NewCropDetector(cfg.FFmpegPath).DetectCrop(a.ctx, inputPath, media)
+}
+
+// --- Test Encode ---
+
+// TestEncode encodes short samples of an input with the given, possibly
+// unsaved, profile and extrapolates their size and speed to the whole
+// input. It runs outside of any session; one test encode runs at a time.
+func (a *App) TestEncode(requestJSON string) (*sample.Result, error) {
+	var req sample.Request
+	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
+		return nil, fmt.Errorf("%s: %w", encoder.ErrValidation, err)
+	}
+	p, err := a.profileMgr.Resolve(req.Profile)
+	if err != nil {
+		return nil, err
+	}
+	req.Profile = p
+	adapter, err := a.registry.Resolve(p.EncoderType)
+	if err != nil {
+		return nil, err
+	}
+	cfg := a.configMgr.Get()
+	if cfg.NVEncCPath == "" {
+		return nil, fmt.Errorf("%s: NVEncC not found", encoder.ErrToolNotFound)
+	}
+
+	ctx, done, err := a.beginTestEncode()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	res, err := a.newTester(adapter).Run(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// CompareProfiles test-encodes the same samples of the inputs with two
+// profiles, possibly unsaved, and saves the comparison as a report linked
+// to both. It counts as a test encode.
+func (a *App) CompareProfiles(requestJSON string) (*sample.Comparison, error) {
+	var req sample.CompareRequest
+	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
+		return nil, fmt.Errorf("%s: %w", encoder.ErrValidation, err)
+	}
+	var err error
+	c := &sample.Comparer{Visuals: sample.NewVisualizer(a.configMgr.Get().FFmpegPath)}
+	if req.ProfileA, c.A, err = a.resolveTester(req.ProfileA); err != nil {
+		return nil, err
+	}
+	if req.ProfileB, c.B, err = a.resolveTester(req.ProfileB); err != nil {
+		return nil, err
+	}
+	if a.configMgr.Get().NVEncCPath == "" {
+		return nil, fmt.Errorf("%s: NVEncC not found", encoder.ErrToolNotFound)
+	}
+
+	ctx, done, err := a.beginTestEncode()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	report, err := c.Run(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := report.Save(config.ComparisonsDir()); err != nil {
+		return nil, fmt.Errorf("%s: %w", encoder.ErrIO, err)
+	}
+	return &report, nil
+}
+
+// ListComparisons returns the saved comparison reports, newest first. With
+// a profile ID, only those comparing that profile are returned.
+func (a *App) ListComparisons(profileID string) ([]sample.Comparison, error) {
+	return sample.ListComparisons(config.ComparisonsDir(), profileID)
+}
+
+// DeleteComparison removes a saved comparison report.
+func (a *App) DeleteComparison(id string) error {
+	return sample.DeleteComparison(config.ComparisonsDir(), id)
+}
+
+// resolveTester resolves p and returns it with a test encoder for its
+// encoder type.
+func (a *App) resolveTester(p profile.Profile) (profile.Profile, *sample.Tester, error) {
+	p, err := a.profileMgr.Resolve(p)
+	if err != nil {
+		return p, nil, err
+	}
+	adapter, err := a.registry.Resolve(p.EncoderType)
+	if err != nil {
+		return p, nil, err
+	}
+	return p, a.newTester(adapter), nil
+}
+
+// newTester returns a test encoder for the adapter with the configured
+// tools.
+func (a *App) newTester(adapter encoder.Adapter) *sample.Tester {
+	cfg := a.configMgr.Get()
+	return &sample.Tester{
+		Runner:    encoder.NewProcessRunner(cfg.NVEncCPath, adapter, cfg.NoOutputTimeoutSec, cfg.NoProgressTimeoutSec),
+		Adapter:   adapter,
+		Prober:    probe.New(cfg.FFprobePath),
+		Keyframes: probe.NewSplitFinder(cfg.FFprobePath, cfg.FFmpegPath),
+		Quality:   probe.NewQualityMeter(cfg.FFmpegPath),
+	}
+}
+
+// beginTestEncode returns the context of a new test encode, which
+// CancelTestEncode cancels, and the func that ends it. Only one test
+// encode runs at a time.
+func (a *App) beginTestEncode() (context.Context, func(), error) {
+	a.testMu.Lock()
+	defer a.testMu.Unlock()
+	if a.testCancel != nil {
+		return nil, nil, fmt.Errorf("%s: a test encode is already running", encoder.ErrSessionRunning)
+	}
+	ctx, cancel := context.WithCancel(a.ctx)
+	a.testCancel = cancel
+	return ctx, func() {
+		cancel()
+		a.testMu.Lock()
+		a.testCancel = nil
+		a.testMu.Unlock()
+	}, nil
+}
+
+// CancelTestEncode stops the running test encode, if any.
+func (a *App) CancelTestEncode() error {
+	a.testMu.Lock()
+	defer a.testMu.Unlock()
+	if a.testCancel != nil {
+		a.testCancel()
+	}
+	return nil
+}
+
 // --- Temp Cleanup ---
 
 // ListTempArtifacts returns leftover temp files from previous sessions.
@@ -291,17 +704,35 @@ func (a *App) OpenDirectoryDialog() ([]string, error) {
 // --- Command Preview ---
 
 // GetCommandPreview returns the command line preview for the given profile.
+// A target-size profile is planned for the input, which must exist.
 func (a *App) GetCommandPreview(profileJSON string, inputPath string, outputPath string) (string, error) {
 	var p profile.Profile
 	if err := json.Unmarshal([]byte(profileJSON), &p); err != nil {
 		return "", fmt.Errorf("%s: %w", encoder.ErrValidation, err)
 	}
+	p, err := a.profileMgr.Resolve(p)
+	if err != nil {
+		return "", err
+	}
 
 	adapter, err := a.registry.Resolve(p.EncoderType)
 	if err != nil {
 		return "", err
 	}
 
+	// A target size becomes bitrates only for a real input.
+	if p.RateControl == encoder.RateControlTargetSize {
+		media, err := probe.New(a.configMgr.Get().FFprobePath).Probe(a.ctx, inputPath)
+		if err != nil {
+			return "", fmt.Errorf("target size: %w", err)
+		}
+		plan, err := encoder.PlanTargetSize(p, media)
+		if err != nil {
+			return "", err
+		}
+		p = plan.Apply(p)
+	}
+
 	args, err := adapter.BuildArgs(p, inputPath, outputPath)
 	if err != nil {
 		return "", err
@@ -309,3 +740,44 @@ func (a *App) GetCommandPreview(profileJSON string, inputPath string, outputPath
 
 	return strings.Join(args, " "), nil
 }
+
+// ValidateProfile returns the encoder-specific errors and warnings for the
+// given profile, keyed by JSON field name. The error is set when the
+// profile fails generic validation.
+func (a *App) ValidateProfile(profileJSON string) ([]profile.FieldIssue, error) {
+	var p profile.Profile
+	if err := json.Unmarshal([]byte(profileJSON), &p); err != nil {
+		return nil, fmt.Errorf("%s: %w", encoder.ErrValidation, err)
+	}
+	return a.profileMgr.Check(p)
+}
+
+// ExplainProfileRules shows which profile the profile rules pick for a file
+// and why, condition by condition. It evaluates the rules even while they
+// are disabled.
+func (a *App) ExplainProfileRules(inputPath string) (rules.Decision, error) {
+	if strings.TrimSpace(inputPath) == "" {
+		return rules.Decision{}, fmt.Errorf("%s: input path is required", encoder.ErrValidation)
+	}
+	return a.selector.Explain(a.ctx, inputPath), nil
+}
+
+// LintCustomOptions reports custom options that duplicate, override or
+// contradict the GUI settings of the given profile, are unknown, or set
+// input/output paths.
+func (a *App) LintCustomOptions(profileJSON string) ([]encoder.LintWarning, error) {
+	var p profile.Profile
+	if err := json.Unmarshal([]byte(profileJSON), &p); err != nil {
+		return nil, fmt.Errorf("%s: %w", encoder.ErrValidation, err)
+	}
+	p, err := a.profileMgr.Resolve(p)
+	if err != nil {
+		return nil, err
+	}
+
+	adapter, err := a.registry.Resolve(p.EncoderType)
+	if err != nil {
+		return nil, err
+	}
+	return encoder.LintProfile(adapter, p), nil
+}
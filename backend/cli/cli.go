@@ -0,0 +1,154 @@
+// Package cli implements the headless command-line mode of Enque
+// (enque encode / profiles / detect). It drives the same config, profile
+// and queue managers as the GUI, without starting Wails.
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/yuta/enque/backend/config"
+	"github.com/yuta/enque/backend/encoder"
+	"github.com/yuta/enque/backend/encoder/nvencc"
+	"github.com/yuta/enque/backend/profile"
+)
+
+// Exit codes returned by Run.
+const (
+	ExitOK      = 0
+	ExitFailed  = 1 // at least one job failed, timed out or was cancelled
+	ExitUsage   = 2 // bad arguments
+	ExitError   = 3 // setup error (config, profiles, tools)
+	ExitAborted = 130
+)
+
+// Env carries the I/O and dependencies of one invocation. Zero fields get
+// defaults (os.Stdout, os.Stderr, a registry with the NVEncC adapter).
+type Env struct {
+	Stdout   io.Writer
+	Stderr   io.Writer
+	Registry *encoder.Registry
+}
+
+func (e Env) withDefaults() Env {
+	if e.Stdout == nil {
+		e.Stdout = os.Stdout
+	}
+	if e.Stderr == nil {
+		e.Stderr = os.Stderr
+	}
+	if e.Registry == nil {
+		e.Registry = encoder.NewRegistry()
+		e.Registry.Register(&nvencc.NVEncCAdapter{})
+	}
+	return e
+}
+
+// IsCommand reports whether arg names a CLI subcommand, i.e. whether the
+// process should run headless instead of opening the window.
+func IsCommand(arg string) bool {
+	switch arg {
+	case "encode", "profiles", "detect", "help", "-h", "--help", "version", "--version":
+		return true
+	}
+	return false
+}
+
+// Run executes the subcommand in args (without the program name) and
+// returns the process exit code.
+func Run(args []string, env Env) int {
+	env = env.withDefaults()
+	if len(args) == 0 {
+		usage(env.Stderr)
+		return ExitUsage
+	}
+
+	switch args[0] {
+	case "encode":
+		return runEncode(args[1:], env)
+	case "profiles":
+		return runProfiles(args[1:], env)
+	case "detect":
+		return runDetect(args[1:], env)
+	case "version", "--version":
+		fmt.Fprintf(env.Stdout, "Enque %s\n", config.AppVersion)
+		return ExitOK
+	case "help", "-h", "--help":
+		usage(env.Stdout)
+		return ExitOK
+	default:
+		fmt.Fprintf(env.Stderr, "unknown command: %s\n\n", args[0])
+		usage(env.Stderr)
+		return ExitUsage
+	}
+}
+
+func usage(w io.Writer) {
+	fmt.Fprint(w, `Usage:
+  enque encode [--profile NAME|ID] [--out DIR] [--jobs N] [--overwrite MODE] [--duplicates MODE] FILE...
+  enque profiles list
+  enque profiles export [--id ID]... FILE
+  enque profiles import FILE
+  enque detect
+  enque version
+
+Running enque without a command opens the GUI.
+`)
+}
+
+// loadManagers loads config.json and profiles.json from the data directory.
+// Profiles Load had to repair are reported on env.Stderr.
+func loadManagers(env Env) (*config.Manager, *profile.Manager, error) {
+	cfgMgr := config.NewManager(config.ConfigPath())
+	if err := cfgMgr.Load(); err != nil {
+		return nil, nil, fmt.Errorf("load config: %w", err)
+	}
+	profMgr := profile.NewManager(config.ProfilesPath())
+	if err := profMgr.Load(); err != nil {
+		return nil, nil, fmt.Errorf("load profiles: %w", err)
+	}
+	for _, w := range profMgr.LoadWarnings() {
+		fmt.Fprintf(env.Stderr, "warning: %s\n", w)
+	}
+	return cfgMgr, profMgr, nil
+}
+
+// findProfile looks a profile up by ID, then by case-insensitive name.
+// An empty ref selects the configured default profile.
+func findProfile(profMgr *profile.Manager, ref, defaultID string) (profile.Profile, error) {
+	if ref == "" {
+		ref = defaultID
+	}
+	if ref == "" {
+		return profile.Profile{}, fmt.Errorf("no --profile given and no default profile configured")
+	}
+	if p, ok := profMgr.Get(ref); ok {
+		return p, nil
+	}
+	var matches []profile.Profile
+	for _, p := range profMgr.List() {
+		if strings.EqualFold(p.Name, ref) {
+			matches = append(matches, p)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return profile.Profile{}, fmt.Errorf("profile not found: %s", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return profile.Profile{}, fmt.Errorf("profile name %q is ambiguous; use the ID", ref)
+	}
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
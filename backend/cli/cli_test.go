@@ -0,0 +1,239 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yuta/enque/backend/config"
+	"github.com/yuta/enque/backend/profile"
+)
+
+// The test binary doubles as a fake NVEncC: when ENQUE_FAKE_ENCODER is set
+// it prints progress lines, writes the -o file and exits. Inputs whose name
+// contains "fail" exit with code 3.
+func TestMain(m *testing.M) {
+	if os.Getenv("ENQUE_FAKE_ENCODER") == "1" {
+		os.Exit(runFakeEncoder(os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+func runFakeEncoder(args []string) int {
+	var input, output string
+	for i := 0; i < len(args)-1; i++ {
+		switch args[i] {
+		case "-i":
+			input = args[i+1]
+		case "-o":
+			output = args[i+1]
+		}
+	}
+	for _, pct := range []int{25, 50, 100} {
+		fmt.Fprintf(os.Stderr, "[%d.0%%] 100 frames: 120.00 fps, 5000 kbps\n", pct)
+		time.Sleep(20 * time.Millisecond)
+	}
+	if strings.Contains(filepath.Base(input), "fail") {
+		fmt.Fprintln(os.Stderr, "error: simulated failure")
+		return 3
+	}
+	if err := os.WriteFile(output, []byte("encoded"), 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// setupDataDir redirects the app data dir into a temp dir and points
+// nvencc_path at the test binary.
+func setupDataDir(t *testing.T) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("APPDATA", home)
+	t.Setenv("ENQUE_FAKE_ENCODER", "1")
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Default()
+	cfg.NVEncCPath = exe
+	if err := config.NewManager(config.ConfigPath()).Save(cfg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func run(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := Run(args, Env{Stdout: &stdout, Stderr: &stderr})
+	return code, stdout.String(), stderr.String()
+}
+
+func writeInputs(t *testing.T, dir string, names ...string) []string {
+	t.Helper()
+	var paths []string
+	for _, name := range names {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte("input"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+func TestEncode_Success(t *testing.T) {
+	setupDataDir(t)
+	in := t.TempDir()
+	out := filepath.Join(t.TempDir(), "out")
+	inputs := writeInputs(t, in, "a.mp4", "b.mp4")
+
+	code, stdout, stderr := run(append([]string{"encode", "--profile", "hevc quality", "--out", out, "--jobs", "2"}, inputs...)...)
+	if code != ExitOK {
+		t.Fatalf("exit=%d, stdout:\n%s\nstderr:\n%s", code, stdout, stderr)
+	}
+	if !strings.Contains(stdout, "2/2 completed") {
+		t.Errorf("summary missing:\n%s", stdout)
+	}
+	for _, name := range []string{"a_encoded.mp4", "b_encoded.mp4"} {
+		if _, err := os.Stat(filepath.Join(out, name)); err != nil {
+			t.Errorf("output %s: %v", name, err)
+		}
+	}
+}
+
+func TestEncode_FailureSetsExitCode(t *testing.T) {
+	setupDataDir(t)
+	in := t.TempDir()
+	inputs := writeInputs(t, in, "ok.mp4", "fail.mp4")
+
+	code, stdout, _ := run(append([]string{"encode", "--profile", "HEVC Quality"}, inputs...)...)
+	if code != ExitFailed {
+		t.Fatalf("exit=%d, want %d\n%s", code, ExitFailed, stdout)
+	}
+	if !strings.Contains(stdout, "1 failed") || !strings.Contains(stdout, "failed: "+inputs[1]) {
+		t.Errorf("summary should list the failed job:\n%s", stdout)
+	}
+}
+
+func TestEncode_UsageErrors(t *testing.T) {
+	setupDataDir(t)
+	dir := t.TempDir()
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"no_files", []string{"encode", "--profile", "HEVC Quality"}, ExitUsage},
+		{"missing_file", []string{"encode", filepath.Join(dir, "nope.mp4")}, ExitUsage},
+		{"directory", []string{"encode", dir}, ExitUsage},
+		{"bad_jobs", []string{"encode", "--jobs", "9", dir}, ExitUsage},
+		{"unknown_profile", []string{"encode", "--profile", "nope", writeInputs(t, dir, "x.mp4")[0]}, ExitError},
+		{"unknown_command", []string{"frobnicate"}, ExitUsage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _, stderr := run(tt.args...); code != tt.want {
+				t.Errorf("exit=%d, want %d (stderr: %s)", code, tt.want, stderr)
+			}
+		})
+	}
+}
+
+func TestEncode_ProfileRulesWithoutDefault(t *testing.T) {
+	setupDataDir(t)
+	profMgr := profile.NewManager(config.ProfilesPath())
+	if err := profMgr.Load(); err != nil {
+		t.Fatal(err)
+	}
+	var hevcID string
+	for _, p := range profMgr.List() {
+		if p.Name == "HEVC Quality" {
+			hevcID = p.ID
+		}
+	}
+	cfgMgr := config.NewManager(config.ConfigPath())
+	if err := cfgMgr.Load(); err != nil {
+		t.Fatal(err)
+	}
+	cfg := cfgMgr.Get()
+	cfg.ProfileRules.Enabled = true
+	cfg.ProfileRules.Rules = []config.ProfileRule{{Name: "mp4", Enabled: true, ProfileID: hevcID, Extensions: []string{".mp4"}}}
+	if err := cfgMgr.Save(cfg); err != nil {
+		t.Fatal(err)
+	}
+	in := t.TempDir()
+	out := filepath.Join(t.TempDir(), "out")
+
+	// The rules cover every file, so no profile is needed.
+	code, stdout, stderr := run(append([]string{"encode", "--out", out}, writeInputs(t, in, "a.mp4", "b.mp4")...)...)
+	if code != ExitOK {
+		t.Fatalf("exit=%d, stdout:\n%s\nstderr:\n%s", code, stdout, stderr)
+	}
+	if !strings.Contains(stdout, "Encoding 2 file(s) with profiles from the profile rules\n") || !strings.Contains(stdout, "2/2 completed") {
+		t.Errorf("stdout:\n%s", stdout)
+	}
+
+	// A file no rule matches has no profile to fall back on.
+	code, _, stderr = run(append([]string{"encode", "--out", out}, writeInputs(t, in, "c.mp4", "d.mkv")...)...)
+	if code != ExitError || !strings.Contains(stderr, "no profile rule matches "+filepath.Join(in, "d.mkv")) {
+		t.Errorf("exit=%d, stderr: %s", code, stderr)
+	}
+}
+
+func TestProfiles_ExportImportRoundTrip(t *testing.T) {
+	setupDataDir(t)
+	file := filepath.Join(t.TempDir(), "profiles.json")
+
+	if code, _, stderr := run("profiles", "export", "--id", "AV1 Fast", file); code != ExitOK {
+		t.Fatalf("export exit=%d: %s", code, stderr)
+	}
+	var b profile.Bundle
+	data, _ := os.ReadFile(file)
+	if err := json.Unmarshal(data, &b); err != nil || b.Format != profile.BundleFormat || len(b.Profiles) != 1 {
+		t.Fatalf("exported file: err=%v format=%q profiles=%d", err, b.Format, len(b.Profiles))
+	}
+
+	if code, _, stderr := run("profiles", "import", file); code != ExitOK {
+		t.Fatalf("import exit=%d: %s", code, stderr)
+	}
+
+	mgr := profile.NewManager(config.ProfilesPath())
+	if err := mgr.Load(); err != nil {
+		t.Fatal(err)
+	}
+	var copies []profile.Profile
+	for _, p := range mgr.List() {
+		if p.Name == "AV1 Fast" || p.Name == "AV1 Fast (2)" {
+			copies = append(copies, p)
+		}
+	}
+	if len(copies) != 2 {
+		t.Fatalf("got %d AV1 Fast profiles, want preset + imported copy", len(copies))
+	}
+	if copies[0].ID == copies[1].ID {
+		t.Error("imported profile must get a new ID when the original exists")
+	}
+	if copies[1].Name != "AV1 Fast (2)" || copies[1].IsPreset {
+		t.Errorf("imported copy=%q preset=%v, want renamed user profile", copies[1].Name, copies[1].IsPreset)
+	}
+
+	if code, _, _ := run("profiles", "import", "--on-conflict", "skip", file); code != ExitOK {
+		t.Errorf("skip import exit=%d", code)
+	}
+	if code, _, _ := run("profiles", "import", "--on-conflict", "merge", file); code != ExitError {
+		t.Errorf("bad policy exit=%d, want %d", code, ExitError)
+	}
+
+	code, stdout, _ := run("profiles", "list")
+	if code != ExitOK || !strings.Contains(stdout, copies[1].ID) {
+		t.Errorf("list exit=%d, output:\n%s", code, stdout)
+	}
+}
@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/yuta/enque/backend/events"
+)
+
+// ConsoleSink prints queue events as plain text lines. Progress is
+// throttled per job so concurrent workers do not flood the terminal.
+type ConsoleSink struct {
+	mu       sync.Mutex
+	w        io.Writer
+	interval time.Duration
+	inputs   map[string]string    // job ID -> input base name
+	lastLine map[string]time.Time // job ID -> last progress line
+	finished []events.JobFinished
+	done     chan events.SessionSnapshot
+}
+
+// NewConsoleSink creates a sink writing to w, printing at most one progress
+// line per job every interval.
+func NewConsoleSink(w io.Writer, interval time.Duration) *ConsoleSink {
+	return &ConsoleSink{
+		w:        w,
+		interval: interval,
+		inputs:   make(map[string]string),
+		lastLine: make(map[string]time.Time),
+		done:     make(chan events.SessionSnapshot, 1),
+	}
+}
+
+// Done receives the final snapshot when the session finishes.
+func (c *ConsoleSink) Done() <-chan events.SessionSnapshot {
+	return c.done
+}
+
+// Finished returns the job_finished payloads received so far.
+func (c *ConsoleSink) Finished() []events.JobFinished {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]events.JobFinished(nil), c.finished...)
+}
+
+// Emit implements events.EventSink.
+func (c *ConsoleSink) Emit(name string, data interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch d := data.(type) {
+	case events.JobStarted:
+		// Segments of a chunked job are reported through their job.
+		if d.Segment != 0 {
+			return
+		}
+		c.inputs[d.JobID] = filepath.Base(d.InputPath)
+		fmt.Fprintf(c.w, "[start] %s -> %s\n", filepath.Base(d.InputPath), d.FinalOutputPath)
+	case events.JobProgress:
+		if _, ok := c.inputs[d.JobID]; !ok {
+			return
+		}
+		now := time.Now()
+		if now.Sub(c.lastLine[d.JobID]) < c.interval {
+			return
+		}
+		c.lastLine[d.JobID] = now
+		fmt.Fprintf(c.w, "[%s] %s\n", c.inputs[d.JobID], formatProgress(d))
+	case events.JobNeedsOverwrite:
+		fmt.Fprintf(c.w, "[ask] output exists: %s\n", d.FinalOutputPath)
+	case events.JobFinished:
+		if d.Segment != 0 {
+			return
+		}
+		c.finished = append(c.finished, d)
+		delete(c.lastLine, d.JobID)
+		line := fmt.Sprintf("[%s] %s", d.Status, filepath.Base(d.InputPath))
+		if d.Status == "completed" {
+			line += " -> " + d.FinalOutputPath
+		}
+		if d.DurationSec > 0 {
+			line += fmt.Sprintf(" (%s)", formatDuration(d.DurationSec))
+		}
+		if d.ErrorMessage != "" && d.Status != "completed" {
+			line += ": " + d.ErrorMessage
+		}
+		fmt.Fprintln(c.w, line)
+	case events.Message:
+		switch name {
+		case events.NameWarning:
+			fmt.Fprintf(c.w, "warning: %s\n", d.Message)
+		case events.NameError:
+			fmt.Fprintf(c.w, "error: %s\n", d.Message)
+		}
+	case events.SessionSnapshot:
+		if name == events.NameSessionFinished {
+			select {
+			case c.done <- d:
+			default:
+			}
+		}
+	}
+}
+
+func formatProgress(p events.JobProgress) string {
+	s := ""
+	if p.Percent != nil {
+		s += fmt.Sprintf("%5.1f%%", *p.Percent)
+	}
+	if p.FPS != nil {
+		s += fmt.Sprintf("  %.1f fps", *p.FPS)
+	}
+	if p.BitrateKbps != nil {
+		s += fmt.Sprintf("  %.0f kbps", *p.BitrateKbps)
+	}
+	if p.ETASec != nil {
+		s += "  eta " + formatDuration(*p.ETASec)
+	}
+	return s
+}
+
+func formatDuration(sec float64) string {
+	return time.Duration(sec * float64(time.Second)).Round(time.Second).String()
+}
+
+// writeSummary prints per-status counts and the list of unsuccessful jobs.
+func writeSummary(w io.Writer, snap events.SessionSnapshot, finished []events.JobFinished, elapsed time.Duration) {
+	fmt.Fprintf(w, "\nSession %s in %s: %d/%d completed", snap.State, elapsed.Round(time.Second), snap.CompletedJobs, snap.TotalJobs)
+	for _, c := range []struct {
+		n     int
+		label string
+	}{
+		{snap.FailedJobs, "failed"},
+		{snap.TimeoutJobs, "timed out"},
+		{snap.CancelledJobs, "cancelled"},
+		{snap.SkippedJobs, "skipped"},
+	} {
+		if c.n > 0 {
+			fmt.Fprintf(w, ", %d %s", c.n, c.label)
+		}
+	}
+	fmt.Fprintln(w)
+
+	for _, f := range finished {
+		if f.Status == "completed" || f.Status == "skipped" {
+			continue
+		}
+		fmt.Fprintf(w, "  %s: %s", f.Status, f.InputPath)
+		if f.ErrorMessage != "" {
+			fmt.Fprintf(w, " (%s)", f.ErrorMessage)
+		}
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !windows
+
+package cli
+
+// AttachConsole is a no-op outside Windows; the process already has the
+// terminal's stdout and stderr.
+func AttachConsole() {}
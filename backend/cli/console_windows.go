@@ -0,0 +1,38 @@
+//go:build windows
+
+package cli
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	kernel32          = syscall.NewLazyDLL("kernel32.dll")
+	procAttachConsole = kernel32.NewProc("AttachConsole")
+)
+
+const attachParentProcess = ^uintptr(0) // (DWORD)-1
+
+// AttachConsole connects a GUI-subsystem build to the console of the shell
+// that started it, so CLI output is visible. Redirected handles are kept.
+func AttachConsole() {
+	if r, _, _ := procAttachConsole.Call(attachParentProcess); r == 0 {
+		return
+	}
+	if needsConsole(os.Stdout) {
+		if f, err := os.OpenFile("CONOUT$", os.O_WRONLY, 0); err == nil {
+			os.Stdout = f
+		}
+	}
+	if needsConsole(os.Stderr) {
+		if f, err := os.OpenFile("CONOUT$", os.O_WRONLY, 0); err == nil {
+			os.Stderr = f
+		}
+	}
+}
+
+func needsConsole(f *os.File) bool {
+	fd := f.Fd()
+	return fd == 0 || fd == uintptr(syscall.InvalidHandle)
+}
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/yuta/enque/backend/config"
+	"github.com/yuta/enque/backend/detector"
+)
+
+// runDetect prints the external tool detection results. The exit code is
+// non-zero when no usable NVEncC is found.
+func runDetect(args []string, env Env) int {
+	fs := flag.NewFlagSet("detect", flag.ContinueOnError)
+	fs.SetOutput(env.Stderr)
+	asJSON := fs.Bool("json", false, "print the detection result as JSON")
+	gpu := fs.Bool("gpu", false, "also print NVEncC --check-device output")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	cfgMgr := config.NewManager(config.ConfigPath())
+	if err := cfgMgr.Load(); err != nil {
+		fmt.Fprintf(env.Stderr, "warning: %v\n", err)
+	}
+	result := detector.DetectAll(cfgMgr.Get())
+
+	if *asJSON {
+		data, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Fprintln(env.Stdout, string(data))
+	} else {
+		tw := tabwriter.NewWriter(env.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "TOOL\tFOUND\tVERSION\tPATH\tNOTE\t")
+		for _, t := range []detector.ToolInfo{result.NVEncC, result.QSVEncC, result.FFmpeg, result.FFprobe} {
+			found := "no"
+			if t.Found {
+				found = "yes"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t\n", t.Name, found, t.Version, t.Path, t.Error)
+		}
+		tw.Flush()
+	}
+
+	if *gpu && result.NVEncC.Found {
+		info, err := detector.GetGPUInfo(result.NVEncC.Path)
+		if err != nil {
+			fmt.Fprintf(env.Stderr, "error: %v\n", err)
+			return ExitError
+		}
+		fmt.Fprintf(env.Stdout, "\n%s\n", info)
+	}
+
+	if !result.NVEncC.Found || !result.NVEncC.Supported {
+		return ExitError
+	}
+	return ExitOK
+}
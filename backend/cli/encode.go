@@ -0,0 +1,251 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yuta/enque/backend/config"
+	"github.com/yuta/enque/backend/dedupe"
+	"github.com/yuta/enque/backend/detector"
+	"github.com/yuta/enque/backend/events"
+	"github.com/yuta/enque/backend/logging"
+	"github.com/yuta/enque/backend/profile"
+	"github.com/yuta/enque/backend/queue"
+	"github.com/yuta/enque/backend/rules"
+)
+
+// runEncode encodes the given files with one profile, or with the ones
+// the profile rules pick, and waits for the session to finish.
+func runEncode(args []string, env Env) int {
+	fs := flag.NewFlagSet("encode", flag.ContinueOnError)
+	fs.SetOutput(env.Stderr)
+	profileRef := fs.String("profile", "", "profile name or ID (default: profile rules, then the configured default profile)")
+	outDir := fs.String("out", "", "output directory (default: output folder from config.json)")
+	jobs := fs.Int("jobs", 0, "concurrent jobs, 1-8 (default: max_concurrent_jobs from config.json)")
+	overwrite := fs.String("overwrite", "", "overwrite, skip or auto_rename (default: overwrite_mode from config.json, ask becomes auto_rename)")
+	duplicates := fs.String("duplicates", "", "allow, warn or skip inputs already encoded with the profile (default: duplicate_inputs from config.json)")
+	progressEvery := fs.Duration("progress-interval", 5*time.Second, "minimum interval between progress lines per job")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	inputs, err := expandInputs(fs.Args())
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "error: %v\n", err)
+		return ExitUsage
+	}
+	if len(inputs) == 0 {
+		fmt.Fprintln(env.Stderr, "error: no input files")
+		return ExitUsage
+	}
+	if *jobs != 0 && (*jobs < 1 || *jobs > 8) {
+		fmt.Fprintln(env.Stderr, "error: --jobs must be 1..8")
+		return ExitUsage
+	}
+	switch *overwrite {
+	case "", "overwrite", "skip", "auto_rename":
+	default:
+		fmt.Fprintf(env.Stderr, "error: --overwrite must be overwrite, skip or auto_rename\n")
+		return ExitUsage
+	}
+
+	switch *duplicates {
+	case "", "allow", "warn", "skip":
+	default:
+		fmt.Fprintf(env.Stderr, "error: --duplicates must be allow, warn or skip\n")
+		return ExitUsage
+	}
+
+	cfgMgr, profMgr, err := loadManagers(env)
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	cfg := cfgMgr.Get()
+	// Without an explicit profile, enabled profile rules pick one per file.
+	var selector *rules.Selector
+	if *profileRef == "" && cfg.ProfileRules.Enabled {
+		selector = &rules.Selector{Config: cfgMgr, Profiles: profMgr}
+	}
+	var prof profile.Profile
+	var picked []*profile.Profile
+	if selector != nil && cfg.DefaultProfileID == "" {
+		// With nothing to fall back on, the rules must cover every file.
+		if picked, err = selectAll(selector, inputs); err != nil {
+			fmt.Fprintf(env.Stderr, "error: %v\n", err)
+			return ExitError
+		}
+		prof = *picked[0]
+	} else if prof, err = findProfile(profMgr, *profileRef, cfg.DefaultProfileID); err != nil {
+		fmt.Fprintf(env.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+
+	// The GUI fills in tool paths on first start; do the same here.
+	if cfg.NVEncCPath == "" {
+		if tool := detector.DetectNVEncC(""); tool.Found {
+			cfg.NVEncCPath = tool.Path
+		}
+	}
+
+	snapshot := queue.NewAppConfigSnapshot(cfg)
+	if *outDir != "" {
+		abs, err := filepath.Abs(*outDir)
+		if err != nil {
+			fmt.Fprintf(env.Stderr, "error: %v\n", err)
+			return ExitUsage
+		}
+		if err := os.MkdirAll(abs, 0o755); err != nil {
+			fmt.Fprintf(env.Stderr, "error: create output dir: %v\n", err)
+			return ExitError
+		}
+		snapshot.OutputFolderMode = "specified"
+		snapshot.OutputFolderPath = abs
+	}
+	if *jobs != 0 {
+		snapshot.MaxConcurrentJobs = *jobs
+	}
+	if *overwrite != "" {
+		snapshot.OverwriteMode = *overwrite
+	} else if snapshot.OverwriteMode == "ask" {
+		snapshot.OverwriteMode = "auto_rename"
+	}
+	if *duplicates != "" {
+		snapshot.DuplicateInputs = *duplicates
+	}
+	snapshot.Unattended = true
+	// Scripts must never shut the machine down behind the caller's back.
+	snapshot.PostCompleteAction = "none"
+
+	logger, err := logging.NewAppLogger(config.LogsDir())
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "warning: failed to init app logger: %v\n", err)
+	}
+	if logger != nil {
+		defer logger.Close()
+	}
+
+	console := NewConsoleSink(env.Stdout, *progressEvery)
+	emitter := events.NewEmitter(console)
+	mgr := queue.NewManager(env.Registry, emitter, logger)
+	mgr.SetProfileResolver(profMgr)
+	if ledger, err := dedupe.LoadLedger(config.EncodeLedgerPath()); err != nil {
+		fmt.Fprintf(env.Stderr, "warning: %v\n", err)
+	} else {
+		mgr.SetEncodeLedger(ledger)
+	}
+	if selector != nil {
+		mgr.SetProfileSelector(selector)
+	}
+
+	req := queue.EncodeRequest{Profile: prof, AppConfigSnapshot: snapshot}
+	for i, in := range inputs {
+		job := queue.JobInput{InputPath: in}
+		if picked != nil {
+			job.Profile = picked[i]
+		}
+		req.Jobs = append(req.Jobs, job)
+	}
+
+	switch {
+	case picked != nil:
+		fmt.Fprintf(env.Stdout, "Encoding %d file(s) with profiles from the profile rules\n", len(inputs))
+	case selector != nil:
+		fmt.Fprintf(env.Stdout, "Encoding %d file(s) with profiles from the profile rules, else profile %q\n", len(inputs), prof.Name)
+	default:
+		fmt.Fprintf(env.Stdout, "Encoding %d file(s) with profile %q\n", len(inputs), prof.Name)
+	}
+	started := time.Now()
+	if err := mgr.StartEncode(req); err != nil {
+		fmt.Fprintf(env.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	interrupted := false
+	var final events.SessionSnapshot
+wait:
+	for {
+		select {
+		case final = <-console.Done():
+			break wait
+		case <-interrupt:
+			if interrupted {
+				continue
+			}
+			interrupted = true
+			fmt.Fprintln(env.Stderr, "interrupted, aborting running jobs...")
+			mgr.RequestAbort(mgr.GetSessionID())
+		}
+	}
+
+	writeSummary(env.Stdout, final, console.Finished(), time.Since(started))
+
+	switch {
+	case interrupted:
+		return ExitAborted
+	case final.FailedJobs+final.TimeoutJobs+final.CancelledJobs > 0 || final.State == string(queue.StateAborted):
+		return ExitFailed
+	default:
+		return ExitOK
+	}
+}
+
+// selectAll picks each input's profile with the profile rules. It fails
+// for an input no rule covers, as there is no profile to fall back on.
+func selectAll(selector *rules.Selector, inputs []string) ([]*profile.Profile, error) {
+	picked := make([]*profile.Profile, len(inputs))
+	for i, in := range inputs {
+		p, _, err := selector.SelectProfile(in)
+		if err != nil {
+			return nil, fmt.Errorf("profile rules: %s: %v", in, err)
+		}
+		if p == nil {
+			return nil, fmt.Errorf("no --profile given, no default profile configured, and no profile rule matches %s", in)
+		}
+		picked[i] = p
+	}
+	return picked, nil
+}
+
+// expandInputs resolves glob patterns (cmd.exe does not expand them) and
+// makes paths absolute. Directories are rejected.
+func expandInputs(args []string) ([]string, error) {
+	var out []string
+	for _, arg := range args {
+		paths := []string{arg}
+		if strings.ContainsAny(arg, "*?[") {
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return nil, fmt.Errorf("bad pattern %q: %w", arg, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match %q", arg)
+			}
+			paths = matches
+		}
+		for _, p := range paths {
+			info, err := os.Stat(p)
+			if err != nil {
+				return nil, err
+			}
+			if info.IsDir() {
+				return nil, fmt.Errorf("%s is a directory", p)
+			}
+			abs, err := filepath.Abs(p)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, abs)
+		}
+	}
+	return out, nil
+}
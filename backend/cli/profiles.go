@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/yuta/enque/backend/profile"
+)
+
+func runProfiles(args []string, env Env) int {
+	if len(args) == 0 {
+		fmt.Fprintln(env.Stderr, "usage: enque profiles list|export|import")
+		return ExitUsage
+	}
+	switch args[0] {
+	case "list":
+		return runProfilesList(env)
+	case "export":
+		return runProfilesExport(args[1:], env)
+	case "import":
+		return runProfilesImport(args[1:], env)
+	default:
+		fmt.Fprintf(env.Stderr, "unknown profiles command: %s\n", args[0])
+		return ExitUsage
+	}
+}
+
+func runProfilesList(env Env) int {
+	cfgMgr, profMgr, err := loadManagers(env)
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	defaultID := cfgMgr.Get().DefaultProfileID
+
+	tw := tabwriter.NewWriter(env.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tENCODER\tCODEC\tRATE\t")
+	for _, p := range profMgr.List() {
+		name := p.Name
+		if p.ID == defaultID {
+			name += " (default)"
+		}
+		if p.IsPreset {
+			name += " [preset]"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s %g\t\n", p.ID, name, p.EncoderType, p.Codec, p.RateControl, p.RateValue)
+	}
+	tw.Flush()
+	return ExitOK
+}
+
+func runProfilesExport(args []string, env Env) int {
+	fs := flag.NewFlagSet("profiles export", flag.ContinueOnError)
+	fs.SetOutput(env.Stderr)
+	var ids stringList
+	fs.Var(&ids, "id", "profile ID or name to export (repeatable; default: all)")
+	strip := fs.Bool("strip-machine", false, "reset machine-specific settings such as the GPU device")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(env.Stderr, "usage: enque profiles export [--id ID]... [--strip-machine] FILE")
+		return ExitUsage
+	}
+
+	_, profMgr, err := loadManagers(env)
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+
+	var selected []string
+	for _, ref := range ids {
+		p, err := findProfile(profMgr, ref, "")
+		if err != nil {
+			fmt.Fprintf(env.Stderr, "error: %v\n", err)
+			return ExitError
+		}
+		selected = append(selected, p.ID)
+	}
+	count := len(selected)
+	if count == 0 {
+		count = len(profMgr.List())
+	}
+
+	if err := profMgr.ExportProfiles(selected, fs.Arg(0), profile.ExportOptions{StripMachineFields: *strip}); err != nil {
+		fmt.Fprintf(env.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	fmt.Fprintf(env.Stdout, "Exported %d profile(s) to %s\n", count, fs.Arg(0))
+	return ExitOK
+}
+
+// runProfilesImport adds the profiles in FILE as user profiles. Entries
+// that fail validation are reported; the exit code is ExitFailed then.
+func runProfilesImport(args []string, env Env) int {
+	fs := flag.NewFlagSet("profiles import", flag.ContinueOnError)
+	fs.SetOutput(env.Stderr)
+	onConflict := fs.String("on-conflict", "rename", "rename, replace or skip profiles whose ID or name exists")
+	strip := fs.Bool("strip-machine", false, "reset machine-specific settings such as the GPU device")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(env.Stderr, "usage: enque profiles import [--on-conflict rename|replace|skip] [--strip-machine] FILE")
+		return ExitUsage
+	}
+
+	_, profMgr, err := loadManagers(env)
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	profMgr.SetChecker(env.Registry)
+
+	res, err := profMgr.ImportProfiles(fs.Arg(0), profile.ImportOptions{
+		OnConflict:         profile.ConflictPolicy(*onConflict),
+		StripMachineFields: *strip,
+	})
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+
+	for _, p := range res.Profiles {
+		switch p.Action {
+		case "invalid", "skipped":
+			fmt.Fprintf(env.Stderr, "%s %q: %s\n", p.Action, p.SourceName, p.Reason)
+		case "renamed":
+			fmt.Fprintf(env.Stdout, "renamed %q -> %q (%s)\n", p.SourceName, p.Name, p.ID)
+		default:
+			fmt.Fprintf(env.Stdout, "%s %q (%s)\n", p.Action, p.Name, p.ID)
+		}
+	}
+	imported := res.Count("created") + res.Count("renamed") + res.Count("replaced")
+	fmt.Fprintf(env.Stdout, "Imported %d profile(s)\n", imported)
+	if res.Count("invalid") > 0 {
+		return ExitFailed
+	}
+	return ExitOK
+}
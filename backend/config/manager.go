@@ -3,10 +3,13 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"text/template"
 )
 
 // Manager handles AppConfig persistence.
@@ -124,5 +127,141 @@ func Validate(cfg AppConfig) error {
 	if cfg.PostCompleteAction == "custom" && strings.TrimSpace(cfg.PostCompleteCommand) == "" {
 		return fmt.Errorf("E_VALIDATION: post_complete_command required when action is 'custom'")
 	}
+	if cfg.RemoteAPIEnabled {
+		if _, _, err := net.SplitHostPort(cfg.RemoteAPIAddr); err != nil {
+			return fmt.Errorf("E_VALIDATION: remote_api_addr must be host:port")
+		}
+		if len(cfg.RemoteAPIToken) < 16 {
+			return fmt.Errorf("E_VALIDATION: remote_api_token must be at least 16 characters")
+		}
+	}
+	if cfg.MetricsEnabled {
+		if _, _, err := net.SplitHostPort(cfg.MetricsAddr); err != nil {
+			return fmt.Errorf("E_VALIDATION: metrics_addr must be host:port")
+		}
+	}
+	for i, wh := range cfg.Webhooks {
+		if err := validateWebhook(wh); err != nil {
+			return fmt.Errorf("E_VALIDATION: webhooks[%d]: %w", i, err)
+		}
+	}
+	for i, wf := range cfg.WatchFolders {
+		if err := validateWatchFolder(wf); err != nil {
+			return fmt.Errorf("E_VALIDATION: watch_folders[%d]: %w", i, err)
+		}
+	}
+	for i, r := range cfg.ProfileRules.Rules {
+		if err := validateProfileRule(r); err != nil {
+			return fmt.Errorf("E_VALIDATION: profile_rules.rules[%d]: %w", i, err)
+		}
+	}
+	switch cfg.DuplicateInputs {
+	case "allow", "warn", "skip":
+	default:
+		return fmt.Errorf("E_VALIDATION: duplicate_inputs must be allow, warn or skip")
+	}
+	return nil
+}
+
+func validateProfileRule(r ProfileRule) error {
+	if strings.TrimSpace(r.ProfileID) == "" {
+		return fmt.Errorf("profile_id is required")
+	}
+	for _, glob := range r.PathGlobs {
+		for _, seg := range strings.Split(strings.ReplaceAll(glob, "\\", "/"), "/") {
+			if _, err := filepath.Match(seg, ""); err != nil {
+				return fmt.Errorf("invalid path glob %q", glob)
+			}
+		}
+	}
+	if r.MinSizeMB < 0 || r.MaxSizeMB < 0 || r.MinFPS < 0 || r.MaxFPS < 0 ||
+		r.MinWidth < 0 || r.MaxWidth < 0 || r.MinHeight < 0 || r.MaxHeight < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	for _, lim := range []struct {
+		name     string
+		min, max float64
+	}{
+		{"size_mb", r.MinSizeMB, r.MaxSizeMB},
+		{"width", float64(r.MinWidth), float64(r.MaxWidth)},
+		{"height", float64(r.MinHeight), float64(r.MaxHeight)},
+		{"fps", r.MinFPS, r.MaxFPS},
+	} {
+		if lim.max > 0 && lim.min > lim.max {
+			return fmt.Errorf("min_%s exceeds max_%s", lim.name, lim.name)
+		}
+	}
+	for _, d := range r.BitDepths {
+		if d != 8 && d != 10 && d != 12 {
+			return fmt.Errorf("bit_depths must be 8, 10 or 12")
+		}
+	}
+	return nil
+}
+
+func validateWatchFolder(wf WatchFolderConfig) error {
+	if strings.TrimSpace(wf.Path) == "" {
+		return fmt.Errorf("path is required")
+	}
+	for _, pat := range append(append([]string{}, wf.Patterns...), wf.ExcludePatterns...) {
+		if _, err := filepath.Match(pat, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q", pat)
+		}
+	}
+	switch wf.OutputFolderMode {
+	case "", "same_as_input":
+	case "specified":
+		if strings.TrimSpace(wf.OutputFolderPath) == "" {
+			return fmt.Errorf("output_folder_path required when mode is 'specified'")
+		}
+	default:
+		return fmt.Errorf("invalid output_folder_mode %q", wf.OutputFolderMode)
+	}
+	if len(wf.OutputNameTemplate) > 255 {
+		return fmt.Errorf("output_name_template must be at most 255 characters")
+	}
+	if wf.StableSec < 1 || wf.StableSec > 3600 {
+		return fmt.Errorf("stable_sec must be 1..3600")
+	}
+	return nil
+}
+
+func validateWebhook(wh WebhookConfig) error {
+	u, err := url.Parse(wh.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an http(s) URL")
+	}
+	if len(wh.Events) == 0 {
+		return fmt.Errorf("events must not be empty")
+	}
+	for _, ev := range wh.Events {
+		if ev != "job_finished" && ev != "session_finished" {
+			return fmt.Errorf("unknown event %q", ev)
+		}
+	}
+	switch wh.Format {
+	case "", "generic", "discord", "slack":
+	default:
+		return fmt.Errorf("format must be generic, discord or slack")
+	}
+	if wh.MaxRetries < 0 || wh.MaxRetries > 10 {
+		return fmt.Errorf("max_retries must be 0..10")
+	}
+	if wh.Template != "" {
+		if _, err := ParseWebhookTemplate(wh.Template); err != nil {
+			return fmt.Errorf("template: %w", err)
+		}
+	}
 	return nil
 }
+
+// ParseWebhookTemplate parses a custom webhook body template with the
+// functions it may use: json quotes a value as JSON.
+func ParseWebhookTemplate(text string) (*template.Template, error) {
+	return template.New("webhook").Funcs(template.FuncMap{"json": toJSON}).Parse(text)
+}
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
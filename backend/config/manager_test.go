@@ -74,6 +74,74 @@ func TestSave_Validation(t *testing.T) {
 			c.PostCompleteAction = "custom"
 			c.PostCompleteCommand = ""
 		}, true},
+		{"remote_short_token", func(c *AppConfig) {
+			c.RemoteAPIEnabled = true
+			c.RemoteAPIToken = "short"
+		}, true},
+		{"remote_bad_addr", func(c *AppConfig) {
+			c.RemoteAPIEnabled = true
+			c.RemoteAPIAddr = "localhost"
+			c.RemoteAPIToken = "0123456789abcdef"
+		}, true},
+		{"webhook_bad_url", func(c *AppConfig) {
+			c.Webhooks = []WebhookConfig{{URL: "ftp://example.com", Events: []string{"job_finished"}}}
+		}, true},
+		{"webhook_unknown_event", func(c *AppConfig) {
+			c.Webhooks = []WebhookConfig{{URL: "https://example.com/hook", Events: []string{"job_started"}}}
+		}, true},
+		{"webhook_bad_template", func(c *AppConfig) {
+			c.Webhooks = []WebhookConfig{{URL: "https://example.com/hook", Events: []string{"job_finished"}, Template: "{{.Event"}}
+		}, true},
+		{"webhook_json_template", func(c *AppConfig) {
+			c.Webhooks = []WebhookConfig{{URL: "https://example.com/hook", Events: []string{"job_finished"}, Template: `{"text":{{json .Summary}}}`}}
+		}, false},
+		{"webhook_unknown_func", func(c *AppConfig) {
+			c.Webhooks = []WebhookConfig{{URL: "https://example.com/hook", Events: []string{"job_finished"}, Template: `{{yaml .Summary}}`}}
+		}, true},
+		{"webhook_valid", func(c *AppConfig) {
+			c.Webhooks = []WebhookConfig{{URL: "https://example.com/hook", Events: []string{"session_finished"}, Format: "slack", MaxRetries: 3}}
+		}, false},
+		{"metrics_bad_addr", func(c *AppConfig) {
+			c.MetricsEnabled = true
+			c.MetricsAddr = "9464"
+		}, true},
+		{"metrics_valid", func(c *AppConfig) { c.MetricsEnabled = true }, false},
+		{"watch_no_path", func(c *AppConfig) {
+			c.WatchFolders = []WatchFolderConfig{{StableSec: 30}}
+		}, true},
+		{"watch_bad_pattern", func(c *AppConfig) {
+			c.WatchFolders = []WatchFolderConfig{{Path: "C:/inbox", Patterns: []string{"[*.mp4"}, StableSec: 30}}
+		}, true},
+		{"watch_stable_zero", func(c *AppConfig) {
+			c.WatchFolders = []WatchFolderConfig{{Path: "C:/inbox"}}
+		}, true},
+		{"watch_specified_no_path", func(c *AppConfig) {
+			c.WatchFolders = []WatchFolderConfig{{Path: "C:/inbox", OutputFolderMode: "specified", StableSec: 30}}
+		}, true},
+		{"watch_valid", func(c *AppConfig) {
+			c.WatchFolders = []WatchFolderConfig{{Path: "C:/inbox", Patterns: []string{"*.mp4"}, StableSec: 30}}
+		}, false},
+		{"rule_no_profile", func(c *AppConfig) {
+			c.ProfileRules.Rules = []ProfileRule{{Name: "4K"}}
+		}, true},
+		{"rule_bad_glob", func(c *AppConfig) {
+			c.ProfileRules.Rules = []ProfileRule{{ProfileID: "p", PathGlobs: []string{"**/[anime/*.ts"}}}
+		}, true},
+		{"rule_min_over_max", func(c *AppConfig) {
+			c.ProfileRules.Rules = []ProfileRule{{ProfileID: "p", MinHeight: 2160, MaxHeight: 1080}}
+		}, true},
+		{"rule_bad_depth", func(c *AppConfig) {
+			c.ProfileRules.Rules = []ProfileRule{{ProfileID: "p", BitDepths: []int{9}}}
+		}, true},
+		{"rule_valid", func(c *AppConfig) {
+			c.ProfileRules.Rules = []ProfileRule{{ProfileID: "p", PathGlobs: []string{"D:\\rec\\**\\*.ts"}, MinHeight: 2160, BitDepths: []int{10}}}
+		}, false},
+		{"duplicate_inputs_bad", func(c *AppConfig) { c.DuplicateInputs = "ask" }, true},
+		{"duplicate_inputs_skip", func(c *AppConfig) { c.DuplicateInputs = "skip" }, false},
+		{"remote_valid", func(c *AppConfig) {
+			c.RemoteAPIEnabled = true
+			c.RemoteAPIToken = "0123456789abcdef"
+		}, false},
 	}
 
 	for _, tt := range tests {
@@ -123,3 +191,28 @@ func TestAtomicWrite(t *testing.T) {
 		t.Errorf("version=%d, want %d", cfg.Version, CurrentVersion)
 	}
 }
+
+func TestMigration_V1toV2(t *testing.T) {
+	cfg := Default()
+	cfg.Version = 1
+	cfg.RemoteAPIAddr = ""
+	result, err := Migrate(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Version != CurrentVersion {
+		t.Errorf("version=%d, want %d", result.Version, CurrentVersion)
+	}
+	if result.RemoteAPIEnabled {
+		t.Error("remote API must stay disabled after migration")
+	}
+	if result.RemoteAPIAddr != Default().RemoteAPIAddr {
+		t.Errorf("remote_api_addr=%q, want %q", result.RemoteAPIAddr, Default().RemoteAPIAddr)
+	}
+	if result.MetricsEnabled || result.MetricsAddr != Default().MetricsAddr {
+		t.Errorf("metrics: enabled=%v addr=%q, want disabled at %q", result.MetricsEnabled, result.MetricsAddr, Default().MetricsAddr)
+	}
+	if result.DuplicateInputs != "warn" {
+		t.Errorf("duplicate_inputs=%q, want warn", result.DuplicateInputs)
+	}
+}
@@ -8,6 +8,18 @@ func Migrate(cfg AppConfig) (AppConfig, error) {
 		switch cfg.Version {
 		case 0:
 			cfg = migrateV0toV1(cfg)
+		case 1:
+			cfg = migrateV1toV2(cfg)
+		case 2:
+			cfg = migrateV2toV3(cfg)
+		case 3:
+			cfg = migrateV3toV4(cfg)
+		case 4:
+			cfg = migrateV4toV5(cfg)
+		case 5:
+			cfg = migrateV5toV6(cfg)
+		case 6:
+			cfg = migrateV6toV7(cfg)
 		default:
 			return cfg, fmt.Errorf("unknown config version %d", cfg.Version)
 		}
@@ -50,3 +62,57 @@ func migrateV0toV1(cfg AppConfig) AppConfig {
 	cfg.Version = 1
 	return cfg
 }
+
+// migrateV1toV2: add remote API settings (disabled by default).
+func migrateV1toV2(cfg AppConfig) AppConfig {
+	if cfg.RemoteAPIAddr == "" {
+		cfg.RemoteAPIAddr = Default().RemoteAPIAddr
+	}
+	cfg.Version = 2
+	return cfg
+}
+
+// migrateV2toV3: add webhooks (none configured).
+func migrateV2toV3(cfg AppConfig) AppConfig {
+	if cfg.Webhooks == nil {
+		cfg.Webhooks = []WebhookConfig{}
+	}
+	cfg.Version = 3
+	return cfg
+}
+
+// migrateV3toV4: add metrics endpoint settings (disabled by default).
+func migrateV3toV4(cfg AppConfig) AppConfig {
+	if cfg.MetricsAddr == "" {
+		cfg.MetricsAddr = Default().MetricsAddr
+	}
+	cfg.Version = 4
+	return cfg
+}
+
+// migrateV4toV5: add watch folders (none configured).
+func migrateV4toV5(cfg AppConfig) AppConfig {
+	if cfg.WatchFolders == nil {
+		cfg.WatchFolders = []WatchFolderConfig{}
+	}
+	cfg.Version = 5
+	return cfg
+}
+
+// migrateV5toV6: add profile rules (disabled, none configured).
+func migrateV5toV6(cfg AppConfig) AppConfig {
+	if cfg.ProfileRules.Rules == nil {
+		cfg.ProfileRules.Rules = []ProfileRule{}
+	}
+	cfg.Version = 6
+	return cfg
+}
+
+// migrateV6toV7: add already-encoded input detection (warn by default).
+func migrateV6toV7(cfg AppConfig) AppConfig {
+	if cfg.DuplicateInputs == "" {
+		cfg.DuplicateInputs = Default().DuplicateInputs
+	}
+	cfg.Version = 7
+	return cfg
+}
@@ -22,10 +22,92 @@ type AppConfig struct {
 	OverwriteMode        string `json:"overwrite_mode"`
 	Language             string `json:"language"`
 	DefaultProfileID     string `json:"default_profile_id"`
+
+	// Remote API (optional embedded HTTP server)
+	RemoteAPIEnabled bool   `json:"remote_api_enabled"`
+	RemoteAPIAddr    string `json:"remote_api_addr"`
+	RemoteAPIToken   string `json:"remote_api_token"`
+
+	// Webhook notifications
+	Webhooks []WebhookConfig `json:"webhooks"`
+
+	// Prometheus metrics endpoint (optional)
+	MetricsEnabled bool   `json:"metrics_enabled"`
+	MetricsAddr    string `json:"metrics_addr"`
+
+	// Watch folders that auto-enqueue new files
+	WatchFolders []WatchFolderConfig `json:"watch_folders"`
+
+	// Automatic profile selection for added files
+	ProfileRules ProfileRulesConfig `json:"profile_rules"`
+
+	// What to do with added files that were already encoded with the same
+	// profile, or are Enque outputs themselves: "allow", "warn" or "skip"
+	DuplicateInputs string `json:"duplicate_inputs"`
+}
+
+// WebhookConfig describes one webhook target.
+type WebhookConfig struct {
+	Name         string   `json:"name"`
+	Enabled      bool     `json:"enabled"`
+	URL          string   `json:"url"`
+	Events       []string `json:"events"`        // "job_finished", "session_finished"
+	FailuresOnly bool     `json:"failures_only"` // job_finished: failed/timeout only; session_finished: with failures or aborted
+	Format       string   `json:"format"`        // "generic", "discord", "slack"
+	Template     string   `json:"template"`      // optional text/template producing the JSON body
+	MaxRetries   int      `json:"max_retries"`
+}
+
+// WatchFolderConfig describes one watched inbox folder. Empty output fields
+// fall back to the app-level output settings; an empty ProfileID uses the
+// profile rules when enabled, else the default profile.
+type WatchFolderConfig struct {
+	Name               string   `json:"name"`
+	Enabled            bool     `json:"enabled"`
+	Path               string   `json:"path"`
+	Recursive          bool     `json:"recursive"`
+	Patterns           []string `json:"patterns"`         // e.g. "*.mp4"; empty matches all files
+	ExcludePatterns    []string `json:"exclude_patterns"` // e.g. "*_encoded.*"
+	ProfileID          string   `json:"profile_id"`
+	OutputFolderMode   string   `json:"output_folder_mode"`
+	OutputFolderPath   string   `json:"output_folder_path"`
+	OutputNameTemplate string   `json:"output_name_template"`
+	StableSec          int      `json:"stable_sec"` // size unchanged this long before enqueueing
+}
+
+// ProfileRulesConfig selects a profile for each added file. Rules are
+// evaluated in order and the first match wins; DefaultProfileID applies when
+// none matches. With no default the file keeps the session profile.
+type ProfileRulesConfig struct {
+	Enabled          bool          `json:"enabled"`
+	DefaultProfileID string        `json:"default_profile_id"`
+	Rules            []ProfileRule `json:"rules"`
+}
+
+// ProfileRule maps files to a profile. Every set condition must hold; zero
+// values and empty lists are not checked. Resolution, codec, HDR, frame rate
+// and bit depth conditions need ffprobe.
+type ProfileRule struct {
+	Name       string   `json:"name"`
+	Enabled    bool     `json:"enabled"`
+	ProfileID  string   `json:"profile_id"`
+	Extensions []string `json:"extensions"` // e.g. ".ts"; case-insensitive
+	PathGlobs  []string `json:"path_globs"` // matched against the full path; "**" spans folders
+	MinSizeMB  float64  `json:"min_size_mb"`
+	MaxSizeMB  float64  `json:"max_size_mb"`
+	MinWidth   int      `json:"min_width"`
+	MaxWidth   int      `json:"max_width"`
+	MinHeight  int      `json:"min_height"`
+	MaxHeight  int      `json:"max_height"`
+	Codecs     []string `json:"codecs"` // ffprobe codec names, e.g. "mpeg2video", "h264"
+	HDR        *bool    `json:"hdr"`
+	MinFPS     float64  `json:"min_fps"`
+	MaxFPS     float64  `json:"max_fps"`
+	BitDepths  []int    `json:"bit_depths"`
 }
 
 // CurrentVersion is the latest config schema version.
-const CurrentVersion = 1
+const CurrentVersion = 7
 
 // Default returns the default AppConfig.
 func Default() AppConfig {
@@ -43,5 +125,11 @@ func Default() AppConfig {
 		OutputContainer:      "mkv",
 		OverwriteMode:        "ask",
 		Language:             "ja",
+		RemoteAPIAddr:        "127.0.0.1:7878",
+		Webhooks:             []WebhookConfig{},
+		MetricsAddr:          "127.0.0.1:9464",
+		WatchFolders:         []WatchFolderConfig{},
+		ProfileRules:         ProfileRulesConfig{Rules: []ProfileRule{}},
+		DuplicateInputs:      "warn",
 	}
 }
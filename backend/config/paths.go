@@ -48,3 +48,18 @@ func RuntimeDir() string {
 func TempIndexPath() string {
 	return filepath.Join(RuntimeDir(), "temp_index.json")
 }
+
+// WatchLedgerPath returns the path to watch_ledger.json.
+func WatchLedgerPath() string {
+	return filepath.Join(RuntimeDir(), "watch_ledger.json")
+}
+
+// EncodeLedgerPath returns the path to encode_ledger.json.
+func EncodeLedgerPath() string {
+	return filepath.Join(RuntimeDir(), "encode_ledger.json")
+}
+
+// ComparisonsDir returns the path to the profile comparison reports.
+func ComparisonsDir() string {
+	return filepath.Join(DataDir(), "comparisons")
+}
@@ -0,0 +1,43 @@
+// Package dedupe remembers the inputs Enque encoded and the outputs it
+// wrote, by content, so inputs added again can be flagged.
+package dedupe
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+)
+
+// sampleSize is the size of each block Fingerprint hashes.
+const sampleSize = 1 << 20
+
+// Fingerprint identifies a file by its content without reading all of it:
+// its size and a SHA-256 of 1 MiB at its start, middle and end, or of the
+// whole file when it is smaller than those three blocks.
+func Fingerprint(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("fingerprint: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("fingerprint: %w", err)
+	}
+
+	size := info.Size()
+	h := sha256.New()
+	if size <= 3*sampleSize {
+		if _, err := io.Copy(h, f); err != nil {
+			return "", fmt.Errorf("fingerprint %s: %w", path, err)
+		}
+	} else {
+		for _, off := range []int64{0, (size - sampleSize) / 2, size - sampleSize} {
+			if _, err := io.Copy(h, io.NewSectionReader(f, off, sampleSize)); err != nil {
+				return "", fmt.Errorf("fingerprint %s: %w", path, err)
+			}
+		}
+	}
+	return fmt.Sprintf("%d-%x", size, h.Sum(nil)[:16]), nil
+}
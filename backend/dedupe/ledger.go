@@ -0,0 +1,191 @@
+package dedupe
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yuta/enque/backend/queue"
+)
+
+// maxEntries bounds the ledger file; the oldest entries are dropped.
+const maxEntries = 50000
+
+// Entry kinds.
+const (
+	KindInput  = "input"  // an encoded input, per profile and variant
+	KindOutput = "output" // a file Enque wrote
+)
+
+// Entry records one side of a completed encode.
+type Entry struct {
+	Kind        string    `json:"kind"`
+	Fingerprint string    `json:"fingerprint"`
+	ProfileID   string    `json:"profile_id,omitempty"`
+	Variant     string    `json:"variant,omitempty"`
+	InputPath   string    `json:"input_path"`
+	OutputPath  string    `json:"output_path"`
+	SessionID   string    `json:"session_id,omitempty"`
+	JobID       string    `json:"job_id,omitempty"`
+	EncodedAt   time.Time `json:"encoded_at"`
+}
+
+type ledgerFile struct {
+	Version int     `json:"version"`
+	Entries []Entry `json:"entries"`
+}
+
+// Ledger remembers completed encodes across restarts
+// (runtime/encode_ledger.json). It implements queue.EncodeLedger.
+type Ledger struct {
+	mu       sync.Mutex
+	filePath string
+	entries  map[string]Entry
+}
+
+// LoadLedger reads the ledger at filePath. A missing file yields an empty
+// ledger; a corrupt file is moved aside.
+func LoadLedger(filePath string) (*Ledger, error) {
+	l := &Ledger{filePath: filePath, entries: make(map[string]Entry)}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return l, nil
+		}
+		return nil, fmt.Errorf("read encode ledger: %w", err)
+	}
+
+	var lf ledgerFile
+	if err := json.Unmarshal(data, &lf); err != nil {
+		os.Rename(filePath, filePath+fmt.Sprintf(".broken.%d", time.Now().Unix()))
+		return l, nil
+	}
+	for _, e := range lf.Entries {
+		l.entries[entryKey(e)] = e
+	}
+	return l, nil
+}
+
+// Lookup implements queue.EncodeLedger. An empty profileID only looks for
+// outputs: unsaved profiles cannot be told apart.
+func (l *Ledger) Lookup(path, profileID, variant string) (*queue.EncodeRecord, bool, error) {
+	fp, err := Fingerprint(path)
+	if err != nil {
+		return nil, false, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.entries[entryKey(Entry{Kind: KindOutput, Fingerprint: fp})]; ok {
+		return e.record(), true, nil
+	}
+	if profileID == "" {
+		return nil, false, nil
+	}
+	if e, ok := l.entries[entryKey(Entry{Kind: KindInput, Fingerprint: fp, ProfileID: profileID, Variant: variant})]; ok {
+		return e.record(), false, nil
+	}
+	return nil, false, nil
+}
+
+// Record implements queue.EncodeLedger. It stores the input with its
+// profile and variant, and the output, and persists the ledger. An input
+// that can no longer be read is left out.
+func (l *Ledger) Record(rec queue.EncodeRecord) error {
+	if rec.EncodedAt.IsZero() {
+		rec.EncodedAt = time.Now()
+	}
+	e := Entry{
+		InputPath:  rec.InputPath,
+		OutputPath: rec.OutputPath,
+		SessionID:  rec.SessionID,
+		JobID:      rec.JobID,
+		EncodedAt:  rec.EncodedAt,
+	}
+	var entries []Entry
+	if fp, err := Fingerprint(rec.InputPath); err == nil && rec.ProfileID != "" {
+		in := e
+		in.Kind, in.Fingerprint, in.ProfileID, in.Variant = KindInput, fp, rec.ProfileID, rec.Variant
+		entries = append(entries, in)
+	}
+	fp, err := Fingerprint(rec.OutputPath)
+	if err != nil {
+		return err
+	}
+	out := e
+	out.Kind, out.Fingerprint = KindOutput, fp
+	entries = append(entries, out)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, e := range entries {
+		l.entries[entryKey(e)] = e
+	}
+	return l.saveLocked()
+}
+
+// Len returns the number of entries.
+func (l *Ledger) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries)
+}
+
+// saveLocked writes the ledger atomically. Caller must hold mu.
+func (l *Ledger) saveLocked() error {
+	lf := ledgerFile{Version: 1, Entries: make([]Entry, 0, len(l.entries))}
+	for _, e := range l.entries {
+		lf.Entries = append(lf.Entries, e)
+	}
+	sort.Slice(lf.Entries, func(i, j int) bool {
+		return lf.Entries[i].EncodedAt.After(lf.Entries[j].EncodedAt)
+	})
+	if len(lf.Entries) > maxEntries {
+		for _, e := range lf.Entries[maxEntries:] {
+			delete(l.entries, entryKey(e))
+		}
+		lf.Entries = lf.Entries[:maxEntries]
+	}
+
+	data, err := json.MarshalIndent(lf, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal encode ledger: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(l.filePath), 0o755); err != nil {
+		return fmt.Errorf("create dir: %w", err)
+	}
+	tmpPath := l.filePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return fmt.Errorf("write encode ledger: %w", err)
+	}
+	if err := os.Rename(tmpPath, l.filePath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("rename encode ledger: %w", err)
+	}
+	return nil
+}
+
+func (e Entry) record() *queue.EncodeRecord {
+	return &queue.EncodeRecord{
+		InputPath:  e.InputPath,
+		OutputPath: e.OutputPath,
+		ProfileID:  e.ProfileID,
+		Variant:    e.Variant,
+		SessionID:  e.SessionID,
+		JobID:      e.JobID,
+		EncodedAt:  e.EncodedAt,
+	}
+}
+
+// entryKey keys inputs by content, profile and variant, outputs by
+// content only.
+func entryKey(e Entry) string {
+	if e.Kind == KindOutput {
+		return e.Kind + "|" + e.Fingerprint
+	}
+	return e.Kind + "|" + e.Fingerprint + "|" + e.ProfileID + "|" + e.Variant
+}
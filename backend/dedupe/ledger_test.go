@@ -0,0 +1,135 @@
+package dedupe
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yuta/enque/backend/queue"
+)
+
+func writeFile(t *testing.T, path string, data []byte) string {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	big := make([]byte, 4*sampleSize)
+	for i := range big {
+		big[i] = byte(i % 251)
+	}
+	a := writeFile(t, filepath.Join(dir, "a.mkv"), big)
+	renamed := writeFile(t, filepath.Join(dir, "copy of a.mkv"), big)
+
+	// A change between the sampled blocks goes unnoticed; one inside the
+	// middle block does not.
+	big[sampleSize+10] ^= 0xff
+	unsampled := writeFile(t, filepath.Join(dir, "unsampled.mkv"), big)
+	big[2*sampleSize] ^= 0xff
+	changed := writeFile(t, filepath.Join(dir, "changed.mkv"), big)
+
+	fp := func(path string) string {
+		t.Helper()
+		s, err := Fingerprint(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	if fp(a) != fp(renamed) || fp(a) != fp(unsampled) {
+		t.Error("same sampled content, different fingerprints")
+	}
+	if fp(a) == fp(changed) {
+		t.Error("changed middle block, same fingerprint")
+	}
+
+	small := writeFile(t, filepath.Join(dir, "small.mkv"), []byte("input"))
+	other := writeFile(t, filepath.Join(dir, "other.mkv"), []byte("inpux"))
+	if fp(small) == fp(other) {
+		t.Error("small files are hashed whole")
+	}
+	if _, err := Fingerprint(filepath.Join(dir, "missing.mkv")); err == nil {
+		t.Error("missing file: want error")
+	}
+}
+
+func TestLedger_RecordLookup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "runtime", "encode_ledger.json")
+	in := writeFile(t, filepath.Join(dir, "movie.mkv"), []byte("movie"))
+	out := writeFile(t, filepath.Join(dir, "movie_encoded.mkv"), []byte("encoded movie"))
+
+	l, err := LoadLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Record(queue.EncodeRecord{InputPath: in, OutputPath: out, ProfileID: "hevc", SessionID: "s_1", JobID: "j1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reload, and look up a moved copy of the input.
+	l, err = LoadLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Len() != 2 {
+		t.Fatalf("entries=%d, want 2", l.Len())
+	}
+	moved := writeFile(t, filepath.Join(t.TempDir(), "renamed.mkv"), []byte("movie"))
+	prior, isOutput, err := l.Lookup(moved, "hevc", "")
+	if err != nil || prior == nil || isOutput {
+		t.Fatalf("prior=%+v isOutput=%v err=%v, want the input", prior, isOutput, err)
+	}
+	if prior.InputPath != in || prior.OutputPath != out || prior.JobID != "j1" || prior.EncodedAt.IsZero() {
+		t.Errorf("prior=%+v", prior)
+	}
+	if prior, _, _ := l.Lookup(moved, "av1", ""); prior != nil {
+		t.Errorf("other profile: prior=%+v, want nil", prior)
+	}
+	if prior, _, _ := l.Lookup(moved, "", ""); prior != nil {
+		t.Errorf("unsaved profile: prior=%+v, want nil", prior)
+	}
+
+	if prior, _, _ := l.Lookup(moved, "hevc", "1080p"); prior != nil {
+		t.Errorf("other variant: prior=%+v, want nil", prior)
+	}
+
+	// Variants are kept apart.
+	out720 := writeFile(t, filepath.Join(dir, "movie_encoded_720p.mkv"), []byte("encoded movie 720p"))
+	if err := l.Record(queue.EncodeRecord{InputPath: in, OutputPath: out720, ProfileID: "hevc", Variant: "720p", JobID: "j2_720p"}); err != nil {
+		t.Fatal(err)
+	}
+	if prior, _, _ := l.Lookup(moved, "hevc", "720p"); prior == nil || prior.OutputPath != out720 || prior.Variant != "720p" {
+		t.Errorf("720p: prior=%+v, want the 720p encode", prior)
+	}
+	if prior, _, _ := l.Lookup(moved, "hevc", ""); prior == nil || prior.OutputPath != out {
+		t.Errorf("no variant: prior=%+v, want the first encode", prior)
+	}
+
+	// Outputs are found with any profile.
+	for _, profileID := range []string{"av1", ""} {
+		prior, isOutput, err := l.Lookup(out, profileID, "")
+		if err != nil || prior == nil || !isOutput || prior.InputPath != in {
+			t.Errorf("%q: prior=%+v isOutput=%v err=%v, want the output", profileID, prior, isOutput, err)
+		}
+	}
+}
+
+func TestLedger_CorruptFileMovedAside(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, filepath.Join(dir, "encode_ledger.json"), []byte("{"))
+	l, err := LoadLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Len() != 0 {
+		t.Errorf("len=%d, want an empty ledger", l.Len())
+	}
+	if matches, _ := filepath.Glob(path + ".broken.*"); len(matches) != 1 {
+		t.Errorf("broken copies=%v", matches)
+	}
+}
@@ -0,0 +1,30 @@
+package encoder
+
+import "github.com/yuta/enque/backend/profile"
+
+// ProfileChecker is implemented by adapters with encoder-specific profile
+// rules beyond profile.Validate.
+type ProfileChecker interface {
+	CheckProfile(p profile.Profile) []profile.FieldIssue
+}
+
+// CheckProfile runs the adapter's rules on p. Adapters without a
+// ProfileChecker report nothing.
+func CheckProfile(adapter Adapter, p profile.Profile) []profile.FieldIssue {
+	c, ok := adapter.(ProfileChecker)
+	if !ok {
+		return nil
+	}
+	return c.CheckProfile(p)
+}
+
+// CheckProfile checks p with the adapter for its encoder type, so a
+// Registry can serve as a profile.Checker. Unknown encoder types are left
+// to profile.Validate.
+func (r *Registry) CheckProfile(p profile.Profile) []profile.FieldIssue {
+	adapter, err := r.Resolve(p.EncoderType)
+	if err != nil {
+		return nil
+	}
+	return CheckProfile(adapter, p)
+}
@@ -0,0 +1,219 @@
+package encoder
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yuta/enque/backend/profile"
+)
+
+// sceneKeyframeTolerance is how close a keyframe must be to a scene change
+// to count as a scene cut.
+const sceneKeyframeTolerance = 0.1
+
+// Chunk is one segment of a chunked encode, from Start to End seconds of
+// the input.
+type Chunk struct {
+	Index int     `json:"index"` // 1-based
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	// Scene is set when the chunk ends at a scene change.
+	Scene bool `json:"scene,omitempty"`
+}
+
+// PlanChunks splits an input of the given duration at keyframes into
+// chunks of about c.SegmentSec. With scene changes, keyframes at a scene
+// change within half a segment of the target are preferred. It returns nil
+// when the input is shorter than c.MinDurationSec or cannot be split into
+// at least two chunks.
+func PlanChunks(duration float64, keyframes, scenes []float64, c profile.ChunkSettings) []Chunk {
+	minDuration := float64(cmp.Or(c.MinDurationSec, profile.DefaultChunkMinDurationSec))
+	seg := float64(cmp.Or(c.SegmentSec, profile.DefaultChunkSegmentSec))
+	if duration <= 0 || duration < minDuration || len(keyframes) == 0 {
+		return nil
+	}
+	sort.Float64s(scenes)
+
+	var chunks []Chunk
+	start := 0.0
+	for duration-start >= seg*1.5 {
+		target := start + seg
+		lo, hi := start+seg/2, math.Min(start+seg*1.5, duration-seg/2)
+		end, scene := -1.0, false
+		for _, k := range keyframes {
+			if k < lo || k > hi {
+				continue
+			}
+			cut := nearScene(k, scenes)
+			switch {
+			case end < 0, cut && !scene, cut == scene && math.Abs(k-target) < math.Abs(end-target):
+				end, scene = k, cut
+			}
+		}
+		if end < 0 {
+			// Sparse keyframes: take the first one after the window.
+			i := sort.SearchFloat64s(keyframes, hi)
+			if i == len(keyframes) || keyframes[i] > duration-seg/2 {
+				break
+			}
+			end = keyframes[i]
+		}
+		chunks = append(chunks, Chunk{Index: len(chunks) + 1, Start: start, End: end, Scene: scene})
+		start = end
+	}
+	if len(chunks) == 0 {
+		return nil
+	}
+	return append(chunks, Chunk{Index: len(chunks) + 1, Start: start, End: duration})
+}
+
+// ChunksUnsupported names the settings of p that need its inputs encoded
+// whole, or returns "" when p can be encoded in chunks. Chunks carry no
+// audio, so per-track audio settings cannot apply, and they seek the input
+// themselves.
+func ChunksUnsupported(p profile.Profile) string {
+	var names []string
+	if p.Tracks != nil {
+		names = append(names, "tracks")
+	}
+	if p.Loudness != nil {
+		names = append(names, "loudness")
+	}
+	adv := p.NVEncCAdvanced
+	if adv.Trim != "" || adv.Seek != "" || adv.SeekTo != "" {
+		names = append(names, "trim or seek")
+	}
+	return strings.Join(names, ", ")
+}
+
+func nearScene(t float64, scenes []float64) bool {
+	i := sort.SearchFloat64s(scenes, t-sceneKeyframeTolerance)
+	return i < len(scenes) && scenes[i] <= t+sceneKeyframeTolerance
+}
+
+// FormatSeek formats seconds as NVEncC's --seek/--seekto time,
+// hh:mm:ss.sss.
+func FormatSeek(sec float64) string {
+	ms := int64(math.Round(sec * 1000))
+	return fmt.Sprintf("%d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// SegmentProfile returns the profile one chunk of p is encoded with: the
+// video of the chunk only. Audio, subtitles, chapters and metadata are
+// taken from the input when the chunks are joined. The last chunk runs to
+// the end of the input.
+func SegmentProfile(p profile.Profile, c Chunk, last bool) profile.Profile {
+	p.Chunks = nil
+	p.AutoCrop, p.HDRMode = "", ""
+	p.AudioMode = "none"
+	p.Tracks, p.TrackMap, p.Loudness, p.AudioGains = nil, nil, nil, nil
+	p.MetadataCopy, p.VideoMetadataCopy, p.AudioMetadataCopy = false, false, false
+	p.ChapterCopy, p.SubCopy, p.DataCopy, p.AttachmentCopy = false, false, false, false
+	p.RestoreFileTime = false
+
+	adv := &p.NVEncCAdvanced
+	adv.AudioCopy, adv.AudioCodec, adv.AudioBitrate, adv.AudioQuality = "", "", "", ""
+	adv.AudioSamplerate, adv.AudioMetadata, adv.SubCopy, adv.SubMetadata = "", "", "", ""
+	adv.DataCopy, adv.AttachmentCopy, adv.Metadata, adv.Trim = "", "", "", ""
+	adv.Seek, adv.SeekTo = "", ""
+	if c.Start > 0 {
+		adv.Seek = FormatSeek(c.Start)
+	}
+	if !last {
+		adv.SeekTo = FormatSeek(c.End)
+	}
+	return p
+}
+
+// JoinArgs returns the ffmpeg arguments that concatenate the segments
+// listed in listPath (a concat demuxer list) into output without
+// re-encoding the video. Audio, subtitles, chapters and metadata come from
+// source as the profile asks; transcoded audio is encoded here.
+func JoinArgs(p profile.Profile, listPath, source, output string) []string {
+	args := []string{"-hide_banner", "-nostats", "-y",
+		"-f", "concat", "-safe", "0", "-i", listPath, "-i", source,
+		"-map", "0:v", "-c:v", "copy"}
+	switch p.AudioMode {
+	case "copy":
+		args = append(args, "-map", "1:a?", "-c:a", "copy")
+	case "aac", "opus":
+		codec := map[string]string{"aac": "aac", "opus": "libopus"}[p.AudioMode]
+		args = append(args, "-map", "1:a?", "-c:a", codec, "-b:a", strconv.Itoa(p.AudioBitrate)+"k")
+	}
+	if p.SubCopy {
+		codec := "copy"
+		if p.OutputContainer == "mp4" {
+			codec = "mov_text"
+		}
+		args = append(args, "-map", "1:s?", "-c:s", codec)
+	}
+	chapters, metadata := "-1", "-1"
+	if p.ChapterCopy {
+		chapters = "1"
+	}
+	if p.MetadataCopy {
+		metadata = "1"
+	}
+	args = append(args, "-map_chapters", chapters, "-map_metadata", metadata)
+	return append(args, output)
+}
+
+// SegmentJoiner concatenates the segments of a chunked encode with ffmpeg.
+type SegmentJoiner struct {
+	Path    string // ffmpeg executable; "ffmpeg" from PATH when empty
+	Timeout time.Duration
+}
+
+// NewSegmentJoiner returns a SegmentJoiner for the given ffmpeg path.
+func NewSegmentJoiner(path string) *SegmentJoiner {
+	return &SegmentJoiner{Path: path, Timeout: time.Hour}
+}
+
+// JoinSegments writes the segments, in order, to output with the audio
+// and other streams of source (see JoinArgs). The concat list is written
+// next to the first segment.
+func (j *SegmentJoiner) JoinSegments(ctx context.Context, p profile.Profile, segments []string, source, output string) error {
+	if len(segments) == 0 {
+		return fmt.Errorf("join: no segments")
+	}
+	var list strings.Builder
+	for _, s := range segments {
+		abs, err := filepath.Abs(s)
+		if err != nil {
+			return fmt.Errorf("join: %w", err)
+		}
+		fmt.Fprintf(&list, "file '%s'\n", strings.ReplaceAll(abs, "'", `'\''`))
+	}
+	listPath := filepath.Join(filepath.Dir(segments[0]), "concat.txt")
+	if err := os.WriteFile(listPath, []byte(list.String()), 0o644); err != nil {
+		return fmt.Errorf("join: %w", err)
+	}
+
+	exe := j.Path
+	if exe == "" {
+		exe = "ffmpeg"
+	}
+	if j.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.Timeout)
+		defer cancel()
+	}
+	out, err := exec.CommandContext(ctx, exe, JoinArgs(p, listPath, source, output)...).CombinedOutput()
+	if ctx.Err() != nil {
+		return fmt.Errorf("join: %w", ctx.Err())
+	}
+	if err != nil {
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		return fmt.Errorf("join: %w: %s", err, lines[len(lines)-1])
+	}
+	return nil
+}
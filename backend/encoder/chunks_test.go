@@ -0,0 +1,84 @@
+package encoder
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/yuta/enque/backend/profile"
+)
+
+func everyTwoSeconds(duration float64) []float64 {
+	var k []float64
+	for t := 0.0; t < duration; t += 2 {
+		k = append(k, t)
+	}
+	return k
+}
+
+func TestPlanChunks(t *testing.T) {
+	settings := profile.ChunkSettings{SegmentSec: 300}
+	chunks := PlanChunks(1800, everyTwoSeconds(1800), nil, settings)
+	if len(chunks) != 6 {
+		t.Fatalf("chunks=%+v", chunks)
+	}
+	for i, c := range chunks {
+		if c.Index != i+1 || c.Start != float64(i*300) || c.End != float64((i+1)*300) {
+			t.Errorf("chunk %d=%+v", i, c)
+		}
+	}
+
+	// A scene cut on a keyframe wins over the keyframe nearest the target.
+	chunks = PlanChunks(1800, everyTwoSeconds(1800), []float64{352.03, 1210.5}, settings)
+	if c := chunks[0]; c.End != 352 || !c.Scene {
+		t.Errorf("chunk 1=%+v, want the scene cut at 352", c)
+	}
+	if c := chunks[3]; c.Scene {
+		t.Errorf("chunk 4=%+v: 1210.5 is not on a keyframe", c)
+	}
+
+	// Sparse keyframes stretch a chunk to the next one.
+	chunks = PlanChunks(1800, []float64{0, 1000}, nil, settings)
+	if len(chunks) != 2 || chunks[0].End != 1000 || chunks[1].End != 1800 {
+		t.Errorf("sparse chunks=%+v", chunks)
+	}
+
+	if PlanChunks(900, everyTwoSeconds(900), nil, profile.ChunkSettings{}) != nil {
+		t.Error("inputs under min_duration_sec are not split")
+	}
+	if PlanChunks(1800, []float64{0}, nil, settings) != nil {
+		t.Error("an input with one keyframe is not split")
+	}
+}
+
+func TestSegmentProfile(t *testing.T) {
+	src := profile.Profile{AudioMode: "aac", SubCopy: true, ChapterCopy: true, AutoCrop: "apply",
+		Chunks: &profile.ChunkSettings{}, NVEncCAdvanced: profile.NVEncCAdvanced{AudioCopy: "1", Trim: "0:100"}}
+	p := SegmentProfile(src, Chunk{Index: 2, Start: 300.5, End: 3725.25}, false)
+	if p.AudioMode != "none" || p.SubCopy || p.ChapterCopy || p.AutoCrop != "" || p.Chunks != nil ||
+		p.NVEncCAdvanced.AudioCopy != "" || p.NVEncCAdvanced.Trim != "" {
+		t.Errorf("profile=%+v", p)
+	}
+	if p.NVEncCAdvanced.Seek != "0:05:00.500" || p.NVEncCAdvanced.SeekTo != "1:02:05.250" {
+		t.Errorf("seek=%s seekto=%s", p.NVEncCAdvanced.Seek, p.NVEncCAdvanced.SeekTo)
+	}
+	p = SegmentProfile(src, Chunk{Index: 1, End: 300}, true)
+	if p.NVEncCAdvanced.Seek != "" || p.NVEncCAdvanced.SeekTo != "" {
+		t.Errorf("seek=%s seekto=%s", p.NVEncCAdvanced.Seek, p.NVEncCAdvanced.SeekTo)
+	}
+}
+
+func TestJoinArgs(t *testing.T) {
+	p := profile.Profile{AudioMode: "aac", AudioBitrate: 192, SubCopy: true, ChapterCopy: true, OutputContainer: "mp4"}
+	got := strings.Join(JoinArgs(p, "list.txt", "in.mkv", "out.mp4"), " ")
+	want := "-hide_banner -nostats -y -f concat -safe 0 -i list.txt -i in.mkv -map 0:v -c:v copy " +
+		"-map 1:a? -c:a aac -b:a 192k -map 1:s? -c:s mov_text -map_chapters 1 -map_metadata -1 out.mp4"
+	if got != want {
+		t.Errorf("args=%s\nwant %s", got, want)
+	}
+
+	args := JoinArgs(profile.Profile{AudioMode: "none"}, "list.txt", "in.mkv", "out.mkv")
+	if slices.Contains(args, "1:a?") || slices.Contains(args, "1:s?") {
+		t.Errorf("args=%v", args)
+	}
+}
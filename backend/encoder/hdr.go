@@ -0,0 +1,177 @@
+package encoder
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/yuta/enque/backend/probe"
+	"github.com/yuta/enque/backend/profile"
+)
+
+// HDR handling modes (profile.HDRMode).
+const (
+	HDRWarn    = "warn"
+	HDREnforce = "enforce"
+	HDRTonemap = "tonemap"
+)
+
+// HDRPlan is how one input is encoded with a profile's hdr_mode.
+type HDRPlan struct {
+	// Source is the input's HDR format: "pq", "hlg" or "dolby_vision";
+	// empty for SDR inputs.
+	Source string `json:"source,omitempty"`
+	// Action is "passthrough" (HDR target), "upgraded" (raised to 10-bit
+	// HEVC/AV1), "warned" (SDR target kept), "tonemapped" or "none" (SDR
+	// input).
+	Action      string `json:"action"`
+	Codec       string `json:"codec"`
+	OutputDepth int    `json:"output_depth"`
+	// Color signal written to the output; empty keeps the profile's value.
+	Transfer      string `json:"transfer,omitempty"`
+	Colorprim     string `json:"colorprim,omitempty"`
+	Colormatrix   string `json:"colormatrix,omitempty"`
+	MasterDisplay string `json:"master_display,omitempty"`
+	MaxCLL        string `json:"max_cll,omitempty"`
+	// Tonemap is the colorspace filter of a tone-mapped encode.
+	Tonemap *profile.Filter `json:"tonemap,omitempty"`
+	// Notes lists what the plan changed or could not do.
+	Notes []string `json:"notes,omitempty"`
+}
+
+// PlanHDR matches a profile to the HDR signal of an input. HDR inputs
+// keep their color signal and HDR10 metadata on 10-bit HEVC/AV1 targets.
+// On SDR targets (H.264 or 8-bit) hdr_mode decides: "warn" keeps the
+// target, "enforce" raises it to 10-bit HEVC (AV1 stays AV1) and
+// "tonemap" converts the picture to BT.709 SDR.
+func PlanHDR(p profile.Profile, media probe.MediaInfo) (HDRPlan, error) {
+	if p.HDRMode != HDRWarn && p.HDRMode != HDREnforce && p.HDRMode != HDRTonemap {
+		return HDRPlan{}, fmt.Errorf("%s: hdr_mode must be warn, enforce or tonemap", ErrValidation)
+	}
+	plan := HDRPlan{Action: "none", Codec: p.Codec, OutputDepth: p.OutputDepth, Source: hdrSource(media)}
+	if plan.Source == "" {
+		return plan, nil
+	}
+	if plan.Source == "dolby_vision" {
+		plan.Notes = append(plan.Notes, "Dolby Vision without an HDR10 or HLG base layer is encoded as is; colors may be off")
+	}
+
+	sdrTarget := p.Codec == "h264" || p.OutputDepth != 10
+	switch {
+	case !sdrTarget:
+		plan.Action = "passthrough"
+	case p.HDRMode == HDRTonemap && plan.Source != "dolby_vision":
+		return planTonemap(p, plan, media), nil
+	case p.HDRMode == HDREnforce:
+		plan.Action = "upgraded"
+		if plan.Codec == "h264" {
+			plan.Codec = "hevc"
+		}
+		plan.OutputDepth = 10
+		plan.Notes = append(plan.Notes, fmt.Sprintf("%s input: encoding 10-bit %s instead of %d-bit %s", plan.Source, plan.Codec, p.OutputDepth, p.Codec))
+	default:
+		plan.Action = "warned"
+		plan.Notes = append(plan.Notes, fmt.Sprintf("%s input encoded as %d-bit %s: expect banding, and washed-out colors where HDR is not supported", plan.Source, p.OutputDepth, p.Codec))
+	}
+
+	plan.Transfer = signal(p.Transfer, media.ColorTransfer)
+	plan.Colorprim = signal(p.Colorprim, media.ColorPrimaries)
+	plan.Colormatrix = signal(p.Colormatrix, media.ColorSpace)
+	if plan.Codec == "h264" {
+		if media.MasterDisplay != "" || media.MaxCLL > 0 {
+			plan.Notes = append(plan.Notes, "HDR10 metadata is dropped: H.264 cannot carry it")
+		}
+		return plan, nil
+	}
+	plan.MasterDisplay = media.MasterDisplay
+	if media.MaxCLL > 0 || media.MaxFALL > 0 {
+		plan.MaxCLL = fmt.Sprintf("%d,%d", media.MaxCLL, media.MaxFALL)
+	}
+	return plan, nil
+}
+
+// planTonemap converts PQ with the hdr2sdr curve and HLG with its
+// transfer function, both to BT.709.
+func planTonemap(p profile.Profile, plan HDRPlan, media probe.MediaInfo) HDRPlan {
+	plan.Action = "tonemapped"
+	plan.Transfer = signal(p.Transfer, "bt709")
+	plan.Colorprim = signal(p.Colorprim, "bt709")
+	plan.Colormatrix = signal(p.Colormatrix, "bt709")
+	if slices.ContainsFunc(p.Filters, func(f profile.Filter) bool { return f.Type == profile.FilterColorspace && !f.Disabled }) {
+		plan.Notes = append(plan.Notes, "the profile's colorspace filter does the tone mapping")
+		return plan
+	}
+
+	from := map[string]string{"pq": "smpte2084", "hlg": "arib-std-b67"}[plan.Source]
+	params := map[string]string{
+		"matrix":    orDefault(media.ColorSpace, "bt2020nc") + ":bt709",
+		"colorprim": orDefault(media.ColorPrimaries, "bt2020") + ":bt709",
+		"transfer":  from + ":bt709",
+	}
+	if plan.Source == "pq" {
+		params["hdr2sdr"] = orDefault(p.Tonemap, "hable")
+	}
+	plan.Tonemap = &profile.Filter{Type: profile.FilterColorspace, Params: params}
+	return plan
+}
+
+// Apply returns p set up as planned.
+func (plan HDRPlan) Apply(p profile.Profile) profile.Profile {
+	if plan.Codec != p.Codec {
+		p.Codec = plan.Codec
+		p.NVEncCAdvanced.Profile = "" // the codec's profiles differ
+	}
+	if plan.OutputDepth != p.OutputDepth {
+		p.OutputDepth = plan.OutputDepth
+		if p.NVEncCAdvanced.Profile == "main" {
+			p.NVEncCAdvanced.Profile = "main10"
+		}
+	}
+	if plan.Transfer != "" {
+		p.Transfer = plan.Transfer
+	}
+	if plan.Colorprim != "" {
+		p.Colorprim = plan.Colorprim
+	}
+	if plan.Colormatrix != "" {
+		p.Colormatrix = plan.Colormatrix
+	}
+	p.MasterDisplay, p.MaxCLL = plan.MasterDisplay, plan.MaxCLL
+	if plan.Action == "tonemapped" {
+		p.DHDR10Info = "off"
+		if plan.Tonemap != nil {
+			p.Filters = append(slices.Clone(p.Filters), *plan.Tonemap)
+		}
+	}
+	return p
+}
+
+func hdrSource(media probe.MediaInfo) string {
+	switch {
+	case media.ColorTransfer == "smpte2084":
+		return "pq"
+	case media.ColorTransfer == "arib-std-b67":
+		return "hlg"
+	case media.DolbyVision:
+		return "dolby_vision"
+	}
+	return ""
+}
+
+// signal returns the value a color field is set to: the profile's own
+// value unless it is "auto", else the input's.
+func signal(profileValue, inputValue string) string {
+	if profileValue != "" && profileValue != "auto" {
+		return ""
+	}
+	if inputValue == "" || inputValue == "unknown" || inputValue == "reserved" {
+		return ""
+	}
+	return inputValue
+}
+
+func orDefault(v, def string) string {
+	if v == "" || v == "unknown" {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,95 @@
+package encoder
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yuta/enque/backend/probe"
+	"github.com/yuta/enque/backend/profile"
+)
+
+var pqMedia = probe.MediaInfo{
+	ColorTransfer: "smpte2084", ColorPrimaries: "bt2020", ColorSpace: "bt2020nc", HDR: true,
+	MasterDisplay: "G(13250,34500)B(7500,3000)R(34000,16000)WP(15635,16450)L(10000000,50)",
+	MaxCLL:        1000, MaxFALL: 400,
+}
+
+func hdrProfile(mode, codec string, depth int) profile.Profile {
+	return profile.Profile{HDRMode: mode, Codec: codec, OutputDepth: depth,
+		Transfer: "auto", Colorprim: "auto", Colormatrix: "auto", DHDR10Info: "copy"}
+}
+
+func TestPlanHDR_PassthroughAndUpgrade(t *testing.T) {
+	plan, err := PlanHDR(hdrProfile(HDRWarn, "av1", 10), pqMedia)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := plan.Apply(hdrProfile(HDRWarn, "av1", 10))
+	if plan.Source != "pq" || plan.Action != "passthrough" || len(plan.Notes) != 0 {
+		t.Errorf("plan=%+v", plan)
+	}
+	if p.Transfer != "smpte2084" || p.Colorprim != "bt2020" || p.Colormatrix != "bt2020nc" ||
+		p.MasterDisplay != pqMedia.MasterDisplay || p.MaxCLL != "1000,400" {
+		t.Errorf("profile=%+v", p)
+	}
+
+	src := hdrProfile(HDREnforce, "h264", 8)
+	src.NVEncCAdvanced.Profile = "high"
+	plan, _ = PlanHDR(src, pqMedia)
+	p = plan.Apply(src)
+	if plan.Action != "upgraded" || p.Codec != "hevc" || p.OutputDepth != 10 || p.NVEncCAdvanced.Profile != "" || p.MaxCLL != "1000,400" {
+		t.Errorf("plan=%+v profile=%+v", plan, p)
+	}
+
+	plan, _ = PlanHDR(hdrProfile(HDRWarn, "h264", 8), pqMedia)
+	p = plan.Apply(hdrProfile(HDRWarn, "h264", 8))
+	if plan.Action != "warned" || p.Codec != "h264" || p.Transfer != "smpte2084" || p.MasterDisplay != "" || len(plan.Notes) != 2 {
+		t.Errorf("plan=%+v profile=%+v", plan, p)
+	}
+
+	// SDR inputs and explicit profile colors are left alone.
+	plan, _ = PlanHDR(hdrProfile(HDREnforce, "h264", 8), probe.MediaInfo{ColorTransfer: "bt709"})
+	if plan.Action != "none" || plan.Codec != "h264" {
+		t.Errorf("sdr plan=%+v", plan)
+	}
+	src = hdrProfile(HDRWarn, "hevc", 10)
+	src.Transfer = "arib-std-b67"
+	plan, _ = PlanHDR(src, pqMedia)
+	if p := plan.Apply(src); p.Transfer != "arib-std-b67" {
+		t.Errorf("transfer=%s, want the profile's", p.Transfer)
+	}
+}
+
+func TestPlanHDR_Tonemap(t *testing.T) {
+	src := hdrProfile(HDRTonemap, "hevc", 8)
+	src.Tonemap = "mobius"
+	plan, err := PlanHDR(src, pqMedia)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := plan.Apply(src)
+	if plan.Action != "tonemapped" || p.Transfer != "bt709" || p.MasterDisplay != "" || p.DHDR10Info != "off" || len(p.Filters) != 1 {
+		t.Fatalf("plan=%+v profile=%+v", plan, p)
+	}
+	want := "--vpp-colorspace colorprim=bt2020:bt709,hdr2sdr=mobius,matrix=bt2020nc:bt709,transfer=smpte2084:bt709"
+	if got := strings.Join(p.Filters[0].Args(), " "); got != want {
+		t.Errorf("filter=%s, want %s", got, want)
+	}
+
+	hlg := pqMedia
+	hlg.ColorTransfer = "arib-std-b67"
+	plan, _ = PlanHDR(hdrProfile(HDRTonemap, "h264", 8), hlg)
+	if plan.Tonemap == nil || plan.Tonemap.Params["transfer"] != "arib-std-b67:bt709" || plan.Tonemap.Params["hdr2sdr"] != "" {
+		t.Errorf("hlg plan=%+v", plan)
+	}
+
+	// A 10-bit HEVC target stays HDR.
+	plan, _ = PlanHDR(hdrProfile(HDRTonemap, "hevc", 10), pqMedia)
+	if plan.Action != "passthrough" || plan.Tonemap != nil {
+		t.Errorf("plan=%+v", plan)
+	}
+
+	if _, err := PlanHDR(hdrProfile("auto", "hevc", 10), pqMedia); err == nil || !strings.HasPrefix(err.Error(), ErrValidation) {
+		t.Errorf("err=%v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package encoder
+
+import "github.com/yuta/enque/backend/profile"
+
+// Lint warning codes for custom options.
+const (
+	LintDuplicate = "duplicate" // repeats a GUI-generated option with the same value
+	LintOverride  = "override"  // changes a value the GUI shows
+	LintConflict  = "conflict"  // contradicts the GUI, e.g. a second rate-control mode
+	LintUnknown   = "unknown"   // not an option the encoder is known to accept
+	LintInputOut  = "input_output"
+	LintSyntax    = "syntax"
+)
+
+// LintWarning describes one problem found in a profile's custom options.
+type LintWarning struct {
+	Code    string `json:"code"`
+	Option  string `json:"option"`          // the custom option, with its values
+	Field   string `json:"field,omitempty"` // profile field affected, if any
+	Message string `json:"message"`
+}
+
+// Linter is implemented by adapters that can check custom options against
+// the options BuildArgs generates.
+type Linter interface {
+	LintProfile(p profile.Profile) []LintWarning
+}
+
+// LintProfile lints p with adapter. Adapters without a Linter report
+// nothing.
+func LintProfile(adapter Adapter, p profile.Profile) []LintWarning {
+	l, ok := adapter.(Linter)
+	if !ok {
+		return nil
+	}
+	return l.LintProfile(p)
+}
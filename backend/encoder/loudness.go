@@ -0,0 +1,20 @@
+package encoder
+
+import (
+	"math"
+
+	"github.com/yuta/enque/backend/probe"
+	"github.com/yuta/enque/backend/profile"
+)
+
+// LoudnessGain returns the gain in dB that brings a measured track to the
+// target loudness, lowered where needed so the true peak stays at or below
+// the target's. limited reports whether the peak lowered it. The gain is
+// linear, so the track's dynamics are kept.
+func LoudnessGain(target profile.Loudness, m probe.Loudness) (gain float64, limited bool) {
+	gain = target.TargetLUFS - m.IntegratedLUFS
+	if headroom := target.TruePeak - m.TruePeakDBTP; gain > headroom {
+		gain, limited = headroom, true
+	}
+	return math.Round(gain*100) / 100, limited
+}
@@ -0,0 +1,28 @@
+package encoder
+
+import (
+	"testing"
+
+	"github.com/yuta/enque/backend/probe"
+	"github.com/yuta/enque/backend/profile"
+)
+
+func TestLoudnessGain(t *testing.T) {
+	target := profile.Loudness{TargetLUFS: -23, TruePeak: -1}
+	tests := []struct {
+		name    string
+		m       probe.Loudness
+		gain    float64
+		limited bool
+	}{
+		{"quiet recording", probe.Loudness{IntegratedLUFS: -31.42, TruePeakDBTP: -9.87}, 8.42, false},
+		{"loud recording", probe.Loudness{IntegratedLUFS: -14, TruePeakDBTP: 0.5}, -9, false},
+		{"quiet with peaks", probe.Loudness{IntegratedLUFS: -35, TruePeakDBTP: -4.5}, 3.5, true},
+	}
+	for _, tt := range tests {
+		gain, limited := LoudnessGain(target, tt.m)
+		if gain != tt.gain || limited != tt.limited {
+			t.Errorf("%s: gain=%g limited=%t, want %g %t", tt.name, gain, limited, tt.gain, tt.limited)
+		}
+	}
+}
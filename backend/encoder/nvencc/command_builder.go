@@ -2,7 +2,9 @@ package nvencc
 
 import (
 	"fmt"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/yuta/enque/backend/encoder"
 	"github.com/yuta/enque/backend/profile"
@@ -17,9 +19,16 @@ func (a *NVEncCAdapter) SupportsDecoderFallback() bool { return true }
 
 // BuildArgs generates NVEncC command-line arguments from a profile.
 // Argument order is a fixed contract (design doc 9.3.1):
-// 1. --avhw/--avsw  2. -i  3. video basic  4. video detail  5. speed
-// 6. audio  7. color  8. metadata  9. nvencc_advanced  10. custom_options  11. -o
+// 1. --avhw/--avsw  2. -i  3. video basic  4. video detail  5. filters
+// 6. speed  7. audio  8. color  9. metadata  10. nvencc_advanced
+// 11. custom_options  12. -o
+// Filters keep the order of the profile's list.
+// A job's track map emits its subtitle options with the audio.
 func (a *NVEncCAdapter) BuildArgs(p profile.Profile, inputPath, outputPath string) ([]string, error) {
+	if p.RateControl == encoder.RateControlTargetSize {
+		return nil, fmt.Errorf("%s: rate_control target_size needs the input duration; plan it for the input first", encoder.ErrValidation)
+	}
+
 	var args []string
 
 	// 1. Decoder (front-positioned)
@@ -37,22 +46,29 @@ func (a *NVEncCAdapter) BuildArgs(p profile.Profile, inputPath, outputPath strin
 	// 4. Video detail (standard GUI)
 	args = appendVideoDetail(args, p)
 
-	// 5. Speed
+	// 5. Filters
+	for _, f := range p.Filters {
+		if !f.Disabled {
+			args = append(args, f.Args()...)
+		}
+	}
+
+	// 6. Speed
 	args = appendSpeed(args, p)
 
-	// 6. Audio (standard GUI)
+	// 7. Audio (standard GUI)
 	args = appendAudio(args, p)
 
-	// 7. Color
+	// 8. Color
 	args = appendColor(args, p)
 
-	// 8. Metadata (standard GUI)
+	// 9. Metadata (standard GUI)
 	args = appendMetadata(args, p)
 
-	// 9. NVEncC Advanced (overwrites standard GUI by later-wins)
+	// 10. NVEncC Advanced (overwrites standard GUI by later-wins)
 	args = appendAdvanced(args, p.NVEncCAdvanced)
 
-	// 10. Custom options (final priority)
+	// 11. Custom options (final priority)
 	if p.CustomOptions != "" {
 		tokens, err := encoder.TokenizeCustomOptions(p.CustomOptions)
 		if err != nil {
@@ -61,7 +77,7 @@ func (a *NVEncCAdapter) BuildArgs(p profile.Profile, inputPath, outputPath strin
 		args = append(args, tokens...)
 	}
 
-	// 11. Output
+	// 12. Output
 	args = append(args, "-o", outputPath)
 
 	return args, nil
@@ -146,13 +162,66 @@ func appendSpeed(args []string, p profile.Profile) []string {
 }
 
 func appendAudio(args []string, p profile.Profile) []string {
-	switch p.AudioMode {
-	case "copy":
-		args = append(args, "--audio-copy")
-	case "aac":
-		args = append(args, "--audio-codec", "aac", "--audio-bitrate", strconv.Itoa(p.AudioBitrate))
-	case "opus":
-		args = append(args, "--audio-codec", "opus", "--audio-bitrate", strconv.Itoa(p.AudioBitrate))
+	if p.TrackMap != nil {
+		args = appendTrackMap(args, p)
+	} else {
+		switch p.AudioMode {
+		case "copy":
+			args = append(args, "--audio-copy")
+		case "aac":
+			args = append(args, "--audio-codec", "aac", "--audio-bitrate", strconv.Itoa(p.AudioBitrate))
+		case "opus":
+			args = append(args, "--audio-codec", "opus", "--audio-bitrate", strconv.Itoa(p.AudioBitrate))
+		}
+	}
+	// Loudness gains, in track order
+	tracks := make([]int, 0, len(p.AudioGains))
+	for n := range p.AudioGains {
+		tracks = append(tracks, n)
+	}
+	slices.Sort(tracks)
+	for _, n := range tracks {
+		args = append(args, "--audio-filter", fmt.Sprintf("%d?volume=%+.2fdB", n, p.AudioGains[n]))
+	}
+	return args
+}
+
+// appendTrackMap emits a job's track mapping with NVEncC's indexed
+// options: copied tracks as one --audio-copy/--sub-copy list, transcoded
+// ones as --audio-codec N?codec, dispositions as N?value. Sidecar files
+// follow as --sub-source.
+func appendTrackMap(args []string, p profile.Profile) []string {
+	m := p.TrackMap
+	var copied, subs []string
+	var encoded, dispositions []string
+	for _, t := range m.Audio {
+		n := strconv.Itoa(t.Track)
+		if t.Codec == "copy" {
+			copied = append(copied, n)
+		} else {
+			encoded = append(encoded, "--audio-codec", n+"?"+t.Codec, "--audio-bitrate", n+"?"+strconv.Itoa(p.AudioBitrate))
+		}
+		if t.Disposition != "" {
+			dispositions = append(dispositions, "--audio-disposition", n+"?"+t.Disposition)
+		}
+	}
+	if len(copied) > 0 {
+		args = append(args, "--audio-copy", strings.Join(copied, ","))
+	}
+	args = append(args, encoded...)
+	for _, t := range m.Subs {
+		n := strconv.Itoa(t.Track)
+		subs = append(subs, n)
+		if t.Disposition != "" {
+			dispositions = append(dispositions, "--sub-disposition", n+"?"+t.Disposition)
+		}
+	}
+	if len(subs) > 0 {
+		args = append(args, "--sub-copy", strings.Join(subs, ","))
+	}
+	args = append(args, dispositions...)
+	for _, path := range m.Sidecars {
+		args = append(args, "--sub-source", path)
 	}
 	return args
 }
@@ -170,6 +239,12 @@ func appendColor(args []string, p profile.Profile) []string {
 	if p.Colorrange != "auto" && p.Colorrange != "" {
 		args = append(args, "--colorrange", p.Colorrange)
 	}
+	if p.MasterDisplay != "" {
+		args = append(args, "--master-display", p.MasterDisplay)
+	}
+	if p.MaxCLL != "" {
+		args = append(args, "--max-cll", p.MaxCLL)
+	}
 	if p.DHDR10Info == "copy" {
 		args = append(args, "--dhdr10-info", "copy")
 	}
@@ -189,7 +264,7 @@ func appendMetadata(args []string, p profile.Profile) []string {
 	if p.ChapterCopy {
 		args = append(args, "--chapter-copy")
 	}
-	if p.SubCopy {
+	if p.SubCopy && p.TrackMap == nil {
 		args = append(args, "--sub-copy")
 	}
 	if p.DataCopy {
@@ -4,6 +4,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/yuta/enque/backend/encoder"
 	"github.com/yuta/enque/backend/profile"
 )
 
@@ -144,6 +145,30 @@ func TestBuildArgs_AllRateControls(t *testing.T) {
 	}
 }
 
+func TestBuildArgs_TargetSize(t *testing.T) {
+	a := &NVEncCAdapter{}
+	p := defaultProfile()
+	p.RateControl, p.RateValue = encoder.RateControlTargetSize, 100
+	if _, err := a.BuildArgs(p, "in.mp4", "out.mkv"); err == nil || !strings.HasPrefix(err.Error(), encoder.ErrValidation) {
+		t.Fatalf("unplanned target size: err=%v, want %s", err, encoder.ErrValidation)
+	}
+
+	plan := encoder.TargetSizePlan{Mode: "vbr", VideoKbps: 1007, MaxKbps: 1510}
+	args, err := a.BuildArgs(plan.Apply(p), "in.mp4", "out.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := argsString(args); !strings.Contains(s, "--vbr 1007") || !strings.Contains(s, "--max-bitrate 1510") {
+		t.Errorf("planned target size: %s", s)
+	}
+
+	// Custom rate control still conflicts with a target size.
+	p.CustomOptions = "--cqp 20"
+	if w := a.LintProfile(p); len(w) != 1 || w[0].Code != encoder.LintConflict {
+		t.Errorf("lint=%+v, want one conflict", w)
+	}
+}
+
 func TestBuildArgs_Decoder_AVSW(t *testing.T) {
 	a := &NVEncCAdapter{}
 	p := defaultProfile()
@@ -232,6 +257,8 @@ func TestBuildArgs_Color_NonAuto(t *testing.T) {
 	p.Colorprim = "bt2020"
 	p.Colorrange = "full"
 	p.DHDR10Info = "copy"
+	p.MasterDisplay = "G(13250,34500)B(7500,3000)R(34000,16000)WP(15635,16450)L(10000000,50)"
+	p.MaxCLL = "1000,400"
 	args, _ := a.BuildArgs(p, "in.mp4", "out.mkv")
 	s := argsString(args)
 	for _, expected := range []string{
@@ -239,6 +266,8 @@ func TestBuildArgs_Color_NonAuto(t *testing.T) {
 		"--transfer smpte2084",
 		"--colorprim bt2020",
 		"--colorrange full",
+		"--master-display G(13250,34500)B(7500,3000)R(34000,16000)WP(15635,16450)L(10000000,50)",
+		"--max-cll 1000,400",
 		"--dhdr10-info copy",
 	} {
 		if !strings.Contains(s, expected) {
@@ -408,6 +437,7 @@ func TestBuildArgs_ArgumentOrder_FullPipeline(t *testing.T) {
 	p.Colormatrix = "bt709"
 	mb := 50000
 	p.NVEncCAdvanced.MaxBitrate = &mb
+	p.Filters = []profile.Filter{{Type: profile.FilterDeband}}
 	p.CustomOptions = "--vpp-nlmeans sigma=0.005"
 
 	args, err := a.BuildArgs(p, "in.mp4", "out.mkv")
@@ -434,6 +464,7 @@ func TestBuildArgs_ArgumentOrder_FullPipeline(t *testing.T) {
 		{"-c", "codec"},
 		{"--multipass", "multipass"},
 		{"--bframes", "bframes"},
+		{"--vpp-deband", "filters"},
 		{"--split-enc", "split-enc"},
 		{"--audio-copy", "audio"},
 		{"--max-bitrate", "advanced"},
@@ -489,3 +520,74 @@ func TestBuildArgs_AdvancedTrimSeek(t *testing.T) {
 		t.Errorf("expected --seekto in %s", s)
 	}
 }
+
+func TestBuildArgs_FiltersKeepListOrder(t *testing.T) {
+	a := &NVEncCAdapter{}
+	p := defaultProfile()
+	p.OutputRes = "1920x-2"
+	p.Filters = []profile.Filter{
+		{Type: profile.FilterCrop, Rect: &profile.FilterRect{Top: 140, Bottom: 140}},
+		{Type: profile.FilterDeinterlace, Method: "yadif", Disabled: true},
+		{Type: profile.FilterDenoise, Method: "knn", Params: map[string]string{"radius": "3"}},
+		{Type: profile.FilterResize, Method: "spline36"},
+		{Type: profile.FilterDeband},
+	}
+	args, err := a.BuildArgs(p, "in.mp4", "out.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := argsString(args)
+	want := "--output-res 1920x-2 --aq --aq-temporal --crop 0,140,0,140 --vpp-knn radius=3 --vpp-resize spline36 --vpp-deband --split-enc auto"
+	if !strings.Contains(s, want) {
+		t.Errorf("args=%s\nwant filters in list order after video detail: %s", s, want)
+	}
+	if strings.Contains(s, "--vpp-yadif") {
+		t.Errorf("disabled filter emitted: %s", s)
+	}
+
+	// Reordering the list reorders the arguments.
+	p.Filters[2], p.Filters[3] = p.Filters[3], p.Filters[2]
+	args, _ = a.BuildArgs(p, "in.mp4", "out.mkv")
+	if s := argsString(args); !strings.Contains(s, "--vpp-resize spline36 --vpp-knn radius=3") {
+		t.Errorf("args=%s, want resize before knn", s)
+	}
+}
+
+func TestBuildArgs_TrackMap(t *testing.T) {
+	a := &NVEncCAdapter{}
+	p := defaultProfile()
+	p.SubCopy, p.AudioBitrate = true, 192
+	p.TrackMap = &profile.TrackMap{
+		Audio: []profile.TrackAction{
+			{Track: 1, Stream: 1, Codec: "copy", Disposition: "unset"},
+			{Track: 3, Stream: 3, Codec: "aac", Disposition: "default"},
+		},
+		Subs:     []profile.TrackAction{{Track: 2, Stream: 6, Codec: "copy", Disposition: "default,forced"}},
+		Sidecars: []string{`C:\video\movie.srt`},
+	}
+	args, err := a.BuildArgs(p, "in.mkv", "out.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := argsString(args)
+	want := `--audio-copy 1 --audio-codec 3?aac --audio-bitrate 3?192` +
+		` --sub-copy 2 --audio-disposition 1?unset --audio-disposition 3?default --sub-disposition 2?default,forced --sub-source C:\video\movie.srt`
+	if !strings.Contains(s, want) {
+		t.Errorf("args=%s\nwant %s", s, want)
+	}
+	if strings.Count(s, "--sub-copy") != 1 {
+		t.Errorf("sub_copy emitted twice: %s", s)
+	}
+}
+
+func TestBuildArgs_AudioGains(t *testing.T) {
+	a := &NVEncCAdapter{}
+	p := defaultProfile()
+	p.AudioMode = "aac"
+	p.AudioGains = map[int]float64{2: -3.5, 1: 8.42}
+	args, _ := a.BuildArgs(p, "in.mkv", "out.mkv")
+	s := argsString(args)
+	if !strings.Contains(s, "--audio-filter 1?volume=+8.42dB --audio-filter 2?volume=-3.50dB") {
+		t.Errorf("args=%s", s)
+	}
+}
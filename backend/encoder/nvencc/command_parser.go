@@ -0,0 +1,499 @@
+package nvencc
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/yuta/enque/backend/encoder"
+	"github.com/yuta/enque/backend/profile"
+)
+
+// CommandImport is the result of importing an NVEncC command line.
+type CommandImport struct {
+	Profile    profile.Profile `json:"profile"`
+	InputPath  string          `json:"input_path"`
+	OutputPath string          `json:"output_path"`
+	// Defaulted lists fields BuildArgs always emits that the command line
+	// did not set; they hold the fallback values below.
+	Defaulted []string `json:"defaulted"`
+	// Custom lists the options moved to custom_options.
+	Custom []string `json:"custom"`
+}
+
+// Fallbacks for options BuildArgs always emits.
+const (
+	fallbackCodec       = "h264"
+	fallbackRateControl = "qvbr"
+	fallbackRateValue   = 28
+	fallbackPreset      = "P4"
+	fallbackOutputDepth = 8
+	fallbackDecoder     = "avhw"
+)
+
+type optionKind int
+
+const (
+	optFlag          optionKind = iota // no value
+	optValue                           // exactly one value
+	optOptionalValue                   // a value unless the next token is an option
+)
+
+// optionSpec maps one NVEncC option onto the profile. apply returns false
+// when the value cannot be represented, and the option is kept in
+// custom_options verbatim.
+type optionSpec struct {
+	kind  optionKind
+	group string // options that override each other; defaults to the name
+	apply func(p *profile.Profile, value string, hasValue bool) bool
+}
+
+var optionAliases = map[string]string{
+	"--codec":  "-c",
+	"-u":       "--preset",
+	"--input":  "-i",
+	"--output": "-o",
+}
+
+var optionSpecs = map[string]optionSpec{
+	// Decoder
+	"--avhw": {kind: optFlag, group: "decoder", apply: func(p *profile.Profile, _ string, _ bool) bool {
+		p.Decoder = "avhw"
+		p.NVEncCAdvanced.AVSWDecoder = ""
+		return true
+	}},
+	"--avsw": {kind: optOptionalValue, group: "decoder", apply: func(p *profile.Profile, v string, _ bool) bool {
+		p.Decoder = "avsw"
+		p.NVEncCAdvanced.AVSWDecoder = v
+		return true
+	}},
+
+	// Video basic
+	"-c":             {kind: optValue, apply: setString(func(p *profile.Profile) *string { return &p.Codec }, "")},
+	"--qvbr":         {kind: optValue, group: "rate", apply: setRate("qvbr")},
+	"--cqp":          {kind: optValue, group: "rate", apply: setRate("cqp")},
+	"--cbr":          {kind: optValue, group: "rate", apply: setRate("cbr")},
+	"--vbr":          {kind: optValue, group: "rate", apply: setRate("vbr")},
+	"--preset":       {kind: optValue, apply: setString(func(p *profile.Profile) *string { return &p.Preset }, "")},
+	"--output-depth": {kind: optValue, apply: setDepth},
+
+	// Video detail
+	"--multipass":   {kind: optValue, apply: setString(func(p *profile.Profile) *string { return &p.Multipass }, "none")},
+	"--output-res":  {kind: optValue, apply: setString(func(p *profile.Profile) *string { return &p.OutputRes }, "")},
+	"--bframes":     {kind: optValue, apply: setIntPtr(func(p *profile.Profile) **int { return &p.Bframes })},
+	"--ref":         {kind: optValue, apply: setIntPtr(func(p *profile.Profile) **int { return &p.Ref })},
+	"--lookahead":   {kind: optValue, apply: setIntPtr(func(p *profile.Profile) **int { return &p.Lookahead })},
+	"--gop-len":     {kind: optValue, apply: setIntPtr(func(p *profile.Profile) **int { return &p.GopLen })},
+	"--aq":          {kind: optFlag, apply: setBool(func(p *profile.Profile) *bool { return &p.AQ })},
+	"--aq-temporal": {kind: optFlag, apply: setBool(func(p *profile.Profile) *bool { return &p.AQTemporal })},
+
+	// Speed
+	"--split-enc": {kind: optValue, apply: setString(func(p *profile.Profile) *string { return &p.SplitEnc }, "off")},
+	"--parallel":  {kind: optValue, apply: setString(func(p *profile.Profile) *string { return &p.Parallel }, "off")},
+	"--device":    {kind: optValue, apply: setString(func(p *profile.Profile) *string { return &p.Device }, "auto")},
+
+	// Color
+	"--colormatrix": {kind: optValue, apply: setString(func(p *profile.Profile) *string { return &p.Colormatrix }, "auto")},
+	"--transfer":    {kind: optValue, apply: setString(func(p *profile.Profile) *string { return &p.Transfer }, "auto")},
+	"--colorprim":   {kind: optValue, apply: setString(func(p *profile.Profile) *string { return &p.Colorprim }, "auto")},
+	"--colorrange":  {kind: optValue, apply: setString(func(p *profile.Profile) *string { return &p.Colorrange }, "auto")},
+	"--dhdr10-info": {kind: optValue, apply: func(p *profile.Profile, v string, _ bool) bool {
+		if v != "copy" {
+			return false
+		}
+		p.DHDR10Info = "copy"
+		return true
+	}},
+
+	// Audio, metadata and stream copies: the plain forms map onto the GUI
+	// settings, anything else onto nvencc_advanced. These may be repeated
+	// for different tracks, so only the first of each goes to a field.
+	"--audio-copy": {kind: optOptionalValue, group: "-", apply: func(p *profile.Profile, v string, has bool) bool {
+		if !has {
+			p.AudioMode = "copy"
+			return true
+		}
+		return setOnce(&p.NVEncCAdvanced.AudioCopy, v)
+	}},
+	"--audio-codec":      {kind: optValue, group: "-", apply: advOnce(func(a *profile.NVEncCAdvanced) *string { return &a.AudioCodec })},
+	"--audio-bitrate":    {kind: optValue, group: "-", apply: advOnce(func(a *profile.NVEncCAdvanced) *string { return &a.AudioBitrate })},
+	"--audio-quality":    {kind: optValue, group: "-", apply: advOnce(func(a *profile.NVEncCAdvanced) *string { return &a.AudioQuality })},
+	"--audio-samplerate": {kind: optValue, group: "-", apply: advOnce(func(a *profile.NVEncCAdvanced) *string { return &a.AudioSamplerate })},
+	"--audio-metadata": {kind: optValue, group: "-", apply: copyOrAdv(func(p *profile.Profile) *bool { return &p.AudioMetadataCopy },
+		func(a *profile.NVEncCAdvanced) *string { return &a.AudioMetadata })},
+	"--video-metadata": {kind: optValue, group: "-", apply: copyOrAdv(func(p *profile.Profile) *bool { return &p.VideoMetadataCopy },
+		func(a *profile.NVEncCAdvanced) *string { return &a.VideoMetadata })},
+	"--metadata": {kind: optValue, group: "-", apply: copyOrAdv(func(p *profile.Profile) *bool { return &p.MetadataCopy },
+		func(a *profile.NVEncCAdvanced) *string { return &a.Metadata })},
+	"--sub-metadata": {kind: optValue, group: "-", apply: advOnce(func(a *profile.NVEncCAdvanced) *string { return &a.SubMetadata })},
+	"--chapter-copy": {kind: optFlag, apply: setBool(func(p *profile.Profile) *bool { return &p.ChapterCopy })},
+	"--sub-copy": {kind: optOptionalValue, group: "-", apply: flagOrAdv(func(p *profile.Profile) *bool { return &p.SubCopy },
+		func(a *profile.NVEncCAdvanced) *string { return &a.SubCopy })},
+	"--data-copy": {kind: optOptionalValue, group: "-", apply: flagOrAdv(func(p *profile.Profile) *bool { return &p.DataCopy },
+		func(a *profile.NVEncCAdvanced) *string { return &a.DataCopy })},
+	"--attachment-copy": {kind: optOptionalValue, group: "-", apply: flagOrAdv(func(p *profile.Profile) *bool { return &p.AttachmentCopy },
+		func(a *profile.NVEncCAdvanced) *string { return &a.AttachmentCopy })},
+
+	// NVEncC advanced
+	"--interlace":       {kind: optValue, apply: setAdv(func(a *profile.NVEncCAdvanced) *string { return &a.Interlace })},
+	"--input-csp":       {kind: optValue, apply: setAdv(func(a *profile.NVEncCAdvanced) *string { return &a.InputCSP })},
+	"--output-csp":      {kind: optValue, apply: setAdv(func(a *profile.NVEncCAdvanced) *string { return &a.OutputCSP })},
+	"--tune":            {kind: optValue, apply: setAdv(func(a *profile.NVEncCAdvanced) *string { return &a.Tune })},
+	"--max-bitrate":     {kind: optValue, apply: setAdvInt(func(a *profile.NVEncCAdvanced) **int { return &a.MaxBitrate })},
+	"--vbr-quality":     {kind: optValue, apply: setAdvInt(func(a *profile.NVEncCAdvanced) **int { return &a.VBRQuality })},
+	"--lookahead-level": {kind: optValue, apply: setAdvInt(func(a *profile.NVEncCAdvanced) **int { return &a.LookaheadLevel })},
+	"--weightp":         {kind: optFlag, apply: func(p *profile.Profile, _ string, _ bool) bool { p.NVEncCAdvanced.WeightP = true; return true }},
+	"--mv-precision":    {kind: optValue, apply: setAdv(func(a *profile.NVEncCAdvanced) *string { return &a.MVPrecision })},
+	"--refs-forward":    {kind: optValue, apply: setAdvInt(func(a *profile.NVEncCAdvanced) **int { return &a.RefsForward })},
+	"--refs-backward":   {kind: optValue, apply: setAdvInt(func(a *profile.NVEncCAdvanced) **int { return &a.RefsBackward })},
+	"--level":           {kind: optValue, apply: setAdv(func(a *profile.NVEncCAdvanced) *string { return &a.Level })},
+	"--profile":         {kind: optValue, apply: setAdv(func(a *profile.NVEncCAdvanced) *string { return &a.Profile })},
+	"--tier":            {kind: optValue, apply: setAdv(func(a *profile.NVEncCAdvanced) *string { return &a.Tier })},
+	"--output-thread":   {kind: optValue, apply: setAdvInt(func(a *profile.NVEncCAdvanced) **int { return &a.OutputThread })},
+	"--ssim":            {kind: optFlag, apply: func(p *profile.Profile, _ string, _ bool) bool { p.NVEncCAdvanced.SSIM = true; return true }},
+	"--psnr":            {kind: optFlag, apply: func(p *profile.Profile, _ string, _ bool) bool { p.NVEncCAdvanced.PSNR = true; return true }},
+	"--trim":            {kind: optValue, apply: setAdv(func(a *profile.NVEncCAdvanced) *string { return &a.Trim })},
+	"--seek":            {kind: optValue, apply: setAdv(func(a *profile.NVEncCAdvanced) *string { return &a.Seek })},
+	"--seekto":          {kind: optValue, apply: setAdv(func(a *profile.NVEncCAdvanced) *string { return &a.SeekTo })},
+}
+
+// ImportCommandLine parses an NVEncC command line as found in a .bat file:
+// a leading executable, "^" line continuations, rem/echo lines and quoted
+// paths are handled. See ImportArgs.
+func ImportCommandLine(cmdline string) (CommandImport, error) {
+	cmdline = strings.NewReplacer("^\r\n", " ", "^\n", " ").Replace(cmdline)
+
+	var lines []string
+	for _, line := range strings.Split(cmdline, "\n") {
+		line = strings.TrimSpace(line)
+		lower := strings.ToLower(line)
+		if line == "" || strings.HasPrefix(lower, "rem ") || strings.HasPrefix(lower, "::") || strings.HasPrefix(lower, "@echo") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) > 1 {
+		for _, line := range lines {
+			if strings.Contains(strings.ToLower(line), "nvencc") {
+				lines = []string{line}
+				break
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return CommandImport{}, fmt.Errorf("%s: command line is empty", encoder.ErrValidation)
+	}
+
+	tokens, err := encoder.TokenizeCustomOptions(lines[0])
+	if err != nil {
+		return CommandImport{}, fmt.Errorf("%s: %w", encoder.ErrValidation, err)
+	}
+	for i := 0; i < len(tokens) && i < 3; i++ {
+		t := strings.ToLower(tokens[i])
+		if strings.HasSuffix(t, ".exe") || strings.Contains(filepath.Base(t), "nvencc") {
+			tokens = tokens[i+1:]
+			break
+		}
+	}
+	return ImportArgs(tokens)
+}
+
+// ImportArgs maps NVEncC arguments onto a profile; it is the inverse of
+// BuildArgs. Recognized options set Profile and NVEncCAdvanced fields,
+// filter options become filters, everything else is kept in custom_options in its original order, so
+// BuildArgs on the result is equivalent to args. Options BuildArgs always
+// emits but args omits are filled with fallbacks and listed in Defaulted.
+func ImportArgs(args []string) (CommandImport, error) {
+	p := profile.Profile{
+		Version:      profile.CurrentVersion,
+		Name:         "Imported",
+		EncoderType:  "nvencc",
+		EncoderOpts:  map[string]any{},
+		Multipass:    "none",
+		SplitEnc:     "off",
+		Parallel:     "off",
+		Device:       "auto",
+		AudioMode:    "none",
+		AudioBitrate: 256,
+		Colormatrix:  "auto",
+		Transfer:     "auto",
+		Colorprim:    "auto",
+		Colorrange:   "auto",
+		DHDR10Info:   "off",
+	}
+	var res CommandImport
+
+	type customGroup struct {
+		group  string
+		tokens []string
+	}
+	var custom []customGroup
+	dropCustom := func(group string) {
+		kept := custom[:0]
+		for _, c := range custom {
+			if c.group != group {
+				kept = append(kept, c)
+			}
+		}
+		custom = kept
+	}
+
+	for i := 0; i < len(args); i++ {
+		tok := args[i]
+		name := tok
+		if alias, ok := optionAliases[name]; ok {
+			name = alias
+		}
+
+		if name == "-i" || name == "-o" {
+			if i+1 >= len(args) {
+				return CommandImport{}, fmt.Errorf("%s: %s needs a path", encoder.ErrValidation, tok)
+			}
+			i++
+			if name == "-i" {
+				res.InputPath = args[i]
+			} else {
+				res.OutputPath = args[i]
+			}
+			continue
+		}
+
+		if profile.IsFilterOption(name) {
+			value := ""
+			if i+1 < len(args) && !isOption(args[i+1]) {
+				value = args[i+1]
+			}
+			if f, ok := profile.ParseFilter(name, value); ok {
+				if value != "" {
+					i++
+				}
+				// A later filter overrides an earlier one, as in NVEncC.
+				p.Filters = slices.DeleteFunc(p.Filters, func(g profile.Filter) bool { return g.Option() == f.Option() })
+				p.Filters = append(p.Filters, f)
+				dropCustom(name)
+				continue
+			}
+		}
+
+		spec, known := optionSpecs[name]
+		if !known {
+			// Unknown option (or stray value, or a filter value that
+			// cannot be represented): keep it with its values.
+			group := customGroup{group: "-", tokens: []string{tok}}
+			if profile.IsFilterOption(name) {
+				group.group = name
+			}
+			for i+1 < len(args) && !isOption(args[i+1]) {
+				i++
+				group.tokens = append(group.tokens, args[i])
+			}
+			custom = append(custom, group)
+			continue
+		}
+
+		value, hasValue := "", false
+		switch spec.kind {
+		case optValue:
+			if i+1 >= len(args) {
+				return CommandImport{}, fmt.Errorf("%s: %s needs a value", encoder.ErrValidation, tok)
+			}
+			i++
+			value, hasValue = args[i], true
+		case optOptionalValue:
+			if i+1 < len(args) && !isOption(args[i+1]) {
+				i++
+				value, hasValue = args[i], true
+			}
+		}
+
+		group := spec.group
+		if group == "" {
+			group = name
+		}
+		if spec.apply(&p, value, hasValue) {
+			if group != "-" {
+				// A later mapped option overrides earlier verbatim ones.
+				dropCustom(group)
+			}
+			continue
+		}
+		c := customGroup{group: group, tokens: []string{name}}
+		if hasValue {
+			c.tokens = append(c.tokens, value)
+		}
+		custom = append(custom, c)
+	}
+
+	promoteAudio(&p)
+
+	var quoted []string
+	for _, c := range custom {
+		res.Custom = append(res.Custom, strings.Join(c.tokens, " "))
+		for _, t := range c.tokens {
+			quoted = append(quoted, quoteToken(t))
+		}
+	}
+	p.CustomOptions = strings.Join(quoted, " ")
+
+	fill := func(field string, unset bool, set func()) {
+		if unset {
+			set()
+			res.Defaulted = append(res.Defaulted, field)
+		}
+	}
+	fill("decoder", p.Decoder == "", func() { p.Decoder = fallbackDecoder })
+	fill("codec", p.Codec == "", func() { p.Codec = fallbackCodec })
+	fill("rate_control", p.RateControl == "", func() { p.RateControl, p.RateValue = fallbackRateControl, fallbackRateValue })
+	fill("preset", p.Preset == "", func() { p.Preset = fallbackPreset })
+	fill("output_depth", p.OutputDepth == 0, func() { p.OutputDepth = fallbackOutputDepth })
+
+	switch ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(res.OutputPath), ".")); ext {
+	case "mp4", "mkv":
+		p.OutputContainer = ext
+	}
+
+	res.Profile = p
+	return res, nil
+}
+
+// promoteAudio turns a single "--audio-codec aac|opus --audio-bitrate N"
+// pair into the GUI audio settings.
+func promoteAudio(p *profile.Profile) {
+	adv := &p.NVEncCAdvanced
+	if p.AudioMode != "none" || (adv.AudioCodec != "aac" && adv.AudioCodec != "opus") {
+		return
+	}
+	kbps, err := strconv.Atoi(adv.AudioBitrate)
+	if err != nil || kbps < 32 || kbps > 1024 {
+		return
+	}
+	p.AudioMode = adv.AudioCodec
+	p.AudioBitrate = kbps
+	adv.AudioCodec = ""
+	adv.AudioBitrate = ""
+}
+
+// isOption reports whether tok starts a new option rather than being a
+// value. Negative numbers are values.
+func isOption(tok string) bool {
+	if len(tok) < 2 || tok[0] != '-' {
+		return false
+	}
+	c := tok[1]
+	return !(c >= '0' && c <= '9') && c != '.'
+}
+
+// quoteToken quotes tok so TokenizeCustomOptions returns it unchanged.
+func quoteToken(tok string) string {
+	if tok != "" && !strings.ContainsAny(tok, " \t\"'\\") {
+		return tok
+	}
+	if !strings.ContainsAny(tok, " \t\"'") {
+		return tok // backslashes are literal outside quotes
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(tok) + `"`
+}
+
+func setString(field func(*profile.Profile) *string, omitted string) func(*profile.Profile, string, bool) bool {
+	return func(p *profile.Profile, v string, _ bool) bool {
+		// BuildArgs does not emit the omitted value, which is not the same
+		// as passing it explicitly.
+		if v == omitted {
+			return false
+		}
+		*field(p) = v
+		return true
+	}
+}
+
+func setBool(field func(*profile.Profile) *bool) func(*profile.Profile, string, bool) bool {
+	return func(p *profile.Profile, _ string, _ bool) bool {
+		*field(p) = true
+		return true
+	}
+}
+
+func setIntPtr(field func(*profile.Profile) **int) func(*profile.Profile, string, bool) bool {
+	return func(p *profile.Profile, v string, _ bool) bool {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return false
+		}
+		*field(p) = &n
+		return true
+	}
+}
+
+func setRate(mode string) func(*profile.Profile, string, bool) bool {
+	return func(p *profile.Profile, v string, _ bool) bool {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 {
+			return false // e.g. --cqp 20:23:25
+		}
+		p.RateControl, p.RateValue = mode, f
+		return true
+	}
+}
+
+func setDepth(p *profile.Profile, v string, _ bool) bool {
+	if v != "8" && v != "10" {
+		return false
+	}
+	p.OutputDepth, _ = strconv.Atoi(v)
+	return true
+}
+
+func setAdv(field func(*profile.NVEncCAdvanced) *string) func(*profile.Profile, string, bool) bool {
+	return func(p *profile.Profile, v string, _ bool) bool {
+		*field(&p.NVEncCAdvanced) = v
+		return true
+	}
+}
+
+func setAdvInt(field func(*profile.NVEncCAdvanced) **int) func(*profile.Profile, string, bool) bool {
+	return func(p *profile.Profile, v string, _ bool) bool {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return false
+		}
+		*field(&p.NVEncCAdvanced) = &n
+		return true
+	}
+}
+
+func setOnce(dst *string, v string) bool {
+	if *dst != "" {
+		return false
+	}
+	*dst = v
+	return true
+}
+
+func advOnce(field func(*profile.NVEncCAdvanced) *string) func(*profile.Profile, string, bool) bool {
+	return func(p *profile.Profile, v string, _ bool) bool {
+		return setOnce(field(&p.NVEncCAdvanced), v)
+	}
+}
+
+func copyOrAdv(flag func(*profile.Profile) *bool, field func(*profile.NVEncCAdvanced) *string) func(*profile.Profile, string, bool) bool {
+	return func(p *profile.Profile, v string, _ bool) bool {
+		if v == "copy" && !*flag(p) {
+			*flag(p) = true
+			return true
+		}
+		return setOnce(field(&p.NVEncCAdvanced), v)
+	}
+}
+
+func flagOrAdv(flag func(*profile.Profile) *bool, field func(*profile.NVEncCAdvanced) *string) func(*profile.Profile, string, bool) bool {
+	return func(p *profile.Profile, v string, has bool) bool {
+		if !has {
+			*flag(p) = true
+			return true
+		}
+		return setOnce(field(&p.NVEncCAdvanced), v)
+	}
+}
@@ -0,0 +1,177 @@
+package nvencc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yuta/enque/backend/profile"
+)
+
+func intPtr(v int) *int { return &v }
+
+func TestImportArgs_RoundTripsBuildArgs(t *testing.T) {
+	a := &NVEncCAdapter{}
+
+	tuned := defaultProfile()
+	tuned.Codec = "av1"
+	tuned.RateControl = "vbr"
+	tuned.RateValue = 6000.5
+	tuned.Multipass = "2pass-full"
+	tuned.OutputRes = "1920x1080"
+	tuned.Bframes = intPtr(3)
+	tuned.Lookahead = intPtr(32)
+	tuned.Parallel = "2"
+	tuned.Decoder = "avsw"
+	tuned.Device = "1"
+	tuned.AudioMode = "opus"
+	tuned.AudioBitrate = 160
+	tuned.Transfer = "smpte2084"
+	tuned.DHDR10Info = "copy"
+	tuned.SubCopy = false
+	tuned.NVEncCAdvanced = profile.NVEncCAdvanced{
+		AVSWDecoder: "libdav1d",
+		Tune:        "uhq",
+		MaxBitrate:  intPtr(20000),
+		WeightP:     true,
+		Trim:        "0:1000",
+		SubMetadata: "1?language=jpn",
+	}
+	tuned.Filters = []profile.Filter{
+		{Type: profile.FilterCrop, Rect: &profile.FilterRect{Top: 140, Bottom: 140}},
+		{Type: profile.FilterDeinterlace, Method: "afs", Params: map[string]string{"preset": "default"}},
+		{Type: profile.FilterResize, Method: "lanczos3"},
+		{Type: profile.FilterPad, Rect: &profile.FilterRect{Top: 140, Bottom: 140}},
+	}
+	tuned.CustomOptions = `--log "C:\logs\nvencc log.txt"`
+
+	minimal := defaultProfile()
+	minimal.AQ, minimal.AQTemporal = false, false
+	minimal.SplitEnc = "off"
+	minimal.AudioMode = "none"
+	minimal.MetadataCopy, minimal.VideoMetadataCopy, minimal.AudioMetadataCopy = false, false, false
+	minimal.ChapterCopy, minimal.SubCopy, minimal.DataCopy, minimal.AttachmentCopy = false, false, false, false
+
+	for name, p := range map[string]profile.Profile{"default": defaultProfile(), "tuned": tuned, "minimal": minimal} {
+		t.Run(name, func(t *testing.T) {
+			want, err := a.BuildArgs(p, `C:\in put.mp4`, `D:\out.mkv`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			imp, err := ImportArgs(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if imp.InputPath != `C:\in put.mp4` || imp.OutputPath != `D:\out.mkv` {
+				t.Errorf("paths=%q %q", imp.InputPath, imp.OutputPath)
+			}
+			if len(imp.Defaulted) != 0 {
+				t.Errorf("defaulted=%v, want none", imp.Defaulted)
+			}
+			if !reflect.DeepEqual(imp.Profile.Filters, p.Filters) {
+				t.Errorf("filters=%+v, want %+v", imp.Profile.Filters, p.Filters)
+			}
+			got, err := a.BuildArgs(imp.Profile, imp.InputPath, imp.OutputPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("round trip mismatch\n got: %s\nwant: %s", argsString(got), argsString(want))
+			}
+		})
+	}
+}
+
+func TestImportCommandLine_BatchFile(t *testing.T) {
+	bat := "@echo off\r\n" +
+		"rem nightly archive\r\n" +
+		`"C:\Tools\NVEncC\NVEncC64.exe" --avhw -i "E:\rec\show 01.ts" -c hevc --cqp 20:23:25 ^` + "\r\n" +
+		`  --preset quality --output-depth 10 --colormatrix auto --interlace tff --vpp-deinterlace normal ^` + "\r\n" +
+		`  --audio-codec aac --audio-bitrate 192 --audio-metadata 1?language=jpn --audio-metadata 2?language=eng ^` + "\r\n" +
+		`  --sub-copy --chapter-copy --qvbr 30 -o "E:\out\show 01.mp4"` + "\r\n" +
+		"pause\r\n"
+
+	imp, err := ImportCommandLine(bat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := imp.Profile
+	if imp.InputPath != `E:\rec\show 01.ts` || imp.OutputPath != `E:\out\show 01.mp4` {
+		t.Errorf("paths=%q %q", imp.InputPath, imp.OutputPath)
+	}
+	if p.Codec != "hevc" || p.Preset != "quality" || p.OutputDepth != 10 || p.OutputContainer != "mp4" {
+		t.Errorf("basic fields=%+v", p)
+	}
+	// The later --qvbr wins over the unrepresentable --cqp, which is dropped.
+	if p.RateControl != "qvbr" || p.RateValue != 30 {
+		t.Errorf("rate=%s %v, want qvbr 30", p.RateControl, p.RateValue)
+	}
+	if p.AudioMode != "aac" || p.AudioBitrate != 192 || p.NVEncCAdvanced.AudioCodec != "" {
+		t.Errorf("audio=%s %d adv=%q", p.AudioMode, p.AudioBitrate, p.NVEncCAdvanced.AudioCodec)
+	}
+	if !p.SubCopy || !p.ChapterCopy || p.DataCopy || p.NVEncCAdvanced.Interlace != "tff" {
+		t.Errorf("flags=%+v", p)
+	}
+	wantCustom := []string{"--colormatrix auto", "--audio-metadata 2?language=eng"}
+	if !reflect.DeepEqual(imp.Custom, wantCustom) {
+		t.Errorf("custom=%q, want %q", imp.Custom, wantCustom)
+	}
+	if len(p.Filters) != 1 || p.Filters[0].Type != profile.FilterDeinterlace || p.Filters[0].Method != "normal" {
+		t.Errorf("filters=%+v, want the deinterlacer", p.Filters)
+	}
+	if len(imp.Defaulted) != 0 {
+		t.Errorf("defaulted=%v", imp.Defaulted)
+	}
+
+	// Every option of the original command line survives a rebuild.
+	args, err := (&NVEncCAdapter{}).BuildArgs(p, imp.InputPath, imp.OutputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := argsString(args)
+	for _, opt := range []string{
+		"--avhw", "-c hevc", "--qvbr 30", "--preset quality", "--output-depth 10", "--colormatrix auto",
+		"--interlace tff", "--vpp-deinterlace normal", "--audio-codec aac --audio-bitrate 192",
+		"--audio-metadata 1?language=jpn", "--audio-metadata 2?language=eng", "--sub-copy", "--chapter-copy",
+	} {
+		if !strings.Contains(s, opt) {
+			t.Errorf("rebuilt args missing %q: %s", opt, s)
+		}
+	}
+	if strings.Contains(s, "--cqp") {
+		t.Errorf("overridden --cqp kept: %s", s)
+	}
+}
+
+func TestImportArgs_DefaultsAndErrors(t *testing.T) {
+	imp, err := ImportArgs([]string{"-i", "in.mp4", "--vpp-resize", "spline36", "--vpp-pad", "1,2", "-o", "out.avi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDefaulted := []string{"decoder", "codec", "rate_control", "preset", "output_depth"}
+	if !reflect.DeepEqual(imp.Defaulted, wantDefaulted) {
+		t.Errorf("defaulted=%v, want %v", imp.Defaulted, wantDefaulted)
+	}
+	// A filter value that cannot be represented stays a custom option.
+	if imp.Profile.OutputContainer != "" || imp.Profile.CustomOptions != "--vpp-pad 1,2" {
+		t.Errorf("container=%q custom=%q", imp.Profile.OutputContainer, imp.Profile.CustomOptions)
+	}
+	if f := imp.Profile.Filters; len(f) != 1 || f[0].Type != profile.FilterResize || f[0].Method != "spline36" {
+		t.Errorf("filters=%+v, want the resize", f)
+	}
+	if err := profile.Validate(imp.Profile); err != nil {
+		t.Errorf("imported profile must validate: %v", err)
+	}
+
+	for _, args := range [][]string{{"-i"}, {"--preset"}} {
+		if _, err := ImportArgs(args); err == nil {
+			t.Errorf("%v: expected error", args)
+		}
+	}
+	if _, err := ImportCommandLine("rem nothing here\n"); err == nil {
+		t.Error("expected error for empty command line")
+	}
+	if _, err := ImportCommandLine(`nvencc -i "unterminated`); err == nil {
+		t.Error("expected error for unbalanced quote")
+	}
+}
@@ -0,0 +1,238 @@
+package nvencc
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+
+	"github.com/yuta/enque/backend/encoder"
+	"github.com/yuta/enque/backend/profile"
+)
+
+// optionFields maps options generated from the standard GUI settings to
+// the profile field they come from. Other mapped options belong to
+// nvencc_advanced.
+var optionFields = map[string]string{
+	"--avhw": "decoder", "--avsw": "decoder",
+	"-c": "codec", "--preset": "preset", "--output-depth": "output_depth",
+	"--qvbr": "rate_control", "--cqp": "rate_control", "--cbr": "rate_control", "--vbr": "rate_control",
+	"--multipass": "multipass", "--output-res": "output_res",
+	"--bframes": "bframes", "--ref": "ref", "--lookahead": "lookahead", "--gop-len": "gop_len",
+	"--aq": "aq", "--aq-temporal": "aq_temporal",
+	"--split-enc": "split_enc", "--parallel": "parallel", "--device": "device",
+	"--audio-copy": "audio_mode", "--audio-codec": "audio_mode", "--audio-bitrate": "audio_bitrate",
+	"--colormatrix": "colormatrix", "--transfer": "transfer", "--colorprim": "colorprim",
+	"--colorrange": "colorrange", "--dhdr10-info": "dhdr10_info",
+	"--metadata": "metadata_copy", "--video-metadata": "video_metadata_copy", "--audio-metadata": "audio_metadata_copy",
+	"--chapter-copy": "chapter_copy", "--sub-copy": "sub_copy", "--data-copy": "data_copy",
+	"--attachment-copy": "attachment_copy",
+}
+
+// knownOptions lists NVEncC options Enque does not map but accepts in
+// custom options without a warning. All --vpp-* filters are accepted too.
+var knownOptions = map[string]bool{
+	"--avi": true, "--avs": true, "--vpy": true, "--vpy-mt": true, "--raw": true, "--y4m": true,
+	"--input-res": true, "--input-format": true, "--output-format": true, "-f": true,
+	"--fps": true, "--crop": true, "--sar": true, "--dar": true,
+	"--input-analyze": true, "--input-probesize": true, "--avsync": true,
+	"--video-track": true, "--video-streamid": true, "--video-tag": true,
+	"--audio-source": true, "--audio-stream": true, "--audio-filter": true, "--audio-resampler": true,
+	"--audio-delay": true, "--audio-disposition": true, "--audio-ignore-decode-error": true,
+	"--sub-source": true, "--sub-disposition": true, "--caption2ass": true,
+	"--data-source": true, "--attachment-source": true,
+	"--chapter": true, "--chapter-no-trim": true, "--key-on-chapter": true, "--keyfile": true,
+	"--timecode": true, "--tcfile-in": true, "--timebase": true,
+	"--qp-init": true, "--qp-min": true, "--qp-max": true, "--chroma-qp-offset": true,
+	"--aq-strength": true, "--strict-gop": true, "--no-i-adapt": true, "--no-b-adapt": true,
+	"--nonrefp": true, "--bref-mode": true, "--direct": true, "--adapt-transform": true,
+	"--slices": true, "--cabac": true, "--cavlc": true, "--bluray": true, "--lossless": true,
+	"--repeat-headers": true, "--pic-struct": true, "--aud": true,
+	"--temporal-layers": true, "--temporal-filter": true, "--tf-level": true,
+	"--cu-max": true, "--cu-min": true, "--part-size-min": true, "--part-size-max": true,
+	"--max-cll": true, "--master-display": true, "--atc-sei": true,
+	"--dolby-vision-rpu": true, "--dolby-vision-profile": true,
+	"--lowlatency": true, "--max-procfps": true, "--cuda-schedule": true, "--disable-nvml": true,
+	"--thread-affinity": true, "--thread-priority": true, "--output-buf": true, "--input-thread": true,
+	"--log": true, "--log-level": true, "--log-framelist": true,
+	"--perf-monitor": true, "--perf-monitor-interval": true,
+	"--ssim-mode": true, "--vmaf": true, "--mux-option": true, "-m": true,
+}
+
+// argOption is one option and its values from an argument list.
+type argOption struct {
+	name   string // canonical name (aliases resolved)
+	values []string
+}
+
+func (o argOption) String() string {
+	return strings.Join(append([]string{o.name}, o.values...), " ")
+}
+
+func (o argOption) value() string {
+	return strings.Join(o.values, " ")
+}
+
+// splitOptions groups args into options with their values, using the
+// arities of the mapped options. Unknown options take every following
+// non-option token.
+func splitOptions(args []string) []argOption {
+	var out []argOption
+	for i := 0; i < len(args); i++ {
+		name := args[i]
+		if alias, ok := optionAliases[name]; ok {
+			name = alias
+		}
+		o := argOption{name: name}
+		spec, known := optionSpecs[name]
+		switch {
+		case name == "-i" || name == "-o" || (known && spec.kind == optValue):
+			if i+1 < len(args) {
+				i++
+				o.values = append(o.values, args[i])
+			}
+		case known && spec.kind == optFlag:
+		default:
+			for i+1 < len(args) && !isOption(args[i+1]) {
+				i++
+				o.values = append(o.values, args[i])
+			}
+		}
+		out = append(out, o)
+	}
+	return out
+}
+
+// LintProfile checks the profile's custom options against the options
+// BuildArgs generates from the GUI settings. Because custom options come
+// last and NVEncC applies the last occurrence, they silently win.
+func (a *NVEncCAdapter) LintProfile(p profile.Profile) []encoder.LintWarning {
+	if strings.TrimSpace(p.CustomOptions) == "" {
+		return nil
+	}
+	tokens, err := encoder.TokenizeCustomOptions(p.CustomOptions)
+	if err != nil {
+		return []encoder.LintWarning{{Code: encoder.LintSyntax, Option: p.CustomOptions, Message: "custom options: " + err.Error()}}
+	}
+
+	gui := p
+	gui.CustomOptions = ""
+	if gui.RateControl == encoder.RateControlTargetSize {
+		// The bitrates depend on the input; every plan emits the same options.
+		gui = encoder.TargetSizePlan{Mode: cmp.Or(gui.TargetSizeMode, "vbr"), VideoKbps: 1, MaxKbps: 1}.Apply(gui)
+	}
+	guiArgs, err := a.BuildArgs(gui, "input", "output")
+	if err != nil {
+		return nil
+	}
+	generated := make(map[string][]argOption)
+	for _, o := range splitOptions(guiArgs) {
+		generated[o.name] = append(generated[o.name], o)
+		if group := optionSpecs[o.name].group; group == "rate" || group == "decoder" {
+			generated[group] = append(generated[group], o)
+		}
+	}
+
+	var warnings []encoder.LintWarning
+	add := func(code string, o argOption, format string, args ...any) {
+		warnings = append(warnings, encoder.LintWarning{
+			Code:    code,
+			Option:  o.String(),
+			Field:   fieldOf(o.name),
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	for _, o := range splitOptions(tokens) {
+		spec, mapped := optionSpecs[o.name]
+		switch {
+		case o.name == "-i" || o.name == "-o":
+			add(encoder.LintInputOut, o, "%s in custom options: input and output paths are set by the queue", o.name)
+			continue
+		case !mapped:
+			if prev := generated[o.name]; len(prev) > 0 && profile.IsFilterOption(o.name) {
+				add(encoder.LintOverride, o, "%s overrides %s from the profile's filters", o, prev[len(prev)-1])
+				continue
+			}
+			if !knownOptions[o.name] && !strings.HasPrefix(o.name, "--vpp-") {
+				if isOption(o.name) {
+					add(encoder.LintUnknown, o, "%s is not a known NVEncC option", o.name)
+				} else {
+					add(encoder.LintUnknown, o, "%q is not an option", o.name)
+				}
+			}
+			continue
+		}
+
+		same := generated[o.name]
+		switch {
+		case spec.group == "rate" || spec.group == "decoder":
+			prev := generated[spec.group]
+			if len(prev) == 0 {
+				add(encoder.LintOverride, o, "%s overrides the GUI setting", o)
+			} else if last := prev[len(prev)-1]; last.name != o.name {
+				add(encoder.LintConflict, o, "%s conflicts with %s generated from the GUI settings", o, last)
+			} else if last.value() == o.value() {
+				add(encoder.LintDuplicate, o, "%s duplicates a GUI option", o)
+			} else {
+				add(encoder.LintOverride, o, "%s overrides %s from the GUI settings", o, last)
+			}
+		case o.name == "-c":
+			if len(same) > 0 && same[0].value() == o.value() {
+				add(encoder.LintDuplicate, o, "%s duplicates a GUI option", o)
+			} else {
+				add(encoder.LintConflict, o, "%s conflicts with the GUI codec %s", o, p.Codec)
+			}
+		case spec.group == "-":
+			// Repeatable per track: only identical copies and audio mode
+			// contradictions are reported.
+			if conflict := audioConflict(p, o); conflict != "" {
+				add(encoder.LintConflict, o, "%s conflicts with the GUI audio setting %q", o, conflict)
+				continue
+			}
+			for _, g := range same {
+				if g.value() == o.value() {
+					add(encoder.LintDuplicate, o, "%s duplicates a GUI option", o)
+					break
+				}
+			}
+		case len(same) == 0:
+			add(encoder.LintOverride, o, "%s overrides a GUI setting that is not set", o)
+		case same[len(same)-1].value() == o.value():
+			add(encoder.LintDuplicate, o, "%s duplicates a GUI option", o)
+		default:
+			add(encoder.LintOverride, o, "%s overrides %s from the GUI settings", o, same[len(same)-1])
+		}
+	}
+	return warnings
+}
+
+// audioConflict returns the GUI audio mode when o selects a different
+// handling for all audio tracks.
+func audioConflict(p profile.Profile, o argOption) string {
+	if strings.Contains(o.value(), "?") {
+		return "" // track specific
+	}
+	switch {
+	case o.name == "--audio-copy" && len(o.values) == 0 && (p.AudioMode == "aac" || p.AudioMode == "opus"):
+		return p.AudioMode
+	case o.name == "--audio-codec" && p.AudioMode == "copy":
+		return p.AudioMode
+	case o.name == "--audio-codec" && (p.AudioMode == "aac" || p.AudioMode == "opus") && o.value() != p.AudioMode:
+		return p.AudioMode
+	}
+	return ""
+}
+
+// fieldOf returns the profile field an option is generated from.
+func fieldOf(name string) string {
+	if f, ok := optionFields[name]; ok {
+		return f
+	}
+	if profile.IsFilterOption(name) {
+		return "filters"
+	}
+	if _, ok := optionSpecs[name]; ok {
+		return "nvencc_advanced." + strings.ReplaceAll(strings.TrimPrefix(name, "--"), "-", "_")
+	}
+	return ""
+}
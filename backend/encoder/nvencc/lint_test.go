@@ -0,0 +1,71 @@
+package nvencc
+
+import (
+	"testing"
+
+	"github.com/yuta/enque/backend/encoder"
+	"github.com/yuta/enque/backend/profile"
+)
+
+func TestLintProfile_CustomOptions(t *testing.T) {
+	a := &NVEncCAdapter{}
+	p := defaultProfile()
+	p.CustomOptions = `--cqp 20 -c av1 --preset P4 --preset P7 --device 1 --aq --audio-codec aac ` +
+		`--audio-metadata 2?language=eng --vpp-resize lanczos --frobnicate 3 -o "D:\x.mkv" --sub-copy`
+
+	type want struct{ code, option, field string }
+	wants := []want{
+		{encoder.LintConflict, "--cqp 20", "rate_control"},
+		{encoder.LintConflict, "-c av1", "codec"},
+		{encoder.LintDuplicate, "--preset P4", "preset"},
+		{encoder.LintOverride, "--preset P7", "preset"},
+		{encoder.LintOverride, "--device 1", "device"},
+		{encoder.LintDuplicate, "--aq", "aq"},
+		{encoder.LintConflict, "--audio-codec aac", "audio_mode"},
+		{encoder.LintUnknown, "--frobnicate 3", ""},
+		{encoder.LintInputOut, `-o D:\x.mkv`, ""},
+		{encoder.LintDuplicate, "--sub-copy", "sub_copy"},
+	}
+
+	got := a.LintProfile(p)
+	if len(got) != len(wants) {
+		for _, w := range got {
+			t.Logf("%+v", w)
+		}
+		t.Fatalf("got %d warnings, want %d", len(got), len(wants))
+	}
+	for i, w := range wants {
+		g := got[i]
+		if g.Code != w.code || g.Option != w.option || g.Field != w.field || g.Message == "" {
+			t.Errorf("warning %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestLintProfile_CleanAndBroken(t *testing.T) {
+	a := &NVEncCAdapter{}
+	p := defaultProfile()
+	if got := a.LintProfile(p); len(got) != 0 {
+		t.Errorf("no custom options: %+v", got)
+	}
+
+	p.CustomOptions = "--vpp-deband --log enc.log --max-bitrate 20000 --audio-copy 1?aac"
+	p.AudioMode = "copy"
+	// Known options, an advanced setting the GUI leaves unset and a
+	// track-specific audio option: only the advanced override is reported.
+	got := a.LintProfile(p)
+	if len(got) != 1 || got[0].Code != encoder.LintOverride || got[0].Field != "nvencc_advanced.max_bitrate" {
+		t.Errorf("warnings=%+v, want one override of max_bitrate", got)
+	}
+
+	p.Filters = []profile.Filter{{Type: profile.FilterDenoise, Method: "knn"}}
+	p.CustomOptions = "--vpp-knn radius=4"
+	if got = a.LintProfile(p); len(got) != 1 || got[0].Code != encoder.LintOverride || got[0].Field != "filters" {
+		t.Errorf("warnings=%+v, want the filter override reported", got)
+	}
+
+	p.CustomOptions = `--log "unterminated`
+	if got = encoder.LintProfile(a, p); len(got) != 1 || got[0].Code != encoder.LintSyntax {
+		t.Errorf("unbalanced quote: %+v", got)
+	}
+}
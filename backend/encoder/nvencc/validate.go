@@ -0,0 +1,196 @@
+package nvencc
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/yuta/enque/backend/encoder"
+	"github.com/yuta/enque/backend/profile"
+)
+
+// codecLimits holds the NVENC limits that differ per codec.
+type codecLimits struct {
+	maxQP    float64 // --cqp and --qvbr
+	tiers    []string
+	profiles []string
+	tenBit   bool
+}
+
+var nvencCodecs = map[string]codecLimits{
+	"h264": {maxQP: 51, profiles: []string{"baseline", "main", "high", "high444"}},
+	"hevc": {maxQP: 51, tiers: []string{"main", "high"}, profiles: []string{"main", "main10", "main444"}, tenBit: true},
+	"av1":  {maxQP: 255, tiers: []string{"0", "1"}, profiles: []string{"main", "high"}, tenBit: true},
+}
+
+// CheckProfile applies the NVENC rules that depend on the codec and on
+// combinations of fields. Errors describe settings NVEncC rejects or
+// cannot honor; warnings describe settings that are ignored or produce
+// files some players cannot handle.
+func (a *NVEncCAdapter) CheckProfile(p profile.Profile) []profile.FieldIssue {
+	var issues []profile.FieldIssue
+	errorf := func(field, format string, args ...any) {
+		issues = append(issues, profile.FieldIssue{Field: field, Severity: profile.SeverityError, Message: fmt.Sprintf(format, args...)})
+	}
+	warnf := func(field, format string, args ...any) {
+		issues = append(issues, profile.FieldIssue{Field: field, Severity: profile.SeverityWarning, Message: fmt.Sprintf(format, args...)})
+	}
+	adv := p.NVEncCAdvanced
+
+	codec, ok := nvencCodecs[p.Codec]
+	if !ok {
+		errorf("codec", "must be h264, hevc or av1")
+		return issues
+	}
+	name := strings.ToUpper(p.Codec)
+	if p.Codec == "h264" {
+		name = "H.264"
+	}
+
+	// Rate control
+	switch p.RateControl {
+	case "cqp", "qvbr":
+		if p.RateValue > codec.maxQP {
+			errorf("rate_value", "%s %s must be 0..%g", name, p.RateControl, codec.maxQP)
+		}
+		if p.RateControl == "cqp" && p.RateValue != math.Trunc(p.RateValue) {
+			errorf("rate_value", "cqp must be an integer")
+		}
+	case "cbr", "vbr":
+	case encoder.RateControlTargetSize:
+		if p.TargetSizeMode != "" && p.TargetSizeMode != "vbr" && p.TargetSizeMode != "cbr" {
+			errorf("target_size_mode", "must be vbr or cbr")
+		}
+		if p.Multipass == "" || p.Multipass == "none" {
+			warnf("multipass", "two-pass encoding hits the target size more reliably")
+		}
+	default:
+		errorf("rate_control", "must be qvbr, cqp, cbr, vbr or target_size")
+	}
+	if p.RateControl == "cqp" {
+		if p.Multipass != "" && p.Multipass != "none" {
+			warnf("multipass", "has no effect with cqp")
+		}
+		if adv.MaxBitrate != nil {
+			warnf("nvencc_advanced.max_bitrate", "has no effect with cqp")
+		}
+	}
+	if adv.VBRQuality != nil && p.RateControl != "vbr" {
+		warnf("nvencc_advanced.vbr_quality", "is only used with vbr")
+	}
+
+	// Bit depth and codec features
+	if p.OutputDepth == 10 && !codec.tenBit {
+		errorf("output_depth", "NVENC %s supports 8-bit output only", name)
+	}
+	if p.Bframes != nil && *p.Bframes > 0 {
+		if p.Codec == "hevc" {
+			warnf("bframes", "HEVC B-frames need a Turing (RTX 20) or newer GPU")
+		}
+		if adv.WeightP {
+			warnf("nvencc_advanced.weightp", "weighted prediction is not used with B-frames")
+		}
+	}
+	if p.Codec != "av1" {
+		if adv.RefsForward != nil {
+			errorf("nvencc_advanced.refs_forward", "is only available for AV1")
+		}
+		if adv.RefsBackward != nil {
+			errorf("nvencc_advanced.refs_backward", "is only available for AV1")
+		}
+	}
+	if p.Codec == "h264" && p.SplitEnc != "" && p.SplitEnc != "off" && p.SplitEnc != "auto" {
+		warnf("split_enc", "split frame encoding is only available for HEVC and AV1")
+	}
+
+	// Tier and profile
+	if adv.Tier != "" {
+		if codec.tiers == nil {
+			errorf("nvencc_advanced.tier", "is not available for %s", name)
+		} else if !contains(codec.tiers, adv.Tier) {
+			errorf("nvencc_advanced.tier", "%s tier must be %s", name, strings.Join(codec.tiers, " or "))
+		}
+	}
+	if adv.Profile != "" {
+		if !contains(codec.profiles, adv.Profile) {
+			errorf("nvencc_advanced.profile", "%s profile must be one of %s", name, strings.Join(codec.profiles, ", "))
+		} else if p.Codec == "hevc" && adv.Profile == "main" && p.OutputDepth == 10 {
+			errorf("nvencc_advanced.profile", "HEVC main is 8-bit; use main10 for 10-bit output")
+		}
+	}
+
+	// HDR
+	if p.DHDR10Info == "copy" && p.Codec == "h264" {
+		errorf("dhdr10_info", "HDR10+ metadata is only available for HEVC and AV1")
+	}
+	if (p.Transfer == "smpte2084" || p.Transfer == "arib-std-b67") && p.OutputDepth == 8 {
+		warnf("output_depth", "HDR transfer %s with 8-bit output causes banding", p.Transfer)
+	}
+	switch {
+	case p.HDRMode == "enforce" && p.Codec == "h264":
+		warnf("hdr_mode", "HDR inputs are encoded as 10-bit HEVC instead of H.264")
+	case p.HDRMode == "tonemap" && p.Codec != "h264" && p.OutputDepth == 10:
+		warnf("hdr_mode", "a 10-bit %s target keeps HDR inputs HDR; tonemap applies to 8-bit targets", name)
+	}
+
+	// Filters
+	for i, f := range p.Filters {
+		field := fmt.Sprintf("filters[%d]", i)
+		switch {
+		case f.Disabled:
+		case f.Option() == "--vpp-deinterlace" && p.Decoder != "avhw":
+			errorf(field, "deinterlace %s needs the avhw decoder; use afs, nnedi or yadif with avsw", f.Method)
+		case f.Type == profile.FilterCrop && (p.AutoCrop == "apply" || p.AutoCrop == "confirm"):
+			warnf(field, "auto_crop replaces this crop with the detected one")
+		case f.Type == profile.FilterResize && p.OutputRes == "":
+			warnf(field, "resize has no effect without output_res")
+		case f.Option() == "--vpp-deinterlace" && adv.Interlace == "":
+			warnf(field, "deinterlace %s needs nvencc_advanced.interlace (tff or bff)", f.Method)
+		}
+	}
+
+	// Container
+	if p.OutputContainer == "mp4" && p.AudioMode == "opus" {
+		warnf("audio_mode", "Opus in MP4 is not supported by older players; use AAC or mkv")
+	}
+
+	// Loudness
+	if p.Loudness != nil {
+		transcodes := func(codec string) bool {
+			if codec == "" {
+				codec = p.AudioMode
+			}
+			return codec == "aac" || codec == "opus"
+		}
+		if t := p.Tracks; !transcodes("") && (t == nil || !transcodes(t.FirstAudio) && !transcodes(t.OtherAudio)) {
+			warnf("loudness", "copied audio cannot be normalized; use aac or opus")
+		}
+	}
+
+	// Track rules
+	if t := p.Tracks; t != nil {
+		if p.OutputContainer == "mp4" && (t.FirstAudio == "opus" || t.OtherAudio == "opus") {
+			warnf("tracks", "Opus in MP4 is not supported by older players; use AAC or mkv")
+		}
+		if !p.SubCopy && (len(t.SubLanguages) > 0 || t.DefaultSub != "" || t.ForcedSub != "") {
+			warnf("tracks", "subtitle rules have no effect without sub_copy")
+		}
+	}
+
+	// Chunks
+	if p.Chunks != nil {
+		if reason := encoder.ChunksUnsupported(p); reason != "" {
+			warnf("chunks", "inputs are encoded whole: chunked encoding does not support %s", reason)
+		}
+	}
+	return issues
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
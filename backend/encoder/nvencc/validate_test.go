@@ -0,0 +1,129 @@
+package nvencc
+
+import (
+	"testing"
+
+	"github.com/yuta/enque/backend/profile"
+)
+
+func TestCheckProfile(t *testing.T) {
+	a := &NVEncCAdapter{}
+
+	tests := []struct {
+		name     string
+		modify   func(p *profile.Profile)
+		field    string // "" means no issues
+		severity string
+	}{
+		{"default profile is clean", func(p *profile.Profile) {}, "", ""},
+		{"unknown codec", func(p *profile.Profile) { p.Codec = "vp9" }, "codec", profile.SeverityError},
+		{"unknown rate control", func(p *profile.Profile) { p.RateControl = "crf" }, "rate_control", profile.SeverityError},
+		{"h264 10-bit", func(p *profile.Profile) { p.Codec = "h264" }, "output_depth", profile.SeverityError},
+		{"h264 8-bit", func(p *profile.Profile) { p.Codec, p.OutputDepth = "h264", 8 }, "", ""},
+		{"hevc cqp above 51", func(p *profile.Profile) { p.RateControl, p.RateValue = "cqp", 60 }, "rate_value", profile.SeverityError},
+		{"av1 cqp 60", func(p *profile.Profile) { p.Codec, p.RateControl, p.RateValue = "av1", "cqp", 60 }, "", ""},
+		{"av1 cqp above 255", func(p *profile.Profile) { p.Codec, p.RateControl, p.RateValue = "av1", "cqp", 300 }, "rate_value", profile.SeverityError},
+		{"fractional cqp", func(p *profile.Profile) { p.RateControl, p.RateValue = "cqp", 20.5 }, "rate_value", profile.SeverityError},
+		{"fractional qvbr", func(p *profile.Profile) { p.RateValue = 27.5 }, "", ""},
+		{"vbr bitrate above qp range", func(p *profile.Profile) { p.RateControl, p.RateValue = "vbr", 8000 }, "", ""},
+		{"target size", func(p *profile.Profile) { p.RateControl, p.RateValue, p.Multipass = "target_size", 500, "2pass-full" }, "", ""},
+		{"target size single pass", func(p *profile.Profile) { p.RateControl, p.RateValue, p.Multipass = "target_size", 500, "none" }, "multipass", profile.SeverityWarning},
+		{"target size bad mode", func(p *profile.Profile) {
+			p.RateControl, p.RateValue, p.Multipass, p.TargetSizeMode = "target_size", 500, "2pass-full", "qvbr"
+		}, "target_size_mode", profile.SeverityError},
+		{"multipass with cqp", func(p *profile.Profile) { p.RateControl, p.RateValue, p.Multipass = "cqp", 24, "2pass-full" }, "multipass", profile.SeverityWarning},
+		{"max bitrate with cqp", func(p *profile.Profile) {
+			p.RateControl, p.RateValue = "cqp", 24
+			p.NVEncCAdvanced.MaxBitrate = intPtr(9000)
+		}, "nvencc_advanced.max_bitrate", profile.SeverityWarning},
+		{"vbr quality without vbr", func(p *profile.Profile) { p.NVEncCAdvanced.VBRQuality = intPtr(25) }, "nvencc_advanced.vbr_quality", profile.SeverityWarning},
+		{"hevc b-frames", func(p *profile.Profile) { p.Bframes = intPtr(3) }, "bframes", profile.SeverityWarning},
+		{"av1 b-frames", func(p *profile.Profile) { p.Codec, p.Bframes = "av1", intPtr(3) }, "", ""},
+		{"weightp with b-frames", func(p *profile.Profile) {
+			p.Codec, p.Bframes = "av1", intPtr(2)
+			p.NVEncCAdvanced.WeightP = true
+		}, "nvencc_advanced.weightp", profile.SeverityWarning},
+		{"refs-forward on hevc", func(p *profile.Profile) { p.NVEncCAdvanced.RefsForward = intPtr(2) }, "nvencc_advanced.refs_forward", profile.SeverityError},
+		{"refs-backward on av1", func(p *profile.Profile) { p.Codec = "av1"; p.NVEncCAdvanced.RefsBackward = intPtr(2) }, "", ""},
+		{"split-enc on h264", func(p *profile.Profile) { p.Codec, p.OutputDepth, p.SplitEnc = "h264", 8, "forced_2" }, "split_enc", profile.SeverityWarning},
+		{"tier on h264", func(p *profile.Profile) { p.Codec, p.OutputDepth = "h264", 8; p.NVEncCAdvanced.Tier = "high" }, "nvencc_advanced.tier", profile.SeverityError},
+		{"hevc high tier", func(p *profile.Profile) { p.NVEncCAdvanced.Tier = "high" }, "", ""},
+		{"av1 tier name", func(p *profile.Profile) { p.Codec = "av1"; p.NVEncCAdvanced.Tier = "high" }, "nvencc_advanced.tier", profile.SeverityError},
+		{"h264 profile on hevc", func(p *profile.Profile) { p.NVEncCAdvanced.Profile = "high" }, "nvencc_advanced.profile", profile.SeverityError},
+		{"hevc main at 10-bit", func(p *profile.Profile) { p.NVEncCAdvanced.Profile = "main" }, "nvencc_advanced.profile", profile.SeverityError},
+		{"hevc main10", func(p *profile.Profile) { p.NVEncCAdvanced.Profile = "main10" }, "", ""},
+		{"hdr10+ on h264", func(p *profile.Profile) { p.Codec, p.OutputDepth, p.DHDR10Info = "h264", 8, "copy" }, "dhdr10_info", profile.SeverityError},
+		{"pq at 8-bit", func(p *profile.Profile) { p.OutputDepth, p.Transfer = 8, "smpte2084" }, "output_depth", profile.SeverityWarning},
+		{"hdr enforce on h264", func(p *profile.Profile) { p.Codec, p.OutputDepth, p.HDRMode = "h264", 8, "enforce" }, "hdr_mode", profile.SeverityWarning},
+		{"hdr tonemap at 8-bit", func(p *profile.Profile) { p.OutputDepth, p.HDRMode = 8, "tonemap" }, "", ""},
+		{"hdr tonemap at 10-bit", func(p *profile.Profile) { p.HDRMode = "tonemap" }, "hdr_mode", profile.SeverityWarning},
+		{"opus in mp4", func(p *profile.Profile) { p.OutputContainer, p.AudioMode = "mp4", "opus" }, "audio_mode", profile.SeverityWarning},
+		{"opus in mkv", func(p *profile.Profile) { p.OutputContainer, p.AudioMode = "mkv", "opus" }, "", ""},
+		{"loudness with copied audio", func(p *profile.Profile) {
+			p.AudioMode, p.Loudness = "copy", &profile.Loudness{TargetLUFS: -23, TruePeak: -1}
+		}, "loudness", profile.SeverityWarning},
+		{"loudness with transcoded tracks", func(p *profile.Profile) {
+			p.AudioMode, p.Loudness = "copy", &profile.Loudness{TargetLUFS: -23, TruePeak: -1}
+			p.Tracks = &profile.TrackRules{OtherAudio: "aac"}
+		}, "", ""},
+		{"track opus in mp4", func(p *profile.Profile) {
+			p.OutputContainer, p.Tracks = "mp4", &profile.TrackRules{OtherAudio: "opus"}
+		}, "tracks", profile.SeverityWarning},
+		{"subtitle rules without sub copy", func(p *profile.Profile) {
+			p.SubCopy, p.Tracks = false, &profile.TrackRules{SubLanguages: []string{"jpn"}}
+		}, "tracks", profile.SeverityWarning},
+		{"chunks", func(p *profile.Profile) { p.Chunks = &profile.ChunkSettings{} }, "", ""},
+		{"chunks with loudness", func(p *profile.Profile) {
+			p.AudioMode, p.Loudness = "aac", &profile.Loudness{TargetLUFS: -23, TruePeak: -1}
+			p.Chunks = &profile.ChunkSettings{}
+		}, "chunks", profile.SeverityWarning},
+		{"chunks with trim", func(p *profile.Profile) {
+			p.Chunks, p.NVEncCAdvanced.Trim = &profile.ChunkSettings{}, "0:1000"
+		}, "chunks", profile.SeverityWarning},
+		{"resize with output res", func(p *profile.Profile) {
+			p.OutputRes = "1280x720"
+			p.Filters = []profile.Filter{{Type: profile.FilterResize, Method: "lanczos3"}}
+		}, "", ""},
+		{"resize without output res", func(p *profile.Profile) {
+			p.Filters = []profile.Filter{{Type: profile.FilterResize, Method: "lanczos3"}}
+		}, "filters[0]", profile.SeverityWarning},
+		{"hardware deinterlace with avsw", func(p *profile.Profile) {
+			p.Decoder = "avsw"
+			p.NVEncCAdvanced.Interlace = "tff"
+			p.Filters = []profile.Filter{{Type: profile.FilterDeinterlace, Method: "adaptive"}}
+		}, "filters[0]", profile.SeverityError},
+		{"hardware deinterlace without interlace", func(p *profile.Profile) {
+			p.Filters = []profile.Filter{{Type: profile.FilterDeinterlace, Method: "normal"}}
+		}, "filters[0]", profile.SeverityWarning},
+		{"yadif with avsw", func(p *profile.Profile) {
+			p.Decoder = "avsw"
+			p.Filters = []profile.Filter{{Type: profile.FilterDeinterlace, Method: "yadif"}}
+		}, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := defaultProfile()
+			tt.modify(&p)
+			issues := a.CheckProfile(p)
+			if tt.field == "" {
+				if len(issues) != 0 {
+					t.Errorf("issues=%+v, want none", issues)
+				}
+				return
+			}
+			if len(issues) != 1 || issues[0].Field != tt.field || issues[0].Severity != tt.severity || issues[0].Message == "" {
+				t.Errorf("issues=%+v, want one %s on %s", issues, tt.severity, tt.field)
+			}
+		})
+	}
+}
+
+func TestCheckProfile_PresetsAreClean(t *testing.T) {
+	a := &NVEncCAdapter{}
+	for _, p := range profile.GeneratePresets() {
+		if issues := a.CheckProfile(p); len(issues) != 0 {
+			t.Errorf("preset %q: %+v", p.Name, issues)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package encoder
+
+import (
+	"fmt"
+
+	"github.com/yuta/enque/backend/probe"
+	"github.com/yuta/enque/backend/profile"
+)
+
+// RateControlTargetSize is the rate control whose rate_value is an output
+// size in MB. It is turned into VBR or CBR per input with PlanTargetSize.
+const RateControlTargetSize = "target_size"
+
+const (
+	// minTargetVideoKbps is the lowest video bitrate a target size may
+	// leave; below it the result is unwatchable.
+	minTargetVideoKbps = 100
+	// unknownAudioKbps is assumed for a copied audio stream whose bitrate
+	// the input does not state.
+	unknownAudioKbps = 192
+)
+
+// containerOverhead is the share of the output taken by muxing.
+var containerOverhead = map[string]float64{"mp4": 0.01, "mkv": 0.005}
+
+// TargetSizePlan is the bitrate budget for encoding one input to a target
+// output size.
+type TargetSizePlan struct {
+	Mode         string  `json:"mode"` // "vbr" or "cbr"
+	TargetBytes  int64   `json:"target_bytes"`
+	DurationSec  float64 `json:"duration_sec"`
+	AudioKbps    float64 `json:"audio_kbps"`
+	OverheadKbps float64 `json:"overhead_kbps"`
+	VideoKbps    int     `json:"video_kbps"`
+	MaxKbps      int     `json:"max_kbps"`
+	// Notes lists the estimates the plan relies on.
+	Notes []string `json:"notes,omitempty"`
+}
+
+// PlanTargetSize computes the video bitrate that makes the output of a
+// target_size profile fit its size: the total bitrate for the input's
+// duration, less the audio and the container overhead.
+func PlanTargetSize(p profile.Profile, media probe.MediaInfo) (TargetSizePlan, error) {
+	plan := TargetSizePlan{
+		Mode:        p.TargetSizeMode,
+		TargetBytes: int64(p.RateValue * 1024 * 1024),
+		DurationSec: media.DurationSec,
+	}
+	if plan.Mode == "" {
+		plan.Mode = "vbr"
+	}
+	if plan.Mode != "vbr" && plan.Mode != "cbr" {
+		return plan, fmt.Errorf("%s: target_size_mode must be vbr or cbr", ErrValidation)
+	}
+	if plan.TargetBytes <= 0 {
+		return plan, fmt.Errorf("%s: target size must be > 0 MB", ErrValidation)
+	}
+	if plan.DurationSec <= 0 {
+		return plan, fmt.Errorf("%s: target size needs the input duration, which is unknown", ErrValidation)
+	}
+
+	// Each output audio track with its codec: every input track with
+	// audio_mode, or the tracks of the job's track map.
+	type audioTrack struct {
+		stream probe.Stream
+		codec  string
+	}
+	var audio []audioTrack
+	for _, s := range media.Streams {
+		if s.Type != "audio" {
+			continue
+		}
+		if p.TrackMap == nil {
+			audio = append(audio, audioTrack{s, p.AudioMode})
+			continue
+		}
+		for _, t := range p.TrackMap.Audio {
+			if t.Stream == s.Index {
+				audio = append(audio, audioTrack{s, t.Codec})
+			}
+		}
+	}
+	for _, a := range audio {
+		switch {
+		case a.codec == "aac" || a.codec == "opus":
+			plan.AudioKbps += float64(p.AudioBitrate)
+		case a.codec != "copy":
+		case a.stream.BitrateKbps > 0:
+			plan.AudioKbps += a.stream.BitrateKbps
+		default:
+			plan.AudioKbps += unknownAudioKbps
+			plan.Notes = append(plan.Notes, fmt.Sprintf("audio stream %d bitrate unknown; assumed %d kbps", a.stream.Index, unknownAudioKbps))
+		}
+	}
+
+	totalKbps := float64(plan.TargetBytes) * 8 / 1000 / plan.DurationSec
+	overhead, ok := containerOverhead[p.OutputContainer]
+	if !ok {
+		overhead = containerOverhead["mp4"]
+	}
+	plan.OverheadKbps = totalKbps * overhead
+	video := int(totalKbps - plan.OverheadKbps - plan.AudioKbps)
+	if video < minTargetVideoKbps {
+		return plan, fmt.Errorf("%s: %g MB is too small for %.0f s of video with %.0f kbps audio (%d kbps left for video)",
+			ErrValidation, p.RateValue, plan.DurationSec, plan.AudioKbps, video)
+	}
+	plan.VideoKbps = video
+
+	plan.MaxKbps = video
+	if plan.Mode == "vbr" {
+		plan.MaxKbps = video * 3 / 2
+		if m := p.NVEncCAdvanced.MaxBitrate; m != nil && *m >= video && *m < plan.MaxKbps {
+			plan.MaxKbps = *m
+		}
+	}
+	return plan, nil
+}
+
+// Apply returns p with its target size replaced by the planned bitrates.
+func (plan TargetSizePlan) Apply(p profile.Profile) profile.Profile {
+	p.RateControl = plan.Mode
+	p.RateValue = float64(plan.VideoKbps)
+	maxKbps := plan.MaxKbps
+	p.NVEncCAdvanced.MaxBitrate = &maxKbps
+	return p
+}
+
+// Hit reports whether an output of the given size meets the target.
+func (plan TargetSizePlan) Hit(outputBytes int64) bool {
+	return outputBytes > 0 && outputBytes <= plan.TargetBytes
+}
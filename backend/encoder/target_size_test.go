@@ -0,0 +1,85 @@
+package encoder
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yuta/enque/backend/probe"
+	"github.com/yuta/enque/backend/profile"
+)
+
+func targetProfile(mb float64) profile.Profile {
+	return profile.Profile{RateControl: RateControlTargetSize, RateValue: mb, AudioMode: "aac", AudioBitrate: 192, OutputContainer: "mkv"}
+}
+
+func TestPlanTargetSize(t *testing.T) {
+	// 100 MiB over 10 minutes is 1398.1 kbps in total.
+	media := probe.MediaInfo{DurationSec: 600, Streams: []probe.Stream{
+		{Index: 0, Type: "video"},
+		{Index: 1, Type: "audio", BitrateKbps: 128},
+		{Index: 2, Type: "audio"},
+	}}
+
+	plan, err := PlanTargetSize(targetProfile(100), media)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Two aac tracks at 192 kbps and 0.5% mkv overhead.
+	if plan.Mode != "vbr" || plan.AudioKbps != 384 || plan.VideoKbps != 1007 || plan.MaxKbps != 1510 {
+		t.Errorf("plan=%+v", plan)
+	}
+
+	p := targetProfile(100)
+	p.AudioMode, p.TargetSizeMode, p.OutputContainer = "copy", "cbr", "mp4"
+	plan, err = PlanTargetSize(p, media)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Copied tracks: 128 kbps stated, 192 kbps assumed; 1% mp4 overhead.
+	if plan.AudioKbps != 320 || plan.VideoKbps != 1064 || plan.MaxKbps != 1064 || len(plan.Notes) != 1 {
+		t.Errorf("plan=%+v", plan)
+	}
+
+	// Only the tracks of a track map count.
+	mapped := targetProfile(100)
+	mapped.TrackMap = &profile.TrackMap{Audio: []profile.TrackAction{{Track: 1, Stream: 1, Codec: "copy"}}}
+	if plan, _ := PlanTargetSize(mapped, media); plan.AudioKbps != 128 {
+		t.Errorf("mapped audio=%.0f kbps, want 128", plan.AudioKbps)
+	}
+
+	applied := plan.Apply(p)
+	if applied.RateControl != "cbr" || applied.RateValue != 1064 || *applied.NVEncCAdvanced.MaxBitrate != 1064 {
+		t.Errorf("applied=%+v", applied)
+	}
+	if !plan.Hit(plan.TargetBytes) || plan.Hit(plan.TargetBytes+1) || plan.Hit(0) {
+		t.Error("Hit must accept outputs up to the target only")
+	}
+}
+
+func TestPlanTargetSize_MaxBitrateAndErrors(t *testing.T) {
+	media := probe.MediaInfo{DurationSec: 600}
+
+	p := targetProfile(100)
+	limit := 1600
+	p.NVEncCAdvanced.MaxBitrate = &limit
+	if plan, err := PlanTargetSize(p, media); err != nil || plan.MaxKbps != 1600 {
+		t.Errorf("plan=%+v err=%v, want the profile's max bitrate", plan, err)
+	}
+
+	tests := []struct {
+		name   string
+		p      profile.Profile
+		media  probe.MediaInfo
+		reason string
+	}{
+		{"unknown duration", targetProfile(100), probe.MediaInfo{}, "duration"},
+		{"too small", targetProfile(1), probe.MediaInfo{DurationSec: 3600}, "too small"},
+		{"bad mode", func() profile.Profile { p := targetProfile(100); p.TargetSizeMode = "cqp"; return p }(), media, "target_size_mode"},
+	}
+	for _, tt := range tests {
+		_, err := PlanTargetSize(tt.p, tt.media)
+		if err == nil || !strings.HasPrefix(err.Error(), ErrValidation) || !strings.Contains(err.Error(), tt.reason) {
+			t.Errorf("%s: err=%v", tt.name, err)
+		}
+	}
+}
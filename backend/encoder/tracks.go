@@ -0,0 +1,149 @@
+package encoder
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/yuta/enque/backend/probe"
+	"github.com/yuta/enque/backend/profile"
+)
+
+// sidecarExts lists the subtitle files FindSidecars picks up.
+var sidecarExts = []string{".srt", ".ass", ".ssa"}
+
+// PlanTracks applies a profile's track rules to the probed streams of an
+// input. It returns the mapping and notes on rules that could not be
+// followed. If the audio language filter matches no track, every audio
+// track is kept rather than encoding without sound.
+func PlanTracks(p profile.Profile, media probe.MediaInfo, sidecars []string) (profile.TrackMap, []string) {
+	rules := profile.TrackRules{}
+	if p.Tracks != nil {
+		rules = *p.Tracks
+	}
+	var notes []string
+	var audio, subs []trackStream
+	for _, s := range media.Streams {
+		switch s.Type {
+		case "audio":
+			audio = append(audio, trackStream{s, len(audio) + 1})
+		case "subtitle":
+			subs = append(subs, trackStream{s, len(subs) + 1})
+		}
+	}
+
+	keptAudio := selectTracks(audio, rules.AudioLanguages, rules.DropCommentary)
+	if len(keptAudio) == 0 && len(audio) > 0 {
+		keptAudio = selectTracks(audio, nil, rules.DropCommentary)
+		notes = append(notes, fmt.Sprintf("no audio track in %s; keeping all audio tracks", strings.Join(rules.AudioLanguages, ", ")))
+	}
+	var m profile.TrackMap
+	for i, t := range keptAudio {
+		codec := cmp.Or(rules.OtherAudio, p.AudioMode)
+		if i == 0 {
+			codec = cmp.Or(rules.FirstAudio, p.AudioMode)
+		}
+		if codec == "none" || codec == "" {
+			continue
+		}
+		m.Audio = append(m.Audio, profile.TrackAction{Track: t.track, Stream: t.Index, Codec: codec})
+	}
+	if !setDefault(m.Audio, audio, rules.DefaultAudio) {
+		notes = append(notes, fmt.Sprintf("no kept audio track in %s to make default", rules.DefaultAudio))
+	}
+
+	if p.SubCopy {
+		for _, t := range selectTracks(subs, rules.SubLanguages, rules.DropCommentary) {
+			a := profile.TrackAction{Track: t.track, Stream: t.Index, Codec: "copy"}
+			if rules.ForcedSub != "" && t.Language == rules.ForcedSub {
+				a.Disposition = "forced"
+			}
+			m.Subs = append(m.Subs, a)
+		}
+		if !setDefault(m.Subs, subs, rules.DefaultSub) {
+			notes = append(notes, fmt.Sprintf("no kept subtitle track in %s to make default", rules.DefaultSub))
+		}
+	}
+	if rules.Sidecars {
+		m.Sidecars = sidecars
+	}
+	return m, notes
+}
+
+// FindSidecars returns the subtitle files next to an input that share its
+// name: "movie.srt", "movie.jpn.ass" and so on for "movie.mkv".
+func FindSidecars(inputPath string) []string {
+	dir := filepath.Dir(inputPath)
+	base := strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var found []string
+	for _, e := range entries {
+		name := e.Name()
+		ext := strings.ToLower(filepath.Ext(name))
+		if e.IsDir() || !slices.Contains(sidecarExts, ext) {
+			continue
+		}
+		stem := strings.TrimSuffix(name, filepath.Ext(name))
+		if stem == base || strings.HasPrefix(stem, base+".") {
+			found = append(found, filepath.Join(dir, name))
+		}
+	}
+	return found
+}
+
+// trackStream is a stream with its 1-based number among its type.
+type trackStream struct {
+	probe.Stream
+	track int
+}
+
+func selectTracks(tracks []trackStream, languages []string, dropCommentary bool) []trackStream {
+	var kept []trackStream
+	for _, t := range tracks {
+		if len(languages) > 0 && t.Language != "" && t.Language != "und" && !slices.Contains(languages, t.Language) {
+			continue
+		}
+		if dropCommentary && (t.Comment || strings.Contains(strings.ToLower(t.Title), "commentary")) {
+			continue
+		}
+		kept = append(kept, t)
+	}
+	return kept
+}
+
+// setDefault marks the first kept track in lang (or the first kept track
+// with "first") as default and unsets the other kept tracks that are
+// default in the input. It returns false when no kept track matches.
+func setDefault(kept []profile.TrackAction, tracks []trackStream, lang string) bool {
+	if lang == "" {
+		return true
+	}
+	chosen := -1
+	for i, a := range kept {
+		if lang == "first" || tracks[a.Track-1].Language == lang {
+			chosen = i
+			break
+		}
+	}
+	if chosen < 0 {
+		return len(kept) == 0
+	}
+	for i := range kept {
+		a := &kept[i]
+		switch {
+		case i == chosen && a.Disposition != "":
+			a.Disposition = "default," + a.Disposition
+		case i == chosen:
+			a.Disposition = "default"
+		case tracks[a.Track-1].Default && a.Disposition == "":
+			a.Disposition = "unset"
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package encoder
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/yuta/enque/backend/probe"
+	"github.com/yuta/enque/backend/profile"
+)
+
+var trackMedia = probe.MediaInfo{Streams: []probe.Stream{
+	{Index: 0, Type: "video"},
+	{Index: 1, Type: "audio", Language: "jpn", Default: true},
+	{Index: 2, Type: "audio", Language: "jpn", Title: "Director's Commentary"},
+	{Index: 3, Type: "audio", Language: "eng"},
+	{Index: 4, Type: "audio", Language: "fra"},
+	{Index: 5, Type: "subtitle", Language: "jpn", Default: true},
+	{Index: 6, Type: "subtitle", Language: "eng"},
+	{Index: 7, Type: "subtitle", Language: "eng", Comment: true},
+}}
+
+func TestPlanTracks(t *testing.T) {
+	p := profile.Profile{AudioMode: "copy", SubCopy: true, Tracks: &profile.TrackRules{
+		AudioLanguages: []string{"jpn", "eng"},
+		DropCommentary: true,
+		OtherAudio:     "aac",
+		DefaultAudio:   "eng",
+		SubLanguages:   []string{"eng"},
+		DefaultSub:     "first",
+		ForcedSub:      "eng",
+		Sidecars:       true,
+	}}
+	m, notes := PlanTracks(p, trackMedia, []string{"movie.srt"})
+	want := profile.TrackMap{
+		Audio: []profile.TrackAction{
+			{Track: 1, Stream: 1, Codec: "copy", Disposition: "unset"},
+			{Track: 3, Stream: 3, Codec: "aac", Disposition: "default"},
+		},
+		Subs:     []profile.TrackAction{{Track: 2, Stream: 6, Codec: "copy", Disposition: "default,forced"}},
+		Sidecars: []string{"movie.srt"},
+	}
+	if !reflect.DeepEqual(m, want) || len(notes) != 0 {
+		t.Errorf("map=%+v notes=%v\nwant %+v", m, notes, want)
+	}
+
+	// A language filter that matches nothing keeps every track; audio
+	// "none" for the rest keeps only the first.
+	p.Tracks = &profile.TrackRules{AudioLanguages: []string{"deu"}, OtherAudio: "none"}
+	p.SubCopy = false
+	m, notes = PlanTracks(p, trackMedia, nil)
+	if len(m.Audio) != 1 || m.Audio[0].Track != 1 || len(m.Subs) != 0 || len(notes) != 1 {
+		t.Errorf("map=%+v notes=%v", m, notes)
+	}
+}
+
+func TestFindSidecars(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"movie.mkv", "movie.srt", "movie.jpn.ASS", "movie2.srt", "movie.txt", "other.ass"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := FindSidecars(filepath.Join(dir, "movie.mkv"))
+	want := []string{filepath.Join(dir, "movie.jpn.ASS"), filepath.Join(dir, "movie.srt")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sidecars=%v, want %v", got, want)
+	}
+}
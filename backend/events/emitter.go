@@ -1,71 +1,121 @@
 package events
 
-import (
-	"context"
+import "sync"
 
-	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
+// Event names (design doc 7).
+const (
+	NameSessionStarted    = "enque:session_started"
+	NameJobStarted        = "enque:job_started"
+	NameJobProgress       = "enque:job_progress"
+	NameJobLog            = "enque:job_log"
+	NameJobNeedsOverwrite = "enque:job_needs_overwrite"
+	NameJobNeedsCrop      = "enque:job_needs_crop"
+	NameJobFinished       = "enque:job_finished"
+	NameSessionState      = "enque:session_state"
+	NameSessionFinished   = "enque:session_finished"
+	NameWarning           = "enque:warning"
+	NameError             = "enque:error"
 )
 
-// Emitter wraps Wails event emission (design doc 7).
+// Emitter fans typed events out to every registered sink (design doc 7).
 type Emitter struct {
-	ctx context.Context
+	mu    sync.RWMutex
+	sinks []EventSink
 }
 
-// NewEmitter creates an Emitter with the given Wails context.
-func NewEmitter(ctx context.Context) *Emitter {
-	return &Emitter{ctx: ctx}
+// NewEmitter creates an Emitter delivering to the given sinks.
+func NewEmitter(sinks ...EventSink) *Emitter {
+	e := &Emitter{}
+	for _, s := range sinks {
+		e.AddSink(s)
+	}
+	return e
+}
+
+// AddSink registers an additional sink. Nil sinks are ignored.
+func (e *Emitter) AddSink(s EventSink) {
+	if s == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sinks = append(e.sinks, s)
+}
+
+// RemoveSink unregisters a sink previously passed to AddSink.
+func (e *Emitter) RemoveSink(s EventSink) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, existing := range e.sinks {
+		if existing == s {
+			e.sinks = append(e.sinks[:i], e.sinks[i+1:]...)
+			return
+		}
+	}
 }
 
 func (e *Emitter) emit(name string, data interface{}) {
-	wailsRuntime.EventsEmit(e.ctx, name, data)
+	e.mu.RLock()
+	sinks := make([]EventSink, len(e.sinks))
+	copy(sinks, e.sinks)
+	e.mu.RUnlock()
+
+	for _, s := range sinks {
+		s.Emit(name, data)
+	}
 }
 
 // SessionStarted emits enque:session_started.
-func (e *Emitter) SessionStarted(data map[string]interface{}) {
-	e.emit("enque:session_started", data)
+func (e *Emitter) SessionStarted(data SessionSnapshot) {
+	e.emit(NameSessionStarted, data)
 }
 
 // JobStarted emits enque:job_started.
-func (e *Emitter) JobStarted(data map[string]interface{}) {
-	e.emit("enque:job_started", data)
+func (e *Emitter) JobStarted(data JobStarted) {
+	e.emit(NameJobStarted, data)
 }
 
 // JobProgress emits enque:job_progress.
-func (e *Emitter) JobProgress(data map[string]interface{}) {
-	e.emit("enque:job_progress", data)
+func (e *Emitter) JobProgress(data JobProgress) {
+	e.emit(NameJobProgress, data)
 }
 
 // JobLog emits enque:job_log.
-func (e *Emitter) JobLog(data map[string]interface{}) {
-	e.emit("enque:job_log", data)
+func (e *Emitter) JobLog(data JobLog) {
+	e.emit(NameJobLog, data)
 }
 
 // JobNeedsOverwrite emits enque:job_needs_overwrite.
-func (e *Emitter) JobNeedsOverwrite(data map[string]interface{}) {
-	e.emit("enque:job_needs_overwrite", data)
+func (e *Emitter) JobNeedsOverwrite(data JobNeedsOverwrite) {
+	e.emit(NameJobNeedsOverwrite, data)
+}
+
+// JobNeedsCrop emits enque:job_needs_crop.
+func (e *Emitter) JobNeedsCrop(data JobNeedsCrop) {
+	e.emit(NameJobNeedsCrop, data)
 }
 
 // JobFinished emits enque:job_finished.
-func (e *Emitter) JobFinished(data map[string]interface{}) {
-	e.emit("enque:job_finished", data)
+func (e *Emitter) JobFinished(data JobFinished) {
+	e.emit(NameJobFinished, data)
 }
 
 // SessionState emits enque:session_state.
-func (e *Emitter) SessionState(data map[string]interface{}) {
-	e.emit("enque:session_state", data)
+func (e *Emitter) SessionState(data SessionSnapshot) {
+	e.emit(NameSessionState, data)
 }
 
 // SessionFinished emits enque:session_finished.
-func (e *Emitter) SessionFinished(data map[string]interface{}) {
-	e.emit("enque:session_finished", data)
+func (e *Emitter) SessionFinished(data SessionSnapshot) {
+	e.emit(NameSessionFinished, data)
 }
 
 // Warning emits enque:warning.
-func (e *Emitter) Warning(data map[string]interface{}) {
-	e.emit("enque:warning", data)
+func (e *Emitter) Warning(data Message) {
+	e.emit(NameWarning, data)
 }
 
 // Error emits enque:error.
-func (e *Emitter) Error(data map[string]interface{}) {
-	e.emit("enque:error", data)
+func (e *Emitter) Error(data Message) {
+	e.emit(NameError, data)
 }
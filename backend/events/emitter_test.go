@@ -0,0 +1,77 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestEmitter_FansOutToAllSinks(t *testing.T) {
+	a := NewRecordingSink()
+	b := NewRecordingSink()
+	var names []string
+	e := NewEmitter(a, nil, SinkFunc(func(name string, data interface{}) {
+		names = append(names, name)
+	}))
+	e.AddSink(b)
+
+	e.JobLog(JobLog{JobID: "j1", Line: "hello"})
+	e.Warning(Message{Message: "careful"})
+
+	for _, rec := range []*RecordingSink{a, b} {
+		got := rec.Events()
+		if len(got) != 2 || got[0].Name != NameJobLog || got[1].Name != NameWarning {
+			t.Errorf("recorded=%+v", got)
+		}
+	}
+	if len(names) != 2 {
+		t.Errorf("func sink saw %d events, want 2", len(names))
+	}
+
+	e.RemoveSink(b)
+	e.Error(Message{Message: "boom"})
+	if len(b.Events()) != 2 {
+		t.Error("removed sink must not receive further events")
+	}
+	if len(a.Named(NameError)) != 1 {
+		t.Error("remaining sink should receive the error event")
+	}
+}
+
+func TestRecordingSink_WaitFor(t *testing.T) {
+	rec := NewRecordingSink()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		rec.Emit(NameSessionFinished, SessionSnapshot{SessionID: "s1"})
+	}()
+
+	ev, ok := rec.WaitFor(NameSessionFinished, time.Second)
+	if !ok {
+		t.Fatal("WaitFor timed out")
+	}
+	if ev.Data.(SessionSnapshot).SessionID != "s1" {
+		t.Errorf("data=%+v", ev.Data)
+	}
+
+	if _, ok := rec.WaitFor(NameError, 10*time.Millisecond); ok {
+		t.Error("WaitFor should time out for an event that never arrives")
+	}
+}
+
+func TestJobProgress_OmitsMissingFields(t *testing.T) {
+	pct := 42.5
+	data, err := json.Marshal(JobProgress{SessionID: "s", JobID: "j", Percent: &pct})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	json.Unmarshal(data, &m)
+	if m["percent"] != 42.5 {
+		t.Errorf("percent=%v", m["percent"])
+	}
+	for _, key := range []string{"fps", "bitrate_kbps", "eta_sec"} {
+		if _, ok := m[key]; ok {
+			t.Errorf("%s should be omitted when nil", key)
+		}
+	}
+}
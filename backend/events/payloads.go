@@ -0,0 +1,112 @@
+package events
+
+// SessionSnapshot is the payload of session_started, session_state and session_finished.
+type SessionSnapshot struct {
+	SessionID      string `json:"session_id"`
+	State          string `json:"state"`
+	EncoderType    string `json:"encoder_type"`
+	StartedAt      string `json:"started_at"`
+	TotalJobs      int    `json:"total_jobs"`
+	CompletedJobs  int    `json:"completed_jobs"`
+	RunningJobs    int    `json:"running_jobs"`
+	FailedJobs     int    `json:"failed_jobs"`
+	CancelledJobs  int    `json:"cancelled_jobs"`
+	TimeoutJobs    int    `json:"timeout_jobs"`
+	SkippedJobs    int    `json:"skipped_jobs"`
+	StopRequested  bool   `json:"stop_requested"`
+	AbortRequested bool   `json:"abort_requested"`
+	// ETASec estimates the time until the remaining jobs are done, and
+	// ETAAt the clock time; both are unset until there is an estimate.
+	// UnestimatedJobs counts the jobs left out for lack of data.
+	ETASec          *float64 `json:"eta_sec,omitempty"`
+	ETAAt           string   `json:"eta_at,omitempty"`
+	ThroughputFPS   float64  `json:"throughput_fps,omitempty"` // of all running jobs
+	UnestimatedJobs int      `json:"unestimated_jobs,omitempty"`
+}
+
+// JobStarted is the payload of job_started.
+type JobStarted struct {
+	SessionID       string `json:"session_id"`
+	JobID           string `json:"job_id"`
+	ParentJobID     string `json:"parent_job_id,omitempty"`
+	InputPath       string `json:"input_path"`
+	InputSizeBytes  int64  `json:"input_size_bytes"`
+	WorkerID        int    `json:"worker_id"`
+	TempOutputPath  string `json:"temp_output_path"`
+	FinalOutputPath string `json:"final_output_path"`
+	EncoderType     string `json:"encoder_type"`
+	// Segment is the 1-based chunk number of a segment of a chunked job.
+	Segment int `json:"segment,omitempty"`
+}
+
+// JobProgress is the payload of job_progress. Fields the encoder did not
+// report are omitted. GroupPercent is the combined progress of all output
+// variants of ParentJobID.
+type JobProgress struct {
+	SessionID    string   `json:"session_id"`
+	JobID        string   `json:"job_id"`
+	ParentJobID  string   `json:"parent_job_id,omitempty"`
+	WorkerID     int      `json:"worker_id"`
+	Percent      *float64 `json:"percent,omitempty"`
+	FPS          *float64 `json:"fps,omitempty"`
+	BitrateKbps  *float64 `json:"bitrate_kbps,omitempty"`
+	ETASec       *float64 `json:"eta_sec,omitempty"`
+	GroupPercent *float64 `json:"group_percent,omitempty"`
+}
+
+// JobLog is the payload of job_log.
+type JobLog struct {
+	SessionID string `json:"session_id"`
+	JobID     string `json:"job_id"`
+	Line      string `json:"line"`
+	TS        string `json:"ts"`
+}
+
+// JobNeedsOverwrite is the payload of job_needs_overwrite.
+type JobNeedsOverwrite struct {
+	SessionID       string `json:"session_id"`
+	JobID           string `json:"job_id"`
+	FinalOutputPath string `json:"final_output_path"`
+}
+
+// JobNeedsCrop is the payload of job_needs_crop: a detected crop of a
+// Width x Height input waiting for confirmation.
+type JobNeedsCrop struct {
+	SessionID string `json:"session_id"`
+	JobID     string `json:"job_id"`
+	InputPath string `json:"input_path"`
+	Left      int    `json:"left"`
+	Top       int    `json:"top"`
+	Right     int    `json:"right"`
+	Bottom    int    `json:"bottom"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+}
+
+// JobFinished is the payload of job_finished.
+type JobFinished struct {
+	SessionID       string  `json:"session_id"`
+	JobID           string  `json:"job_id"`
+	ParentJobID     string  `json:"parent_job_id,omitempty"`
+	InputPath       string  `json:"input_path"`
+	Status          string  `json:"status"`
+	ExitCode        *int    `json:"exit_code,omitempty"`
+	ErrorMessage    string  `json:"error_message"`
+	TempOutputPath  string  `json:"temp_output_path"`
+	FinalOutputPath string  `json:"final_output_path"`
+	TimeoutReason   string  `json:"timeout_reason,omitempty"`
+	InputSizeBytes  int64   `json:"input_size_bytes"`
+	OutputSizeBytes int64   `json:"output_size_bytes"`
+	DurationSec     float64 `json:"duration_sec"`
+	// Segment is the 1-based chunk number of a segment of a chunked job.
+	// Segments do not count as jobs; their job finishes once they are
+	// joined.
+	Segment int `json:"segment,omitempty"`
+}
+
+// Message is the payload of warning and error events.
+type Message struct {
+	SessionID string `json:"session_id,omitempty"`
+	JobID     string `json:"job_id,omitempty"`
+	Message   string `json:"message"`
+}
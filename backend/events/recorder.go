@@ -0,0 +1,86 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event is a single recorded emission.
+type Event struct {
+	Name string
+	Data interface{}
+}
+
+// RecordingSink keeps every event in memory. Intended for tests and
+// headless callers that inspect the event stream after the fact.
+type RecordingSink struct {
+	mu     sync.Mutex
+	events []Event
+	notify chan struct{}
+}
+
+// NewRecordingSink creates an empty recorder.
+func NewRecordingSink() *RecordingSink {
+	return &RecordingSink{notify: make(chan struct{})}
+}
+
+// Emit implements EventSink.
+func (r *RecordingSink) Emit(name string, data interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, Event{Name: name, Data: data})
+	close(r.notify)
+	r.notify = make(chan struct{})
+}
+
+// Events returns a copy of all recorded events in emission order.
+func (r *RecordingSink) Events() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]Event, len(r.events))
+	copy(out, r.events)
+	return out
+}
+
+// Named returns the recorded events with the given name.
+func (r *RecordingSink) Named(name string) []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []Event
+	for _, e := range r.events {
+		if e.Name == name {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Reset discards all recorded events.
+func (r *RecordingSink) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = nil
+}
+
+// WaitFor blocks until an event with the given name has been recorded or the
+// timeout elapses. It returns the first matching event.
+func (r *RecordingSink) WaitFor(name string, timeout time.Duration) (Event, bool) {
+	deadline := time.After(timeout)
+	for {
+		r.mu.Lock()
+		for _, e := range r.events {
+			if e.Name == name {
+				r.mu.Unlock()
+				return e, true
+			}
+		}
+		notify := r.notify
+		r.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-deadline:
+			return Event{}, false
+		}
+	}
+}
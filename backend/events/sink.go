@@ -0,0 +1,37 @@
+package events
+
+import (
+	"context"
+
+	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// EventSink receives every event emitted by an Emitter.
+// Implementations must be safe for concurrent use and must not block for long,
+// since workers emit synchronously.
+type EventSink interface {
+	Emit(name string, data interface{})
+}
+
+// SinkFunc adapts a plain function to the EventSink interface.
+type SinkFunc func(name string, data interface{})
+
+// Emit calls f(name, data).
+func (f SinkFunc) Emit(name string, data interface{}) {
+	f(name, data)
+}
+
+// WailsSink forwards events to the frontend through the Wails runtime.
+type WailsSink struct {
+	ctx context.Context
+}
+
+// NewWailsSink creates a sink bound to the given Wails context.
+func NewWailsSink(ctx context.Context) *WailsSink {
+	return &WailsSink{ctx: ctx}
+}
+
+// Emit implements EventSink.
+func (s *WailsSink) Emit(name string, data interface{}) {
+	wailsRuntime.EventsEmit(s.ctx, name, data)
+}
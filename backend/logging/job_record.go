@@ -11,6 +11,8 @@ import (
 type JobRecord struct {
 	SchemaVersion  int      `json:"schema_version"`
 	JobID          string   `json:"job_id"`
+	ParentJobID    string   `json:"parent_job_id,omitempty"`
+	Variant        string   `json:"variant,omitempty"`
 	SessionID      string   `json:"session_id"`
 	InputPath      string   `json:"input_path"`
 	OutputPath     string   `json:"output_path"`
@@ -27,6 +29,10 @@ type JobRecord struct {
 	ProfileID         string `json:"profile_id"`
 	ProfileName       string `json:"profile_name"`
 	ProfileVersion    int    `json:"profile_version"`
+	ProfileRevision   int    `json:"profile_revision,omitempty"`
+	// VariantOverrides are what the output variant changed in the
+	// profile revision, on the sub-jobs of a job with variants.
+	VariantOverrides *VariantOverrides `json:"variant_overrides,omitempty"`
 	Device            string `json:"device"`
 	MaxConcurrentJobs int    `json:"max_concurrent_jobs"`
 	UsedJobObject     bool   `json:"used_job_object"`
@@ -35,6 +41,111 @@ type JobRecord struct {
 	DurationSec    float64  `json:"duration_sec"`
 	RetryApplied   bool     `json:"retry_applied"`
 	RetryDetail    string   `json:"retry_detail,omitempty"`
+	TargetSize     *TargetSizeResult `json:"target_size,omitempty"`
+	Crop           *CropResult       `json:"crop,omitempty"`
+	HDR            *HDRResult        `json:"hdr,omitempty"`
+	Loudness       *LoudnessResult   `json:"loudness,omitempty"`
+	Chunks         *ChunksResult     `json:"chunks,omitempty"`
+	// AvgFPS is the encoder's last reported fps, its average over the job.
+	AvgFPS           float64 `json:"avg_fps,omitempty"`
+	InputSizeBytes   int64   `json:"input_size_bytes,omitempty"`
+	InputDurationSec float64 `json:"input_duration_sec,omitempty"`
+}
+
+// VariantOverrides records the settings an output variant encoded with
+// instead of its profile's. Empty fields kept the profile's.
+type VariantOverrides struct {
+	OutputRes string  `json:"output_res,omitempty"`
+	RateValue float64 `json:"rate_value,omitempty"`
+}
+
+// ChunksResult records how a chunked job was split into segments and
+// joined.
+type ChunksResult struct {
+	Boundary  string         `json:"boundary"` // "keyframe" or "scene"
+	Segments  []ChunkSegment `json:"segments"`
+	JoinError string         `json:"join_error,omitempty"`
+}
+
+// ChunkSegment is one segment of a chunked job.
+type ChunkSegment struct {
+	JobID    string  `json:"job_id"`
+	Start    float64 `json:"start"` // seconds into the input
+	End      float64 `json:"end"`
+	Scene    bool    `json:"scene,omitempty"` // ends at a scene change
+	Status   string  `json:"status"`
+	Attempts int     `json:"attempts"`
+}
+
+// LoudnessResult records the loudness normalization of a job.
+type LoudnessResult struct {
+	TargetLUFS float64         `json:"target_lufs"`
+	TruePeak   float64         `json:"true_peak"`
+	Tracks     []LoudnessTrack `json:"tracks,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// LoudnessTrack is the measurement and gain of one transcoded audio track.
+type LoudnessTrack struct {
+	Track            int     `json:"track"` // 1-based among the input's audio tracks
+	MeasuredLUFS     float64 `json:"measured_lufs"`
+	MeasuredTruePeak float64 `json:"measured_true_peak"`
+	MeasuredLRA      float64 `json:"measured_lra"`
+	GainDB           float64 `json:"gain_db"`
+	OutputLUFS       float64 `json:"output_lufs"`
+	// PeakLimited is set when the true peak target lowered the gain.
+	PeakLimited bool   `json:"peak_limited,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// HDRResult records how a job with hdr_mode handled its input's HDR
+// signal.
+type HDRResult struct {
+	Source        string   `json:"source,omitempty"` // "pq", "hlg", "dolby_vision"; empty for SDR
+	Action        string   `json:"action"`           // "passthrough", "upgraded", "warned", "tonemapped", "none"
+	Codec         string   `json:"codec"`
+	OutputDepth   int      `json:"output_depth"`
+	MasterDisplay string   `json:"master_display,omitempty"`
+	MaxCLL        string   `json:"max_cll,omitempty"`
+	Tonemap       string   `json:"tonemap,omitempty"` // the tone-mapping filter's arguments
+	Notes         []string `json:"notes,omitempty"`
+	Error         string   `json:"error,omitempty"`
+}
+
+// CropResult records the black-bar detection of a job and the crop the
+// encode used.
+type CropResult struct {
+	// Decision is "applied" (automatically), "confirmed", "adjusted",
+	// "ignored", "skipped", "preset" (set on the job), "none" (nothing to
+	// crop) or "failed".
+	Decision string `json:"decision"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	Detected *CropRect `json:"detected,omitempty"`
+	Applied  *CropRect `json:"applied,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// CropRect is the number of pixels removed on each side.
+type CropRect struct {
+	Left   int `json:"left"`
+	Top    int `json:"top"`
+	Right  int `json:"right"`
+	Bottom int `json:"bottom"`
+}
+
+// TargetSizeResult reports how an encode with a target output size came
+// out against its plan.
+type TargetSizeResult struct {
+	TargetBytes  int64   `json:"target_bytes"`
+	OutputBytes  int64   `json:"output_bytes"`
+	Hit          bool    `json:"hit"`
+	DeviationPct float64 `json:"deviation_pct"`
+	Mode         string  `json:"mode"`
+	DurationSec  float64 `json:"duration_sec"`
+	VideoKbps    int     `json:"video_kbps"`
+	MaxKbps      int     `json:"max_kbps"`
+	AudioKbps    float64 `json:"audio_kbps"`
 }
 
 // Save writes the job record to {logsDir}/{jobID}.json atomically.
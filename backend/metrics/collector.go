@@ -0,0 +1,296 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/yuta/enque/backend/events"
+)
+
+// durationBuckets are the upper bounds (seconds) of the encode duration histogram.
+var durationBuckets = []float64{30, 60, 120, 300, 600, 1200, 1800, 3600, 7200, 14400}
+
+// terminalStatuses are the job statuses reported by job_finished.
+var terminalStatuses = []string{"completed", "failed", "cancelled", "timeout", "skipped"}
+
+type runningJob struct {
+	workerID    int
+	parentJobID string // of a segment of a chunked job
+	percent     float64
+	fps         float64
+	bitrateKbps float64
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, non-cumulative; last entry is +Inf
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(durationBuckets)+1)
+	}
+	i := sort.SearchFloat64s(durationBuckets, v)
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// Collector aggregates queue events into Prometheus metrics.
+// It implements events.EventSink and is fed by the same emitter the
+// workers use for job_progress and job_finished.
+type Collector struct {
+	mu sync.Mutex
+
+	// Current session
+	sessionTotal    int
+	sessionFinished map[string]int
+	running         map[string]*runningJob
+
+	// Process lifetime counters
+	sessionsTotal map[string]float64 // by final state
+	jobsFinished  map[string]float64 // by status
+	durations     map[string]*histogram
+	inputBytes    float64
+	outputBytes   float64
+	timeoutsTotal map[string]float64 // by reason
+}
+
+// NewCollector creates an empty collector.
+func NewCollector() *Collector {
+	return &Collector{
+		sessionFinished: make(map[string]int),
+		running:         make(map[string]*runningJob),
+		sessionsTotal:   make(map[string]float64),
+		jobsFinished:    make(map[string]float64),
+		durations:       make(map[string]*histogram),
+		timeoutsTotal:   make(map[string]float64),
+	}
+}
+
+// Emit implements events.EventSink.
+func (c *Collector) Emit(name string, data interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch d := data.(type) {
+	case events.SessionSnapshot:
+		switch name {
+		case events.NameSessionStarted:
+			c.sessionTotal = d.TotalJobs
+			c.sessionFinished = make(map[string]int)
+			c.running = make(map[string]*runningJob)
+		case events.NameSessionState:
+			c.sessionTotal = d.TotalJobs
+		case events.NameSessionFinished:
+			c.sessionTotal = d.TotalJobs
+			c.running = make(map[string]*runningJob)
+			c.sessionsTotal[d.State]++
+		}
+	case events.JobStarted:
+		rj := &runningJob{workerID: d.WorkerID}
+		if d.Segment != 0 {
+			rj.parentJobID = d.ParentJobID
+		}
+		c.running[d.JobID] = rj
+	case events.JobProgress:
+		rj, ok := c.running[d.JobID]
+		if !ok {
+			return
+		}
+		if d.Percent != nil {
+			rj.percent = *d.Percent
+		}
+		if d.FPS != nil {
+			rj.fps = *d.FPS
+		}
+		if d.BitrateKbps != nil {
+			rj.bitrateKbps = *d.BitrateKbps
+		}
+	case events.JobFinished:
+		delete(c.running, d.JobID)
+		if d.Segment != 0 {
+			return
+		}
+		c.sessionFinished[d.Status]++
+		c.jobsFinished[d.Status]++
+		if d.DurationSec > 0 {
+			h, ok := c.durations[d.Status]
+			if !ok {
+				h = &histogram{}
+				c.durations[d.Status] = h
+			}
+			h.observe(d.DurationSec)
+		}
+		if d.Status == "completed" {
+			c.inputBytes += float64(d.InputSizeBytes)
+			c.outputBytes += float64(d.OutputSizeBytes)
+		}
+		if d.Status == "timeout" {
+			reason := d.TimeoutReason
+			if reason == "" {
+				reason = "unknown"
+			}
+			c.timeoutsTotal[reason]++
+		}
+	}
+}
+
+// Handler serves the metrics in the Prometheus text exposition format.
+func (c *Collector) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.WriteText(w)
+	})
+}
+
+// WriteText writes all metrics in the Prometheus text exposition format.
+func (c *Collector) WriteText(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Jobs by status in the current session
+	header(w, "enque_jobs", "gauge", "Jobs in the current session by status.")
+	finished := 0
+	for _, st := range terminalStatuses {
+		finished += c.sessionFinished[st]
+	}
+	// A chunked job runs as its segments: it counts as one running job,
+	// and its segments as the workers.
+	running, workers := 0, len(c.running)
+	split := make(map[string]bool)
+	for _, rj := range c.running {
+		if rj.parentJobID == "" {
+			running++
+		} else {
+			split[rj.parentJobID] = true
+		}
+	}
+	for id := range split {
+		if _, ok := c.running[id]; ok {
+			workers--
+		}
+	}
+	pending := c.sessionTotal - finished - running
+	if pending < 0 {
+		pending = 0
+	}
+	sample(w, "enque_jobs", labels("status", "pending"), float64(pending))
+	sample(w, "enque_jobs", labels("status", "running"), float64(running))
+	for _, st := range terminalStatuses {
+		sample(w, "enque_jobs", labels("status", st), float64(c.sessionFinished[st]))
+	}
+
+	header(w, "enque_active_workers", "gauge", "Workers currently running an encoder process.")
+	sample(w, "enque_active_workers", "", float64(workers))
+
+	// Per-job gauges
+	jobIDs := make([]string, 0, len(c.running))
+	for id := range c.running {
+		jobIDs = append(jobIDs, id)
+	}
+	sort.Strings(jobIDs)
+	for _, g := range []struct {
+		name, help string
+		value      func(*runningJob) float64
+	}{
+		{"enque_job_progress_percent", "Progress of a running job.", func(j *runningJob) float64 { return j.percent }},
+		{"enque_job_fps", "Encoding speed of a running job in frames per second.", func(j *runningJob) float64 { return j.fps }},
+		{"enque_job_bitrate_kbps", "Current output bitrate of a running job.", func(j *runningJob) float64 { return j.bitrateKbps }},
+	} {
+		header(w, g.name, "gauge", g.help)
+		for _, id := range jobIDs {
+			rj := c.running[id]
+			sample(w, g.name, labels("job_id", id, "worker_id", strconv.Itoa(rj.workerID)), g.value(rj))
+		}
+	}
+
+	header(w, "enque_jobs_finished_total", "counter", "Jobs finished since start by status.")
+	for _, st := range terminalStatuses {
+		sample(w, "enque_jobs_finished_total", labels("status", st), c.jobsFinished[st])
+	}
+
+	header(w, "enque_sessions_finished_total", "counter", "Sessions finished since start by final state.")
+	for _, st := range sortedKeys(c.sessionsTotal) {
+		sample(w, "enque_sessions_finished_total", labels("state", st), c.sessionsTotal[st])
+	}
+
+	header(w, "enque_job_duration_seconds", "histogram", "Wall-clock encode duration per job.")
+	statuses := make([]string, 0, len(c.durations))
+	for st := range c.durations {
+		statuses = append(statuses, st)
+	}
+	sort.Strings(statuses)
+	for _, st := range statuses {
+		h := c.durations[st]
+		var cumulative uint64
+		for i, le := range durationBuckets {
+			cumulative += h.counts[i]
+			sample(w, "enque_job_duration_seconds_bucket", labels("status", st, "le", formatFloat(le)), float64(cumulative))
+		}
+		cumulative += h.counts[len(durationBuckets)]
+		sample(w, "enque_job_duration_seconds_bucket", labels("status", st, "le", "+Inf"), float64(cumulative))
+		sample(w, "enque_job_duration_seconds_sum", labels("status", st), h.sum)
+		sample(w, "enque_job_duration_seconds_count", labels("status", st), float64(h.count))
+	}
+
+	header(w, "enque_input_bytes_total", "counter", "Input bytes of successfully encoded jobs.")
+	sample(w, "enque_input_bytes_total", "", c.inputBytes)
+	header(w, "enque_output_bytes_total", "counter", "Output bytes of successfully encoded jobs.")
+	sample(w, "enque_output_bytes_total", "", c.outputBytes)
+
+	header(w, "enque_timeouts_total", "counter", "Jobs killed by the timeout guard by reason.")
+	for _, reason := range sortedKeys(c.timeoutsTotal) {
+		sample(w, "enque_timeouts_total", labels("reason", reason), c.timeoutsTotal[reason])
+	}
+}
+
+func header(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func sample(w io.Writer, name, lbls string, v float64) {
+	fmt.Fprintf(w, "%s%s %s\n", name, lbls, formatFloat(v))
+}
+
+// labels renders key/value pairs as {k="v",...} with Prometheus escaping.
+func labels(kv ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(kv); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(kv[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(kv[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
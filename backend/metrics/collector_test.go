@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yuta/enque/backend/events"
+)
+
+func ptr(v float64) *float64 { return &v }
+
+func render(c *Collector) string {
+	var b strings.Builder
+	c.WriteText(&b)
+	return b.String()
+}
+
+func assertLine(t *testing.T, out, line string) {
+	t.Helper()
+	for _, l := range strings.Split(out, "\n") {
+		if l == line {
+			return
+		}
+	}
+	t.Errorf("missing line %q in:\n%s", line, out)
+}
+
+func TestCollector_SessionLifecycle(t *testing.T) {
+	c := NewCollector()
+	c.Emit(events.NameSessionStarted, events.SessionSnapshot{SessionID: "s1", State: "running", TotalJobs: 3})
+	c.Emit(events.NameJobStarted, events.JobStarted{SessionID: "s1", JobID: "j1", WorkerID: 0})
+	c.Emit(events.NameJobProgress, events.JobProgress{SessionID: "s1", JobID: "j1", Percent: ptr(42.5), FPS: ptr(120), BitrateKbps: ptr(8000)})
+
+	out := render(c)
+	assertLine(t, out, `enque_jobs{status="pending"} 2`)
+	assertLine(t, out, `enque_jobs{status="running"} 1`)
+	assertLine(t, out, `enque_active_workers 1`)
+	assertLine(t, out, `enque_job_progress_percent{job_id="j1",worker_id="0"} 42.5`)
+	assertLine(t, out, `enque_job_fps{job_id="j1",worker_id="0"} 120`)
+	assertLine(t, out, `enque_job_bitrate_kbps{job_id="j1",worker_id="0"} 8000`)
+
+	c.Emit(events.NameJobFinished, events.JobFinished{
+		SessionID: "s1", JobID: "j1", Status: "completed",
+		InputSizeBytes: 1000, OutputSizeBytes: 400, DurationSec: 90,
+	})
+	c.Emit(events.NameJobStarted, events.JobStarted{SessionID: "s1", JobID: "j2", WorkerID: 0})
+	c.Emit(events.NameJobFinished, events.JobFinished{
+		SessionID: "s1", JobID: "j2", Status: "timeout", TimeoutReason: "no_progress", DurationSec: 400,
+	})
+
+	out = render(c)
+	assertLine(t, out, `enque_jobs{status="pending"} 1`)
+	assertLine(t, out, `enque_jobs{status="completed"} 1`)
+	assertLine(t, out, `enque_jobs{status="timeout"} 1`)
+	assertLine(t, out, `enque_active_workers 0`)
+	assertLine(t, out, `enque_input_bytes_total 1000`)
+	assertLine(t, out, `enque_output_bytes_total 400`)
+	assertLine(t, out, `enque_timeouts_total{reason="no_progress"} 1`)
+	assertLine(t, out, `enque_job_duration_seconds_bucket{status="completed",le="60"} 0`)
+	assertLine(t, out, `enque_job_duration_seconds_bucket{status="completed",le="120"} 1`)
+	assertLine(t, out, `enque_job_duration_seconds_bucket{status="completed",le="+Inf"} 1`)
+	assertLine(t, out, `enque_job_duration_seconds_sum{status="timeout"} 400`)
+	if strings.Contains(out, `job_id="j1"`) {
+		t.Error("per-job gauges must be dropped when the job finishes")
+	}
+
+	c.Emit(events.NameSessionFinished, events.SessionSnapshot{SessionID: "s1", State: "completed", TotalJobs: 3})
+	c.Emit(events.NameSessionStarted, events.SessionSnapshot{SessionID: "s2", State: "running", TotalJobs: 1})
+
+	out = render(c)
+	assertLine(t, out, `enque_jobs{status="pending"} 1`)
+	assertLine(t, out, `enque_jobs{status="completed"} 0`)
+	assertLine(t, out, `enque_jobs_finished_total{status="completed"} 1`)
+	assertLine(t, out, `enque_sessions_finished_total{state="completed"} 1`)
+}
+
+func TestCollector_ChunkedJob(t *testing.T) {
+	c := NewCollector()
+	c.Emit(events.NameSessionStarted, events.SessionSnapshot{SessionID: "s1", State: "running", TotalJobs: 2})
+	c.Emit(events.NameJobStarted, events.JobStarted{SessionID: "s1", JobID: "j1", WorkerID: 0})
+	c.Emit(events.NameJobStarted, events.JobStarted{SessionID: "s1", JobID: "j1_seg01", ParentJobID: "j1", Segment: 1, WorkerID: 0})
+	c.Emit(events.NameJobStarted, events.JobStarted{SessionID: "s1", JobID: "j1_seg02", ParentJobID: "j1", Segment: 2, WorkerID: 1})
+
+	out := render(c)
+	assertLine(t, out, `enque_jobs{status="pending"} 1`)
+	assertLine(t, out, `enque_jobs{status="running"} 1`)
+	assertLine(t, out, `enque_active_workers 2`)
+
+	c.Emit(events.NameJobFinished, events.JobFinished{SessionID: "s1", JobID: "j1_seg01", ParentJobID: "j1", Segment: 1, Status: "completed", DurationSec: 30})
+	c.Emit(events.NameJobFinished, events.JobFinished{SessionID: "s1", JobID: "j1_seg02", ParentJobID: "j1", Segment: 2, Status: "completed", DurationSec: 30})
+
+	out = render(c)
+	assertLine(t, out, `enque_jobs{status="completed"} 0`)
+	assertLine(t, out, `enque_jobs_finished_total{status="completed"} 0`)
+	assertLine(t, out, `enque_jobs{status="running"} 1`)
+	assertLine(t, out, `enque_active_workers 1`)
+}
+
+func TestCollector_IgnoresProgressForUnknownJob(t *testing.T) {
+	c := NewCollector()
+	c.Emit(events.NameJobProgress, events.JobProgress{JobID: "ghost", FPS: ptr(10)})
+	if strings.Contains(render(c), "ghost") {
+		t.Error("progress for a job that never started must not create gauges")
+	}
+}
+
+func TestLabelsEscaping(t *testing.T) {
+	got := labels("k", "a\"b\\c\nd")
+	want := `{k="a\"b\\c\nd"}`
+	if got != want {
+		t.Errorf("labels=%s, want %s", got, want)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	c := NewCollector()
+	srv := httptest.NewServer(c.Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type=%q", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "# TYPE enque_job_duration_seconds histogram") {
+		t.Errorf("unexpected body:\n%s", body)
+	}
+}
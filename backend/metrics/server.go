@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/yuta/enque/backend/encoder"
+)
+
+// Server exposes a Collector at GET /metrics for Prometheus to scrape.
+// It has no authentication and is meant to be bound to a loopback or
+// trusted address.
+type Server struct {
+	addr      string
+	collector *Collector
+
+	mu       sync.Mutex
+	httpSrv  *http.Server
+	listener net.Listener
+}
+
+// NewServer creates a server. Call Start to begin listening.
+func NewServer(addr string, collector *Collector) *Server {
+	return &Server{addr: addr, collector: collector}
+}
+
+// Start binds the configured address and serves in the background.
+func (s *Server) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.httpSrv != nil {
+		return fmt.Errorf("metrics endpoint already running")
+	}
+
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("%s: listen %s: %w", encoder.ErrIO, s.addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", s.collector.Handler())
+
+	s.listener = ln
+	s.httpSrv = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go s.httpSrv.Serve(ln)
+	return nil
+}
+
+// Addr returns the bound address, or "" when not running.
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
+// Stop shuts the server down.
+func (s *Server) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	srv := s.httpSrv
+	s.httpSrv = nil
+	s.listener = nil
+	s.mu.Unlock()
+
+	if srv == nil {
+		return nil
+	}
+	if err := srv.Shutdown(ctx); err != nil {
+		return srv.Close()
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/yuta/enque/backend/config"
+	"github.com/yuta/enque/backend/events"
+	"github.com/yuta/enque/backend/logging"
+)
+
+// Webhook event identifiers used in WebhookConfig.Events.
+const (
+	EventJobFinished     = "job_finished"
+	EventSessionFinished = "session_finished"
+)
+
+// Notifier delivers job_finished and session_finished events to the
+// configured webhooks. It implements events.EventSink; deliveries run in the
+// background so workers are never blocked by slow endpoints.
+type Notifier struct {
+	mu       sync.RWMutex
+	webhooks []webhook
+	client   *http.Client
+	logger   *logging.AppLogger
+	wg       sync.WaitGroup
+
+	// BackoffBase is the delay before the first retry; it doubles per attempt.
+	BackoffBase time.Duration
+}
+
+// NewNotifier creates a notifier with no webhooks configured.
+func NewNotifier(logger *logging.AppLogger) *Notifier {
+	return &Notifier{
+		client:      &http.Client{Timeout: 15 * time.Second},
+		logger:      logger,
+		BackoffBase: 2 * time.Second,
+	}
+}
+
+// webhook is a configured webhook with its body template parsed.
+type webhook struct {
+	config.WebhookConfig
+	tmpl *template.Template // nil without a template
+}
+
+// SetWebhooks replaces the webhook configuration. Templates are parsed
+// here; a webhook whose template does not parse is logged and left out.
+// Config validation rejects such templates, so this only happens for
+// unvalidated configs.
+func (n *Notifier) SetWebhooks(webhooks []config.WebhookConfig) {
+	parsed := make([]webhook, 0, len(webhooks))
+	for _, wh := range webhooks {
+		hook := webhook{WebhookConfig: wh}
+		if wh.Template != "" {
+			tmpl, err := config.ParseWebhookTemplate(wh.Template)
+			if err != nil {
+				n.logError("webhook %q: parse template: %v; webhook disabled", webhookLabel(wh), err)
+				continue
+			}
+			hook.tmpl = tmpl
+		}
+		parsed = append(parsed, hook)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.webhooks = parsed
+}
+
+// Wait blocks until all in-flight deliveries have finished or ctx is done.
+func (n *Notifier) Wait(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// Emit implements events.EventSink.
+func (n *Notifier) Emit(name string, data interface{}) {
+	var event string
+	switch name {
+	case events.NameJobFinished:
+		if d, ok := data.(events.JobFinished); ok && d.Segment != 0 {
+			return
+		}
+		event = EventJobFinished
+	case events.NameSessionFinished:
+		event = EventSessionFinished
+	default:
+		return
+	}
+
+	n.mu.RLock()
+	webhooks := n.webhooks
+	n.mu.RUnlock()
+
+	now := time.Now()
+	for _, wh := range webhooks {
+		if !wh.Enabled || !subscribes(wh.WebhookConfig, event) {
+			continue
+		}
+		if wh.FailuresOnly && !isFailure(data) {
+			continue
+		}
+		body, err := buildPayload(wh.WebhookConfig, wh.tmpl, event, data, now)
+		if err != nil {
+			n.logError("webhook %q: build payload: %v", webhookLabel(wh.WebhookConfig), err)
+			continue
+		}
+		n.wg.Add(1)
+		go func(wh config.WebhookConfig, body []byte) {
+			defer n.wg.Done()
+			if err := n.deliver(wh, body); err != nil {
+				n.logError("webhook %q: %v", webhookLabel(wh), err)
+			}
+		}(wh.WebhookConfig, body)
+	}
+}
+
+// deliver POSTs body, retrying network errors, 429 and 5xx responses with
+// exponential backoff.
+func (n *Notifier) deliver(wh config.WebhookConfig, body []byte) error {
+	var lastErr error
+	for attempt := 0; attempt <= wh.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(n.BackoffBase << (attempt - 1))
+		}
+
+		req, err := http.NewRequest(http.MethodPost, wh.URL, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("build request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "Enque/"+config.AppVersion)
+
+		resp, err := n.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		switch {
+		case resp.StatusCode < 300:
+			return nil
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+			lastErr = fmt.Errorf("status %d", resp.StatusCode)
+		default:
+			return fmt.Errorf("status %d (not retried)", resp.StatusCode)
+		}
+	}
+	return fmt.Errorf("giving up after %d attempt(s): %w", wh.MaxRetries+1, lastErr)
+}
+
+func (n *Notifier) logError(msg string, args ...interface{}) {
+	if n.logger != nil {
+		n.logger.Error(msg, args...)
+	}
+}
+
+// TemplateData is the value a custom webhook template is executed with.
+type TemplateData struct {
+	Event     string
+	Timestamp string
+	Summary   string
+	Data      interface{}
+}
+
+// BuildPayload renders the request body for one webhook.
+func BuildPayload(wh config.WebhookConfig, event string, data interface{}, now time.Time) ([]byte, error) {
+	var tmpl *template.Template
+	if wh.Template != "" {
+		var err error
+		if tmpl, err = config.ParseWebhookTemplate(wh.Template); err != nil {
+			return nil, fmt.Errorf("parse template: %w", err)
+		}
+	}
+	return buildPayload(wh, tmpl, event, data, now)
+}
+
+// buildPayload is BuildPayload with the webhook's template parsed.
+func buildPayload(wh config.WebhookConfig, tmpl *template.Template, event string, data interface{}, now time.Time) ([]byte, error) {
+	summary := Summarize(event, data)
+	ts := now.Format(time.RFC3339)
+
+	if tmpl != nil {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, TemplateData{Event: event, Timestamp: ts, Summary: summary, Data: data}); err != nil {
+			return nil, fmt.Errorf("execute template: %w", err)
+		}
+		if !json.Valid(buf.Bytes()) {
+			return nil, fmt.Errorf("template output is not valid JSON")
+		}
+		return buf.Bytes(), nil
+	}
+
+	switch wh.Format {
+	case "discord":
+		return json.Marshal(map[string]string{"content": summary})
+	case "slack":
+		return json.Marshal(map[string]string{"text": summary})
+	default:
+		return json.Marshal(map[string]interface{}{
+			"event":     event,
+			"timestamp": ts,
+			"summary":   summary,
+			"data":      data,
+		})
+	}
+}
+
+// Summarize returns a one-line human readable description of the event.
+func Summarize(event string, data interface{}) string {
+	switch d := data.(type) {
+	case events.JobFinished:
+		s := fmt.Sprintf("[Enque] Job %s: %s", d.Status, filepath.Base(d.InputPath))
+		if d.Status == "completed" && d.FinalOutputPath != "" {
+			s += " -> " + filepath.Base(d.FinalOutputPath)
+		}
+		if d.ExitCode != nil && *d.ExitCode != 0 {
+			s += fmt.Sprintf(" (exit %d)", *d.ExitCode)
+		}
+		if d.ErrorMessage != "" && d.Status != "completed" {
+			s += ": " + d.ErrorMessage
+		}
+		return s
+	case events.SessionSnapshot:
+		parts := []string{fmt.Sprintf("%d/%d completed", d.CompletedJobs, d.TotalJobs)}
+		for _, c := range []struct {
+			n     int
+			label string
+		}{
+			{d.FailedJobs, "failed"},
+			{d.TimeoutJobs, "timed out"},
+			{d.CancelledJobs, "cancelled"},
+			{d.SkippedJobs, "skipped"},
+		} {
+			if c.n > 0 {
+				parts = append(parts, fmt.Sprintf("%d %s", c.n, c.label))
+			}
+		}
+		return fmt.Sprintf("[Enque] Session %s: %s", d.State, strings.Join(parts, ", "))
+	default:
+		return "[Enque] " + event
+	}
+}
+
+func subscribes(wh config.WebhookConfig, event string) bool {
+	for _, e := range wh.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func isFailure(data interface{}) bool {
+	switch d := data.(type) {
+	case events.JobFinished:
+		return d.Status == "failed" || d.Status == "timeout"
+	case events.SessionSnapshot:
+		return d.FailedJobs > 0 || d.TimeoutJobs > 0 || d.State == "aborted"
+	}
+	return false
+}
+
+func webhookLabel(wh config.WebhookConfig) string {
+	if wh.Name != "" {
+		return wh.Name
+	}
+	return wh.URL
+}
@@ -0,0 +1,207 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yuta/enque/backend/config"
+	"github.com/yuta/enque/backend/events"
+)
+
+type hookRecorder struct {
+	mu       sync.Mutex
+	bodies   []map[string]interface{}
+	failures int // respond 503 this many times before succeeding
+}
+
+func (h *hookRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.failures > 0 {
+		h.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	data, _ := io.ReadAll(r.Body)
+	var m map[string]interface{}
+	json.Unmarshal(data, &m)
+	h.bodies = append(h.bodies, m)
+}
+
+func (h *hookRecorder) received() []map[string]interface{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]map[string]interface{}(nil), h.bodies...)
+}
+
+func newTestNotifier(webhooks ...config.WebhookConfig) *Notifier {
+	n := NewNotifier(nil)
+	n.BackoffBase = time.Millisecond
+	n.SetWebhooks(webhooks)
+	return n
+}
+
+func waitDeliveries(t *testing.T, n *Notifier) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	n.Wait(ctx)
+}
+
+func exitCode(c int) *int { return &c }
+
+func TestNotifier_FiltersEvents(t *testing.T) {
+	rec := &hookRecorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	n := newTestNotifier(config.WebhookConfig{
+		Enabled:      true,
+		URL:          srv.URL,
+		Events:       []string{EventJobFinished},
+		FailuresOnly: true,
+	})
+
+	n.Emit(events.NameJobStarted, events.JobStarted{JobID: "j0"})
+	n.Emit(events.NameJobFinished, events.JobFinished{JobID: "j1", Status: "completed", ExitCode: exitCode(0)})
+	n.Emit(events.NameJobFinished, events.JobFinished{JobID: "j2", Status: "failed", ExitCode: exitCode(1), InputPath: "/in/b.mp4"})
+	n.Emit(events.NameJobFinished, events.JobFinished{JobID: "j3_seg01", ParentJobID: "j3", Segment: 1, Status: "failed", ExitCode: exitCode(1)})
+	n.Emit(events.NameSessionFinished, events.SessionSnapshot{State: "completed", FailedJobs: 1})
+	waitDeliveries(t, n)
+
+	got := rec.received()
+	if len(got) != 1 {
+		t.Fatalf("received %d webhooks, want 1: %+v", len(got), got)
+	}
+	if got[0]["event"] != EventJobFinished {
+		t.Errorf("event=%v", got[0]["event"])
+	}
+	data := got[0]["data"].(map[string]interface{})
+	if data["job_id"] != "j2" {
+		t.Errorf("job_id=%v, want j2", data["job_id"])
+	}
+	if got[0]["summary"] != "[Enque] Job failed: b.mp4 (exit 1)" {
+		t.Errorf("summary=%v", got[0]["summary"])
+	}
+}
+
+func TestNotifier_DisabledWebhookIgnored(t *testing.T) {
+	rec := &hookRecorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	n := newTestNotifier(config.WebhookConfig{URL: srv.URL, Events: []string{EventJobFinished}})
+	n.Emit(events.NameJobFinished, events.JobFinished{Status: "failed"})
+	waitDeliveries(t, n)
+
+	if len(rec.received()) != 0 {
+		t.Error("disabled webhook must not fire")
+	}
+}
+
+func TestNotifier_TemplateParsedOnce(t *testing.T) {
+	rec := &hookRecorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	n := newTestNotifier(
+		config.WebhookConfig{Enabled: true, URL: srv.URL, Events: []string{EventJobFinished}, Template: `{"text":{{json .Summary}}}`},
+		config.WebhookConfig{Enabled: true, URL: srv.URL, Events: []string{EventJobFinished}, Template: `{{.Event`},
+	)
+	if len(n.webhooks) != 1 || n.webhooks[0].tmpl == nil {
+		t.Fatalf("webhooks=%+v, want the valid one with its template parsed", n.webhooks)
+	}
+	n.Emit(events.NameJobFinished, events.JobFinished{JobID: "j1", Status: "completed", InputPath: "/in/a.mp4"})
+	n.Emit(events.NameJobFinished, events.JobFinished{JobID: "j2", Status: "completed", InputPath: "/in/b.mp4"})
+	waitDeliveries(t, n)
+
+	got := rec.received()
+	if len(got) != 2 {
+		t.Fatalf("received %d webhooks, want 2: %+v", len(got), got)
+	}
+	for _, b := range got {
+		if text, _ := b["text"].(string); !strings.HasPrefix(text, "[Enque] Job completed: ") {
+			t.Errorf("body=%v", b)
+		}
+	}
+}
+
+func TestNotifier_RetriesWithBackoff(t *testing.T) {
+	rec := &hookRecorder{failures: 2}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	n := newTestNotifier(config.WebhookConfig{
+		Enabled:    true,
+		URL:        srv.URL,
+		Events:     []string{EventSessionFinished},
+		Format:     "slack",
+		MaxRetries: 2,
+	})
+	n.Emit(events.NameSessionFinished, events.SessionSnapshot{State: "completed", TotalJobs: 2, CompletedJobs: 2})
+	waitDeliveries(t, n)
+
+	got := rec.received()
+	if len(got) != 1 {
+		t.Fatalf("received %d, want 1 after retries", len(got))
+	}
+	if got[0]["text"] != "[Enque] Session completed: 2/2 completed" {
+		t.Errorf("text=%v", got[0]["text"])
+	}
+}
+
+func TestNotifier_GivesUpAfterMaxRetries(t *testing.T) {
+	rec := &hookRecorder{failures: 5}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	n := newTestNotifier()
+	err := n.deliver(config.WebhookConfig{URL: srv.URL, MaxRetries: 1}, []byte(`{}`))
+	if err == nil {
+		t.Fatal("expected delivery error")
+	}
+	rec.mu.Lock()
+	remaining := rec.failures
+	rec.mu.Unlock()
+	if remaining != 3 {
+		t.Errorf("server saw %d attempts, want 2", 5-remaining)
+	}
+}
+
+func TestBuildPayload_Formats(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	data := events.SessionSnapshot{State: "aborted", TotalJobs: 3, CompletedJobs: 1, CancelledJobs: 2}
+
+	tests := []struct {
+		name string
+		wh   config.WebhookConfig
+		want string
+	}{
+		{"discord", config.WebhookConfig{Format: "discord"}, `{"content":"[Enque] Session aborted: 1/3 completed, 2 cancelled"}`},
+		{"slack", config.WebhookConfig{Format: "slack"}, `{"text":"[Enque] Session aborted: 1/3 completed, 2 cancelled"}`},
+		{"template", config.WebhookConfig{Template: `{"e":{{json .Event}},"at":{{json .Timestamp}},"done":{{.Data.CompletedJobs}}}`},
+			`{"e":"session_finished","at":"2025-01-02T03:04:05Z","done":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BuildPayload(tt.wh, EventSessionFinished, data, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := BuildPayload(config.WebhookConfig{Template: `not json {{.Event}}`}, EventSessionFinished, data, now); err == nil {
+		t.Error("expected error for template producing invalid JSON")
+	}
+}
@@ -0,0 +1,125 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Crop is a crop rectangle proposed for a video: the pixels to remove on
+// each side of a Width x Height frame.
+type Crop struct {
+	Left   int `json:"left"`
+	Top    int `json:"top"`
+	Right  int `json:"right"`
+	Bottom int `json:"bottom"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// Samples is the number of sampled positions that reported a crop.
+	Samples int `json:"samples"`
+}
+
+// IsZero reports whether the crop removes nothing.
+func (c Crop) IsZero() bool {
+	return c.Left == 0 && c.Top == 0 && c.Right == 0 && c.Bottom == 0
+}
+
+// CropDetector runs ffmpeg's cropdetect filter on frames sampled across
+// an input.
+type CropDetector struct {
+	Path    string // ffmpeg executable; "ffmpeg" from PATH when empty
+	Timeout time.Duration
+	Samples int // positions sampled across the input
+	Frames  int // frames analyzed per position
+}
+
+// NewCropDetector returns a CropDetector for the given ffmpeg path.
+func NewCropDetector(path string) *CropDetector {
+	return &CropDetector{Path: path, Timeout: 2 * time.Minute, Samples: 8, Frames: 24}
+}
+
+// DetectCrop samples the input at evenly spaced positions and returns the
+// smallest crop that keeps the picture of every sample, so a dark scene
+// does not crop into a brighter one. Sides are rounded to even pixels.
+func (d *CropDetector) DetectCrop(ctx context.Context, path string, media MediaInfo) (Crop, error) {
+	if media.Width <= 0 || media.Height <= 0 {
+		return Crop{}, fmt.Errorf("cropdetect: video size unknown")
+	}
+	if media.DurationSec <= 0 {
+		return Crop{}, fmt.Errorf("cropdetect: duration unknown")
+	}
+	exe := d.Path
+	if exe == "" {
+		exe = "ffmpeg"
+	}
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+
+	var rects []cropRect
+	for i := 0; i < d.Samples; i++ {
+		pos := media.DurationSec * float64(i+1) / float64(d.Samples+1)
+		cmd := exec.CommandContext(ctx, exe, "-hide_banner", "-nostats",
+			"-ss", strconv.FormatFloat(pos, 'f', 3, 64), "-i", path,
+			"-frames:v", strconv.Itoa(d.Frames), "-an", "-sn", "-dn",
+			"-vf", "cropdetect=limit=24:round=2:reset=0", "-f", "null", "-")
+		out, err := cmd.CombinedOutput()
+		if ctx.Err() != nil {
+			return Crop{}, fmt.Errorf("cropdetect: %w", ctx.Err())
+		}
+		if err != nil {
+			return Crop{}, fmt.Errorf("cropdetect at %.1f s: %w", pos, err)
+		}
+		if r, ok := parseCropDetect(out); ok {
+			rects = append(rects, r)
+		}
+	}
+	if len(rects) == 0 {
+		return Crop{}, fmt.Errorf("cropdetect: no crop reported")
+	}
+	return combineCrops(rects, media.Width, media.Height), nil
+}
+
+// cropRect is one cropdetect result: a w x h area at x, y.
+type cropRect struct{ w, h, x, y int }
+
+var cropDetectRe = regexp.MustCompile(`crop=(\d+):(\d+):(\d+):(\d+)`)
+
+// parseCropDetect returns the last crop=w:h:x:y reported in ffmpeg's
+// cropdetect output.
+func parseCropDetect(out []byte) (cropRect, bool) {
+	all := cropDetectRe.FindAllSubmatch(out, -1)
+	if len(all) == 0 {
+		return cropRect{}, false
+	}
+	m := all[len(all)-1]
+	atoi := func(b []byte) int { n, _ := strconv.Atoi(string(b)); return n }
+	return cropRect{w: atoi(m[1]), h: atoi(m[2]), x: atoi(m[3]), y: atoi(m[4])}, true
+}
+
+// combineCrops returns the union of the sampled areas as a crop of a
+// width x height frame.
+func combineCrops(rects []cropRect, width, height int) Crop {
+	left, top, right, bottom := width, height, 0, 0
+	for _, r := range rects {
+		left = min(left, r.x)
+		top = min(top, r.y)
+		right = max(right, r.x+r.w)
+		bottom = max(bottom, r.y+r.h)
+	}
+	even := func(v int) int { return max(v, 0) &^ 1 }
+	return Crop{
+		Left:    even(left),
+		Top:     even(top),
+		Right:   even(width - right),
+		Bottom:  even(height - bottom),
+		Width:   width,
+		Height:  height,
+		Samples: len(rects),
+	}
+}
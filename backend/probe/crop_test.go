@@ -0,0 +1,32 @@
+package probe
+
+import "testing"
+
+func TestParseCropDetect(t *testing.T) {
+	out := []byte(`[Parsed_cropdetect_0 @ 000001] x1:0 x2:1919 y1:138 y2:941 w:1920 h:800 x:0 y:140 pts:1001 t:0.041708 crop=1920:800:0:140
+[Parsed_cropdetect_0 @ 000001] x1:0 x2:1919 y1:132 y2:947 w:1920 h:816 x:0 y:132 pts:2002 t:0.083417 crop=1920:816:0:132
+`)
+	r, ok := parseCropDetect(out)
+	if !ok || r != (cropRect{w: 1920, h: 816, x: 0, y: 132}) {
+		t.Errorf("rect=%+v ok=%t, want the last report", r, ok)
+	}
+	if _, ok := parseCropDetect([]byte("frame=  24 fps=0.0")); ok {
+		t.Error("expected no crop")
+	}
+}
+
+func TestCombineCrops(t *testing.T) {
+	// A dark scene reports a tighter crop; the union keeps its picture.
+	c := combineCrops([]cropRect{
+		{w: 1920, h: 800, x: 0, y: 140},
+		{w: 1904, h: 780, x: 8, y: 150},
+		{w: 1920, h: 802, x: 0, y: 139},
+	}, 1920, 1080)
+	want := Crop{Left: 0, Top: 138, Right: 0, Bottom: 138, Width: 1920, Height: 1080, Samples: 3}
+	if c != want {
+		t.Errorf("crop=%+v, want %+v", c, want)
+	}
+	if c.IsZero() || !combineCrops([]cropRect{{w: 1280, h: 720}}, 1280, 720).IsZero() {
+		t.Error("IsZero mismatch")
+	}
+}
@@ -0,0 +1,83 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// Loudness is the EBU R128 measurement of one audio track.
+type Loudness struct {
+	IntegratedLUFS float64 `json:"integrated_lufs"`
+	TruePeakDBTP   float64 `json:"true_peak_dbtp"`
+	LRA            float64 `json:"lra"`       // loudness range, LU
+	Threshold      float64 `json:"threshold"` // gating threshold, LUFS
+}
+
+// LoudnessMeter measures audio tracks with ffmpeg's loudnorm filter.
+type LoudnessMeter struct {
+	Path    string // ffmpeg executable; "ffmpeg" from PATH when empty
+	Timeout time.Duration
+}
+
+// NewLoudnessMeter returns a LoudnessMeter for the given ffmpeg path.
+func NewLoudnessMeter(path string) *LoudnessMeter {
+	return &LoudnessMeter{Path: path, Timeout: 30 * time.Minute}
+}
+
+// MeasureLoudness decodes audio track (1-based, among the input's audio
+// tracks) of the input once and returns its loudness.
+func (m *LoudnessMeter) MeasureLoudness(ctx context.Context, path string, track int) (Loudness, error) {
+	exe := m.Path
+	if exe == "" {
+		exe = "ffmpeg"
+	}
+	if m.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.Timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, exe, "-hide_banner", "-nostats", "-i", path,
+		"-map", fmt.Sprintf("0:a:%d", track-1), "-vn", "-sn", "-dn",
+		"-af", "loudnorm=print_format=json", "-f", "null", "-")
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return Loudness{}, fmt.Errorf("loudnorm: %w", ctx.Err())
+	}
+	if err != nil {
+		return Loudness{}, fmt.Errorf("loudnorm track %d: %w", track, err)
+	}
+	return parseLoudnorm(out)
+}
+
+// parseLoudnorm reads the JSON block loudnorm prints at the end of its
+// output. Values are strings there, and "-inf" for silence.
+func parseLoudnorm(out []byte) (Loudness, error) {
+	start := bytes.LastIndexByte(out, '{')
+	end := bytes.LastIndexByte(out, '}')
+	if start < 0 || end < start {
+		return Loudness{}, fmt.Errorf("loudnorm: no measurement in output")
+	}
+	var raw struct {
+		InputI      string `json:"input_i"`
+		InputTP     string `json:"input_tp"`
+		InputLRA    string `json:"input_lra"`
+		InputThresh string `json:"input_thresh"`
+	}
+	if err := json.Unmarshal(out[start:end+1], &raw); err != nil {
+		return Loudness{}, fmt.Errorf("loudnorm: %w", err)
+	}
+	var l Loudness
+	var err error
+	if l.IntegratedLUFS, err = strconv.ParseFloat(raw.InputI, 64); err != nil || l.IntegratedLUFS < -99 {
+		return Loudness{}, fmt.Errorf("loudnorm: track is silent")
+	}
+	l.TruePeakDBTP, _ = strconv.ParseFloat(raw.InputTP, 64)
+	l.LRA, _ = strconv.ParseFloat(raw.InputLRA, 64)
+	l.Threshold, _ = strconv.ParseFloat(raw.InputThresh, 64)
+	return l, nil
+}
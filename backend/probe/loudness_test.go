@@ -0,0 +1,35 @@
+package probe
+
+import "testing"
+
+func TestParseLoudnorm(t *testing.T) {
+	out := []byte(`Input #0, matroska,webm, from 'rec.mkv':
+[Parsed_loudnorm_0 @ 0x55d0c8c0] 
+{
+	"input_i" : "-31.42",
+	"input_tp" : "-9.87",
+	"input_lra" : "6.10",
+	"input_thresh" : "-41.80",
+	"output_i" : "-23.05",
+	"output_tp" : "-2.00",
+	"output_lra" : "5.30",
+	"output_thresh" : "-33.40",
+	"normalization_type" : "dynamic",
+	"target_offset" : "0.05"
+}
+`)
+	l, err := parseLoudnorm(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l != (Loudness{IntegratedLUFS: -31.42, TruePeakDBTP: -9.87, LRA: 6.1, Threshold: -41.8}) {
+		t.Errorf("loudness=%+v", l)
+	}
+
+	if _, err := parseLoudnorm([]byte(`{"input_i" : "-inf", "input_tp" : "-inf"}`)); err == nil {
+		t.Error("expected error for a silent track")
+	}
+	if _, err := parseLoudnorm([]byte("Conversion failed!")); err == nil {
+		t.Error("expected error without a measurement")
+	}
+}
@@ -0,0 +1,258 @@
+// Package probe reads media properties with ffprobe.
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MediaInfo holds the properties of a media file that profile selection
+// and encoding decisions depend on. Video fields describe the first video
+// stream.
+type MediaInfo struct {
+	FormatName  string  `json:"format_name"`
+	DurationSec float64 `json:"duration_sec"`
+	SizeBytes   int64   `json:"size_bytes"`
+	BitrateKbps float64 `json:"bitrate_kbps"`
+
+	VideoCodec     string  `json:"video_codec"`
+	Width          int     `json:"width"`
+	Height         int     `json:"height"`
+	FPS            float64 `json:"fps"`
+	BitDepth       int     `json:"bit_depth"`
+	PixFmt         string  `json:"pix_fmt"`
+	ColorTransfer  string  `json:"color_transfer"`
+	ColorPrimaries string  `json:"color_primaries"`
+	ColorSpace     string  `json:"color_space"`
+	HDR            bool    `json:"hdr"`
+	DolbyVision    bool    `json:"dolby_vision"`
+	// MasterDisplay is the mastering display color volume in NVEncC's
+	// --master-display syntax, e.g. "G(13250,34500)B(7500,3000)R(34000,16000)WP(15635,16450)L(10000000,50)".
+	MasterDisplay string `json:"master_display,omitempty"`
+	MaxCLL        int    `json:"max_cll,omitempty"`  // cd/m2
+	MaxFALL       int    `json:"max_fall,omitempty"` // cd/m2
+
+	Streams []Stream `json:"streams"`
+}
+
+// Stream is one stream of the file.
+type Stream struct {
+	Index    int    `json:"index"`
+	Type     string `json:"type"` // "video", "audio", "subtitle", "data", "attachment"
+	Codec    string `json:"codec"`
+	Language string `json:"language,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Channels int    `json:"channels,omitempty"`
+	Default  bool   `json:"default,omitempty"`
+	Forced   bool   `json:"forced,omitempty"`
+	Comment  bool   `json:"comment,omitempty"` // commentary disposition
+	// BitrateKbps is 0 when neither the stream nor its tags state it.
+	BitrateKbps float64 `json:"bitrate_kbps,omitempty"`
+}
+
+// Prober runs ffprobe.
+type Prober struct {
+	Path    string // ffprobe executable; "ffprobe" from PATH when empty
+	Timeout time.Duration
+}
+
+// New returns a Prober for the given ffprobe path.
+func New(path string) *Prober {
+	return &Prober{Path: path, Timeout: 30 * time.Second}
+}
+
+// Probe reads the properties of the file at path.
+func (p *Prober) Probe(ctx context.Context, path string) (MediaInfo, error) {
+	exe := p.Path
+	if exe == "" {
+		exe = "ffprobe"
+	}
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, exe, "-v", "error", "-print_format", "json", "-show_format", "-show_streams", path)
+	out, err := cmd.Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok && len(ee.Stderr) > 0 {
+			return MediaInfo{}, fmt.Errorf("ffprobe: %s", strings.TrimSpace(string(ee.Stderr)))
+		}
+		return MediaInfo{}, fmt.Errorf("ffprobe: %w", err)
+	}
+	return Parse(out)
+}
+
+type ffprobeOutput struct {
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		Size       string `json:"size"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+	Streams []struct {
+		Index            int               `json:"index"`
+		CodecType        string            `json:"codec_type"`
+		CodecName        string            `json:"codec_name"`
+		Width            int               `json:"width"`
+		Height           int               `json:"height"`
+		PixFmt           string            `json:"pix_fmt"`
+		BitsPerRawSample string            `json:"bits_per_raw_sample"`
+		AvgFrameRate     string            `json:"avg_frame_rate"`
+		RFrameRate       string            `json:"r_frame_rate"`
+		ColorTransfer    string            `json:"color_transfer"`
+		ColorPrimaries   string            `json:"color_primaries"`
+		ColorSpace       string            `json:"color_space"`
+		Channels         int               `json:"channels"`
+		BitRate          string            `json:"bit_rate"`
+		Tags             map[string]string `json:"tags"`
+		Disposition      map[string]int    `json:"disposition"`
+		SideDataList     []sideData        `json:"side_data_list"`
+	} `json:"streams"`
+}
+
+type sideData struct {
+	SideDataType string `json:"side_data_type"`
+	// Mastering display metadata, as rationals like "34000/50000"
+	RedX         string `json:"red_x"`
+	RedY         string `json:"red_y"`
+	GreenX       string `json:"green_x"`
+	GreenY       string `json:"green_y"`
+	BlueX        string `json:"blue_x"`
+	BlueY        string `json:"blue_y"`
+	WhitePointX  string `json:"white_point_x"`
+	WhitePointY  string `json:"white_point_y"`
+	MinLuminance string `json:"min_luminance"`
+	MaxLuminance string `json:"max_luminance"`
+	// Content light level metadata
+	MaxContent int `json:"max_content"`
+	MaxAverage int `json:"max_average"`
+}
+
+// Parse converts ffprobe's JSON output (-show_format -show_streams).
+func Parse(data []byte) (MediaInfo, error) {
+	var raw ffprobeOutput
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return MediaInfo{}, fmt.Errorf("parse ffprobe output: %w", err)
+	}
+
+	info := MediaInfo{FormatName: raw.Format.FormatName}
+	info.DurationSec, _ = strconv.ParseFloat(raw.Format.Duration, 64)
+	info.SizeBytes, _ = strconv.ParseInt(raw.Format.Size, 10, 64)
+	if br, err := strconv.ParseFloat(raw.Format.BitRate, 64); err == nil {
+		info.BitrateKbps = br / 1000
+	}
+
+	videoSeen := false
+	for _, s := range raw.Streams {
+		st := Stream{
+			Index:    s.Index,
+			Type:     s.CodecType,
+			Codec:    s.CodecName,
+			Language: s.Tags["language"],
+			Title:    s.Tags["title"],
+			Channels: s.Channels,
+			Default:  s.Disposition["default"] == 1,
+			Forced:   s.Disposition["forced"] == 1,
+			Comment:  s.Disposition["comment"] == 1,
+		}
+		// Matroska keeps stream bitrates in statistics tags.
+		for _, v := range []string{s.BitRate, s.Tags["BPS"], s.Tags["BPS-eng"]} {
+			if br, err := strconv.ParseFloat(v, 64); err == nil && br > 0 {
+				st.BitrateKbps = br / 1000
+				break
+			}
+		}
+		info.Streams = append(info.Streams, st)
+
+		// Cover art is a video stream too.
+		if s.CodecType != "video" || videoSeen || s.Disposition["attached_pic"] == 1 {
+			continue
+		}
+		videoSeen = true
+		info.VideoCodec = s.CodecName
+		info.Width, info.Height = s.Width, s.Height
+		info.PixFmt = s.PixFmt
+		info.ColorTransfer = s.ColorTransfer
+		info.ColorPrimaries = s.ColorPrimaries
+		info.ColorSpace = s.ColorSpace
+		info.FPS = parseRate(s.AvgFrameRate)
+		if info.FPS == 0 {
+			info.FPS = parseRate(s.RFrameRate)
+		}
+		info.BitDepth, _ = strconv.Atoi(s.BitsPerRawSample)
+		if info.BitDepth == 0 {
+			info.BitDepth = depthFromPixFmt(s.PixFmt)
+		}
+		for _, sd := range s.SideDataList {
+			switch typ := strings.ToLower(sd.SideDataType); {
+			case strings.Contains(typ, "dovi"):
+				info.DolbyVision = true
+			case typ == "mastering display metadata":
+				info.MasterDisplay = masterDisplay(sd)
+			case typ == "content light level metadata":
+				info.MaxCLL, info.MaxFALL = sd.MaxContent, sd.MaxAverage
+			}
+		}
+		info.HDR = info.DolbyVision || s.ColorTransfer == "smpte2084" || s.ColorTransfer == "arib-std-b67"
+	}
+	if !videoSeen && len(raw.Streams) == 0 {
+		return info, fmt.Errorf("ffprobe found no streams")
+	}
+	return info, nil
+}
+
+// masterDisplay renders mastering display metadata in NVEncC's syntax:
+// chromaticities in units of 0.00002, luminance in units of 0.0001 cd/m2.
+// It returns "" when a value is missing.
+func masterDisplay(sd sideData) string {
+	var v [10]int
+	for i, r := range []string{sd.GreenX, sd.GreenY, sd.BlueX, sd.BlueY, sd.RedX, sd.RedY,
+		sd.WhitePointX, sd.WhitePointY, sd.MaxLuminance, sd.MinLuminance} {
+		f := parseRate(r)
+		if f <= 0 && i != 9 {
+			return ""
+		}
+		scale := 50000.0
+		if i >= 8 {
+			scale = 10000
+		}
+		v[i] = int(math.Round(f * scale))
+	}
+	return fmt.Sprintf("G(%d,%d)B(%d,%d)R(%d,%d)WP(%d,%d)L(%d,%d)", v[0], v[1], v[2], v[3], v[4], v[5], v[6], v[7], v[8], v[9])
+}
+
+// parseRate parses "30000/1001" or "25".
+func parseRate(s string) float64 {
+	num, den, frac := strings.Cut(s, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	if !frac {
+		return n
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+func depthFromPixFmt(pixFmt string) int {
+	switch {
+	case pixFmt == "":
+		return 0
+	case strings.Contains(pixFmt, "12"):
+		return 12
+	case strings.Contains(pixFmt, "10"), strings.HasPrefix(pixFmt, "p010"):
+		return 10
+	}
+	return 8
+}
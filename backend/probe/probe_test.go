@@ -0,0 +1,78 @@
+package probe
+
+import "testing"
+
+const hdrOutput = `{
+  "streams": [
+    {"index": 0, "codec_type": "video", "codec_name": "hevc", "width": 3840, "height": 2160,
+     "pix_fmt": "yuv420p10le", "avg_frame_rate": "24000/1001", "r_frame_rate": "24000/1001",
+     "color_transfer": "smpte2084", "color_primaries": "bt2020", "color_space": "bt2020nc",
+     "disposition": {"default": 1},
+     "side_data_list": [
+       {"side_data_type": "Mastering display metadata", "red_x": "34000/50000", "red_y": "16000/50000",
+        "green_x": "13250/50000", "green_y": "34500/50000", "blue_x": "7500/50000", "blue_y": "3000/50000",
+        "white_point_x": "15635/50000", "white_point_y": "16450/50000",
+        "min_luminance": "50/10000", "max_luminance": "10000000/10000"},
+       {"side_data_type": "Content light level metadata", "max_content": 1000, "max_average": 400}
+     ]},
+    {"index": 1, "codec_type": "audio", "codec_name": "eac3", "channels": 6,
+     "tags": {"language": "jpn", "title": "Main", "BPS": "640000"}, "disposition": {"default": 1}},
+    {"index": 2, "codec_type": "subtitle", "codec_name": "hdmv_pgs_subtitle", "tags": {"language": "eng"}},
+    {"index": 3, "codec_type": "video", "codec_name": "mjpeg", "width": 600, "height": 600,
+     "disposition": {"attached_pic": 1}}
+  ],
+  "format": {"format_name": "matroska,webm", "duration": "5400.5", "size": "21474836480", "bit_rate": "31811000"}
+}`
+
+func TestParse(t *testing.T) {
+	info, err := Parse([]byte(hdrOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.VideoCodec != "hevc" || info.Width != 3840 || info.Height != 2160 {
+		t.Errorf("video=%s %dx%d", info.VideoCodec, info.Width, info.Height)
+	}
+	if info.FPS < 23.97 || info.FPS > 23.98 {
+		t.Errorf("fps=%f", info.FPS)
+	}
+	if info.BitDepth != 10 || !info.HDR || info.DolbyVision {
+		t.Errorf("bit_depth=%d hdr=%t dv=%t", info.BitDepth, info.HDR, info.DolbyVision)
+	}
+	if info.MasterDisplay != "G(13250,34500)B(7500,3000)R(34000,16000)WP(15635,16450)L(10000000,50)" || info.MaxCLL != 1000 || info.MaxFALL != 400 {
+		t.Errorf("master_display=%q max_cll=%d max_fall=%d", info.MasterDisplay, info.MaxCLL, info.MaxFALL)
+	}
+	if info.DurationSec != 5400.5 || info.SizeBytes != 21474836480 || info.BitrateKbps != 31811 {
+		t.Errorf("format=%+v", info)
+	}
+	if len(info.Streams) != 4 || info.Streams[1].Language != "jpn" || info.Streams[1].Channels != 6 || !info.Streams[1].Default || info.Streams[1].BitrateKbps != 640 {
+		t.Errorf("streams=%+v", info.Streams)
+	}
+}
+
+func TestParse_SDRAndDolbyVision(t *testing.T) {
+	sdr, err := Parse([]byte(`{"streams": [{"codec_type": "video", "codec_name": "mpeg2video",
+		"width": 1440, "height": 1080, "pix_fmt": "yuv420p", "avg_frame_rate": "0/0", "r_frame_rate": "30000/1001"}],
+		"format": {}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sdr.HDR || sdr.BitDepth != 8 || sdr.FPS < 29.97 || sdr.FPS > 29.98 {
+		t.Errorf("sdr=%+v", sdr)
+	}
+
+	dv, err := Parse([]byte(`{"streams": [{"codec_type": "video", "codec_name": "hevc", "pix_fmt": "yuv420p10le",
+		"bits_per_raw_sample": "10", "side_data_list": [{"side_data_type": "DOVI configuration record"}]}], "format": {}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dv.DolbyVision || !dv.HDR {
+		t.Errorf("dolby vision not detected: %+v", dv)
+	}
+
+	if _, err := Parse([]byte(`{"streams": [], "format": {}}`)); err == nil {
+		t.Error("expected error for no streams")
+	}
+	if _, err := Parse([]byte(`not json`)); err == nil {
+		t.Error("expected error for bad output")
+	}
+}
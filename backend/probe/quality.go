@@ -0,0 +1,87 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QualityMeter compares an encode with its source with ffmpeg's ssim or
+// libvmaf filter.
+type QualityMeter struct {
+	Path    string // ffmpeg executable; "ffmpeg" from PATH when empty
+	Timeout time.Duration
+}
+
+// NewQualityMeter returns a QualityMeter for the given ffmpeg path.
+func NewQualityMeter(path string) *QualityMeter {
+	return &QualityMeter{Path: path, Timeout: 30 * time.Minute}
+}
+
+// Measure returns the "ssim" (0..1) or "vmaf" (0..100) score of distorted
+// against duration seconds of source from start. distorted is scaled to
+// width x height, the size of source, first. Pass duration 0 to compare
+// to the end of source.
+func (m *QualityMeter) Measure(ctx context.Context, metric, distorted, source string, start, duration float64, width, height int) (float64, error) {
+	var filter string
+	var re *regexp.Regexp
+	switch metric {
+	case "ssim":
+		filter, re = "ssim", ssimAllRe
+	case "vmaf":
+		filter, re = "libvmaf", vmafScoreRe
+	default:
+		return 0, fmt.Errorf("quality: unknown metric %q", metric)
+	}
+	exe := m.Path
+	if exe == "" {
+		exe = "ffmpeg"
+	}
+	if m.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.Timeout)
+		defer cancel()
+	}
+
+	args := []string{"-hide_banner", "-nostats", "-i", distorted}
+	if start > 0 {
+		args = append(args, "-ss", strconv.FormatFloat(start, 'f', 3, 64))
+	}
+	if duration > 0 {
+		args = append(args, "-t", strconv.FormatFloat(duration, 'f', 3, 64))
+	}
+	args = append(args, "-i", source, "-lavfi", fmt.Sprintf(
+		"[0:v]scale=%d:%d:flags=bicubic,setpts=PTS-STARTPTS[d];[1:v]setpts=PTS-STARTPTS[r];[d][r]%s",
+		width, height, filter), "-f", "null", "-")
+	out, err := exec.CommandContext(ctx, exe, args...).CombinedOutput()
+	if ctx.Err() != nil {
+		return 0, fmt.Errorf("%s: %w", metric, ctx.Err())
+	}
+	if err != nil {
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		return 0, fmt.Errorf("%s: %w: %s", metric, err, lines[len(lines)-1])
+	}
+	return parseScore(metric, re, out)
+}
+
+var (
+	ssimAllRe   = regexp.MustCompile(`SSIM .*\bAll:([\d.]+)`)
+	vmafScoreRe = regexp.MustCompile(`VMAF score\s*[:=]\s*([\d.]+)`)
+)
+
+// parseScore reads the last score the filter printed.
+func parseScore(metric string, re *regexp.Regexp, out []byte) (float64, error) {
+	matches := re.FindAllSubmatch(out, -1)
+	if len(matches) == 0 {
+		return 0, fmt.Errorf("%s: no score in output", metric)
+	}
+	v, err := strconv.ParseFloat(string(matches[len(matches)-1][1]), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", metric, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,27 @@
+package probe
+
+import "testing"
+
+func TestParseScore(t *testing.T) {
+	ssim := []byte(`Input #0, matroska,webm, from 'sample.mkv':
+[Parsed_ssim_4 @ 0x55d1] SSIM Y:0.985421 (18.362) U:0.991002 (20.457) V:0.990113 (20.048) All:0.987524 (19.037)
+`)
+	if got, err := parseScore("ssim", ssimAllRe, ssim); err != nil || got != 0.987524 {
+		t.Errorf("ssim=%v, %v; want 0.987524", got, err)
+	}
+
+	vmaf := []byte(`[Parsed_libvmaf_4 @ 0x55d1] VMAF score: 94.812003
+`)
+	if got, err := parseScore("vmaf", vmafScoreRe, vmaf); err != nil || got != 94.812003 {
+		t.Errorf("vmaf=%v, %v; want 94.812003", got, err)
+	}
+	old := []byte(`[libvmaf @ 0x55d1] VMAF score = 91.5
+`)
+	if got, err := parseScore("vmaf", vmafScoreRe, old); err != nil || got != 91.5 {
+		t.Errorf("vmaf (old)=%v, %v; want 91.5", got, err)
+	}
+
+	if _, err := parseScore("ssim", ssimAllRe, []byte("Conversion failed!\n")); err == nil {
+		t.Error("expected an error without a score")
+	}
+}
@@ -0,0 +1,122 @@
+package probe
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SplitFinder lists the points an input can be split at for chunked
+// encoding: its video keyframes (ffprobe) and scene changes (ffmpeg).
+type SplitFinder struct {
+	FFprobePath string // "ffprobe" from PATH when empty
+	FFmpegPath  string // "ffmpeg" from PATH when empty
+	Timeout     time.Duration
+	// SceneThreshold is the scene score (0..1) of a scene change.
+	SceneThreshold float64
+}
+
+// NewSplitFinder returns a SplitFinder for the given tool paths.
+func NewSplitFinder(ffprobePath, ffmpegPath string) *SplitFinder {
+	return &SplitFinder{FFprobePath: ffprobePath, FFmpegPath: ffmpegPath, Timeout: 30 * time.Minute, SceneThreshold: 0.4}
+}
+
+// Keyframes returns the times in seconds of the first video stream's
+// keyframes, in order. It reads packet flags only, without decoding.
+func (f *SplitFinder) Keyframes(ctx context.Context, path string) ([]float64, error) {
+	return f.keyframes(ctx, path)
+}
+
+// KeyframesBetween is Keyframes for the part of the input from from to to
+// seconds. ffprobe seeks to the keyframe before from, so that keyframe is
+// included.
+func (f *SplitFinder) KeyframesBetween(ctx context.Context, path string, from, to float64) ([]float64, error) {
+	return f.keyframes(ctx, path, "-read_intervals", fmt.Sprintf("%.3f%%%.3f", from, to))
+}
+
+func (f *SplitFinder) keyframes(ctx context.Context, path string, extra ...string) ([]float64, error) {
+	exe := f.FFprobePath
+	if exe == "" {
+		exe = "ffprobe"
+	}
+	ctx, cancel := f.withTimeout(ctx)
+	defer cancel()
+	args := append([]string{"-v", "error", "-select_streams", "v:0"}, extra...)
+	args = append(args, "-show_entries", "packet=pts_time,flags", "-of", "csv=p=0", path)
+	out, err := exec.CommandContext(ctx, exe, args...).Output()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("keyframes: %w", ctx.Err())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("keyframes: %w", err)
+	}
+	return parseKeyframes(out), nil
+}
+
+// SceneChanges returns the times in seconds where ffmpeg's scene score
+// exceeds the threshold. It decodes the whole input, scaled down.
+func (f *SplitFinder) SceneChanges(ctx context.Context, path string) ([]float64, error) {
+	exe := f.FFmpegPath
+	if exe == "" {
+		exe = "ffmpeg"
+	}
+	ctx, cancel := f.withTimeout(ctx)
+	defer cancel()
+	filter := fmt.Sprintf("scale=320:-2,select='gt(scene,%.2f)',showinfo", f.SceneThreshold)
+	cmd := exec.CommandContext(ctx, exe, "-hide_banner", "-nostats", "-i", path,
+		"-map", "0:v:0", "-an", "-sn", "-dn", "-vf", filter, "-f", "null", "-")
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("scene detection: %w", ctx.Err())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scene detection: %w", err)
+	}
+	return parseShowinfo(out), nil
+}
+
+func (f *SplitFinder) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if f.Timeout > 0 {
+		return context.WithTimeout(ctx, f.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// parseKeyframes reads "pts_time,flags" lines and keeps the packets
+// flagged K. Packets come in decode order, so the times are sorted.
+func parseKeyframes(out []byte) []float64 {
+	var times []float64
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		pts, flags, ok := strings.Cut(strings.TrimSpace(sc.Text()), ",")
+		if !ok || !strings.HasPrefix(flags, "K") {
+			continue
+		}
+		t, err := strconv.ParseFloat(pts, 64)
+		if err != nil {
+			continue
+		}
+		times = append(times, t)
+	}
+	slices.Sort(times)
+	return slices.Compact(times)
+}
+
+var showinfoPTSRe = regexp.MustCompile(`Parsed_showinfo.*\bpts_time:\s*(-?[\d.]+)`)
+
+func parseShowinfo(out []byte) []float64 {
+	var times []float64
+	for _, m := range showinfoPTSRe.FindAllSubmatch(out, -1) {
+		if t, err := strconv.ParseFloat(string(m[1]), 64); err == nil {
+			times = append(times, t)
+		}
+	}
+	return times
+}
@@ -0,0 +1,24 @@
+package probe
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseKeyframes(t *testing.T) {
+	out := []byte("0.000000,K__\n0.041708,___\n4.004000,K_\n2.002000,K__\nN/A,K__\n4.004000,K__\n6.006000,__D\n")
+	if got, want := parseKeyframes(out), []float64{0, 2.002, 4.004}; !slices.Equal(got, want) {
+		t.Errorf("keyframes=%v, want %v", got, want)
+	}
+}
+
+func TestParseShowinfo(t *testing.T) {
+	out := []byte(`[Parsed_showinfo_2 @ 0x5581] config in time_base: 1/1000, frame_rate: 24000/1001
+[Parsed_showinfo_2 @ 0x5581] n:   0 pts:  12304 pts_time:12.304  duration:     42 fmt:yuv420p
+[Parsed_showinfo_2 @ 0x5581] n:   1 pts: 310500 pts_time:310.5   duration:     42 fmt:yuv420p
+frame=    2 fps=0.0 q=-0.0 Lsize=N/A time=00:05:10.54
+`)
+	if got, want := parseShowinfo(out), []float64{12.304, 310.5}; !slices.Equal(got, want) {
+		t.Errorf("scenes=%v, want %v", got, want)
+	}
+}
@@ -0,0 +1,371 @@
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Bundle identification for exported profile files.
+const (
+	BundleFormat         = "enque-profiles"
+	CurrentBundleVersion = 1
+)
+
+// Bundle is the portable file format for sharing profiles.
+type Bundle struct {
+	Format        string    `json:"format"`
+	BundleVersion int       `json:"bundle_version"`
+	ExportedAt    string    `json:"exported_at"`
+	Profiles      []Profile `json:"profiles"`
+}
+
+// ConflictPolicy decides what happens when an imported profile has the ID
+// or name of an existing one.
+type ConflictPolicy string
+
+const (
+	ConflictRename  ConflictPolicy = "rename"  // import under a new ID and/or a unique name
+	ConflictReplace ConflictPolicy = "replace" // overwrite the existing user profile
+	ConflictSkip    ConflictPolicy = "skip"    // keep the existing profile
+)
+
+// ExportOptions controls ExportProfiles.
+type ExportOptions struct {
+	StripMachineFields bool `json:"strip_machine_fields"`
+}
+
+// ImportOptions controls ImportProfiles.
+type ImportOptions struct {
+	OnConflict         ConflictPolicy `json:"on_conflict"`
+	StripMachineFields bool           `json:"strip_machine_fields"`
+}
+
+// ImportedProfile reports what happened to one profile of a bundle.
+type ImportedProfile struct {
+	SourceID   string `json:"source_id"`
+	SourceName string `json:"source_name"`
+	ID         string `json:"id,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Action     string `json:"action"` // "created", "renamed", "replaced", "skipped", "invalid"
+	Reason     string `json:"reason,omitempty"`
+}
+
+// ImportResult lists the outcome per bundle entry, in bundle order.
+type ImportResult struct {
+	Profiles []ImportedProfile `json:"profiles"`
+}
+
+// Count returns how many entries ended with the given action.
+func (r ImportResult) Count(action string) int {
+	n := 0
+	for _, p := range r.Profiles {
+		if p.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// StripMachineFields resets settings that only make sense on the machine
+// the profile was tuned on (currently the GPU device selection).
+func StripMachineFields(p Profile) Profile {
+	p.Device = "auto"
+	return p
+}
+
+// ExportProfiles writes the profiles with the given IDs (all profiles when
+// ids is empty) to path as a Bundle.
+func (m *Manager) ExportProfiles(ids []string, path string, opts ExportOptions) error {
+	m.mu.RLock()
+	var selected []Profile
+	if len(ids) == 0 {
+		selected = append(selected, m.profiles...)
+	}
+	for _, id := range ids {
+		p, ok := m.findLocked(id)
+		if !ok {
+			m.mu.RUnlock()
+			return fmt.Errorf("profile not found: %s", id)
+		}
+		selected = append(selected, p)
+	}
+	m.mu.RUnlock()
+
+	b := Bundle{
+		Format:        BundleFormat,
+		BundleVersion: CurrentBundleVersion,
+		ExportedAt:    time.Now().Format(time.RFC3339),
+		Profiles:      make([]Profile, len(selected)),
+	}
+	for i, p := range selected {
+		if opts.StripMachineFields {
+			p = StripMachineFields(p)
+		}
+		b.Profiles[i] = p
+	}
+
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal bundle: %w", err)
+	}
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("create dir: %w", err)
+		}
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("write bundle: %w", err)
+	}
+	return nil
+}
+
+// ReadBundle parses a bundle. Plain profiles.json files ({"profiles": [...]}),
+// bare arrays and single profile objects are accepted too.
+func ReadBundle(data []byte) (Bundle, error) {
+	var probe struct {
+		Format        string          `json:"format"`
+		BundleVersion int             `json:"bundle_version"`
+		Profiles      json.RawMessage `json:"profiles"`
+		Name          *string         `json:"name"`
+	}
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "[") {
+		var flat []Profile
+		if err := json.Unmarshal(data, &flat); err != nil {
+			return Bundle{}, fmt.Errorf("E_VALIDATION: parse bundle: %w", err)
+		}
+		return Bundle{Format: BundleFormat, BundleVersion: CurrentBundleVersion, Profiles: flat}, nil
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return Bundle{}, fmt.Errorf("E_VALIDATION: parse bundle: %w", err)
+	}
+
+	switch {
+	case probe.Format != "":
+		if probe.Format != BundleFormat {
+			return Bundle{}, fmt.Errorf("E_VALIDATION: unknown bundle format %q", probe.Format)
+		}
+		if probe.BundleVersion < 1 || probe.BundleVersion > CurrentBundleVersion {
+			return Bundle{}, fmt.Errorf("E_VALIDATION: unsupported bundle_version %d", probe.BundleVersion)
+		}
+		var b Bundle
+		if err := json.Unmarshal(data, &b); err != nil {
+			return Bundle{}, fmt.Errorf("E_VALIDATION: parse bundle: %w", err)
+		}
+		return b, nil
+	case probe.Profiles != nil:
+		var pf ProfilesFile
+		if err := json.Unmarshal(data, &pf); err != nil {
+			return Bundle{}, fmt.Errorf("E_VALIDATION: parse bundle: %w", err)
+		}
+		return Bundle{Format: BundleFormat, BundleVersion: CurrentBundleVersion, Profiles: pf.Profiles}, nil
+	case probe.Name != nil:
+		var p Profile
+		if err := json.Unmarshal(data, &p); err != nil {
+			return Bundle{}, fmt.Errorf("E_VALIDATION: parse bundle: %w", err)
+		}
+		return Bundle{Format: BundleFormat, BundleVersion: CurrentBundleVersion, Profiles: []Profile{p}}, nil
+	default:
+		return Bundle{}, fmt.Errorf("E_VALIDATION: file contains no profiles")
+	}
+}
+
+// ImportProfiles reads a bundle and adds its profiles as user profiles.
+// Each entry is migrated and validated; invalid entries are reported and
+// skipped. Conflicts with existing IDs or names follow opts.OnConflict
+// (rename when empty). Presets are never replaced.
+func (m *Manager) ImportProfiles(path string, opts ImportOptions) (ImportResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("read bundle: %w", err)
+	}
+	b, err := ReadBundle(data)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	policy := opts.OnConflict
+	switch policy {
+	case "":
+		policy = ConflictRename
+	case ConflictRename, ConflictReplace, ConflictSkip:
+	default:
+		return ImportResult{}, fmt.Errorf("E_VALIDATION: invalid conflict policy %q", opts.OnConflict)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before := make([]Profile, len(m.profiles))
+	copy(before, m.profiles)
+	var result ImportResult
+	changed := false
+	for _, src := range b.Profiles {
+		entry := ImportedProfile{SourceID: src.ID, SourceName: src.Name}
+
+		p, err := Migrate(src)
+		if err == nil {
+			err = m.validateLocked(p)
+		}
+		if err == nil {
+			err = checkOverrides(p.Overrides)
+		}
+		if err != nil {
+			entry.Action = "invalid"
+			entry.Reason = err.Error()
+			result.Profiles = append(result.Profiles, entry)
+			continue
+		}
+		if opts.StripMachineFields {
+			p = StripMachineFields(p)
+		}
+		p.IsPreset = false
+		p.Revision = 0
+		p.Name = strings.TrimSpace(p.Name)
+
+		target := m.conflictLocked(p)
+		switch {
+		case target < 0:
+			if p.ID == "" {
+				p.ID = uuid.New().String()
+			}
+			entry.Action = "created"
+			m.profiles = append(m.profiles, p)
+		case policy == ConflictSkip:
+			entry.Action = "skipped"
+			entry.Reason = fmt.Sprintf("conflicts with existing profile %q", m.profiles[target].Name)
+			result.Profiles = append(result.Profiles, entry)
+			continue
+		case policy == ConflictReplace && !m.profiles[target].IsPreset && !m.nameTakenLocked(p.Name, target):
+			p.ID = m.profiles[target].ID
+			entry.Action = "replaced"
+			m.profiles[target] = p
+		default:
+			if _, taken := m.findLocked(p.ID); taken || p.ID == "" {
+				p.ID = uuid.New().String()
+			}
+			p.Name = m.uniqueNameLocked(p.Name)
+			entry.Action = "renamed"
+			m.profiles = append(m.profiles, p)
+		}
+
+		entry.ID = p.ID
+		entry.Name = p.Name
+		result.Profiles = append(result.Profiles, entry)
+		changed = true
+	}
+
+	if changed {
+		m.relinkImportedLocked(result)
+		notes := make(map[string]string)
+		for _, e := range result.Profiles {
+			if e.ID != "" {
+				notes[e.ID] = "imported from " + filepath.Base(path)
+			}
+		}
+		m.trackLocked(before, notes)
+		if err := m.commitLocked(); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// relinkImportedLocked points imported children at the imported copy of
+// their parent. Children whose parent is neither in the bundle nor stored
+// here keep their exported values as a standalone profile.
+func (m *Manager) relinkImportedLocked(result ImportResult) {
+	newIDs := make(map[string]string)
+	imported := make(map[string]bool)
+	for _, e := range result.Profiles {
+		if e.ID != "" && e.Action != "skipped" {
+			newIDs[e.SourceID] = e.ID
+			imported[e.ID] = true
+		}
+	}
+	for i := range m.profiles {
+		p := &m.profiles[i]
+		if !imported[p.ID] || p.ParentID == "" {
+			continue
+		}
+		if id, ok := newIDs[p.ParentID]; ok {
+			p.ParentID = id
+		}
+		if _, ok := m.findLocked(p.ParentID); !ok {
+			p.ParentID, p.Overrides = "", nil
+		}
+	}
+	for _, id := range m.refreshChildrenLocked() {
+		for i := range m.profiles {
+			if m.profiles[i].ID == id {
+				m.profiles[i].ParentID, m.profiles[i].Overrides = "", nil
+			}
+		}
+	}
+}
+
+// conflictLocked returns the index of the existing profile p collides with
+// (same ID first, then same name), or -1.
+func (m *Manager) conflictLocked(p Profile) int {
+	if p.ID != "" {
+		for i, existing := range m.profiles {
+			if existing.ID == p.ID {
+				return i
+			}
+		}
+	}
+	for i, existing := range m.profiles {
+		if strings.EqualFold(existing.Name, p.Name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// nameTakenLocked reports whether a profile other than index except uses name.
+func (m *Manager) nameTakenLocked(name string, except int) bool {
+	for i, existing := range m.profiles {
+		if i != except && strings.EqualFold(existing.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueNameLocked returns name, or "name (2)", "name (3)", ... if taken.
+// A name shortened to fit the 80-byte limit is cut between characters.
+func (m *Manager) uniqueNameLocked(name string) string {
+	if !m.nameTakenLocked(name, -1) {
+		return name
+	}
+	for n := 2; ; n++ {
+		suffix := fmt.Sprintf(" (%d)", n)
+		base := name
+		if len(base)+len(suffix) > 80 {
+			cut := 80 - len(suffix)
+			for cut > 0 && !utf8.RuneStart(base[cut]) {
+				cut--
+			}
+			base = base[:cut]
+		}
+		if candidate := base + suffix; !m.nameTakenLocked(candidate, -1) {
+			return candidate
+		}
+	}
+}
+
+func (m *Manager) findLocked(id string) (Profile, bool) {
+	for _, p := range m.profiles {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return Profile{}, false
+}
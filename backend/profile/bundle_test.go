@@ -0,0 +1,233 @@
+package profile
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func loadedManager(t *testing.T) *Manager {
+	t.Helper()
+	m := NewManager(tempProfilePath(t))
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func userProfile(name string) Profile {
+	return Profile{
+		Name:         name,
+		EncoderType:  "nvencc",
+		EncoderOpts:  map[string]any{},
+		Codec:        "hevc",
+		RateControl:  "qvbr",
+		RateValue:    28,
+		OutputDepth:  10,
+		AudioBitrate: 256,
+		Device:       "1",
+	}
+}
+
+func TestExportProfiles_BundleFormat(t *testing.T) {
+	m := loadedManager(t)
+	if err := m.Upsert(userProfile("Tuned")); err != nil {
+		t.Fatal(err)
+	}
+	tuned := m.List()[4]
+
+	path := filepath.Join(t.TempDir(), "nested", "tuned.json")
+	if err := m.ExportProfiles([]string{tuned.ID}, path, ExportOptions{StripMachineFields: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b Bundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		t.Fatal(err)
+	}
+	if b.Format != BundleFormat || b.BundleVersion != CurrentBundleVersion || b.ExportedAt == "" {
+		t.Errorf("header=%q v%d at %q", b.Format, b.BundleVersion, b.ExportedAt)
+	}
+	if len(b.Profiles) != 1 || b.Profiles[0].ID != tuned.ID {
+		t.Fatalf("profiles=%+v, want only %s", b.Profiles, tuned.ID)
+	}
+	if b.Profiles[0].Device != "auto" {
+		t.Errorf("device=%q, want stripped to auto", b.Profiles[0].Device)
+	}
+	if got, _ := m.Get(tuned.ID); got.Device != "1" {
+		t.Error("export must not modify the stored profile")
+	}
+
+	if err := m.ExportProfiles([]string{"missing"}, path, ExportOptions{}); err == nil {
+		t.Error("expected error for unknown ID")
+	}
+}
+
+func TestImportProfiles_ConflictPolicies(t *testing.T) {
+	src := loadedManager(t)
+	if err := src.Upsert(userProfile("Tuned")); err != nil {
+		t.Fatal(err)
+	}
+	tuned := src.List()[4]
+	bundle := filepath.Join(t.TempDir(), "bundle.json")
+	if err := src.ExportProfiles([]string{tuned.ID}, bundle, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := loadedManager(t)
+
+	// First import: no conflict, ID is kept.
+	res, err := dst.ImportProfiles(bundle, ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Count("created") != 1 || res.Profiles[0].ID != tuned.ID {
+		t.Fatalf("first import=%+v", res)
+	}
+
+	// Rename: new ID and unique name.
+	res, err = dst.ImportProfiles(bundle, ImportOptions{OnConflict: ConflictRename})
+	if err != nil {
+		t.Fatal(err)
+	}
+	renamed := res.Profiles[0]
+	if renamed.Action != "renamed" || renamed.ID == tuned.ID || renamed.Name != "Tuned (2)" {
+		t.Errorf("rename=%+v", renamed)
+	}
+
+	// Skip: nothing changes.
+	before := len(dst.List())
+	res, err = dst.ImportProfiles(bundle, ImportOptions{OnConflict: ConflictSkip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Count("skipped") != 1 || len(dst.List()) != before {
+		t.Errorf("skip=%+v, profiles %d -> %d", res, before, len(dst.List()))
+	}
+
+	// Replace: updates the profile with the same ID in place.
+	edited := tuned
+	edited.RateValue = 31
+	if err := src.Upsert(edited); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.ExportProfiles([]string{tuned.ID}, bundle, ExportOptions{StripMachineFields: true}); err != nil {
+		t.Fatal(err)
+	}
+	res, err = dst.ImportProfiles(bundle, ImportOptions{OnConflict: ConflictReplace})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := dst.Get(tuned.ID)
+	if res.Count("replaced") != 1 || got.RateValue != 31 || len(dst.List()) != before {
+		t.Errorf("replace=%+v rate=%v profiles=%d", res, got.RateValue, len(dst.List()))
+	}
+	if got.Device != "auto" {
+		t.Errorf("device=%q, want stripped", got.Device)
+	}
+
+	// Reload from disk to make sure the result was persisted.
+	reloaded := NewManager(dst.filePath)
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.List()) != before {
+		t.Errorf("persisted %d profiles, want %d", len(reloaded.List()), before)
+	}
+}
+
+func TestImportProfiles_PresetsAreNeverReplaced(t *testing.T) {
+	m := loadedManager(t)
+	preset := m.List()[0]
+	bundle := filepath.Join(t.TempDir(), "preset.json")
+	if err := m.ExportProfiles([]string{preset.ID}, bundle, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := m.ImportProfiles(bundle, ImportOptions{OnConflict: ConflictReplace})
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported := res.Profiles[0]
+	if imported.Action != "renamed" || imported.ID == preset.ID {
+		t.Fatalf("import=%+v, want renamed copy", imported)
+	}
+	copied, _ := m.Get(imported.ID)
+	if copied.IsPreset {
+		t.Error("imported copy must not be a preset")
+	}
+}
+
+func TestImportProfiles_InvalidAndLegacyFiles(t *testing.T) {
+	m := loadedManager(t)
+	dir := t.TempDir()
+
+	// Legacy profiles.json layout, with one invalid and one old-version entry.
+	legacy := ProfilesFile{Profiles: []Profile{
+		{Name: "Broken", EncoderType: "nvencc", RateValue: 0, OutputDepth: 10, AudioBitrate: 256},
+		{Version: 1, Name: "Old", RateValue: 28, OutputDepth: 8, AudioBitrate: 192},
+	}}
+	data, _ := json.Marshal(legacy)
+	path := filepath.Join(dir, "legacy.json")
+	os.WriteFile(path, data, 0o644)
+
+	res, err := m.ImportProfiles(path, ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Profiles[0].Action != "invalid" || res.Profiles[0].Reason == "" {
+		t.Errorf("broken entry=%+v, want invalid", res.Profiles[0])
+	}
+	old, ok := m.Get(res.Profiles[1].ID)
+	if !ok || old.Version != CurrentVersion || old.EncoderType != "nvencc" {
+		t.Errorf("old entry not migrated: %+v", old)
+	}
+
+	for name, content := range map[string]string{
+		"wrong_format.json": `{"format":"something-else","bundle_version":1,"profiles":[]}`,
+		"future.json":       `{"format":"enque-profiles","bundle_version":99,"profiles":[]}`,
+		"not_profiles.json": `{"hello":"world"}`,
+		"garbage.json":      `not json`,
+	} {
+		p := filepath.Join(dir, name)
+		os.WriteFile(p, []byte(content), 0o644)
+		if _, err := m.ImportProfiles(p, ImportOptions{}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	if _, err := m.ImportProfiles(path, ImportOptions{OnConflict: "merge"}); err == nil {
+		t.Error("expected error for unknown conflict policy")
+	}
+}
+
+func TestImportProfiles_RenameKeepsMultiByteNamesValid(t *testing.T) {
+	// 26 three-byte characters: 78 bytes, so " (2)" needs a cut.
+	name := strings.Repeat("高", 26)
+	src := loadedManager(t)
+	if err := src.Upsert(userProfile(name)); err != nil {
+		t.Fatal(err)
+	}
+	bundle := filepath.Join(t.TempDir(), "bundle.json")
+	if err := src.ExportProfiles([]string{src.List()[4].ID}, bundle, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := loadedManager(t)
+	for i := 0; i < 2; i++ {
+		if _, err := dst.ImportProfiles(bundle, ImportOptions{OnConflict: ConflictRename}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := dst.List()[len(dst.List())-1].Name
+	if want := strings.Repeat("高", 25) + " (2)"; got != want || !utf8.ValidString(got) {
+		t.Errorf("renamed to %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,47 @@
+package profile
+
+import "fmt"
+
+// ChunkSettings split long inputs into segments that the session's workers
+// encode in parallel. Segments start at input keyframes and are joined
+// without re-encoding.
+type ChunkSettings struct {
+	// MinDurationSec is the input length from which inputs are split;
+	// shorter inputs are encoded whole. 0 means 1200 (20 minutes).
+	MinDurationSec int `json:"min_duration_sec,omitempty"`
+	// SegmentSec is the target segment length; 0 means 300.
+	SegmentSec int `json:"segment_sec,omitempty"`
+	// Boundary is "keyframe" (default) to split at any keyframe near the
+	// target length, or "scene" to prefer keyframes at scene changes.
+	Boundary string `json:"boundary,omitempty"`
+	// Retries is how often a failed segment is encoded again before the
+	// job fails.
+	Retries int `json:"retries,omitempty"`
+}
+
+// Default chunk settings.
+const (
+	DefaultChunkMinDurationSec = 1200
+	DefaultChunkSegmentSec     = 300
+)
+
+func validateChunks(c *ChunkSettings) error {
+	if c == nil {
+		return nil
+	}
+	if c.MinDurationSec < 0 || c.MinDurationSec > 86400 {
+		return fmt.Errorf("E_VALIDATION: chunks: min_duration_sec must be 0..86400")
+	}
+	if c.SegmentSec != 0 && (c.SegmentSec < 30 || c.SegmentSec > 3600) {
+		return fmt.Errorf("E_VALIDATION: chunks: segment_sec must be 30..3600")
+	}
+	switch c.Boundary {
+	case "", "keyframe", "scene":
+	default:
+		return fmt.Errorf("E_VALIDATION: chunks: boundary must be keyframe or scene")
+	}
+	if c.Retries < 0 || c.Retries > 5 {
+		return fmt.Errorf("E_VALIDATION: chunks: retries must be 0..5")
+	}
+	return nil
+}
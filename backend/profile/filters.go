@@ -0,0 +1,299 @@
+package profile
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Filter types.
+const (
+	FilterDeinterlace = "deinterlace"
+	FilterResize      = "resize"
+	FilterDenoise     = "denoise"
+	FilterDeband      = "deband"
+	FilterEdgeLevel   = "edgelevel"
+	FilterCrop        = "crop"
+	FilterPad         = "pad"
+	FilterColorspace  = "colorspace"
+)
+
+// MaxFilters is the number of filters a profile may list.
+const MaxFilters = 16
+
+// Filter is one NVEncC video processing step (--vpp-* and --crop).
+// Filters are emitted in the order the profile lists them.
+type Filter struct {
+	Type     string `json:"type"`
+	Disabled bool   `json:"disabled,omitempty"`
+	// Method selects the algorithm of deinterlace (afs, nnedi, yadif,
+	// decomb, or the hardware modes normal, adaptive, bob), resize and
+	// denoise filters.
+	Method string `json:"method,omitempty"`
+	// Rect holds the pixels to crop or pad on each side.
+	Rect *FilterRect `json:"rect,omitempty"`
+	// Params are the filter's key=value parameters, e.g. {"sigma": "0.005"}.
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// FilterRect is a crop or padding amount per side in pixels.
+type FilterRect struct {
+	Left   int `json:"left"`
+	Top    int `json:"top"`
+	Right  int `json:"right"`
+	Bottom int `json:"bottom"`
+}
+
+// filterMethods lists the methods of the filter types that have them.
+var filterMethods = map[string][]string{
+	FilterDeinterlace: {"afs", "nnedi", "yadif", "decomb", "normal", "adaptive", "bob"},
+	FilterResize: {"bilinear", "bicubic", "spline16", "spline36", "spline64",
+		"lanczos2", "lanczos3", "lanczos4", "nn", "npp_linear", "nvvfx-superres", "ngx-vsr"},
+	FilterDenoise: {"knn", "pmd", "nlmeans", "smooth", "fft3d", "convolution3d"},
+}
+
+// hwDeinterlace lists the deinterlace methods of the hardware decoder,
+// which take the mode as a plain value of --vpp-deinterlace.
+var hwDeinterlace = []string{"normal", "adaptive", "bob"}
+
+var filterParamKeyRe = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// Option returns the NVEncC option the filter is emitted as.
+func (f Filter) Option() string {
+	switch f.Type {
+	case FilterDeinterlace:
+		if slices.Contains(hwDeinterlace, f.Method) {
+			return "--vpp-deinterlace"
+		}
+		return "--vpp-" + f.Method
+	case FilterDenoise:
+		return "--vpp-" + f.Method
+	case FilterCrop:
+		return "--crop"
+	default:
+		return "--vpp-" + f.Type
+	}
+}
+
+// Args returns the filter's NVEncC arguments: the option and, unless the
+// filter runs with its defaults, its value.
+func (f Filter) Args() []string {
+	var value string
+	switch {
+	case f.Type == FilterCrop || f.Type == FilterPad:
+		if r := f.Rect; r != nil {
+			value = fmt.Sprintf("%d,%d,%d,%d", r.Left, r.Top, r.Right, r.Bottom)
+		}
+	case f.Type == FilterDeinterlace && slices.Contains(hwDeinterlace, f.Method):
+		value = f.Method
+	case f.Type == FilterResize && len(f.Params) == 0:
+		value = f.Method
+	case f.Type == FilterResize:
+		value = "algo=" + f.Method + "," + f.paramString()
+	default:
+		value = f.paramString()
+	}
+	if value == "" {
+		return []string{f.Option()}
+	}
+	return []string{f.Option(), value}
+}
+
+// paramString renders Params as "key=value,..." in key order.
+func (f Filter) paramString() string {
+	keys := make([]string, 0, len(f.Params))
+	for k := range f.Params {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + f.Params[k]
+	}
+	return strings.Join(parts, ",")
+}
+
+// filterOptions maps the options ParseFilter understands to their filter
+// type; the method, if any, is taken from the option name.
+var filterOptions = map[string]string{
+	"--vpp-afs":           FilterDeinterlace,
+	"--vpp-nnedi":         FilterDeinterlace,
+	"--vpp-yadif":         FilterDeinterlace,
+	"--vpp-decomb":        FilterDeinterlace,
+	"--vpp-deinterlace":   FilterDeinterlace,
+	"--vpp-resize":        FilterResize,
+	"--vpp-knn":           FilterDenoise,
+	"--vpp-pmd":           FilterDenoise,
+	"--vpp-nlmeans":       FilterDenoise,
+	"--vpp-smooth":        FilterDenoise,
+	"--vpp-fft3d":         FilterDenoise,
+	"--vpp-convolution3d": FilterDenoise,
+	"--vpp-deband":        FilterDeband,
+	"--vpp-edgelevel":     FilterEdgeLevel,
+	"--crop":              FilterCrop,
+	"--vpp-pad":           FilterPad,
+	"--vpp-colorspace":    FilterColorspace,
+}
+
+// IsFilterOption reports whether an NVEncC option is represented by a
+// Filter.
+func IsFilterOption(name string) bool {
+	_, ok := filterOptions[name]
+	return ok
+}
+
+// ParseFilter turns an NVEncC filter option and its value ("" for none)
+// into a Filter. It returns false when the option is not a filter or the
+// value cannot be represented.
+func ParseFilter(option, value string) (Filter, bool) {
+	typ, ok := filterOptions[option]
+	if !ok {
+		return Filter{}, false
+	}
+	f := Filter{Type: typ}
+	switch {
+	case typ == FilterCrop || typ == FilterPad:
+		var r FilterRect
+		if _, err := fmt.Sscanf(value, "%d,%d,%d,%d", &r.Left, &r.Top, &r.Right, &r.Bottom); err != nil ||
+			value != fmt.Sprintf("%d,%d,%d,%d", r.Left, r.Top, r.Right, r.Bottom) {
+			return Filter{}, false
+		}
+		f.Rect = &r
+	case option == "--vpp-deinterlace":
+		f.Method = value
+	case typ == FilterResize && !strings.Contains(value, "="):
+		f.Method = value
+	default:
+		if typ == FilterDeinterlace || typ == FilterDenoise {
+			f.Method = strings.TrimPrefix(option, "--vpp-")
+		}
+		if value != "" {
+			f.Params = map[string]string{}
+			for _, kv := range strings.Split(value, ",") {
+				k, v, ok := strings.Cut(kv, "=")
+				if !ok {
+					return Filter{}, false
+				}
+				f.Params[k] = v
+			}
+		}
+		if typ == FilterResize {
+			f.Method = f.Params["algo"]
+			delete(f.Params, "algo")
+		}
+	}
+	if validateFilter(f) != nil {
+		return Filter{}, false
+	}
+	return f, true
+}
+
+// ValidateFilters checks a list of filters.
+func ValidateFilters(filters []Filter) error {
+	if len(filters) > MaxFilters {
+		return fmt.Errorf("E_VALIDATION: at most %d filters", MaxFilters)
+	}
+	seen := map[string]bool{}
+	for i, f := range filters {
+		if err := validateFilter(f); err != nil {
+			return fmt.Errorf("E_VALIDATION: filters[%d]: %v", i, err)
+		}
+		if seen[f.Option()] {
+			return fmt.Errorf("E_VALIDATION: filters[%d]: %s is listed twice", i, f.Option())
+		}
+		seen[f.Option()] = true
+	}
+	return nil
+}
+
+func validateFilter(f Filter) error {
+	methods, hasMethod := filterMethods[f.Type]
+	switch {
+	case f.Type == FilterCrop || f.Type == FilterPad:
+		r := f.Rect
+		if r == nil {
+			return fmt.Errorf("%s needs rect", f.Type)
+		}
+		for _, v := range []int{r.Left, r.Top, r.Right, r.Bottom} {
+			if v < 0 || v%2 != 0 {
+				return fmt.Errorf("%s values must be even and >= 0", f.Type)
+			}
+		}
+		if len(f.Params) > 0 || f.Method != "" {
+			return fmt.Errorf("%s takes rect only", f.Type)
+		}
+		return nil
+	case hasMethod:
+		if !slices.Contains(methods, f.Method) {
+			return fmt.Errorf("%s method must be one of %s", f.Type, strings.Join(methods, ", "))
+		}
+		if f.Type == FilterDeinterlace && slices.Contains(hwDeinterlace, f.Method) && len(f.Params) > 0 {
+			return fmt.Errorf("deinterlace %s takes no params", f.Method)
+		}
+	case f.Type == FilterDeband || f.Type == FilterEdgeLevel || f.Type == FilterColorspace:
+		if f.Method != "" {
+			return fmt.Errorf("%s takes no method", f.Type)
+		}
+	default:
+		return fmt.Errorf("unknown filter type %q", f.Type)
+	}
+	if f.Rect != nil {
+		return fmt.Errorf("%s takes no rect", f.Type)
+	}
+	for k, v := range f.Params {
+		if !filterParamKeyRe.MatchString(k) {
+			return fmt.Errorf("invalid param name %q", k)
+		}
+		if v == "" || strings.ContainsAny(v, ", \t\"") {
+			return fmt.Errorf("param %s: value must be non-empty without commas, spaces or quotes", k)
+		}
+	}
+	return nil
+}
+
+// liftFilters moves the filter options of custom options into filters.
+// Custom options with quotes are left alone, as are options whose values
+// cannot be represented. Later duplicates replace earlier ones, as in
+// NVEncC.
+func liftFilters(custom string) ([]Filter, string) {
+	if strings.ContainsAny(custom, `"'`) {
+		return nil, custom
+	}
+	tokens := strings.Fields(custom)
+	var filters []Filter
+	var rest []string
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		if !IsFilterOption(tok) {
+			rest = append(rest, tok)
+			continue
+		}
+		value := ""
+		if i+1 < len(tokens) && !isOptionToken(tokens[i+1]) {
+			value = tokens[i+1]
+		}
+		f, ok := ParseFilter(tok, value)
+		if !ok {
+			rest = append(rest, tok)
+			continue
+		}
+		if value != "" {
+			i++
+		}
+		filters = slices.DeleteFunc(filters, func(g Filter) bool { return g.Option() == f.Option() })
+		filters = append(filters, f)
+	}
+	return filters, strings.Join(rest, " ")
+}
+
+// isOptionToken reports whether tok is an option rather than a value.
+// Negative numbers are values.
+func isOptionToken(tok string) bool {
+	if len(tok) < 2 || tok[0] != '-' {
+		return false
+	}
+	_, err := strconv.ParseFloat(tok, 64)
+	return err != nil
+}
@@ -0,0 +1,102 @@
+package profile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFilterArgs(t *testing.T) {
+	tests := []struct {
+		f    Filter
+		want string
+	}{
+		{Filter{Type: FilterDeinterlace, Method: "bob"}, "--vpp-deinterlace bob"},
+		{Filter{Type: FilterDeinterlace, Method: "afs", Params: map[string]string{"preset": "default"}}, "--vpp-afs preset=default"},
+		{Filter{Type: FilterResize, Method: "spline36"}, "--vpp-resize spline36"},
+		{Filter{Type: FilterResize, Method: "ngx-vsr", Params: map[string]string{"quality": "3"}}, "--vpp-resize algo=ngx-vsr,quality=3"},
+		{Filter{Type: FilterDenoise, Method: "nlmeans", Params: map[string]string{"sigma": "0.005", "h": "0.05"}}, "--vpp-nlmeans h=0.05,sigma=0.005"},
+		{Filter{Type: FilterDeband}, "--vpp-deband"},
+		{Filter{Type: FilterCrop, Rect: &FilterRect{Top: 140, Bottom: 140}}, "--crop 0,140,0,140"},
+		{Filter{Type: FilterPad, Rect: &FilterRect{Left: 8, Right: 8}}, "--vpp-pad 8,0,8,0"},
+		{Filter{Type: FilterColorspace, Params: map[string]string{"hdr2sdr": "hable"}}, "--vpp-colorspace hdr2sdr=hable"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(tt.f.Args(), " "); got != tt.want {
+			t.Errorf("%+v: args=%q, want %q", tt.f, got, tt.want)
+		}
+		// Every emitted filter parses back to itself.
+		args := tt.f.Args()
+		value := ""
+		if len(args) > 1 {
+			value = args[1]
+		}
+		if back, ok := ParseFilter(args[0], value); !ok || !reflect.DeepEqual(back, tt.f) {
+			t.Errorf("%q parsed to %+v, %t", tt.want, back, ok)
+		}
+	}
+}
+
+func TestValidateFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters []Filter
+		reason  string // "" means valid
+	}{
+		{"ordered chain", []Filter{
+			{Type: FilterCrop, Rect: &FilterRect{Top: 20, Bottom: 20}},
+			{Type: FilterDenoise, Method: "knn"},
+			{Type: FilterDenoise, Method: "pmd"},
+			{Type: FilterResize, Method: "lanczos3"},
+		}, ""},
+		{"unknown type", []Filter{{Type: "sharpen"}}, "unknown filter type"},
+		{"missing method", []Filter{{Type: FilterDenoise}}, "method must be one of"},
+		{"method on deband", []Filter{{Type: FilterDeband, Method: "knn"}}, "takes no method"},
+		{"odd crop", []Filter{{Type: FilterCrop, Rect: &FilterRect{Top: 1}}}, "even"},
+		{"pad without rect", []Filter{{Type: FilterPad}}, "needs rect"},
+		{"hardware deinterlace params", []Filter{{Type: FilterDeinterlace, Method: "normal", Params: map[string]string{"x": "1"}}}, "takes no params"},
+		{"comma in value", []Filter{{Type: FilterDeband, Params: map[string]string{"range": "1,2"}}}, "without commas"},
+		{"twice", []Filter{{Type: FilterDenoise, Method: "knn"}, {Type: FilterDenoise, Method: "knn", Disabled: true}}, "listed twice"},
+		{"too many", make([]Filter, MaxFilters+1), "at most"},
+	}
+	for _, tt := range tests {
+		err := ValidateFilters(tt.filters)
+		if tt.reason == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), "E_VALIDATION") || !strings.Contains(err.Error(), tt.reason) {
+			t.Errorf("%s: err=%v, want %q", tt.name, err, tt.reason)
+		}
+	}
+}
+
+func TestMigration_V4toV5LiftsFilters(t *testing.T) {
+	p := Profile{
+		Version:       4,
+		Name:          "Old",
+		CustomOptions: "--vpp-resize lanczos3 --gop-len 300 --vpp-knn radius=3 --vpp-pad 0,140,0,140 --vpp-knn radius=4 --vpp-resize bogus --vpp-unsharp radius=3",
+	}
+	got, err := Migrate(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Filter{
+		{Type: FilterResize, Method: "lanczos3"},
+		{Type: FilterPad, Rect: &FilterRect{Top: 140, Bottom: 140}},
+		{Type: FilterDenoise, Method: "knn", Params: map[string]string{"radius": "4"}},
+	}
+	if got.Version != 5 || !reflect.DeepEqual(got.Filters, want) {
+		t.Errorf("filters=%+v", got.Filters)
+	}
+	if got.CustomOptions != "--gop-len 300 --vpp-resize bogus --vpp-unsharp radius=3" {
+		t.Errorf("custom_options=%q", got.CustomOptions)
+	}
+
+	quoted := Profile{Version: 4, CustomOptions: `--vpp-deband --log "C:\my logs\a.txt"`}
+	if got, _ := Migrate(quoted); got.Filters != nil || got.CustomOptions != quoted.CustomOptions {
+		t.Errorf("quoted custom options changed: %+v", got)
+	}
+}
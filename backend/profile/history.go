@@ -0,0 +1,233 @@
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+)
+
+// MaxRevisions bounds the history kept per profile; older revisions are
+// dropped first.
+const MaxRevisions = 20
+
+// Revision is a saved state of a profile.
+type Revision struct {
+	Number    int    `json:"number"`
+	CreatedAt string `json:"created_at"`
+	Note      string `json:"note,omitempty"`
+	// Changes lists the fields that differ from the previous revision.
+	Changes []FieldChange `json:"changes"`
+	// Profile is the effective profile at this revision.
+	Profile Profile `json:"profile"`
+}
+
+// FieldChange is one changed field between two revisions, keyed by JSON
+// field name. Values are JSON; null means unset.
+type FieldChange struct {
+	Field string          `json:"field"`
+	Old   json.RawMessage `json:"old"`
+	New   json.RawMessage `json:"new"`
+}
+
+// historyFile is the on-disk layout of the revision history.
+type historyFile struct {
+	Profiles map[string][]Revision `json:"profiles"`
+}
+
+func (m *Manager) historyPath() string {
+	return filepath.Join(filepath.Dir(m.filePath), "profile_history.json")
+}
+
+// diffProfiles returns the fields that differ between a and b: the name,
+// the parent and every overridable field.
+func diffProfiles(a, b Profile) []FieldChange {
+	var changes []FieldChange
+	add := func(field string, old, new any) {
+		o, _ := json.Marshal(old)
+		n, _ := json.Marshal(new)
+		changes = append(changes, FieldChange{Field: field, Old: o, New: n})
+	}
+	if a.Name != b.Name {
+		add("name", a.Name, b.Name)
+	}
+	if a.ParentID != b.ParentID {
+		add("parent_id", a.ParentID, b.ParentID)
+	}
+	av, bv := reflect.ValueOf(a), reflect.ValueOf(b)
+	for _, field := range ChangedFields(a, b) {
+		path := fieldIndex[field]
+		add(field, av.FieldByIndex(path).Interface(), bv.FieldByIndex(path).Interface())
+	}
+	return changes
+}
+
+// ListRevisions returns the revisions of a profile, oldest first. Deleted
+// profiles keep their revisions.
+func (m *Manager) ListRevisions(id string) ([]Revision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, ok := m.findLocked(id); !ok && len(m.history[id]) == 0 {
+		return nil, fmt.Errorf("profile not found: %s", id)
+	}
+	hist := m.history[id]
+	out := make([]Revision, len(hist))
+	copy(out, hist)
+	return out, nil
+}
+
+// GetRevision returns one revision of a profile.
+func (m *Manager) GetRevision(id string, number int) (Revision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.revisionLocked(id, number)
+}
+
+func (m *Manager) revisionLocked(id string, number int) (Revision, error) {
+	for _, r := range m.history[id] {
+		if r.Number == number {
+			return r, nil
+		}
+	}
+	return Revision{}, fmt.Errorf("revision %d of profile %s not found", number, id)
+}
+
+// DiffRevisions returns the fields that changed from revision from to
+// revision to of a profile.
+func (m *Manager) DiffRevisions(id string, from, to int) ([]FieldChange, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	a, err := m.revisionLocked(id, from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := m.revisionLocked(id, to)
+	if err != nil {
+		return nil, err
+	}
+	return diffProfiles(a.Profile, b.Profile), nil
+}
+
+// RestoreRevision makes a revision the current state of a profile. The
+// restore is recorded as a new revision, so it can be undone too. A child
+// keeps its current parent and takes the revision's overridden fields. A
+// deleted profile is recreated with its ID.
+func (m *Manager) RestoreRevision(id string, number int, note string) (Profile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rev, err := m.revisionLocked(id, number)
+	if err != nil {
+		return Profile{}, err
+	}
+	if note == "" {
+		note = fmt.Sprintf("restored revision %d", number)
+	}
+	p := rev.Profile
+	if p.ParentID != "" {
+		if _, ok := m.findLocked(p.ParentID); !ok {
+			p.ParentID, p.Overrides = "", nil
+		}
+	}
+	if err := m.upsertLocked(p, note); err != nil {
+		return Profile{}, err
+	}
+	restored, _ := m.findLocked(id)
+	return restored, nil
+}
+
+// trackLocked records a revision for every profile that differs from its
+// latest revision. before holds the profiles prior to the change and
+// seeds the history of profiles that have none yet. notes are keyed by
+// profile ID. It reports whether anything was recorded.
+func (m *Manager) trackLocked(before []Profile, notes map[string]string) bool {
+	prev := make(map[string]Profile, len(before))
+	for _, p := range before {
+		prev[p.ID] = p
+	}
+	now := time.Now().Format(time.RFC3339)
+	changed := false
+	for i := range m.profiles {
+		p := &m.profiles[i]
+		hist := m.history[p.ID]
+		if len(hist) == 0 {
+			if old, ok := prev[p.ID]; ok && len(diffProfiles(old, *p)) > 0 {
+				old.Revision = max(old.Revision, 1)
+				hist = append(hist, Revision{Number: old.Revision, CreatedAt: now, Changes: []FieldChange{}, Profile: old})
+			}
+		}
+
+		var changes []FieldChange
+		number := max(p.Revision, 1)
+		if len(hist) > 0 {
+			last := hist[len(hist)-1]
+			changes = diffProfiles(last.Profile, *p)
+			if len(changes) == 0 {
+				p.Revision = last.Number
+				continue
+			}
+			number = last.Number + 1
+		}
+		if changes == nil {
+			changes = []FieldChange{}
+		}
+
+		note, ok := notes[p.ID]
+		if !ok && len(hist) > 0 && p.ParentID != "" {
+			note = "inherited from parent"
+		}
+		p.Revision = number
+		hist = append(hist, Revision{Number: number, CreatedAt: now, Note: note, Changes: changes, Profile: *p})
+		if len(hist) > MaxRevisions {
+			hist = append([]Revision(nil), hist[len(hist)-MaxRevisions:]...)
+		}
+		m.history[p.ID] = hist
+		changed = true
+	}
+	return changed
+}
+
+// loadHistoryLocked reads the revision history. A missing file starts an
+// empty history; an unreadable one is moved aside.
+func (m *Manager) loadHistoryLocked() error {
+	m.history = make(map[string][]Revision)
+	data, err := os.ReadFile(m.historyPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read profile history: %w", err)
+	}
+	var hf historyFile
+	if err := json.Unmarshal(data, &hf); err != nil {
+		os.Rename(m.historyPath(), m.historyPath()+fmt.Sprintf(".broken.%d", time.Now().Unix()))
+		return nil
+	}
+	if hf.Profiles != nil {
+		m.history = hf.Profiles
+	}
+	return nil
+}
+
+// saveHistoryLocked writes the revision history atomically.
+func (m *Manager) saveHistoryLocked() error {
+	data, err := json.MarshalIndent(historyFile{Profiles: m.history}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal profile history: %w", err)
+	}
+	path := m.historyPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create dir: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("write profile history: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("rename profile history: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package profile
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRevisions_RecordDiffAndRestore(t *testing.T) {
+	m := loadedManager(t)
+	if err := m.Upsert(userProfile("Tuned")); err != nil {
+		t.Fatal(err)
+	}
+	p := findByName(t, m, "Tuned")
+	if p.Revision != 1 {
+		t.Fatalf("new profile revision=%d, want 1", p.Revision)
+	}
+
+	p.RateValue = 22
+	p.NVEncCAdvanced.MaxBitrate = intPtr(12000)
+	if err := m.UpsertWithNote(p, "sharper"); err != nil {
+		t.Fatal(err)
+	}
+	// Saving without changes records nothing.
+	if err := m.Upsert(findByName(t, m, "Tuned")); err != nil {
+		t.Fatal(err)
+	}
+
+	revs, err := m.ListRevisions(p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revs) != 2 || revs[1].Number != 2 || revs[1].Note != "sharper" || revs[1].CreatedAt == "" {
+		t.Fatalf("revisions=%+v", revs)
+	}
+	if got := fieldNames(revs[1].Changes); len(got) != 2 || got[0] != "nvencc_advanced.max_bitrate" || got[1] != "rate_value" {
+		t.Errorf("changes=%v", got)
+	}
+
+	diff, err := m.DiffRevisions(p.ID, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range diff {
+		if c.Field == "rate_value" && (string(c.Old) != "22" || string(c.New) != "28") {
+			t.Errorf("rate_value change %s -> %s", c.Old, c.New)
+		}
+	}
+
+	restored, err := m.RestoreRevision(p.ID, 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.RateValue != 28 || restored.NVEncCAdvanced.MaxBitrate != nil || restored.Revision != 3 {
+		t.Errorf("restored=%+v", restored)
+	}
+	revs, _ = m.ListRevisions(p.ID)
+	if revs[2].Note != "restored revision 1" {
+		t.Errorf("restore note=%q", revs[2].Note)
+	}
+
+	// History survives a reload.
+	reloaded := NewManager(m.filePath)
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if revs, _ := reloaded.ListRevisions(p.ID); len(revs) != 3 {
+		t.Errorf("reloaded %d revisions, want 3", len(revs))
+	}
+
+	if _, err := m.GetRevision(p.ID, 9); err == nil {
+		t.Error("expected error for unknown revision")
+	}
+	if err := m.Delete(p.ID); err != nil {
+		t.Fatal(err)
+	}
+	if revs, err := m.ListRevisions(p.ID); err != nil || len(revs) == 0 {
+		t.Errorf("deleted profile lost its history: %v", err)
+	}
+}
+
+func TestRevisions_BoundedAndChildren(t *testing.T) {
+	m := loadedManager(t)
+	if err := m.Upsert(userProfile("Base")); err != nil {
+		t.Fatal(err)
+	}
+	base := findByName(t, m, "Base")
+	if err := m.Upsert(Profile{Name: "Child", ParentID: base.ID, Overrides: []string{"output_res"}, OutputRes: "1280x720"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < MaxRevisions+5; i++ {
+		base.RateValue = float64(20 + i)
+		if err := m.Upsert(base); err != nil {
+			t.Fatal(err)
+		}
+	}
+	revs, _ := m.ListRevisions(base.ID)
+	if len(revs) != MaxRevisions || revs[len(revs)-1].Number != MaxRevisions+6 {
+		t.Errorf("kept %d revisions, last %d", len(revs), revs[len(revs)-1].Number)
+	}
+
+	// Parent edits that change the child's effective settings are
+	// recorded on the child as well.
+	child := findByName(t, m, "Child")
+	childRevs, _ := m.ListRevisions(child.ID)
+	last := childRevs[len(childRevs)-1]
+	if child.Revision != last.Number || last.Note != "inherited from parent" || last.Profile.RateValue != child.RateValue {
+		t.Errorf("child revision %d, last=%+v", child.Revision, last)
+	}
+}
+
+func TestRevisions_LegacyFileAndResolve(t *testing.T) {
+	path := tempProfilePath(t)
+	legacy := ProfilesFile{Profiles: append(GeneratePresets(), userProfile("Old"))}
+	legacy.Profiles[len(legacy.Profiles)-1].ID = "old"
+	legacy.Profiles[len(legacy.Profiles)-1].Version = CurrentVersion
+	data, _ := json.Marshal(legacy)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager(path)
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+	old, _ := m.Get("old")
+	if revs, _ := m.ListRevisions("old"); old.Revision != 1 || len(revs) != 1 {
+		t.Fatalf("legacy profile revision=%d history=%d, want a baseline", old.Revision, len(revs))
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(path), "profile_history.json")); err != nil {
+		t.Errorf("history file: %v", err)
+	}
+
+	// Resolve reports the stored revision only for an unmodified profile.
+	if got, _ := m.Resolve(old); got.Revision != 1 {
+		t.Errorf("stored profile resolved to revision %d", got.Revision)
+	}
+	edited := old
+	edited.RateValue = 40
+	if got, _ := m.Resolve(edited); got.Revision != 0 {
+		t.Errorf("unsaved edit resolved to revision %d, want 0", got.Revision)
+	}
+}
+
+func fieldNames(changes []FieldChange) []string {
+	names := make([]string, len(changes))
+	for i, c := range changes {
+		names[i] = c.Field
+	}
+	return names
+}
+
+func TestRevisions_KeptAfterDelete(t *testing.T) {
+	m := loadedManager(t)
+	if err := m.Upsert(userProfile("Gone")); err != nil {
+		t.Fatal(err)
+	}
+	p := findByName(t, m, "Gone")
+	p.RateValue = 30
+	if err := m.Upsert(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Delete(p.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reload: a job record naming revision 1 still resolves.
+	reloaded := NewManager(m.filePath)
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	revs, err := reloaded.ListRevisions(p.ID)
+	if err != nil || len(revs) != 2 {
+		t.Fatalf("revisions=%d err=%v, want 2 after delete", len(revs), err)
+	}
+	if rev, err := reloaded.GetRevision(p.ID, 1); err != nil || rev.Profile.RateValue != 28 {
+		t.Errorf("revision 1=%+v err=%v", rev.Profile.RateValue, err)
+	}
+
+	restored, err := reloaded.RestoreRevision(p.ID, 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := reloaded.Get(p.ID); !ok || got.RateValue != 28 || restored.Revision != 3 {
+		t.Errorf("restored=%+v ok=%v", restored, ok)
+	}
+	if _, err := reloaded.ListRevisions("unknown"); err == nil {
+		t.Error("unknown profile: want error")
+	}
+}
@@ -0,0 +1,327 @@
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// maxInheritanceDepth bounds parent chains so a corrupt file cannot make
+// resolution run away even without a cycle.
+const maxInheritanceDepth = 16
+
+// metaFields belong to the profile itself and are never inherited.
+var metaFields = map[string]bool{
+	"id": true, "version": true, "name": true, "is_preset": true,
+	"parent_id": true, "overrides": true, "revision": true,
+}
+
+// fieldIndex maps overridable JSON field names to struct field index paths.
+// nvencc_advanced can be overridden as a whole or per field
+// ("nvencc_advanced.max_bitrate").
+var fieldIndex = buildFieldIndex()
+
+func buildFieldIndex() map[string][]int {
+	idx := make(map[string][]int)
+	pt := reflect.TypeOf(Profile{})
+	for i := 0; i < pt.NumField(); i++ {
+		f := pt.Field(i)
+		name := jsonName(f)
+		if name == "" || metaFields[name] {
+			continue
+		}
+		idx[name] = []int{i}
+		if f.Type == reflect.TypeOf(NVEncCAdvanced{}) {
+			for j := 0; j < f.Type.NumField(); j++ {
+				if sub := jsonName(f.Type.Field(j)); sub != "" {
+					idx[name+"."+sub] = []int{i, j}
+				}
+			}
+		}
+	}
+	return idx
+}
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// OverridableFields returns the field names a child profile may override.
+func OverridableFields() []string {
+	names := make([]string, 0, len(fieldIndex))
+	for name := range fieldIndex {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ChangedFields returns the top-level fields whose values differ between
+// base and p. nvencc_advanced is compared per field.
+func ChangedFields(base, p Profile) []string {
+	bv, pv := reflect.ValueOf(base), reflect.ValueOf(p)
+	var changed []string
+	for _, name := range OverridableFields() {
+		path := fieldIndex[name]
+		if len(path) == 1 && bv.Field(path[0]).Kind() == reflect.Struct {
+			continue // compared per field
+		}
+		a, b := bv.FieldByIndex(path).Interface(), pv.FieldByIndex(path).Interface()
+		if m, ok := a.(map[string]any); ok && len(m) == 0 {
+			a = map[string]any(nil)
+		}
+		if m, ok := b.(map[string]any); ok && len(m) == 0 {
+			b = map[string]any(nil)
+		}
+		if !reflect.DeepEqual(a, b) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+func checkOverrides(names []string) error {
+	for _, name := range names {
+		if _, ok := fieldIndex[name]; !ok {
+			return fmt.Errorf("E_VALIDATION: unknown override field %q", name)
+		}
+	}
+	return nil
+}
+
+// applyOverrides returns parent with the overridden fields taken from child
+// and the child's own identity.
+func applyOverrides(parent, child Profile) Profile {
+	out := parent
+	ov, cv := reflect.ValueOf(&out).Elem(), reflect.ValueOf(child)
+	for _, name := range child.Overrides {
+		path := fieldIndex[name]
+		ov.FieldByIndex(path).Set(cv.FieldByIndex(path))
+	}
+	if out.EncoderOpts != nil {
+		opts := make(map[string]any, len(out.EncoderOpts))
+		for k, v := range out.EncoderOpts {
+			opts[k] = v
+		}
+		out.EncoderOpts = opts
+	}
+	out.ID = child.ID
+	out.Version = child.Version
+	out.Name = child.Name
+	out.IsPreset = child.IsPreset
+	out.ParentID = child.ParentID
+	out.Overrides = child.Overrides
+	out.Revision = child.Revision
+	return out
+}
+
+// Resolve returns the effective profile for p: its parent chain merged
+// down with p's overrides on top. p does not need to be saved. Revision
+// is set to the stored revision when p matches it, and to 0 for unsaved
+// edits, so it identifies exactly what was used.
+func (m *Manager) Resolve(p Profile) (Profile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if p.ParentID != "" {
+		eff, err := m.materializeLocked(p)
+		if err != nil {
+			return Profile{}, err
+		}
+		p = eff
+	}
+	p.Revision = 0
+	if stored, ok := m.findLocked(p.ID); ok && len(diffProfiles(stored, p)) == 0 {
+		p.Revision = stored.Revision
+	}
+	return p, nil
+}
+
+// materializeLocked resolves p against the stored parent chain. When p
+// carries no override list, it is derived from the fields p changes
+// relative to its parent.
+func (m *Manager) materializeLocked(p Profile) (Profile, error) {
+	if err := checkOverrides(p.Overrides); err != nil {
+		return Profile{}, err
+	}
+	visiting := map[string]bool{}
+	if p.ID != "" {
+		visiting[p.ID] = true
+	}
+	parent, err := m.effectiveLocked(p.ParentID, visiting)
+	if err != nil {
+		return Profile{}, err
+	}
+	if p.Overrides == nil {
+		p.Overrides = ChangedFields(parent, p)
+	}
+	return applyOverrides(parent, p), nil
+}
+
+// effectiveLocked computes the effective profile with the given ID from
+// the stored override values of its chain.
+func (m *Manager) effectiveLocked(id string, visiting map[string]bool) (Profile, error) {
+	if visiting[id] {
+		return Profile{}, fmt.Errorf("E_VALIDATION: profile inheritance cycle at %s", id)
+	}
+	if len(visiting) > maxInheritanceDepth {
+		return Profile{}, fmt.Errorf("E_VALIDATION: profile inheritance deeper than %d levels", maxInheritanceDepth)
+	}
+	p, ok := m.findLocked(id)
+	if !ok {
+		return Profile{}, fmt.Errorf("E_VALIDATION: parent profile not found: %s", id)
+	}
+	if p.ParentID == "" {
+		return p, nil
+	}
+	visiting[id] = true
+	parent, err := m.effectiveLocked(p.ParentID, visiting)
+	delete(visiting, id)
+	if err != nil {
+		return Profile{}, err
+	}
+	return applyOverrides(parent, p), nil
+}
+
+// refreshChildrenLocked re-resolves every child so inherited fields follow
+// their parents. Children whose chain cannot be resolved are returned.
+func (m *Manager) refreshChildrenLocked() []string {
+	resolved := make([]Profile, len(m.profiles))
+	var broken []string
+	for i, p := range m.profiles {
+		resolved[i] = p
+		if p.ParentID == "" {
+			continue
+		}
+		eff, err := m.effectiveLocked(p.ID, map[string]bool{})
+		if err != nil {
+			broken = append(broken, p.ID)
+			continue
+		}
+		resolved[i] = eff
+	}
+	m.profiles = resolved
+	return broken
+}
+
+// demoteBrokenLocked makes children whose parent chain cannot be resolved
+// (a deleted parent, a cycle, a chain too deep) standalone, so one broken
+// chain does not keep the other profiles from loading. A demoted child
+// keeps the fields of its newest revision with its own overrides on top.
+// Only the child where the chain breaks is demoted; its own children
+// resolve again afterwards. It returns a revision note per demoted child
+// and records a warning for each.
+func (m *Manager) demoteBrokenLocked() map[string]string {
+	notes := map[string]string{}
+	for {
+		broken := m.refreshChildrenLocked()
+		if len(broken) == 0 {
+			return notes
+		}
+		isBroken := make(map[string]bool, len(broken))
+		for _, id := range broken {
+			isBroken[id] = true
+		}
+		// A cycle has no member whose parent resolves; break it at the first.
+		id := broken[0]
+		for _, b := range broken {
+			p, _ := m.findLocked(b)
+			if _, ok := m.findLocked(p.ParentID); !ok || !isBroken[p.ParentID] {
+				id = b
+				break
+			}
+		}
+
+		i := slices.IndexFunc(m.profiles, func(p Profile) bool { return p.ID == id })
+		p := m.profiles[i]
+		_, err := m.effectiveLocked(id, map[string]bool{})
+		if hist := m.history[id]; len(hist) > 0 {
+			p = applyOverrides(hist[len(hist)-1].Profile, p)
+		}
+		p.ParentID = ""
+		p.Overrides = nil
+		m.profiles[i] = p
+
+		reason := strings.TrimPrefix(err.Error(), "E_VALIDATION: ")
+		notes[id] = "made standalone: " + reason
+		m.warnings = append(m.warnings, fmt.Sprintf("profile %q: %s; loaded as a standalone profile", p.Name, reason))
+	}
+}
+
+// dropUnknownOverrides removes override names that are not overridable
+// fields from a loaded child and returns them.
+func dropUnknownOverrides(p *Profile) []string {
+	if p.ParentID == "" || checkOverrides(p.Overrides) == nil {
+		return nil
+	}
+	var kept, dropped []string
+	for _, name := range p.Overrides {
+		if _, ok := fieldIndex[name]; ok {
+			kept = append(kept, name)
+		} else {
+			dropped = append(dropped, name)
+		}
+	}
+	if kept == nil {
+		kept = []string{}
+	}
+	p.Overrides = kept
+	return dropped
+}
+
+// childrenLocked returns the names of profiles whose parent is id.
+func (m *Manager) childrenLocked(id string) []string {
+	var names []string
+	for _, p := range m.profiles {
+		if p.ParentID == id {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
+
+// storedForm returns the JSON written to profiles.json for p. Children are
+// stored with their identity and overridden fields only.
+func storedForm(p Profile) (json.RawMessage, error) {
+	full, err := json.Marshal(p)
+	if err != nil || p.ParentID == "" {
+		return full, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(full, &fields); err != nil {
+		return nil, err
+	}
+	out := make(map[string]any)
+	for name := range metaFields {
+		if v, ok := fields[name]; ok {
+			out[name] = v
+		}
+	}
+	for _, name := range p.Overrides {
+		top, sub, nested := strings.Cut(name, ".")
+		if !nested {
+			out[top] = fields[top]
+			continue
+		}
+		var adv map[string]json.RawMessage
+		if err := json.Unmarshal(fields[top], &adv); err != nil {
+			return nil, err
+		}
+		group, _ := out[top].(map[string]json.RawMessage)
+		if group == nil {
+			if _, whole := out[top]; whole {
+				continue
+			}
+			group = make(map[string]json.RawMessage)
+			out[top] = group
+		}
+		group[sub] = adv[sub]
+	}
+	return json.Marshal(out)
+}
@@ -0,0 +1,307 @@
+package profile
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func intPtr(v int) *int { return &v }
+
+func findByName(t *testing.T, m *Manager, name string) Profile {
+	t.Helper()
+	for _, p := range m.List() {
+		if p.Name == name {
+			return p
+		}
+	}
+	t.Fatalf("profile %q not found", name)
+	return Profile{}
+}
+
+func TestInheritance_ChildOfPreset(t *testing.T) {
+	m := loadedManager(t)
+	preset := findByName(t, m, "HEVC Quality")
+
+	child := Profile{Name: "HEVC 1080p", ParentID: preset.ID, Overrides: []string{"output_res", "rate_value"}, OutputRes: "1920x1080", RateValue: 30}
+	if err := m.Upsert(child); err != nil {
+		t.Fatal(err)
+	}
+
+	got := findByName(t, m, "HEVC 1080p")
+	if got.Codec != preset.Codec || got.Preset != preset.Preset || got.AudioBitrate != preset.AudioBitrate {
+		t.Errorf("inherited fields not resolved: %+v", got)
+	}
+	if got.OutputRes != "1920x1080" || got.RateValue != 30 {
+		t.Errorf("overrides lost: res=%q rate=%v", got.OutputRes, got.RateValue)
+	}
+	if got.IsPreset || got.ParentID != preset.ID {
+		t.Errorf("child identity: preset=%v parent=%q", got.IsPreset, got.ParentID)
+	}
+}
+
+func TestInheritance_ParentChangesPropagate(t *testing.T) {
+	m := loadedManager(t)
+	if err := m.Upsert(userProfile("Base")); err != nil {
+		t.Fatal(err)
+	}
+	base := findByName(t, m, "Base")
+	if err := m.Upsert(Profile{Name: "Mid", ParentID: base.ID, Overrides: []string{"output_res"}, OutputRes: "1280x720"}); err != nil {
+		t.Fatal(err)
+	}
+	mid := findByName(t, m, "Mid")
+	if err := m.Upsert(Profile{Name: "Leaf", ParentID: mid.ID, Overrides: []string{"nvencc_advanced.max_bitrate"},
+		NVEncCAdvanced: NVEncCAdvanced{MaxBitrate: intPtr(8000)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	base.RateValue = 24
+	base.NVEncCAdvanced.Tune = "uhq"
+	if err := m.Upsert(base); err != nil {
+		t.Fatal(err)
+	}
+
+	leaf := findByName(t, m, "Leaf")
+	if leaf.RateValue != 24 || leaf.OutputRes != "1280x720" {
+		t.Errorf("leaf rate=%v res=%q, want 24 and 1280x720", leaf.RateValue, leaf.OutputRes)
+	}
+	if leaf.NVEncCAdvanced.Tune != "uhq" || leaf.NVEncCAdvanced.MaxBitrate == nil || *leaf.NVEncCAdvanced.MaxBitrate != 8000 {
+		t.Errorf("nvencc_advanced merge: %+v", leaf.NVEncCAdvanced)
+	}
+
+	// Children are stored with their overrides only and resolve the same after reload.
+	data, err := os.ReadFile(m.filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw struct {
+		Profiles []map[string]json.RawMessage `json:"profiles"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range raw.Profiles {
+		if string(p["name"]) != `"Leaf"` {
+			continue
+		}
+		if _, ok := p["codec"]; ok {
+			t.Errorf("stored child contains inherited field codec: %s", data)
+		}
+		if adv := string(p["nvencc_advanced"]); !strings.Contains(adv, "max_bitrate") || strings.Contains(adv, "tune") {
+			t.Errorf("stored nvencc_advanced=%s, want max_bitrate only", adv)
+		}
+	}
+
+	reloaded := NewManager(m.filePath)
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if again := findByName(t, reloaded, "Leaf"); again.RateValue != 24 || again.Codec != "hevc" || *again.NVEncCAdvanced.MaxBitrate != 8000 {
+		t.Errorf("reloaded leaf=%+v", again)
+	}
+}
+
+func TestInheritance_CyclesAndDeletes(t *testing.T) {
+	m := loadedManager(t)
+	if err := m.Upsert(userProfile("A")); err != nil {
+		t.Fatal(err)
+	}
+	a := findByName(t, m, "A")
+	if err := m.Upsert(Profile{Name: "B", ParentID: a.ID, Overrides: []string{}}); err != nil {
+		t.Fatal(err)
+	}
+	b := findByName(t, m, "B")
+
+	a.ParentID = b.ID
+	a.Overrides = []string{}
+	if err := m.Upsert(a); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("cycle: err=%v", err)
+	}
+	b.ParentID = b.ID
+	if err := m.Upsert(b); err == nil {
+		t.Error("expected error for self parent")
+	}
+	if err := m.Upsert(Profile{Name: "C", ParentID: "missing"}); err == nil {
+		t.Error("expected error for missing parent")
+	}
+	if err := m.Upsert(Profile{Name: "D", ParentID: a.ID, Overrides: []string{"name"}}); err == nil {
+		t.Error("expected error for non-overridable field")
+	}
+
+	if err := m.Delete(a.ID); err == nil {
+		t.Error("deleting a parent with children must fail")
+	}
+	if err := m.Delete(b.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Delete(a.ID); err != nil {
+		t.Errorf("delete after removing children: %v", err)
+	}
+}
+
+func TestResolve_DerivesOverridesFromChangedFields(t *testing.T) {
+	m := loadedManager(t)
+	preset := findByName(t, m, "AV1 Fast")
+
+	// An editor may send the full profile without an override list.
+	edited := preset
+	edited.ID = ""
+	edited.Name = "AV1 Fast 720p"
+	edited.IsPreset = false
+	edited.ParentID = preset.ID
+	edited.OutputRes = "1280x720"
+
+	got, err := m.Resolve(edited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Overrides) != 1 || got.Overrides[0] != "output_res" || got.OutputRes != "1280x720" {
+		t.Errorf("overrides=%v res=%q, want [output_res]", got.Overrides, got.OutputRes)
+	}
+
+	standalone := userProfile("Solo")
+	if got, err := m.Resolve(standalone); err != nil || got.Name != "Solo" {
+		t.Errorf("profile without parent must be returned as is: %+v, %v", got, err)
+	}
+}
+
+func TestImportProfiles_RelinksChildren(t *testing.T) {
+	src := loadedManager(t)
+	if err := src.Upsert(userProfile("Base")); err != nil {
+		t.Fatal(err)
+	}
+	base := findByName(t, src, "Base")
+	if err := src.Upsert(Profile{Name: "Child", ParentID: base.ID, Overrides: []string{"rate_value"}, RateValue: 33}); err != nil {
+		t.Fatal(err)
+	}
+	child := findByName(t, src, "Child")
+	bundle := t.TempDir() + "/bundle.json"
+
+	// Child alone: parent unknown at the destination, imported standalone.
+	if err := src.ExportProfiles([]string{child.ID}, bundle, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	dst := loadedManager(t)
+	if _, err := dst.ImportProfiles(bundle, ImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := findByName(t, dst, "Child"); got.ParentID != "" || got.RateValue != 33 || got.Codec != "hevc" {
+		t.Errorf("standalone import=%+v", got)
+	}
+
+	// Both again under rename: the copy of the child follows the copy of the parent.
+	if err := src.ExportProfiles([]string{base.ID, child.ID}, bundle, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	res, err := dst.ImportProfiles(bundle, ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var baseCopy string
+	for _, e := range res.Profiles {
+		if e.SourceID == base.ID {
+			baseCopy = e.ID
+		}
+	}
+	for _, e := range res.Profiles {
+		if e.SourceID != child.ID {
+			continue
+		}
+		got, _ := dst.Get(e.ID)
+		if got.ParentID != baseCopy || got.RateValue != 33 {
+			t.Errorf("child copy parent=%q rate=%v, want %q and 33", got.ParentID, got.RateValue, baseCopy)
+		}
+	}
+}
+
+func TestInheritance_LoadDemotesBrokenChains(t *testing.T) {
+	m := loadedManager(t)
+	for _, name := range []string{"Base", "P", "Q"} {
+		if err := m.Upsert(userProfile(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	base := findByName(t, m, "Base")
+	if err := m.Upsert(Profile{Name: "Mid", ParentID: base.ID, Overrides: []string{"output_res"}, OutputRes: "1280x720"}); err != nil {
+		t.Fatal(err)
+	}
+	mid := findByName(t, m, "Mid")
+	if err := m.Upsert(Profile{Name: "Leaf", ParentID: mid.ID, Overrides: []string{"rate_value"}, RateValue: 30}); err != nil {
+		t.Fatal(err)
+	}
+	p, q := findByName(t, m, "P"), findByName(t, m, "Q")
+
+	// Delete Base behind the manager's back, make P and Q each other's
+	// parent and give Leaf an override field that does not exist.
+	data, err := os.ReadFile(m.filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw struct {
+		Profiles []map[string]any `json:"profiles"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	var kept []map[string]any
+	for _, rp := range raw.Profiles {
+		switch rp["id"] {
+		case base.ID:
+			continue
+		case p.ID:
+			rp["parent_id"], rp["overrides"] = q.ID, []string{}
+		case q.ID:
+			rp["parent_id"], rp["overrides"] = p.ID, []string{}
+		}
+		if rp["name"] == "Leaf" {
+			rp["overrides"] = []string{"rate_value", "no_such_field"}
+		}
+		kept = append(kept, rp)
+	}
+	raw.Profiles = kept
+	if data, err = json.Marshal(raw); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(m.filePath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := NewManager(m.filePath)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("load with broken chains: %v", err)
+	}
+	findByName(t, reloaded, "HEVC Quality")
+
+	// Mid keeps its last fields; Leaf resolves against it again.
+	gotMid := findByName(t, reloaded, "Mid")
+	if gotMid.ParentID != "" || gotMid.Codec != "hevc" || gotMid.OutputRes != "1280x720" {
+		t.Errorf("demoted mid=%+v", gotMid)
+	}
+	leaf := findByName(t, reloaded, "Leaf")
+	if leaf.ParentID != mid.ID || leaf.RateValue != 30 || leaf.OutputRes != "1280x720" || len(leaf.Overrides) != 1 {
+		t.Errorf("leaf parent=%q rate=%v res=%q overrides=%v", leaf.ParentID, leaf.RateValue, leaf.OutputRes, leaf.Overrides)
+	}
+	if gp, gq := findByName(t, reloaded, "P"), findByName(t, reloaded, "Q"); (gp.ParentID == "") == (gq.ParentID == "") {
+		t.Errorf("cycle not broken once: P parent=%q Q parent=%q", gp.ParentID, gq.ParentID)
+	}
+
+	warnings := strings.Join(reloaded.LoadWarnings(), "\n")
+	for _, want := range []string{`"Mid": parent profile not found`, "cycle", "no_such_field"} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("warnings missing %q:\n%s", want, warnings)
+		}
+	}
+	if n := len(reloaded.LoadWarnings()); n != 3 {
+		t.Errorf("%d warnings, want 3:\n%s", n, warnings)
+	}
+
+	// The repair is saved: the next load is clean.
+	again := NewManager(m.filePath)
+	if err := again.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if w := again.LoadWarnings(); len(w) != 0 {
+		t.Errorf("warnings after repair: %v", w)
+	}
+}
@@ -0,0 +1,93 @@
+package profile
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severities of a FieldIssue.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// FieldIssue is an encoder-specific validation finding for one field,
+// keyed by its JSON name ("bframes", "nvencc_advanced.tier").
+type FieldIssue struct {
+	Field    string `json:"field"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// Checker validates a profile against the rules of its encoder.
+// encoder.Registry implements it.
+type Checker interface {
+	CheckProfile(p Profile) []FieldIssue
+}
+
+// IssuesError returns an E_VALIDATION error listing the error-severity
+// issues, or nil when there are none. Warnings never fail.
+func IssuesError(issues []FieldIssue) error {
+	var msgs []string
+	for _, is := range issues {
+		if is.Severity == SeverityError {
+			msgs = append(msgs, is.Field+": "+is.Message)
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("E_VALIDATION: %s", strings.Join(msgs, "; "))
+}
+
+// Warnings returns the warning-severity issues.
+func Warnings(issues []FieldIssue) []FieldIssue {
+	var out []FieldIssue
+	for _, is := range issues {
+		if is.Severity == SeverityWarning {
+			out = append(out, is)
+		}
+	}
+	return out
+}
+
+// SetChecker installs the encoder-specific checker run by Upsert, imports
+// and Check.
+func (m *Manager) SetChecker(c Checker) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checker = c
+}
+
+// Check resolves p and returns its encoder-specific issues. The error is
+// non-nil when p fails generic validation or cannot be resolved; issues
+// of error severity are returned, not reported as an error.
+func (m *Manager) Check(p Profile) ([]FieldIssue, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if p.ParentID != "" {
+		eff, err := m.materializeLocked(p)
+		if err != nil {
+			return nil, err
+		}
+		p = eff
+	}
+	if err := Validate(p); err != nil {
+		return nil, err
+	}
+	if m.checker == nil {
+		return nil, nil
+	}
+	return m.checker.CheckProfile(p), nil
+}
+
+// validateLocked runs generic validation and the checker's error rules.
+func (m *Manager) validateLocked(p Profile) error {
+	if err := Validate(p); err != nil {
+		return err
+	}
+	if m.checker == nil {
+		return nil
+	}
+	return IssuesError(m.checker.CheckProfile(p))
+}
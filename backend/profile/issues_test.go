@@ -0,0 +1,92 @@
+package profile
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// codecChecker rejects h264 at 10-bit and warns about opus.
+type codecChecker struct{}
+
+func (codecChecker) CheckProfile(p Profile) []FieldIssue {
+	var issues []FieldIssue
+	if p.Codec == "h264" && p.OutputDepth == 10 {
+		issues = append(issues, FieldIssue{Field: "output_depth", Severity: SeverityError, Message: "8-bit only"})
+	}
+	if p.AudioMode == "opus" {
+		issues = append(issues, FieldIssue{Field: "audio_mode", Severity: SeverityWarning, Message: "old players"})
+	}
+	return issues
+}
+
+func TestUpsert_RunsChecker(t *testing.T) {
+	m := loadedManager(t)
+	m.SetChecker(codecChecker{})
+
+	bad := userProfile("H264 10-bit")
+	bad.Codec = "h264"
+	err := m.Upsert(bad)
+	if err == nil || !strings.HasPrefix(err.Error(), "E_VALIDATION") || !strings.Contains(err.Error(), "output_depth") {
+		t.Fatalf("err=%v, want E_VALIDATION naming output_depth", err)
+	}
+
+	warned := userProfile("Opus")
+	warned.AudioMode = "opus"
+	if err := m.Upsert(warned); err != nil {
+		t.Fatalf("warnings must not block saving: %v", err)
+	}
+
+	issues, err := m.Check(bad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	warned.Codec = "h264"
+	issues = append(issues, mustCheck(t, m, warned)...)
+	if len(issues) != 3 || len(Warnings(issues)) != 1 {
+		t.Errorf("issues=%+v, want two errors and one warning", issues)
+	}
+
+	// The checker also applies to children through their parent.
+	parent := findByName(t, m, "Opus")
+	child := Profile{Name: "Child", ParentID: parent.ID, Overrides: []string{"codec"}, Codec: "h264"}
+	if err := m.Upsert(child); err == nil {
+		t.Error("child inheriting 10-bit output with h264 must be rejected")
+	}
+
+	if _, err := m.Check(Profile{Name: ""}); err == nil {
+		t.Error("Check must report generic validation errors")
+	}
+}
+
+func TestImportProfiles_RunsChecker(t *testing.T) {
+	src := loadedManager(t)
+	bad := userProfile("H264 10-bit")
+	bad.Codec = "h264"
+	if err := src.Upsert(bad); err != nil {
+		t.Fatal(err)
+	}
+	bundle := filepath.Join(t.TempDir(), "bundle.json")
+	if err := src.ExportProfiles([]string{findByName(t, src, "H264 10-bit").ID}, bundle, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := loadedManager(t)
+	dst.SetChecker(codecChecker{})
+	res, err := dst.ImportProfiles(bundle, ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Count("invalid") != 1 || !strings.Contains(res.Profiles[0].Reason, "output_depth") {
+		t.Errorf("import=%+v, want invalid entry", res)
+	}
+}
+
+func mustCheck(t *testing.T, m *Manager, p Profile) []FieldIssue {
+	t.Helper()
+	issues, err := m.Check(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return issues
+}
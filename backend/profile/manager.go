@@ -17,6 +17,9 @@ type Manager struct {
 	mu       sync.RWMutex
 	profiles []Profile
 	filePath string
+	checker  Checker
+	history  map[string][]Revision
+	warnings []string
 }
 
 // NewManager creates a Manager for the given profiles.json path.
@@ -29,11 +32,16 @@ func (m *Manager) Load() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	m.warnings = nil
+	if err := m.loadHistoryLocked(); err != nil {
+		return err
+	}
 	data, err := os.ReadFile(m.filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			m.profiles = GeneratePresets()
-			return m.saveLocked()
+			m.trackLocked(nil, nil)
+			return m.commitLocked()
 		}
 		return fmt.Errorf("read profiles: %w", err)
 	}
@@ -48,7 +56,8 @@ func (m *Manager) Load() error {
 			backupPath := m.filePath + fmt.Sprintf(".broken.%d", time.Now().Unix())
 			os.Rename(m.filePath, backupPath)
 			m.profiles = GeneratePresets()
-			return m.saveLocked()
+			m.trackLocked(nil, nil)
+			return m.commitLocked()
 		}
 		pf.Profiles = flat
 		needsResave = true
@@ -60,18 +69,39 @@ func (m *Manager) Load() error {
 		if err != nil {
 			return fmt.Errorf("migrate profile %q: %w", p.Name, err)
 		}
+		if dropped := dropUnknownOverrides(&mp); len(dropped) > 0 {
+			m.warnings = append(m.warnings, fmt.Sprintf("profile %q: dropped unknown override fields %s", mp.Name, strings.Join(dropped, ", ")))
+			needsResave = true
+		}
 		migrated = append(migrated, mp)
 	}
 
 	m.profiles = migrated
+	notes := m.demoteBrokenLocked()
+	if len(notes) > 0 {
+		needsResave = true
+	}
+
+	// Profiles without history (older files) start at their current state.
+	if m.trackLocked(nil, notes) {
+		needsResave = true
+	}
 
 	// Re-save in correct format after flat array migration
 	if needsResave {
-		return m.saveLocked()
+		return m.commitLocked()
 	}
 	return nil
 }
 
+// LoadWarnings returns the problems the last Load worked around, such as
+// children made standalone because their parent chain is broken.
+func (m *Manager) LoadWarnings() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]string(nil), m.warnings...)
+}
+
 // List returns all profiles.
 func (m *Manager) List() []Profile {
 	m.mu.RLock()
@@ -93,14 +123,37 @@ func (m *Manager) Get(id string) (Profile, bool) {
 	return Profile{}, false
 }
 
-// Upsert creates or updates a profile.
+// Upsert creates or updates a profile. A profile with a parent is stored
+// as a child: see materializeLocked for how its overrides are determined.
+// Children of an updated profile pick up the change.
 func (m *Manager) Upsert(p Profile) error {
-	if err := Validate(p); err != nil {
-		return err
-	}
+	return m.UpsertWithNote(p, "")
+}
+
+// UpsertWithNote is Upsert with a note stored on the revision it creates.
+// Saving an unchanged profile creates no revision.
+func (m *Manager) UpsertWithNote(p Profile, note string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	return m.upsertLocked(p, note)
+}
+
+func (m *Manager) upsertLocked(p Profile, note string) error {
+	if p.ParentID != "" {
+		eff, err := m.materializeLocked(p)
+		if err != nil {
+			return err
+		}
+		p = eff
+	} else {
+		p.Overrides = nil
+	}
+	if err := m.validateLocked(p); err != nil {
+		return err
+	}
 
+	before := make([]Profile, len(m.profiles))
+	copy(before, m.profiles)
 	found := false
 	for i, existing := range m.profiles {
 		if existing.ID == p.ID {
@@ -117,12 +170,17 @@ func (m *Manager) Upsert(p Profile) error {
 			p.ID = uuid.New().String()
 		}
 		p.Version = CurrentVersion
+		p.Revision = 0
 		m.profiles = append(m.profiles, p)
 	}
-	return m.saveLocked()
+	m.refreshChildrenLocked()
+	m.trackLocked(before, map[string]string{p.ID: note})
+	return m.commitLocked()
 }
 
-// Delete removes a profile by ID. Presets cannot be deleted.
+// Delete removes a profile by ID. Presets cannot be deleted. Its revision
+// history is kept, so job records that name a revision still resolve and
+// the profile can be restored from it.
 func (m *Manager) Delete(id string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -132,8 +190,11 @@ func (m *Manager) Delete(id string) error {
 			if p.IsPreset {
 				return fmt.Errorf("cannot delete preset profile %q", p.Name)
 			}
+			if children := m.childrenLocked(id); len(children) > 0 {
+				return fmt.Errorf("profile %q is the parent of %s", p.Name, strings.Join(children, ", "))
+			}
 			m.profiles = append(m.profiles[:i], m.profiles[i+1:]...)
-			return m.saveLocked()
+			return m.commitLocked()
 		}
 	}
 	return fmt.Errorf("profile not found: %s", id)
@@ -155,11 +216,13 @@ func (m *Manager) Duplicate(id string, newName string) (Profile, error) {
 			dup.ID = uuid.New().String()
 			dup.Name = newName
 			dup.IsPreset = false
+			dup.Revision = 0
 			m.profiles = append(m.profiles, dup)
-			if err := m.saveLocked(); err != nil {
+			m.trackLocked(nil, map[string]string{dup.ID: fmt.Sprintf("duplicated from %q", p.Name)})
+			if err := m.commitLocked(); err != nil {
 				return Profile{}, err
 			}
-			return dup, nil
+			return m.profiles[len(m.profiles)-1], nil
 		}
 	}
 	return Profile{}, fmt.Errorf("profile not found: %s", id)
@@ -178,9 +241,27 @@ func (m *Manager) SetDefault(id string) error {
 	return fmt.Errorf("profile not found: %s", id)
 }
 
+// commitLocked writes profiles and their revision history.
+func (m *Manager) commitLocked() error {
+	if err := m.saveLocked(); err != nil {
+		return err
+	}
+	return m.saveHistoryLocked()
+}
+
 // saveLocked writes profiles to disk atomically. Caller must hold mu.
 func (m *Manager) saveLocked() error {
-	pf := ProfilesFile{Profiles: m.profiles}
+	var pf struct {
+		Profiles []json.RawMessage `json:"profiles"`
+	}
+	pf.Profiles = make([]json.RawMessage, len(m.profiles))
+	for i, p := range m.profiles {
+		raw, err := storedForm(p)
+		if err != nil {
+			return fmt.Errorf("marshal profile %q: %w", p.Name, err)
+		}
+		pf.Profiles[i] = raw
+	}
 	data, err := json.MarshalIndent(pf, "", "  ")
 	if err != nil {
 		return fmt.Errorf("marshal profiles: %w", err)
@@ -251,6 +332,39 @@ func Validate(p Profile) error {
 		return fmt.Errorf("E_VALIDATION: custom_options max 4096 characters")
 	}
 
+	if err := ValidateFilters(p.Filters); err != nil {
+		return err
+	}
+	switch p.AutoCrop {
+	case "", "off", "apply", "confirm":
+	default:
+		return fmt.Errorf("E_VALIDATION: auto_crop must be off, apply or confirm")
+	}
+	if err := validateTrackRules(p.Tracks); err != nil {
+		return err
+	}
+	if err := validateChunks(p.Chunks); err != nil {
+		return err
+	}
+	if l := p.Loudness; l != nil {
+		if l.TargetLUFS < -70 || l.TargetLUFS > -5 {
+			return fmt.Errorf("E_VALIDATION: loudness target_lufs must be -70..-5")
+		}
+		if l.TruePeak < -9 || l.TruePeak > 0 {
+			return fmt.Errorf("E_VALIDATION: loudness true_peak must be -9..0")
+		}
+	}
+	switch p.HDRMode {
+	case "", "off", "warn", "enforce", "tonemap":
+	default:
+		return fmt.Errorf("E_VALIDATION: hdr_mode must be off, warn, enforce or tonemap")
+	}
+	switch p.Tonemap {
+	case "", "hable", "mobius", "reinhard", "bt2390":
+	default:
+		return fmt.Errorf("E_VALIDATION: tonemap must be hable, mobius, reinhard or bt2390")
+	}
+
 	adv := p.NVEncCAdvanced
 	if adv.MaxBitrate != nil && *adv.MaxBitrate <= 0 {
 		return fmt.Errorf("E_VALIDATION: nvencc_advanced.max_bitrate must be > 0")
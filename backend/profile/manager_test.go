@@ -199,6 +199,22 @@ func TestValidation(t *testing.T) {
 		{"lookahead too high", func(p *Profile) { v := 33; p.Lookahead = &v }, true},
 		{"audio_bitrate low", func(p *Profile) { p.AudioBitrate = 10 }, true},
 		{"custom_options too long", func(p *Profile) { p.CustomOptions = string(make([]byte, 4097)) }, true},
+		{"auto_crop confirm", func(p *Profile) { p.AutoCrop = "confirm" }, false},
+		{"bad auto_crop", func(p *Profile) { p.AutoCrop = "always" }, true},
+		{"hdr_mode tonemap", func(p *Profile) { p.HDRMode, p.Tonemap = "tonemap", "bt2390" }, false},
+		{"bad hdr_mode", func(p *Profile) { p.HDRMode = "auto" }, true},
+		{"bad tonemap", func(p *Profile) { p.Tonemap = "aces" }, true},
+		{"track rules", func(p *Profile) {
+			p.Tracks = &TrackRules{AudioLanguages: []string{"jpn"}, FirstAudio: "copy", OtherAudio: "aac", DefaultSub: "first", ForcedSub: "eng"}
+		}, false},
+		{"loudness", func(p *Profile) { p.Loudness = &Loudness{TargetLUFS: -16, TruePeak: -1.5} }, false},
+		{"loudness too loud", func(p *Profile) { p.Loudness = &Loudness{TargetLUFS: -3, TruePeak: -1} }, true},
+		{"loudness positive peak", func(p *Profile) { p.Loudness = &Loudness{TargetLUFS: -23, TruePeak: 1} }, true},
+		{"track rules bad codec", func(p *Profile) { p.Tracks = &TrackRules{OtherAudio: "flac"} }, true},
+		{"track rules bad language", func(p *Profile) { p.Tracks = &TrackRules{SubLanguages: []string{"Japanese"}} }, true},
+		{"chunks", func(p *Profile) { p.Chunks = &ChunkSettings{SegmentSec: 120, Boundary: "scene", Retries: 2} }, false},
+		{"chunks short segments", func(p *Profile) { p.Chunks = &ChunkSettings{SegmentSec: 10} }, true},
+		{"chunks bad boundary", func(p *Profile) { p.Chunks = &ChunkSettings{Boundary: "gop"} }, true},
 	}
 
 	for _, tt := range tests {
@@ -13,6 +13,8 @@ func Migrate(p Profile) (Profile, error) {
 			p, err = migrateV2toV3(p)
 		case 3:
 			p, err = migrateV3toV4(p)
+		case 4:
+			p, err = migrateV4toV5(p)
 		default:
 			return p, fmt.Errorf("unknown profile version %d", p.Version)
 		}
@@ -48,3 +50,14 @@ func migrateV3toV4(p Profile) (Profile, error) {
 	p.Version = 4
 	return p, nil
 }
+
+// migrateV4toV5: add filters, moving filter options out of custom_options.
+func migrateV4toV5(p Profile) (Profile, error) {
+	lifted, rest := liftFilters(p.CustomOptions)
+	if len(lifted) > 0 && len(p.Filters)+len(lifted) <= MaxFilters {
+		p.Filters = append(p.Filters, lifted...)
+		p.CustomOptions = rest
+	}
+	p.Version = 5
+	return p, nil
+}
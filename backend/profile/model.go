@@ -9,10 +9,22 @@ type Profile struct {
 	EncoderType  string         `json:"encoder_type"`
 	EncoderOpts  map[string]any `json:"encoder_options"`
 
+	// Inheritance: a child takes every field from its parent except the
+	// ones listed in Overrides (JSON field names, see OverridableFields).
+	ParentID  string   `json:"parent_id,omitempty"`
+	Overrides []string `json:"overrides,omitempty"`
+
+	// Revision is the number of the latest revision in the profile's
+	// history (see ListRevisions). It is assigned by the Manager.
+	Revision int `json:"revision,omitempty"`
+
 	// Video basic (nvencc)
 	Codec       string  `json:"codec"`
 	RateControl string  `json:"rate_control"`
-	RateValue   float64 `json:"rate_value"`
+	RateValue   float64 `json:"rate_value"` // target size in MB with rate_control "target_size"
+	// TargetSizeMode is the rate control a target size is encoded with:
+	// "vbr" (default) or "cbr".
+	TargetSizeMode string `json:"target_size_mode,omitempty"`
 	Preset      string  `json:"preset"`
 	OutputDepth int     `json:"output_depth"`
 	Multipass   string  `json:"multipass"`
@@ -26,15 +38,35 @@ type Profile struct {
 	AQ        bool `json:"aq"`
 	AQTemporal bool `json:"aq_temporal"`
 
+	// Video processing filters (nvencc), in emission order
+	Filters []Filter `json:"filters,omitempty"`
+	// AutoCrop detects black bars per input: "apply" crops them, "confirm"
+	// asks before cropping. Empty or "off" disables detection.
+	AutoCrop string `json:"auto_crop,omitempty"`
+
 	// Speed
 	SplitEnc string `json:"split_enc"`
 	Parallel string `json:"parallel"`
 	Decoder  string `json:"decoder"`
 	Device   string `json:"device"`
+	// Chunks splits long inputs into segments encoded in parallel by the
+	// session's workers and joined afterwards; nil encodes inputs whole.
+	Chunks *ChunkSettings `json:"chunks,omitempty"`
 
 	// Audio
 	AudioMode    string `json:"audio_mode"`
 	AudioBitrate int    `json:"audio_bitrate"`
+	// Tracks maps audio and subtitle tracks per input; nil handles every
+	// track with audio_mode and sub_copy.
+	Tracks *TrackRules `json:"tracks,omitempty"`
+	// TrackMap is what Tracks selected from a job's input (set per job).
+	TrackMap *TrackMap `json:"-"`
+	// Loudness normalizes the transcoded audio tracks of each input to a
+	// loudness target after a measurement pass; nil leaves levels alone.
+	Loudness *Loudness `json:"loudness,omitempty"`
+	// AudioGains is the gain in dB per audio track number that loudness
+	// normalization applies to a job's input (set per job).
+	AudioGains map[int]float64 `json:"-"`
 
 	// Color
 	Colormatrix string `json:"colormatrix"`
@@ -42,6 +74,18 @@ type Profile struct {
 	Colorprim   string `json:"colorprim"`
 	Colorrange  string `json:"colorrange"`
 	DHDR10Info  string `json:"dhdr10_info"`
+	// HDRMode adapts the encode to HDR (PQ, HLG) inputs per job: "warn"
+	// keeps an SDR target and warns, "enforce" raises it to 10-bit
+	// HEVC/AV1, "tonemap" converts the input to SDR. HDR targets get the
+	// input's color signal and HDR10 metadata. Empty or "off" disables it.
+	HDRMode string `json:"hdr_mode,omitempty"`
+	// Tonemap is the hdr2sdr curve of "tonemap": hable (default), mobius,
+	// reinhard or bt2390.
+	Tonemap string `json:"tonemap,omitempty"`
+	// MasterDisplay and MaxCLL carry the HDR10 metadata of a job's input
+	// (--master-display, --max-cll). They are set per job, never saved.
+	MasterDisplay string `json:"-"`
+	MaxCLL        string `json:"-"`
 
 	// Metadata
 	MetadataCopy      bool `json:"metadata_copy"`
@@ -100,10 +144,16 @@ type NVEncCAdvanced struct {
 	OutputThread   *int   `json:"output_thread"`
 }
 
+// Loudness is an EBU R128 loudness target.
+type Loudness struct {
+	TargetLUFS float64 `json:"target_lufs"` // integrated loudness, e.g. -23 (EBU R128) or -16
+	TruePeak   float64 `json:"true_peak"`   // maximum true peak in dBTP, e.g. -1
+}
+
 // ProfilesFile is the top-level structure for profiles.json.
 type ProfilesFile struct {
 	Profiles []Profile `json:"profiles"`
 }
 
 // CurrentVersion is the latest profile schema version.
-const CurrentVersion = 4
+const CurrentVersion = 5
@@ -0,0 +1,87 @@
+package profile
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// TrackRules select and map the audio and subtitle tracks of each input.
+// They replace audio_mode for the tracks they keep and narrow sub_copy.
+type TrackRules struct {
+	// AudioLanguages keeps the audio tracks in these languages (as tagged
+	// in the input, e.g. "jpn", "eng"); empty keeps every track. Tracks
+	// without a language are always kept.
+	AudioLanguages []string `json:"audio_languages,omitempty"`
+	// DropCommentary drops audio and subtitle tracks marked or titled as
+	// commentary.
+	DropCommentary bool `json:"drop_commentary,omitempty"`
+	// FirstAudio and OtherAudio are "copy", "aac", "opus" or "none" for
+	// the first kept audio track and the others; empty uses audio_mode.
+	FirstAudio string `json:"first_audio,omitempty"`
+	OtherAudio string `json:"other_audio,omitempty"`
+	// DefaultAudio marks the first kept audio track in this language, or
+	// the first kept track with "first", as the default track.
+	DefaultAudio string `json:"default_audio,omitempty"`
+	// SubLanguages keeps the subtitle tracks in these languages when
+	// sub_copy is on; empty keeps every track.
+	SubLanguages []string `json:"sub_languages,omitempty"`
+	// DefaultSub marks the first kept subtitle track in this language (or
+	// "first") as the default one; ForcedSub marks the kept tracks in this
+	// language as forced.
+	DefaultSub string `json:"default_sub,omitempty"`
+	ForcedSub  string `json:"forced_sub,omitempty"`
+	// Sidecars adds the .srt, .ass and .ssa files next to the input that
+	// share its name, e.g. "movie.srt" or "movie.jpn.ass" for "movie.mkv".
+	Sidecars bool `json:"sidecars,omitempty"`
+}
+
+// TrackMap is what a profile's TrackRules select from one input. It is set
+// per job and never saved.
+type TrackMap struct {
+	Audio    []TrackAction
+	Subs     []TrackAction
+	Sidecars []string
+}
+
+// TrackAction maps one kept input track.
+type TrackAction struct {
+	// Track is the 1-based number among the input's tracks of its type, as
+	// NVEncC counts them; Stream is the stream index.
+	Track  int
+	Stream int
+	// Codec is "copy", "aac" or "opus"; subtitles are always copied.
+	Codec string
+	// Disposition is e.g. "default", "forced" or "unset"; empty keeps the
+	// input's.
+	Disposition string
+}
+
+var trackLanguageRe = regexp.MustCompile(`^[a-z]{2,3}$`)
+
+func validateTrackRules(r *TrackRules) error {
+	if r == nil {
+		return nil
+	}
+	for _, codec := range []string{r.FirstAudio, r.OtherAudio} {
+		switch codec {
+		case "", "copy", "aac", "opus", "none":
+		default:
+			return fmt.Errorf("E_VALIDATION: tracks: audio codec must be copy, aac, opus or none")
+		}
+	}
+	langs := append(append([]string{}, r.AudioLanguages...), r.SubLanguages...)
+	for _, l := range []string{r.DefaultAudio, r.DefaultSub, r.ForcedSub} {
+		if l != "" && l != "first" {
+			langs = append(langs, l)
+		}
+	}
+	for _, l := range langs {
+		if !trackLanguageRe.MatchString(l) {
+			return fmt.Errorf("E_VALIDATION: tracks: language %q must be a 2 or 3 letter code like jpn", l)
+		}
+	}
+	if r.ForcedSub == "first" {
+		return fmt.Errorf("E_VALIDATION: tracks: forced_sub must be a language")
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+package queue
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yuta/enque/backend/encoder"
+	"github.com/yuta/enque/backend/events"
+	"github.com/yuta/enque/backend/logging"
+	"github.com/yuta/enque/backend/probe"
+	"github.com/yuta/enque/backend/profile"
+)
+
+// SplitFinder lists the points an input can be split at for chunked
+// encoding. *probe.SplitFinder implements it.
+type SplitFinder interface {
+	Keyframes(ctx context.Context, path string) ([]float64, error)
+	SceneChanges(ctx context.Context, path string) ([]float64, error)
+}
+
+// SegmentJoiner joins the encoded segments of a chunked job into its
+// output. *encoder.SegmentJoiner implements it.
+type SegmentJoiner interface {
+	JoinSegments(ctx context.Context, p profile.Profile, segments []string, source, output string) error
+}
+
+// chunkState is kept on a job that was split into segments, for joining
+// them once they are all done.
+type chunkState struct {
+	prof     profile.Profile // the job's planned profile
+	resolved *ResolveResult
+	dir      string // holds the segments
+	boundary string
+	joined   bool
+	result   *logging.ChunksResult
+}
+
+// segmentState is kept on each segment of a chunked job.
+type segmentState struct {
+	parent   *QueueJob
+	chunk    encoder.Chunk
+	path     string
+	attempts int // retries so far
+}
+
+// planChunks decides whether a job with chunks is split, and where. It
+// returns nil to encode the input whole: when it is short, when the
+// profile needs a whole-file encode, or when there is no media info.
+func (w *Worker) planChunks(ctx context.Context, job *QueueJob, prof profile.Profile, media probe.MediaInfo, probeErr error) []encoder.Chunk {
+	warn := func(msg string) {
+		w.emitter.Warning(events.Message{SessionID: w.session.ID, JobID: job.JobID, Message: "chunks: " + msg})
+	}
+	if reason := encoder.ChunksUnsupported(prof); reason != "" {
+		warn(fmt.Sprintf("%s need a whole-file encode; encoding the input whole", reason))
+		return nil
+	}
+	if probeErr != nil || w.splitter == nil {
+		return nil
+	}
+	if media.DurationSec < float64(cmp.Or(prof.Chunks.MinDurationSec, profile.DefaultChunkMinDurationSec)) {
+		return nil
+	}
+	keyframes, err := w.splitter.Keyframes(ctx, job.InputPath)
+	if err != nil {
+		warn(fmt.Sprintf("%v; encoding the input whole", err))
+		return nil
+	}
+	var scenes []float64
+	if prof.Chunks.Boundary == "scene" {
+		if scenes, err = w.splitter.SceneChanges(ctx, job.InputPath); err != nil {
+			warn(fmt.Sprintf("%v; splitting at keyframes", err))
+		}
+	}
+	return encoder.PlanChunks(media.DurationSec, keyframes, scenes, *prof.Chunks)
+}
+
+// splitJob queues one segment sub-job per chunk. Segments encode the video
+// of their chunk into a folder next to the job's temp output; the worker
+// that finishes the last one joins them. The job stays running meanwhile.
+func (w *Worker) splitJob(job *QueueJob, prof profile.Profile, resolved *ResolveResult, chunks []encoder.Chunk) error {
+	ext := filepath.Ext(resolved.TempPath)
+	dir := strings.TrimSuffix(resolved.TempPath, ext) + ".chunks"
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("chunks: %w", err)
+	}
+	w.session.withLock(func() {
+		job.chunks = &chunkState{prof: prof, resolved: resolved, dir: dir, boundary: cmp.Or(prof.Chunks.Boundary, "keyframe")}
+	})
+
+	inputs := make([]JobInput, len(chunks))
+	scenes := 0
+	for i, c := range chunks {
+		p := encoder.SegmentProfile(prof, c, i == len(chunks)-1)
+		inputs[i] = JobInput{
+			JobID:       fmt.Sprintf("%s_seg%02d", job.JobID, c.Index),
+			InputPath:   job.InputPath,
+			Profile:     &p,
+			parentJobID: job.JobID,
+			segment: &segmentState{
+				parent: job,
+				chunk:  c,
+				path:   filepath.Join(dir, fmt.Sprintf("seg%02d%s", c.Index, ext)),
+			},
+		}
+		if c.Scene {
+			scenes++
+		}
+	}
+	if _, err := w.session.appendSegments(inputs); err != nil {
+		os.RemoveAll(dir)
+		return fmt.Errorf("chunks: %w", err)
+	}
+	w.emitJobLog(job, fmt.Sprintf("chunks: %d segments of about %ds, %d at scene changes",
+		len(chunks), cmp.Or(prof.Chunks.SegmentSec, profile.DefaultChunkSegmentSec), scenes))
+	w.emitter.SessionState(w.session.Snapshot())
+	return nil
+}
+
+// retrySegment queues a failed or timed-out segment again while it has
+// retries left. It reports whether the segment was requeued.
+func (w *Worker) retrySegment(job *QueueJob, status JobStatus, resolved *ResolveResult) bool {
+	seg := job.segment
+	if status != JobFailed && status != JobTimeout {
+		return false
+	}
+	retries := seg.parent.chunks.prof.Chunks.Retries
+	if seg.attempts >= retries || w.session.IsAborting() {
+		return false
+	}
+	os.Remove(resolved.TempPath)
+	w.tempTracker.Remove(resolved.TempPath)
+	if !w.session.requeue(job) {
+		return false
+	}
+	w.emitter.Warning(events.Message{SessionID: w.session.ID, JobID: job.JobID,
+		Message: fmt.Sprintf("segment %d %s; retrying (%d/%d)", seg.chunk.Index, status, seg.attempts, retries)})
+	return true
+}
+
+// finishSegment joins the segments of a chunked job once its last segment
+// is done. Only the first worker to see them all done joins them.
+func (w *Worker) finishSegment(ctx context.Context, job *QueueJob) {
+	if job.segment == nil {
+		return
+	}
+	if segments := w.session.takeSegments(job.segment.parent); segments != nil {
+		w.joinSegments(ctx, job.segment.parent, segments)
+	}
+}
+
+// joinSegments finishes a chunked job: it joins its segments into the
+// job's output, or fails the job with its first unfinished segment.
+func (w *Worker) joinSegments(ctx context.Context, job *QueueJob, segments []*QueueJob) {
+	st := job.chunks
+	res := &logging.ChunksResult{Boundary: st.boundary}
+	paths := make([]string, len(segments))
+	var failed *QueueJob
+	var failedStatus JobStatus
+	var failedMsg string
+	w.session.withLock(func() {
+		for i, s := range segments {
+			c := s.segment.chunk
+			res.Segments = append(res.Segments, logging.ChunkSegment{
+				JobID: s.JobID, Start: c.Start, End: c.End, Scene: c.Scene,
+				Status: string(s.Status), Attempts: s.segment.attempts + 1,
+			})
+			paths[i] = s.segment.path
+			if s.Status != JobCompleted && failed == nil {
+				failed, failedStatus, failedMsg = s, s.Status, s.ErrorMessage
+			}
+		}
+		st.result = res
+	})
+
+	status, msg := JobCompleted, ""
+	if failed != nil {
+		status = JobFailed
+		if failedStatus == JobCancelled || failedStatus == JobSkipped {
+			status = failedStatus
+		}
+		msg = fmt.Sprintf("segment %d %s", failed.segment.chunk.Index, failedStatus)
+		if failedMsg != "" {
+			msg += ": " + failedMsg
+		}
+	} else {
+		w.tempTracker.Add(TempEntry{
+			TempPath:  st.resolved.TempPath,
+			FinalPath: st.resolved.FinalPath,
+			JobID:     job.JobID,
+			SessionID: w.session.ID,
+		})
+		w.emitJobLog(job, fmt.Sprintf("chunks: joining %d segments", len(segments)))
+		if err := w.joiner.JoinSegments(ctx, st.prof, paths, job.InputPath, st.resolved.TempPath); err != nil {
+			status, msg = JobFailed, err.Error()
+			w.session.withLock(func() { res.JoinError = msg })
+		}
+	}
+
+	exitCode := 0
+	if status != JobCompleted {
+		exitCode = -1
+	}
+	w.session.MarkJobStatus(job.JobID, status, &exitCode, msg)
+	if status == JobCompleted {
+		w.postProcessSuccess(job, st.prof, st.resolved)
+	} else {
+		w.postProcessFailure(job, st.resolved, status)
+	}
+	if status == JobCompleted || !w.appCfg.KeepFailedTemp {
+		os.RemoveAll(st.dir)
+	}
+	w.saveJobRecord(job, st.prof, st.resolved, nil, encoder.RunResult{ExitCode: exitCode, ErrorMessage: msg}, status, false, "")
+	w.emitJobFinished(job, status, &exitCode, msg)
+
+	if status == JobFailed && w.appCfg.OnError == "stop" {
+		w.session.RequestStop()
+	}
+}
+
+// takeSegments returns the segments of a chunked job, in order, once none
+// is pending or running and nobody has taken them yet; otherwise nil.
+func (s *Session) takeSegments(parent *QueueJob) []*QueueJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if parent.chunks == nil || parent.chunks.joined {
+		return nil
+	}
+	var segments []*QueueJob
+	for _, j := range s.Jobs {
+		if j.segment == nil || j.segment.parent != parent {
+			continue
+		}
+		if j.Status == JobPending || j.Status == JobRunning {
+			return nil
+		}
+		segments = append(segments, j)
+	}
+	parent.chunks.joined = true
+	return segments
+}
+
+// requeue puts a dispatched segment back in the queue as pending, for
+// another attempt. Like appendSegments it works during a graceful stop,
+// but fails once the session is aborting.
+func (s *Session) requeue(job *QueueJob) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dispatchClosed || s.State != StateRunning && s.State != StateStopping {
+		return false
+	}
+	job.Status = JobPending
+	job.ExitCode, job.ErrorMessage, job.TimeoutReason = nil, "", ""
+	job.percent, job.fps, job.etaSec = 0, 0, nil
+	if job.segment != nil {
+		job.segment.attempts++
+	}
+	s.queued = append(s.queued, job)
+	s.signalLocked()
+	return true
+}
+
+// segmentJobIDs returns the IDs of the segments of a chunked job.
+func (s *Session) segmentJobIDs(jobID string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var ids []string
+	for _, j := range s.Jobs {
+		if j.segment != nil && j.segment.parent.JobID == jobID {
+			ids = append(ids, j.JobID)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,136 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yuta/enque/backend/events"
+	"github.com/yuta/enque/backend/logging"
+	"github.com/yuta/enque/backend/probe"
+	"github.com/yuta/enque/backend/profile"
+)
+
+// Crop confirmation decisions.
+const (
+	CropApply  = "apply"  // crop, with the detected or an adjusted rect
+	CropIgnore = "ignore" // encode uncropped
+	CropSkip   = "skip"   // skip the job
+)
+
+// CropDecision answers a job_needs_crop prompt.
+type CropDecision struct {
+	Decision string
+	Rect     *profile.FilterRect // replaces the detected crop with CropApply
+	timedOut bool
+}
+
+// autoCrop crops a job with a crop of its own or, for profiles with
+// auto_crop, with the one detected in the probed input. A failed detection
+// encodes the input uncropped. It returns false when the user skipped the
+// job; the caller checks ctx for a session aborted meanwhile.
+func (w *Worker) autoCrop(ctx context.Context, job *QueueJob, prof profile.Profile, media probe.MediaInfo, probeErr error) (profile.Profile, bool) {
+	res := &logging.CropResult{}
+	defer w.session.withLock(func() { job.Crop = res })
+
+	if job.crop != nil {
+		res.Decision, res.Applied = "preset", logRect(*job.crop)
+		return withCrop(prof, *job.crop), true
+	}
+
+	if probeErr != nil {
+		res.Decision, res.Error = "failed", probeErr.Error()
+		return prof, true
+	}
+	crop, err := w.detectCrop(ctx, job, media)
+	if err != nil {
+		res.Decision, res.Error = "failed", err.Error()
+		w.emitter.Warning(events.Message{SessionID: w.session.ID, JobID: job.JobID,
+			Message: fmt.Sprintf("auto crop: %v; encoding uncropped", err)})
+		return prof, true
+	}
+	rect := profile.FilterRect{Left: crop.Left, Top: crop.Top, Right: crop.Right, Bottom: crop.Bottom}
+	res.Width, res.Height, res.Detected = crop.Width, crop.Height, logRect(rect)
+	if crop.IsZero() {
+		res.Decision = "none"
+		w.emitJobLog(job, fmt.Sprintf("auto crop: no black bars in %d samples", crop.Samples))
+		return prof, true
+	}
+
+	res.Decision = "applied"
+	if prof.AutoCrop == "confirm" {
+		if w.appCfg.Unattended {
+			res.Decision = "ignored"
+			w.emitter.Warning(events.Message{SessionID: w.session.ID, JobID: job.JobID,
+				Message: fmt.Sprintf("auto crop %s needs confirmation, but nobody is asked; encoding uncropped", cropString(rect))})
+			return prof, true
+		}
+		d := w.manager.WaitForCrop(ctx, job.JobID, func() {
+			w.emitter.JobNeedsCrop(events.JobNeedsCrop{
+				SessionID: w.session.ID,
+				JobID:     job.JobID,
+				InputPath: job.InputPath,
+				Left:      rect.Left,
+				Top:       rect.Top,
+				Right:     rect.Right,
+				Bottom:    rect.Bottom,
+				Width:     crop.Width,
+				Height:    crop.Height,
+			})
+		})
+		switch d.Decision {
+		case CropSkip:
+			res.Decision = "skipped"
+			return prof, false
+		case CropApply:
+			res.Decision = "confirmed"
+			if d.Rect != nil && *d.Rect != rect {
+				res.Decision, rect = "adjusted", *d.Rect
+			}
+		default:
+			res.Decision = "ignored"
+			if d.timedOut {
+				w.emitter.Warning(events.Message{SessionID: w.session.ID, JobID: job.JobID,
+					Message: "auto crop was not confirmed in time; encoding uncropped"})
+			}
+			return prof, true
+		}
+	}
+
+	res.Applied = logRect(rect)
+	w.emitJobLog(job, fmt.Sprintf("auto crop %s of %dx%d (%s)", cropString(rect), crop.Width, crop.Height, res.Decision))
+	return withCrop(prof, rect), true
+}
+
+func (w *Worker) detectCrop(ctx context.Context, job *QueueJob, media probe.MediaInfo) (probe.Crop, error) {
+	if w.cropper == nil {
+		return probe.Crop{}, fmt.Errorf("no crop detection")
+	}
+	return w.cropper.DetectCrop(ctx, job.InputPath, media)
+}
+
+// withCrop returns p with its crop filter replaced by rect, or with a crop
+// filter in front of its filters.
+func withCrop(p profile.Profile, rect profile.FilterRect) profile.Profile {
+	crop := profile.Filter{Type: profile.FilterCrop, Rect: &rect}
+	filters := make([]profile.Filter, 0, len(p.Filters)+1)
+	replaced := false
+	for _, f := range p.Filters {
+		if f.Type == profile.FilterCrop {
+			f, replaced = crop, true
+		}
+		filters = append(filters, f)
+	}
+	if !replaced {
+		filters = append([]profile.Filter{crop}, filters...)
+	}
+	p.Filters = filters
+	return p
+}
+
+func logRect(r profile.FilterRect) *logging.CropRect {
+	return &logging.CropRect{Left: r.Left, Top: r.Top, Right: r.Right, Bottom: r.Bottom}
+}
+
+func cropString(r profile.FilterRect) string {
+	return fmt.Sprintf("%d,%d,%d,%d", r.Left, r.Top, r.Right, r.Bottom)
+}
@@ -0,0 +1,174 @@
+package queue
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/yuta/enque/backend/events"
+)
+
+// EncodeLedger remembers completed encodes by the content of their inputs
+// and outputs, so an input that was encoded before is recognized when it is
+// added again, even renamed or moved. *dedupe.Ledger implements it.
+type EncodeLedger interface {
+	// Lookup returns the earlier encode that produced the file at path
+	// (isOutput), or that encoded the same content with the profile and
+	// output variant. prior is nil when there is neither.
+	Lookup(path, profileID, variant string) (prior *EncodeRecord, isOutput bool, err error)
+	// Record remembers a completed encode.
+	Record(rec EncodeRecord) error
+}
+
+// EncodeRecord is a completed encode.
+type EncodeRecord struct {
+	InputPath  string
+	OutputPath string
+	ProfileID  string
+	Variant    string // of a sub-job with output variants
+	SessionID  string
+	JobID      string
+	EncodedAt  time.Time
+}
+
+// flagInputs warns about added jobs whose input is a duplicate: an Enque
+// output, by its name or by the ledger, an input already encoded with the
+// job's profile and variant, or the input of an earlier job of the session
+// with both. Fingerprinting reads the inputs, so it runs in the background
+// once the jobs are in the session; under the "skip" duplicate_inputs
+// policy checkInput checks each job again when its turn comes.
+func (m *Manager) flagInputs(s *Session, jobs []*QueueJob) {
+	policy := s.AppCfg.DuplicateInputs
+	if policy != "warn" && policy != "skip" {
+		return
+	}
+	for _, j := range jobs {
+		reason := m.duplicateReason(s, j)
+		if reason == "" {
+			continue
+		}
+		if m.logger != nil {
+			m.logger.Info("duplicate input: %s: %s", j.InputPath, reason)
+		}
+		if policy == "skip" {
+			reason += "; skipping"
+		}
+		m.emitter.Warning(events.Message{SessionID: s.ID, JobID: j.JobID, Message: reason})
+	}
+}
+
+// checkInput returns why a job is skipped under the "skip"
+// duplicate_inputs policy, or "". flagInputs already warned about it.
+func (w *Worker) checkInput(job *QueueJob) string {
+	if w.appCfg.DuplicateInputs != "skip" || job.segment != nil {
+		return ""
+	}
+	return w.manager.duplicateReason(w.session, job)
+}
+
+// duplicateReason explains why the input of a job should not be encoded
+// with its profile and variant again, or returns "".
+func (m *Manager) duplicateReason(s *Session, job *QueueJob) string {
+	tpl := s.AppCfg.OutputNameTemplate
+	if job.output != nil && job.output.NameTemplate != "" {
+		tpl = job.output.NameTemplate
+	}
+	path, profileID, variant := job.InputPath, s.jobProfileID(job), job.Variant
+	if re := outputNamePattern(tpl); re != nil && re.MatchString(filepath.Base(path)) {
+		return "input is named like an Enque output"
+	}
+	if other := s.earlierJobWithInput(job, profileID); other != "" {
+		return fmt.Sprintf("input is also encoded by job %s of this session", other)
+	}
+	m.mu.RLock()
+	ledger := m.ledger
+	m.mu.RUnlock()
+	if ledger == nil {
+		return ""
+	}
+	prior, isOutput, err := ledger.Lookup(path, profileID, variant)
+	if err != nil {
+		if m.logger != nil {
+			m.logger.Warn("encode ledger: %v", err)
+		}
+		return ""
+	}
+	switch {
+	case prior == nil, prior.SessionID == s.ID && prior.JobID == job.JobID:
+		return ""
+	case isOutput:
+		return fmt.Sprintf("input is the output of job %s, encoded from %s on %s",
+			prior.JobID, prior.InputPath, prior.EncodedAt.Format("2006-01-02"))
+	}
+	msg := fmt.Sprintf("input was already encoded with this profile on %s to %s",
+		prior.EncodedAt.Format("2006-01-02"), prior.OutputPath)
+	if filepath.Clean(prior.InputPath) != filepath.Clean(path) {
+		msg += fmt.Sprintf(" (as %s)", prior.InputPath)
+	}
+	return msg
+}
+
+// earlierJobWithInput returns the ID of a job ahead of job in the session
+// that encodes the same input with the profile and variant, and has not
+// failed or been skipped. Unsaved profiles cannot be told apart.
+func (s *Session) earlierJobWithInput(job *QueueJob, profileID string) string {
+	if profileID == "" {
+		return ""
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, j := range s.Jobs {
+		if j == job {
+			break
+		}
+		if j.segment != nil || j.Variant != job.Variant || s.jobProfileID(j) != profileID ||
+			filepath.Clean(j.InputPath) != filepath.Clean(job.InputPath) {
+			continue
+		}
+		if j.Status == JobPending || j.Status == JobRunning || j.Status == JobCompleted {
+			return j.JobID
+		}
+	}
+	return ""
+}
+
+// recordEncode adds a completed job to the ledger. A failure is logged:
+// it only costs a later duplicate warning.
+func (m *Manager) recordEncode(rec EncodeRecord) {
+	m.mu.RLock()
+	ledger := m.ledger
+	m.mu.RUnlock()
+	if ledger == nil || rec.OutputPath == "" {
+		return
+	}
+	if err := ledger.Record(rec); err != nil && m.logger != nil {
+		m.logger.Warn("encode ledger: %v", err)
+	}
+}
+
+// outputNamePattern matches the file names an output name template
+// produces, also with an auto-rename number ("_001"). Matching is
+// case-insensitive. It returns nil for templates that add nothing to the
+// input name, like "{name}.{ext}", as every file would match.
+func outputNamePattern(template string) *regexp.Regexp {
+	if template == "" {
+		template = "{name}_encoded.{ext}"
+	}
+	if strings.NewReplacer("{name}", "", "{ext}", "", ".", "").Replace(template) == "" {
+		return nil
+	}
+	pat := regexp.QuoteMeta(template)
+	pat = strings.ReplaceAll(pat, regexp.QuoteMeta("{name}"), ".+")
+	ext := regexp.QuoteMeta(".{ext}")
+	if strings.HasSuffix(pat, ext) {
+		pat = strings.TrimSuffix(pat, ext) + `(?:_\d{3})?` + ext
+	}
+	pat = strings.ReplaceAll(pat, regexp.QuoteMeta("{ext}"), `[^.]+`)
+	re, err := regexp.Compile("(?i)^" + pat + "$")
+	if err != nil {
+		return nil
+	}
+	return re
+}
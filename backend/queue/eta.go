@@ -0,0 +1,314 @@
+package queue
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yuta/enque/backend/logging"
+)
+
+// etaHistorySessions is how many past sessions' job records the session
+// ETA learns per-profile speeds from.
+const etaHistorySessions = 20
+
+// inputMedia is what the ETA needs to know of an input.
+type inputMedia struct {
+	durationSec float64
+	fps         float64
+	sizeBytes   int64
+}
+
+// profileRate is the speed of encoding with a profile: encoder frames per
+// second, and input bytes per second of encoding.
+type profileRate struct {
+	fps         float64
+	bytesPerSec float64
+}
+
+// etaEstimator holds what the session ETA is estimated from besides the
+// jobs themselves: the pending inputs, probed in the background, and the
+// per-profile speeds of past sessions.
+type etaEstimator struct {
+	ctx     context.Context // the session's
+	prober  MediaProber
+	mu      sync.Mutex
+	media   map[string]inputMedia  // by input path
+	history map[string]profileRate // by profile ID
+}
+
+func newETAEstimator(ctx context.Context, prober MediaProber) *etaEstimator {
+	return &etaEstimator{ctx: ctx, prober: prober, media: make(map[string]inputMedia), history: make(map[string]profileRate)}
+}
+
+// probeInputs probes the inputs not probed yet, one at a time. An input
+// that cannot be probed is estimated from its size.
+func (e *etaEstimator) probeInputs(paths []string) {
+	for _, path := range paths {
+		if e.ctx.Err() != nil {
+			return
+		}
+		e.mu.Lock()
+		_, done := e.media[path]
+		e.mu.Unlock()
+		if done {
+			continue
+		}
+		var m inputMedia
+		if info, err := os.Stat(path); err == nil {
+			m.sizeBytes = info.Size()
+		}
+		if e.prober != nil {
+			if media, err := e.prober.Probe(e.ctx, path); err == nil {
+				m.durationSec, m.fps = media.DurationSec, media.FPS
+			}
+		}
+		e.mu.Lock()
+		e.media[path] = m
+		e.mu.Unlock()
+	}
+}
+
+func (e *etaEstimator) inputMedia(path string) (inputMedia, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	m, ok := e.media[path]
+	return m, ok
+}
+
+// loadHistory averages the speeds of the completed jobs of the latest past
+// sessions in logsDir per profile.
+func (e *etaEstimator) loadHistory(logsDir, currentSessionID string) {
+	entries, err := os.ReadDir(logsDir)
+	if err != nil {
+		return
+	}
+	// Session IDs start with their start time, so names sort by age.
+	var sessions []string
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), "s_") && entry.Name() != currentSessionID {
+			sessions = append(sessions, entry.Name())
+		}
+	}
+	slices.Sort(sessions)
+	if len(sessions) > etaHistorySessions {
+		sessions = sessions[len(sessions)-etaHistorySessions:]
+	}
+
+	sums := make(map[string]*rateSum)
+	for _, session := range sessions {
+		files, _ := filepath.Glob(filepath.Join(logsDir, session, "*.json"))
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				continue
+			}
+			var r logging.JobRecord
+			if json.Unmarshal(data, &r) != nil || r.Status != string(JobCompleted) || r.ProfileID == "" {
+				continue
+			}
+			sum := sums[r.ProfileID]
+			if sum == nil {
+				sum = &rateSum{}
+				sums[r.ProfileID] = sum
+			}
+			sum.addFPS(r.AvgFPS)
+			if r.ParentJobID == "" && r.DurationSec > 0 {
+				sum.addBytesPerSec(float64(r.InputSizeBytes) / r.DurationSec)
+			}
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for id, sum := range sums {
+		e.history[id] = sum.rate()
+	}
+}
+
+func (e *etaEstimator) historyRate(profileID string) (profileRate, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	r, ok := e.history[profileID]
+	return r, ok
+}
+
+// rateSum averages speeds.
+type rateSum struct {
+	fps, bytesPerSec float64
+	nFPS, nBytes     int
+}
+
+func (s *rateSum) addFPS(fps float64) {
+	if fps > 0 {
+		s.fps += fps
+		s.nFPS++
+	}
+}
+
+func (s *rateSum) addBytesPerSec(bps float64) {
+	if bps > 0 {
+		s.bytesPerSec += bps
+		s.nBytes++
+	}
+}
+
+func (s *rateSum) rate() profileRate {
+	var r profileRate
+	if s.nFPS > 0 {
+		r.fps = s.fps / float64(s.nFPS)
+	}
+	if s.nBytes > 0 {
+		r.bytesPerSec = s.bytesPerSec / float64(s.nBytes)
+	}
+	return r
+}
+
+// sessionETA is the estimate reported in session snapshots.
+type sessionETA struct {
+	sec         *float64
+	throughput  float64 // sum of the running jobs' fps
+	unestimated int     // jobs left out of sec
+}
+
+// estimateLocked estimates how long the session's remaining jobs take on
+// its workers. A running job takes its encoder's ETA, or what its progress
+// so far suggests. A pending job takes its frames (from a probe) at the
+// speed of its profile: as seen in this session, as recorded in past
+// sessions, or as seen for any profile in this session, in that order.
+// Without frames, its size is used likewise. Jobs are then laid out on the
+// workers in queue order. The caller holds s.mu.
+func (s *Session) estimateLocked(now time.Time) sessionETA {
+	var est sessionETA
+	if s.eta == nil || (s.State != StateRunning && s.State != StateStopping) {
+		return est
+	}
+
+	// Speeds seen in this session, per profile and overall.
+	seen := make(map[string]*rateSum)
+	all := &rateSum{}
+	for _, j := range s.Jobs {
+		if j.Status != JobCompleted && j.Status != JobRunning {
+			continue
+		}
+		key := s.jobProfileID(j)
+		if seen[key] == nil {
+			seen[key] = &rateSum{}
+		}
+		seen[key].addFPS(j.fps)
+		all.addFPS(j.fps)
+		if j.Status == JobCompleted && j.ParentJobID == "" && j.segment == nil && !j.FinishedAt.IsZero() {
+			if sec := j.FinishedAt.Sub(j.StartedAt).Seconds(); sec > 0 {
+				bps := float64(j.InputSizeBytes) / sec
+				seen[key].addBytesPerSec(bps)
+				all.addBytesPerSec(bps)
+			}
+		}
+		if j.Status == JobRunning {
+			est.throughput += j.fps
+		}
+	}
+	rateFor := func(j *QueueJob) profileRate {
+		key := s.jobProfileID(j)
+		var r profileRate
+		if sum := seen[key]; sum != nil {
+			r = sum.rate()
+		}
+		h, _ := s.eta.historyRate(key)
+		overall := all.rate()
+		if r.fps == 0 {
+			r.fps = cmp.Or(h.fps, overall.fps)
+		}
+		if r.bytesPerSec == 0 {
+			r.bytesPerSec = cmp.Or(h.bytesPerSec, overall.bytesPerSec)
+		}
+		return r
+	}
+
+	workers := max(1, s.AppCfg.MaxConcurrentJobs)
+	free := make([]float64, workers) // when each worker is next free
+	place := func(sec float64) {
+		i := slices.Index(free, slices.Min(free))
+		free[i] += sec
+	}
+	estimated := false
+	for _, j := range s.Jobs {
+		if j.Status != JobRunning || j.chunks != nil {
+			continue
+		}
+		elapsed := now.Sub(j.StartedAt).Seconds()
+		work, ok := s.jobWorkSec(j, rateFor(j))
+		switch {
+		case j.etaSec != nil:
+			place(*j.etaSec)
+		case j.percent > 0 && j.percent < 100:
+			place(elapsed * (100 - j.percent) / j.percent)
+		case ok:
+			place(math.Max(0, work-elapsed))
+		default:
+			est.unestimated++
+			continue
+		}
+		estimated = true
+	}
+	if s.State == StateRunning {
+		for _, j := range s.queued {
+			if s.SkipSet[j.JobID] || j.segment != nil && s.SkipSet[j.ParentJobID] {
+				continue
+			}
+			if work, ok := s.jobWorkSec(j, rateFor(j)); ok {
+				place(work)
+				estimated = true
+			} else {
+				est.unestimated++
+			}
+		}
+	}
+	if estimated {
+		eta := slices.Max(free)
+		est.sec = &eta
+	}
+	return est
+}
+
+// jobWorkSec estimates how long j takes to encode at rate r.
+func (s *Session) jobWorkSec(j *QueueJob, r profileRate) (float64, bool) {
+	m, ok := s.eta.inputMedia(j.InputPath)
+	if !ok {
+		return 0, false
+	}
+	duration, size := m.durationSec, float64(m.sizeBytes)
+	if seg := j.segment; seg != nil {
+		end := seg.chunk.End
+		if end <= seg.chunk.Start {
+			end = duration
+		}
+		if duration <= 0 {
+			return 0, false
+		}
+		size *= (end - seg.chunk.Start) / duration
+		duration = end - seg.chunk.Start
+	}
+	switch {
+	case duration > 0 && m.fps > 0 && r.fps > 0:
+		return duration * m.fps / r.fps, true
+	case size > 0 && r.bytesPerSec > 0:
+		return size / r.bytesPerSec, true
+	}
+	return 0, false
+}
+
+// jobProfileID returns the ID of the profile j is encoded with.
+func (s *Session) jobProfileID(j *QueueJob) string {
+	if j.ProfileID != "" {
+		return j.ProfileID
+	}
+	return s.profile.ID
+}
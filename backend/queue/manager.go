@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -11,8 +13,40 @@ import (
 	"github.com/yuta/enque/backend/encoder"
 	"github.com/yuta/enque/backend/events"
 	"github.com/yuta/enque/backend/logging"
+	"github.com/yuta/enque/backend/probe"
+	"github.com/yuta/enque/backend/profile"
 )
 
+// ProfileResolver turns a profile that inherits from a parent into the
+// effective profile. profile.Manager implements it.
+type ProfileResolver interface {
+	Resolve(p profile.Profile) (profile.Profile, error)
+}
+
+// ProfileSelector picks a profile for an added file that has none. It
+// returns nil to keep the session profile, and a reason for the log.
+type ProfileSelector interface {
+	SelectProfile(inputPath string) (*profile.Profile, string, error)
+}
+
+// MediaProber reads the media properties of an input. *probe.Prober
+// implements it.
+type MediaProber interface {
+	Probe(ctx context.Context, path string) (probe.MediaInfo, error)
+}
+
+// CropDetector proposes a crop for an input's black bars.
+// *probe.CropDetector implements it.
+type CropDetector interface {
+	DetectCrop(ctx context.Context, path string, media probe.MediaInfo) (probe.Crop, error)
+}
+
+// LoudnessMeter measures the loudness of an input's audio track.
+// *probe.LoudnessMeter implements it.
+type LoudnessMeter interface {
+	MeasureLoudness(ctx context.Context, path string, track int) (probe.Loudness, error)
+}
+
 // Manager orchestrates encoding sessions with a worker pool.
 type Manager struct {
 	mu                 sync.RWMutex
@@ -25,6 +59,15 @@ type Manager struct {
 	cancelFunc         context.CancelFunc
 	wg                 sync.WaitGroup
 	overwriteResponses map[string]chan string
+	cropResponses      map[string]chan CropDecision
+	profiles           ProfileResolver
+	selector           ProfileSelector
+	prober             MediaProber
+	cropper            CropDetector
+	meter              LoudnessMeter
+	splitter           SplitFinder
+	joiner             SegmentJoiner
+	ledger             EncodeLedger
 }
 
 // NewManager creates a new queue manager.
@@ -35,16 +78,96 @@ func NewManager(registry *encoder.Registry, emitter *events.Emitter, logger *log
 		logger:             logger,
 		tempTracker:        NewTempTracker(config.TempIndexPath()),
 		overwriteResponses: make(map[string]chan string),
+		cropResponses:      make(map[string]chan CropDecision),
 	}
 }
 
+// SetProfileResolver makes the manager resolve inherited profiles of
+// requests and appended jobs before their arguments are built.
+func (m *Manager) SetProfileResolver(r ProfileResolver) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.profiles = r
+}
+
+// SetProfileSelector makes the manager pick profiles for added jobs that
+// have none.
+func (m *Manager) SetProfileSelector(s ProfileSelector) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.selector = s
+}
+
+// SetMediaProber replaces the ffprobe-based prober used for inputs, e.g.
+// for target-size encodes.
+func (m *Manager) SetMediaProber(p MediaProber) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prober = p
+}
+
+// SetCropDetector replaces the ffmpeg-based crop detection used by
+// profiles with auto_crop.
+func (m *Manager) SetCropDetector(d CropDetector) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cropper = d
+}
+
+// SetLoudnessMeter replaces the ffmpeg-based loudness measurement used by
+// profiles with loudness normalization.
+func (m *Manager) SetLoudnessMeter(lm LoudnessMeter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.meter = lm
+}
+
+// SetSplitFinder replaces the ffprobe/ffmpeg-based keyframe and scene
+// detection used by profiles with chunks.
+func (m *Manager) SetSplitFinder(f SplitFinder) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.splitter = f
+}
+
+// SetSegmentJoiner replaces the ffmpeg-based joining of the segments of
+// chunked jobs.
+func (m *Manager) SetSegmentJoiner(j SegmentJoiner) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.joiner = j
+}
+
+// SetEncodeLedger makes the manager flag added inputs that were encoded
+// before, as the session's duplicate_inputs policy says, and record every
+// completed job.
+func (m *Manager) SetEncodeLedger(l EncodeLedger) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ledger = l
+}
+
 // StartEncode begins a new encoding session.
 func (m *Manager) StartEncode(req EncodeRequest) error {
+	// Selection may probe files, so it runs before taking the lock, and
+	// only for a start that is not rejected anyway.
+	m.mu.RLock()
+	active := m.sessionActiveLocked()
+	m.mu.RUnlock()
+	if active {
+		return fmt.Errorf("%s: session already running", encoder.ErrSessionRunning)
+	}
+	notes := m.selectProfiles(req.Jobs, req.Profile.EncoderType)
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if err := m.resolveProfiles(&req.Profile, req.Jobs); err != nil {
+		return err
+	}
+
 	// Check if a session is already running
-	if m.session != nil && (m.session.State == StateRunning || m.session.State == StateStopping || m.session.State == StateAborting) {
+	if m.sessionActiveLocked() {
 		return fmt.Errorf("%s: session already running", encoder.ErrSessionRunning)
 	}
 
@@ -60,9 +183,28 @@ func (m *Manager) StartEncode(req EncodeRequest) error {
 		return fmt.Errorf("%s: encoder path not configured for %s", encoder.ErrToolNotFound, req.Profile.EncoderType)
 	}
 
+	if err := assignJobIDs(req.Jobs, nil); err != nil {
+		return err
+	}
+	inputs := req.Jobs
+	req.Jobs, err = expandVariants(req.Jobs, req.Profile, req.AppConfigSnapshot.OutputNameTemplate)
+	if err != nil {
+		return err
+	}
+	if err := assignJobIDs(req.Jobs, nil); err != nil {
+		return err
+	}
+	if err := checkJobProfiles(req.Jobs, req.Profile.EncoderType); err != nil {
+		return err
+	}
+	if err := checkProfileRules(adapter, &req.Profile, req.Jobs); err != nil {
+		return err
+	}
+
 	// Create session
 	sessionID := generateSessionID()
 	session := NewSession(sessionID, req.Jobs, req.Profile.EncoderType, req.AppConfigSnapshot)
+	session.profile = req.Profile
 	m.session = session
 
 	// Create process runner
@@ -85,20 +227,48 @@ func (m *Manager) StartEncode(req EncodeRequest) error {
 		maxJobs = 1
 	}
 
-	// Job channel
-	jobCh := make(chan *QueueJob, len(session.Jobs))
-	for _, job := range session.Jobs {
-		jobCh <- job
-	}
-	close(jobCh)
+	// Job channel, fed by the dispatcher so jobs can be appended mid-session
+	jobCh := make(chan *QueueJob)
 
 	// Emit session started
 	if m.logger != nil {
 		m.logger.Info("session started: %s (encoder=%s, jobs=%d, workers=%d)", sessionID, req.Profile.EncoderType, len(req.Jobs), maxJobs)
 	}
 	m.emitter.SessionStarted(session.Snapshot())
+	m.emitJobNotes(sessionID, inputs, req.Jobs, notes)
+	m.warnProfiles(sessionID, adapter, &req.Profile, req.Jobs)
 
 	// Launch workers
+	prober := m.prober
+	if prober == nil {
+		prober = probe.New(req.AppConfigSnapshot.FFprobePath)
+	}
+	var cropper CropDetector = m.cropper
+	if cropper == nil {
+		cropper = probe.NewCropDetector(req.AppConfigSnapshot.FFmpegPath)
+	}
+	var meter LoudnessMeter = m.meter
+	if meter == nil {
+		meter = probe.NewLoudnessMeter(req.AppConfigSnapshot.FFmpegPath)
+	}
+	var splitter SplitFinder = m.splitter
+	if splitter == nil {
+		splitter = probe.NewSplitFinder(req.AppConfigSnapshot.FFprobePath, req.AppConfigSnapshot.FFmpegPath)
+	}
+	var joiner SegmentJoiner = m.joiner
+	if joiner == nil {
+		joiner = encoder.NewSegmentJoiner(req.AppConfigSnapshot.FFmpegPath)
+	}
+	session.withLock(func() { session.eta = newETAEstimator(ctx, prober) })
+	go m.refineETA(session, inputPaths(req.Jobs), true)
+	// The session finishes once its inputs are flagged, too.
+	var added []*QueueJob
+	session.withLock(func() { added = append(added, session.Jobs...) })
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.flagInputs(session, added)
+	}()
 	m.workers = make([]*Worker, maxJobs)
 	for i := 0; i < maxJobs; i++ {
 		w := NewWorker(WorkerConfig{
@@ -113,6 +283,11 @@ func (m *Manager) StartEncode(req EncodeRequest) error {
 			Profile:     req.Profile,
 			AppConfig:   req.AppConfigSnapshot,
 			EncoderPath: encoderPath,
+			Prober:      prober,
+			Cropper:     cropper,
+			Meter:       meter,
+			Splitter:    splitter,
+			Joiner:      joiner,
 		})
 		m.workers[i] = w
 		m.wg.Add(1)
@@ -122,6 +297,8 @@ func (m *Manager) StartEncode(req EncodeRequest) error {
 		}(w)
 	}
 
+	go m.dispatch(session, jobCh)
+
 	// Monitor completion in background
 	go m.waitForCompletion()
 
@@ -186,14 +363,129 @@ func (m *Manager) CancelJob(sessionID, jobID string) error {
 
 	// Find the worker running this job and cancel it
 	for _, w := range m.workers {
-		// Workers track their current job through the cancel context
-		// For now, we mark the job for cancellation via session
-		w.CancelCurrentJob()
+		if w.CurrentJobID() == jobID {
+			w.CancelCurrentJob()
+			return nil
+		}
+	}
+
+	// A chunked job runs as its segments: skip the queued ones and cancel
+	// the running ones.
+	if segments := m.session.segmentJobIDs(jobID); len(segments) > 0 {
+		for _, id := range segments {
+			m.session.RequestSkipJob(id)
+			for _, w := range m.workers {
+				if w.CurrentJobID() == id {
+					w.CancelCurrentJob()
+				}
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("job not running: %s", jobID)
+}
+
+// AppendJobs adds jobs to the running session. Jobs without an ID get one.
+func (m *Manager) AppendJobs(sessionID string, jobs []JobInput) error {
+	var notes []jobNote
+	if s := m.currentSession(sessionID); s != nil {
+		notes = m.selectProfiles(jobs, s.EncoderType)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.session == nil || m.session.ID != sessionID {
+		return fmt.Errorf("session not found: %s", sessionID)
+	}
+	if len(jobs) == 0 {
+		return fmt.Errorf("%s: no jobs to append", encoder.ErrValidation)
+	}
+	existing := m.session.JobsSnapshot()
+	if err := assignJobIDs(jobs, existing); err != nil {
+		return err
+	}
+	if err := m.resolveProfiles(nil, jobs); err != nil {
+		return err
+	}
+	inputs := jobs
+	jobs, err := expandVariants(jobs, m.session.profile, m.session.AppCfg.OutputNameTemplate)
+	if err != nil {
+		return err
+	}
+	if err := assignJobIDs(jobs, existing); err != nil {
+		return err
+	}
+	if err := checkJobProfiles(jobs, m.session.EncoderType); err != nil {
+		return err
+	}
+	adapter, err := m.registry.Resolve(m.session.EncoderType)
+	if err != nil {
+		return err
+	}
+	if err := checkProfileRules(adapter, nil, jobs); err != nil {
+		return err
 	}
 
+	added, err := m.session.AppendJobs(jobs)
+	if err != nil {
+		return err
+	}
+	go m.refineETA(m.session, inputPaths(jobs), false)
+	// The queued jobs keep the workers, and so the wait group, alive.
+	m.wg.Add(1)
+	go func(s *Session) {
+		defer m.wg.Done()
+		m.flagInputs(s, added)
+	}(m.session)
+	m.emitJobNotes(sessionID, inputs, jobs, notes)
+	m.warnProfiles(sessionID, adapter, nil, jobs)
+	if m.logger != nil {
+		m.logger.Info("appended %d job(s) to session %s", len(jobs), sessionID)
+	}
+	m.emitter.SessionState(m.session.Snapshot())
 	return nil
 }
 
+// refineETA probes inputs for the session ETA in the background, after
+// loading the speeds of past sessions when history is set, and emits the
+// refined session state.
+func (m *Manager) refineETA(session *Session, paths []string, history bool) {
+	est := session.eta
+	if est == nil {
+		return
+	}
+	if history {
+		est.loadHistory(config.LogsDir(), session.ID)
+	}
+	est.probeInputs(paths)
+	if snap := session.Snapshot(); snap.State == string(StateRunning) || snap.State == string(StateStopping) {
+		m.emitter.SessionState(snap)
+	}
+}
+
+// inputPaths returns the distinct input paths of jobs.
+func inputPaths(jobs []JobInput) []string {
+	var paths []string
+	for _, j := range jobs {
+		if !slices.Contains(paths, j.InputPath) {
+			paths = append(paths, j.InputPath)
+		}
+	}
+	return paths
+}
+
+// ListJobs returns a snapshot of the current session's jobs.
+func (m *Manager) ListJobs() []QueueJob {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.session == nil {
+		return nil
+	}
+	return m.session.JobsSnapshot()
+}
+
 // GetSession returns the current session (thread-safe snapshot).
 func (m *Manager) GetSession() *Session {
 	m.mu.RLock()
@@ -220,8 +512,8 @@ func (m *Manager) ListTempArtifacts() []string {
 func (m *Manager) CleanupTempArtifacts(paths []string) error {
 	for _, p := range paths {
 		if err := removeFileIfExists(p); err != nil {
-			m.emitter.Warning(map[string]interface{}{
-				"message": fmt.Sprintf("failed to cleanup temp file: %s: %v", p, err),
+			m.emitter.Warning(events.Message{
+				Message: fmt.Sprintf("failed to cleanup temp file: %s: %v", p, err),
 			})
 		}
 		m.tempTracker.Remove(p)
@@ -274,6 +566,82 @@ func (m *Manager) WaitForOverwrite(jobID string) (string, error) {
 	}
 }
 
+// ResolveCrop responds to a crop confirmation for a job. rect replaces the
+// detected crop when the decision is "apply"; nil keeps it.
+func (m *Manager) ResolveCrop(sessionID, jobID, decision string, rect *profile.FilterRect) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.session == nil || m.session.ID != sessionID {
+		return fmt.Errorf("session not found: %s", sessionID)
+	}
+	switch decision {
+	case CropApply, CropIgnore, CropSkip:
+	default:
+		return fmt.Errorf("%s: crop decision must be apply, ignore or skip", encoder.ErrValidation)
+	}
+	if rect != nil && decision == CropApply {
+		if err := profile.ValidateFilters([]profile.Filter{{Type: profile.FilterCrop, Rect: rect}}); err != nil {
+			return err
+		}
+	}
+
+	ch, ok := m.cropResponses[jobID]
+	if !ok {
+		return fmt.Errorf("no pending crop for job: %s", jobID)
+	}
+	select {
+	case ch <- CropDecision{Decision: decision, Rect: rect}:
+	default:
+		return fmt.Errorf("crop already resolved for job: %s", jobID)
+	}
+	return nil
+}
+
+// WaitForCrop calls prompt and waits for the crop decision with a
+// 10-minute timeout, after which the job is encoded uncropped. The
+// decision is accepted from before prompt is called. It gives up when ctx
+// is cancelled.
+func (m *Manager) WaitForCrop(ctx context.Context, jobID string, prompt func()) CropDecision {
+	ch := make(chan CropDecision, 1)
+
+	m.mu.Lock()
+	m.cropResponses[jobID] = ch
+	m.mu.Unlock()
+	prompt()
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.cropResponses, jobID)
+		m.mu.Unlock()
+	}()
+
+	select {
+	case d := <-ch:
+		return d
+	case <-ctx.Done():
+		return CropDecision{Decision: CropIgnore}
+	case <-time.After(10 * time.Minute):
+		return CropDecision{Decision: CropIgnore, timedOut: true}
+	}
+}
+
+// dispatch hands queued jobs to workers and closes the channel once the
+// session is idle (nothing queued, nothing running).
+func (m *Manager) dispatch(session *Session, jobCh chan<- *QueueJob) {
+	defer close(jobCh)
+	for {
+		if job := session.nextQueued(); job != nil {
+			jobCh <- job
+			continue
+		}
+		if session.closeDispatchIfIdle() {
+			return
+		}
+		<-session.wake
+	}
+}
+
 func (m *Manager) waitForCompletion() {
 	m.wg.Wait()
 
@@ -331,6 +699,187 @@ func (m *Manager) resolveEncoderPath(encoderType string, cfg AppConfigSnapshot)
 	}
 }
 
+// jobNote is a problem with one added job, e.g. of its profile selection,
+// reported once the job has an ID and the session is known.
+type jobNote struct {
+	job int
+	msg string
+}
+
+// selectProfiles gives jobs without a profile the one the selector picks.
+// A selection that fails or targets another encoder than the session's
+// leaves the job on the session profile with a note.
+func (m *Manager) selectProfiles(jobs []JobInput, encoderType string) []jobNote {
+	m.mu.RLock()
+	sel := m.selector
+	m.mu.RUnlock()
+	if sel == nil {
+		return nil
+	}
+	var notes []jobNote
+	for i := range jobs {
+		if jobs[i].Profile != nil {
+			continue
+		}
+		p, reason, err := sel.SelectProfile(jobs[i].InputPath)
+		switch {
+		case err != nil:
+			notes = append(notes, jobNote{i, fmt.Sprintf("profile rules: %v; using the session profile", err)})
+		case p == nil:
+		case p.EncoderType != encoderType:
+			notes = append(notes, jobNote{i, fmt.Sprintf("profile rules: %s, but profile %q uses encoder %q and the session runs %q; using the session profile", reason, p.Name, p.EncoderType, encoderType)})
+		default:
+			jobs[i].Profile = p
+			if m.logger != nil {
+				m.logger.Info("profile rules: %s: %s -> %s", jobs[i].InputPath, reason, p.Name)
+			}
+		}
+	}
+	return notes
+}
+
+// emitJobNotes warns about the added inputs the notes point at. A note on
+// an input with variants goes to each of its sub-jobs in jobs.
+func (m *Manager) emitJobNotes(sessionID string, inputs, jobs []JobInput, notes []jobNote) {
+	for _, n := range notes {
+		id := inputs[n.job].JobID
+		for _, j := range jobs {
+			if j.JobID == id || j.parentJobID == id {
+				m.emitter.Warning(events.Message{SessionID: sessionID, JobID: j.JobID, Message: n.msg})
+			}
+		}
+	}
+}
+
+// sessionActiveLocked reports whether a session is running or winding
+// down. The caller holds m.mu.
+func (m *Manager) sessionActiveLocked() bool {
+	return m.session != nil && (m.session.State == StateRunning || m.session.State == StateStopping || m.session.State == StateAborting)
+}
+
+// currentSession returns the session with the given ID, or nil when that
+// session is not current.
+func (m *Manager) currentSession(sessionID string) *Session {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.session == nil || m.session.ID != sessionID {
+		return nil
+	}
+	return m.session
+}
+
+// resolveProfiles replaces inherited profiles with their effective
+// profiles. Resolver errors already carry E_VALIDATION.
+func (m *Manager) resolveProfiles(prof *profile.Profile, jobs []JobInput) error {
+	if m.profiles == nil {
+		return nil
+	}
+	if prof != nil {
+		eff, err := m.profiles.Resolve(*prof)
+		if err != nil {
+			return err
+		}
+		*prof = eff
+	}
+	for i := range jobs {
+		if jobs[i].Profile == nil {
+			continue
+		}
+		eff, err := m.profiles.Resolve(*jobs[i].Profile)
+		if err != nil {
+			return err
+		}
+		jobs[i].Profile = &eff
+	}
+	return nil
+}
+
+// checkProfileRules rejects the session profile or a per-job profile that
+// breaks the adapter's encoder-specific rules.
+func checkProfileRules(adapter encoder.Adapter, prof *profile.Profile, jobs []JobInput) error {
+	if prof != nil {
+		if err := profile.IssuesError(encoder.CheckProfile(adapter, *prof)); err != nil {
+			return err
+		}
+	}
+	for _, j := range jobs {
+		if j.Profile == nil {
+			continue
+		}
+		if err := profile.IssuesError(encoder.CheckProfile(adapter, *j.Profile)); err != nil {
+			return fmt.Errorf("%s: job %s: %s", encoder.ErrValidation, j.JobID, strings.TrimPrefix(err.Error(), encoder.ErrValidation+": "))
+		}
+	}
+	return nil
+}
+
+// warnProfiles emits a warning for each rule warning and custom option
+// problem of the session profile and the per-job profiles. Encoding still
+// proceeds.
+func (m *Manager) warnProfiles(sessionID string, adapter encoder.Adapter, prof *profile.Profile, jobs []JobInput) {
+	report := func(jobID string, p profile.Profile) {
+		for _, is := range profile.Warnings(encoder.CheckProfile(adapter, p)) {
+			m.emitter.Warning(events.Message{
+				SessionID: sessionID,
+				JobID:     jobID,
+				Message:   is.Field + ": " + is.Message,
+			})
+		}
+		for _, w := range encoder.LintProfile(adapter, p) {
+			m.emitter.Warning(events.Message{
+				SessionID: sessionID,
+				JobID:     jobID,
+				Message:   "custom options: " + w.Message,
+			})
+		}
+	}
+	if prof != nil {
+		report("", *prof)
+	}
+	for _, j := range jobs {
+		if j.Profile != nil {
+			report(j.JobID, *j.Profile)
+		}
+	}
+}
+
+// checkJobProfiles rejects per-job profiles for a different encoder than the
+// session's; all workers share one adapter and encoder binary.
+func checkJobProfiles(jobs []JobInput, encoderType string) error {
+	for _, j := range jobs {
+		if j.Profile != nil && j.Profile.EncoderType != encoderType {
+			return fmt.Errorf("%s: job %s uses encoder %q but the session runs %q", encoder.ErrValidation, j.JobID, j.Profile.EncoderType, encoderType)
+		}
+	}
+	return nil
+}
+
+// assignJobIDs fills in missing job IDs and rejects empty inputs and
+// duplicate IDs (within jobs or against existing).
+func assignJobIDs(jobs []JobInput, existing []QueueJob) error {
+	seen := make(map[string]bool, len(jobs)+len(existing))
+	for _, j := range existing {
+		seen[j.JobID] = true
+	}
+	for i := range jobs {
+		if jobs[i].InputPath == "" {
+			return fmt.Errorf("%s: input_path is required", encoder.ErrValidation)
+		}
+		if jobs[i].JobID == "" {
+			jobs[i].JobID = generateJobID()
+		}
+		if seen[jobs[i].JobID] {
+			return fmt.Errorf("%s: duplicate job_id: %s", encoder.ErrValidation, jobs[i].JobID)
+		}
+		seen[jobs[i].JobID] = true
+	}
+	return nil
+}
+
+func generateJobID() string {
+	return fmt.Sprintf("j_%d_%s", time.Now().UnixMilli(), generateShortID())
+}
+
 func generateSessionID() string {
 	return fmt.Sprintf("s_%d_%s", time.Now().UnixMilli(), generateShortID())
 }
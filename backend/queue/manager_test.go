@@ -0,0 +1,1624 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yuta/enque/backend/config"
+	"github.com/yuta/enque/backend/encoder"
+	"github.com/yuta/enque/backend/events"
+	"github.com/yuta/enque/backend/logging"
+	"github.com/yuta/enque/backend/probe"
+	"github.com/yuta/enque/backend/profile"
+)
+
+// The test binary doubles as a fake encoder: when ENQUE_FAKE_ENCODER is set
+// it writes a few progress lines to stderr, creates the -o file and exits.
+// Inputs whose name contains "fail" exit with code 3; "slow" inputs take
+// about two seconds. An input's "<input>.failonce" file fails the next
+// encode whose output name contains the file's text once.
+func TestMain(m *testing.M) {
+	if os.Getenv("ENQUE_FAKE_ENCODER") == "1" {
+		os.Exit(runFakeEncoder(os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+func runFakeEncoder(args []string) int {
+	var input, output string
+	for i := 0; i < len(args)-1; i++ {
+		switch args[i] {
+		case "-i":
+			input = args[i+1]
+		case "-o":
+			output = args[i+1]
+		}
+	}
+	step := 20 * time.Millisecond
+	if strings.Contains(filepath.Base(input), "slow") {
+		step = 700 * time.Millisecond
+	}
+	for _, pct := range []int{25, 50, 100} {
+		fmt.Fprintf(os.Stderr, "[%d.0%%] 100 frames: 120.00 fps, 5000 kbps\n", pct)
+		time.Sleep(step)
+	}
+	if strings.Contains(filepath.Base(input), "fail") {
+		fmt.Fprintln(os.Stderr, "error: simulated failure")
+		return 3
+	}
+	if once, err := os.ReadFile(input + ".failonce"); err == nil && strings.Contains(filepath.Base(output), string(once)) {
+		os.Remove(input + ".failonce")
+		fmt.Fprintln(os.Stderr, "error: simulated failure")
+		return 3
+	}
+	if err := os.WriteFile(output, []byte("encoded"), 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+type fakeAdapter struct{}
+
+var fakeProgressRe = regexp.MustCompile(`\[(\d+\.?\d*)%\].*?(\d+\.?\d*) fps`)
+
+func (a *fakeAdapter) Type() string { return "nvencc" }
+func (a *fakeAdapter) BuildArgs(p profile.Profile, input, output string) ([]string, error) {
+	return []string{"-i", input, "-o", output}, nil
+}
+func (a *fakeAdapter) ParseProgress(line string) encoder.Progress {
+	m := fakeProgressRe.FindStringSubmatch(line)
+	if m == nil {
+		return encoder.Progress{RawLine: line}
+	}
+	pct, _ := strconv.ParseFloat(m[1], 64)
+	fps, _ := strconv.ParseFloat(m[2], 64)
+	return encoder.Progress{Percent: &pct, FPS: &fps, RawLine: line}
+}
+func (a *fakeAdapter) SupportsDecoderFallback() bool { return false }
+func (a *fakeAdapter) CheckProfile(p profile.Profile) []profile.FieldIssue {
+	switch p.Codec {
+	case "bad":
+		return []profile.FieldIssue{{Field: "codec", Severity: profile.SeverityError, Message: "unsupported"}}
+	case "odd":
+		return []profile.FieldIssue{{Field: "codec", Severity: profile.SeverityWarning, Message: "unusual"}}
+	}
+	return nil
+}
+func (a *fakeAdapter) LintProfile(p profile.Profile) []encoder.LintWarning {
+	if p.CustomOptions == "" {
+		return nil
+	}
+	return []encoder.LintWarning{{Code: encoder.LintUnknown, Option: p.CustomOptions, Message: p.CustomOptions + " is not known"}}
+}
+
+// newTestManager returns a Manager wired to a recording sink, with the
+// app data dir redirected into a temp dir.
+func newTestManager(t *testing.T) (*Manager, *events.RecordingSink) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("APPDATA", home)
+	t.Setenv("ENQUE_FAKE_ENCODER", "1")
+
+	reg := encoder.NewRegistry()
+	reg.Register(&fakeAdapter{})
+	rec := events.NewRecordingSink()
+	return NewManager(reg, events.NewEmitter(rec), nil), rec
+}
+
+func testEncodeRequest(t *testing.T, dir string, names ...string) EncodeRequest {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jobs []JobInput
+	for i, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("input"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		jobs = append(jobs, JobInput{JobID: fmt.Sprintf("job%d", i+1), InputPath: path})
+	}
+	return EncodeRequest{
+		Jobs:    jobs,
+		Profile: profile.Profile{EncoderType: "nvencc", OutputContainer: "mkv"},
+		AppConfigSnapshot: AppConfigSnapshot{
+			MaxConcurrentJobs:  2,
+			OnError:            "skip",
+			OutputFolderMode:   "same_as_input",
+			OutputNameTemplate: "{name}_encoded.{ext}",
+			OverwriteMode:      "auto_rename",
+			NVEncCPath:         exe,
+		},
+	}
+}
+
+func finishedByJob(rec *events.RecordingSink) map[string]events.JobFinished {
+	out := map[string]events.JobFinished{}
+	for _, e := range rec.Named(events.NameJobFinished) {
+		jf := e.Data.(events.JobFinished)
+		out[jf.JobID] = jf
+	}
+	return out
+}
+
+func TestManager_SessionLifecycle(t *testing.T) {
+	m, rec := newTestManager(t)
+	dir := t.TempDir()
+
+	if err := m.StartEncode(testEncodeRequest(t, dir, "a.mp4", "b_fail.mp4", "c.mp4")); err != nil {
+		t.Fatal(err)
+	}
+
+	ev, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second)
+	if !ok {
+		t.Fatal("session did not finish")
+	}
+
+	snap := ev.Data.(events.SessionSnapshot)
+	if snap.State != string(StateCompleted) {
+		t.Errorf("state=%q, want completed", snap.State)
+	}
+	if snap.TotalJobs != 3 || snap.CompletedJobs != 2 || snap.FailedJobs != 1 {
+		t.Errorf("counters total=%d completed=%d failed=%d, want 3/2/1", snap.TotalJobs, snap.CompletedJobs, snap.FailedJobs)
+	}
+
+	if n := len(rec.Named(events.NameSessionStarted)); n != 1 {
+		t.Errorf("session_started emitted %d times, want 1", n)
+	}
+	if n := len(rec.Named(events.NameJobStarted)); n != 3 {
+		t.Errorf("job_started emitted %d times, want 3", n)
+	}
+	if len(rec.Named(events.NameJobProgress)) == 0 {
+		t.Error("expected at least one job_progress event")
+	}
+
+	finished := finishedByJob(rec)
+	if finished["job1"].Status != string(JobCompleted) || finished["job3"].Status != string(JobCompleted) {
+		t.Errorf("unexpected statuses: %+v", finished)
+	}
+	if jf := finished["job2"]; jf.Status != string(JobFailed) || jf.ExitCode == nil || *jf.ExitCode != 3 {
+		t.Errorf("job2 finished=%+v, want failed with exit 3", jf)
+	}
+
+	if !fileExists(filepath.Join(dir, "a_encoded.mkv")) {
+		t.Error("a_encoded.mkv not renamed into place")
+	}
+	if fileExists(filepath.Join(dir, "b_fail_encoded.mkv")) {
+		t.Error("failed job must not produce a final output")
+	}
+	if paths := m.ListTempArtifacts(); len(paths) != 0 {
+		t.Errorf("temp artifacts left behind: %v", paths)
+	}
+}
+
+func TestManager_OnErrorStopSkipsRemaining(t *testing.T) {
+	m, rec := newTestManager(t)
+	dir := t.TempDir()
+
+	req := testEncodeRequest(t, dir, "a_fail.mp4", "b.mp4", "c.mp4")
+	req.AppConfigSnapshot.MaxConcurrentJobs = 1
+	req.AppConfigSnapshot.OnError = "stop"
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second); !ok {
+		t.Fatal("session did not finish")
+	}
+
+	finished := finishedByJob(rec)
+	if finished["job1"].Status != string(JobFailed) {
+		t.Errorf("job1 status=%q, want failed", finished["job1"].Status)
+	}
+	for _, id := range []string{"job2", "job3"} {
+		if finished[id].Status != string(JobSkipped) {
+			t.Errorf("%s status=%q, want skipped", id, finished[id].Status)
+		}
+	}
+}
+
+func TestManager_RejectsConcurrentSession(t *testing.T) {
+	m, rec := newTestManager(t)
+	dir := t.TempDir()
+
+	sel := &countingSelector{}
+	m.SetProfileSelector(sel)
+
+	if err := m.StartEncode(testEncodeRequest(t, dir, "a_slow.mp4")); err != nil {
+		t.Fatal(err)
+	}
+	err := m.StartEncode(testEncodeRequest(t, dir, "b.mp4"))
+	if err == nil || !strings.Contains(err.Error(), encoder.ErrSessionRunning) {
+		t.Errorf("second StartEncode err=%v, want %s", err, encoder.ErrSessionRunning)
+	}
+	if n := sel.calls.Load(); n != 1 {
+		t.Errorf("selector called %d times, want only for the first session", n)
+	}
+	if _, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second); !ok {
+		t.Fatal("session did not finish")
+	}
+}
+
+// countingSelector keeps the session profile and counts its calls.
+type countingSelector struct{ calls atomic.Int32 }
+
+func (s *countingSelector) SelectProfile(path string) (*profile.Profile, string, error) {
+	s.calls.Add(1)
+	return nil, "no rule matched", nil
+}
+
+func TestManager_GracefulStopAndUnknownSession(t *testing.T) {
+	m, rec := newTestManager(t)
+	dir := t.TempDir()
+
+	if err := m.RequestGracefulStop("missing"); err == nil {
+		t.Error("expected error for unknown session")
+	}
+
+	req := testEncodeRequest(t, dir, "a.mp4", "b.mp4", "c.mp4")
+	req.AppConfigSnapshot.MaxConcurrentJobs = 1
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RequestGracefulStop(m.GetSessionID()); err != nil {
+		t.Fatal(err)
+	}
+	ev, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second)
+	if !ok {
+		t.Fatal("session did not finish")
+	}
+	snap := ev.Data.(events.SessionSnapshot)
+	if !snap.StopRequested {
+		t.Error("stop_requested should be true")
+	}
+	if snap.CompletedJobs+snap.SkippedJobs != 3 {
+		t.Errorf("completed=%d skipped=%d, want sum 3", snap.CompletedJobs, snap.SkippedJobs)
+	}
+	if len(rec.Named(events.NameSessionState)) == 0 {
+		t.Error("expected session_state after stop request")
+	}
+}
+
+func TestManager_AppendJobsWhileRunning(t *testing.T) {
+	m, rec := newTestManager(t)
+	dir := t.TempDir()
+
+	req := testEncodeRequest(t, dir, "a_slow.mp4")
+	req.AppConfigSnapshot.MaxConcurrentJobs = 1
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+
+	extra := filepath.Join(dir, "b.mp4")
+	os.WriteFile(extra, []byte("input"), 0o644)
+	if err := m.AppendJobs(m.GetSessionID(), []JobInput{{InputPath: extra}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AppendJobs(m.GetSessionID(), []JobInput{{JobID: "job1", InputPath: extra}}); err == nil {
+		t.Error("expected duplicate job_id to be rejected")
+	}
+
+	ev, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second)
+	if !ok {
+		t.Fatal("session did not finish")
+	}
+	snap := ev.Data.(events.SessionSnapshot)
+	if snap.TotalJobs != 2 || snap.CompletedJobs != 2 {
+		t.Errorf("total=%d completed=%d, want 2/2", snap.TotalJobs, snap.CompletedJobs)
+	}
+	if !fileExists(filepath.Join(dir, "b_encoded.mkv")) {
+		t.Error("appended job did not produce output")
+	}
+
+	if err := m.AppendJobs(snap.SessionID, []JobInput{{InputPath: extra}}); err == nil {
+		t.Error("append after session finished should fail")
+	}
+}
+
+func TestManager_CancelJobTargetsRunningJob(t *testing.T) {
+	m, rec := newTestManager(t)
+	dir := t.TempDir()
+
+	if err := m.StartEncode(testEncodeRequest(t, dir, "a_slow.mp4", "b_slow.mp4")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.WaitFor(events.NameJobStarted, 10*time.Second); !ok {
+		t.Fatal("no job started")
+	}
+	// Wait until both workers picked up their job.
+	deadline := time.Now().Add(10 * time.Second)
+	for len(rec.Named(events.NameJobStarted)) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := m.CancelJob(m.GetSessionID(), "missing"); err == nil {
+		t.Error("cancel of unknown job should fail")
+	}
+	if err := m.CancelJob(m.GetSessionID(), "job1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second); !ok {
+		t.Fatal("session did not finish")
+	}
+
+	finished := finishedByJob(rec)
+	if finished["job1"].Status != string(JobCancelled) {
+		t.Errorf("job1 status=%q, want cancelled", finished["job1"].Status)
+	}
+	if finished["job2"].Status != string(JobCompleted) {
+		t.Errorf("job2 status=%q, want completed", finished["job2"].Status)
+	}
+}
+
+func TestManager_PerJobProfileAndOutputOverride(t *testing.T) {
+	m, rec := newTestManager(t)
+	dir := t.TempDir()
+	outDir := t.TempDir()
+
+	req := testEncodeRequest(t, dir, "a.mp4", "b.mp4")
+	req.Jobs[1].Profile = &profile.Profile{ID: "p-mp4", EncoderType: "nvencc", OutputContainer: "mp4"}
+	req.Jobs[1].Output = &OutputOverride{FolderMode: "specified", FolderPath: outDir, NameTemplate: "{name}_watch.{ext}"}
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second); !ok {
+		t.Fatal("session did not finish")
+	}
+
+	if !fileExists(filepath.Join(dir, "a_encoded.mkv")) {
+		t.Error("job without overrides must use the session settings")
+	}
+	if !fileExists(filepath.Join(outDir, "b_watch.mp4")) {
+		t.Error("job overrides were not applied")
+	}
+	jobs := m.ListJobs()
+	if jobs[1].ProfileID != "p-mp4" {
+		t.Errorf("profile_id=%q, want p-mp4", jobs[1].ProfileID)
+	}
+
+	bad := testEncodeRequest(t, dir, "c.mp4")
+	bad.Jobs[0].Profile = &profile.Profile{EncoderType: "qsvenc"}
+	if err := m.StartEncode(bad); err == nil || !strings.HasPrefix(err.Error(), encoder.ErrValidation) {
+		t.Errorf("mixed encoder types: err=%v, want %s", err, encoder.ErrValidation)
+	}
+}
+
+type mp4Resolver struct{}
+
+func (mp4Resolver) Resolve(p profile.Profile) (profile.Profile, error) {
+	if p.ParentID == "" {
+		return p, nil
+	}
+	if p.ParentID == "missing" {
+		return p, fmt.Errorf("%s: parent profile not found: missing", encoder.ErrValidation)
+	}
+	p.OutputContainer = "mp4"
+	p.Revision = 7
+	return p, nil
+}
+
+func TestManager_ResolvesInheritedProfiles(t *testing.T) {
+	m, rec := newTestManager(t)
+	m.SetProfileResolver(mp4Resolver{})
+	dir := t.TempDir()
+
+	bad := testEncodeRequest(t, dir, "a.mp4")
+	bad.Profile.ParentID = "missing"
+	if err := m.StartEncode(bad); err == nil || !strings.HasPrefix(err.Error(), encoder.ErrValidation) {
+		t.Fatalf("unresolvable parent: err=%v, want %s", err, encoder.ErrValidation)
+	}
+
+	req := testEncodeRequest(t, dir, "a.mp4")
+	req.Profile.ParentID = "base"
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second); !ok {
+		t.Fatal("session did not finish")
+	}
+	if !fileExists(filepath.Join(dir, "a_encoded.mp4")) {
+		t.Error("session profile was not resolved before building arguments")
+	}
+
+	// The job record references the resolved profile revision.
+	data, err := os.ReadFile(filepath.Join(config.LogsDir(), m.GetSessionID(), "job1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record logging.JobRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.ProfileRevision != 7 {
+		t.Errorf("profile_revision=%d, want 7", record.ProfileRevision)
+	}
+}
+
+func TestManager_WarnsAboutCustomOptions(t *testing.T) {
+	m, rec := newTestManager(t)
+	dir := t.TempDir()
+
+	req := testEncodeRequest(t, dir, "a.mp4", "b.mp4")
+	req.Profile.CustomOptions = "--bogus"
+	req.Jobs[1].Profile = &profile.Profile{EncoderType: "nvencc", OutputContainer: "mkv", CustomOptions: "--other"}
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second); !ok {
+		t.Fatal("session did not finish")
+	}
+
+	got := map[string]string{}
+	for _, e := range rec.Named(events.NameWarning) {
+		msg := e.Data.(events.Message)
+		if msg.SessionID == "" {
+			t.Errorf("warning without session ID: %+v", msg)
+		}
+		got[msg.JobID] = msg.Message
+	}
+	if !strings.Contains(got[""], "--bogus") || !strings.Contains(got["job2"], "--other") {
+		t.Errorf("warnings=%v, want session and job2 custom option warnings", got)
+	}
+	if len(finishedByJob(rec)) != 2 {
+		t.Error("lint warnings must not stop the session")
+	}
+}
+
+func TestManager_EnforcesEncoderRules(t *testing.T) {
+	m, rec := newTestManager(t)
+	dir := t.TempDir()
+
+	bad := testEncodeRequest(t, dir, "a.mp4")
+	bad.Profile.Codec = "bad"
+	if err := m.StartEncode(bad); err == nil || !strings.HasPrefix(err.Error(), encoder.ErrValidation) || !strings.Contains(err.Error(), "codec") {
+		t.Fatalf("session profile: err=%v, want %s on codec", err, encoder.ErrValidation)
+	}
+	badJob := testEncodeRequest(t, dir, "a.mp4")
+	badJob.Jobs[0].Profile = &profile.Profile{EncoderType: "nvencc", Codec: "bad"}
+	if err := m.StartEncode(badJob); err == nil || !strings.Contains(err.Error(), "job1") {
+		t.Fatalf("job profile: err=%v, want error naming job1", err)
+	}
+
+	req := testEncodeRequest(t, dir, "a.mp4")
+	req.Profile.Codec = "odd"
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second); !ok {
+		t.Fatal("session did not finish")
+	}
+	found := false
+	for _, e := range rec.Named(events.NameWarning) {
+		if msg := e.Data.(events.Message); msg.Message == "codec: unusual" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("rule warning was not emitted")
+	}
+}
+
+// extSelector picks an mp4 profile for .ts files and a QSVEnc profile for
+// .m2ts files, and fails for .bad files.
+type extSelector struct{}
+
+func (extSelector) SelectProfile(path string) (*profile.Profile, string, error) {
+	switch filepath.Ext(path) {
+	case ".ts":
+		return &profile.Profile{ID: "p-ts", Name: "TS", EncoderType: "nvencc", OutputContainer: "mp4"}, "rule \"ts\" matched", nil
+	case ".m2ts":
+		return &profile.Profile{ID: "p-qsv", Name: "QSV", EncoderType: "qsvenc"}, "rule \"m2ts\" matched", nil
+	case ".bad":
+		return nil, "", fmt.Errorf("profile not found: gone")
+	}
+	return nil, "no rule matched", nil
+}
+
+func TestManager_SelectsProfilesByRules(t *testing.T) {
+	m, rec := newTestManager(t)
+	m.SetProfileSelector(extSelector{})
+	dir := t.TempDir()
+
+	req := testEncodeRequest(t, dir, "a.ts", "b.mp4", "c.m2ts", "d.bad", "e.ts")
+	req.Jobs[4].Profile = &profile.Profile{ID: "p-explicit", EncoderType: "nvencc", OutputContainer: "mkv"}
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second); !ok {
+		t.Fatal("session did not finish")
+	}
+
+	want := map[string]string{"job1": "p-ts", "job2": "", "job3": "", "job4": "", "job5": "p-explicit"}
+	for _, j := range m.ListJobs() {
+		if j.ProfileID != want[j.JobID] {
+			t.Errorf("%s profile_id=%q, want %q", j.JobID, j.ProfileID, want[j.JobID])
+		}
+	}
+	if !fileExists(filepath.Join(dir, "a_encoded.mp4")) {
+		t.Error("selected profile was not used")
+	}
+
+	warned := map[string]bool{}
+	for _, e := range rec.Named(events.NameWarning) {
+		msg := e.Data.(events.Message)
+		if strings.HasPrefix(msg.Message, "profile rules: ") && msg.SessionID != "" {
+			warned[msg.JobID] = true
+		}
+	}
+	if !warned["job3"] || !warned["job4"] || len(warned) != 2 {
+		t.Errorf("selection warnings for %v, want job3 and job4", warned)
+	}
+}
+
+// durationProber reports 10 s for every input except "tiny" ones, which
+// are 0.1 ms long, and fails for "noprobe" ones.
+type durationProber struct{}
+
+func (durationProber) Probe(ctx context.Context, path string) (probe.MediaInfo, error) {
+	switch {
+	case strings.Contains(path, "noprobe"):
+		return probe.MediaInfo{}, fmt.Errorf("ffprobe: invalid data")
+	case strings.Contains(path, "tiny"):
+		return probe.MediaInfo{DurationSec: 0.0001}, nil
+	}
+	return probe.MediaInfo{DurationSec: 10}, nil
+}
+
+func TestManager_TargetSizeRecordsResult(t *testing.T) {
+	m, rec := newTestManager(t)
+	m.SetMediaProber(durationProber{})
+	dir := t.TempDir()
+
+	req := testEncodeRequest(t, dir, "a.mp4", "tiny.mp4", "noprobe.mp4")
+	req.Profile.RateControl, req.Profile.RateValue = encoder.RateControlTargetSize, 1
+	// The fake encoder writes 7 bytes, more than this 5-byte target.
+	req.Jobs[1].Profile = &profile.Profile{EncoderType: "nvencc", OutputContainer: "mkv", RateControl: encoder.RateControlTargetSize, RateValue: 5.0 / (1024 * 1024)}
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second); !ok {
+		t.Fatal("session did not finish")
+	}
+
+	records := map[string]logging.JobRecord{}
+	for _, id := range []string{"job1", "job2"} {
+		data, err := os.ReadFile(filepath.Join(config.LogsDir(), m.GetSessionID(), id+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r logging.JobRecord
+		if err := json.Unmarshal(data, &r); err != nil {
+			t.Fatal(err)
+		}
+		records[id] = r
+	}
+	if ts := records["job1"].TargetSize; ts == nil || !ts.Hit || ts.OutputBytes != 7 || ts.Mode != "vbr" || ts.VideoKbps == 0 {
+		t.Errorf("job1 target_size=%+v, want a hit", ts)
+	}
+	if ts := records["job2"].TargetSize; ts == nil || ts.Hit || ts.TargetBytes != 5 || ts.DeviationPct != 40 {
+		t.Errorf("job2 target_size=%+v, want a 40%% miss", ts)
+	}
+
+	finished := finishedByJob(rec)
+	if finished["job3"].Status != string(JobFailed) || !strings.Contains(finished["job3"].ErrorMessage, "target size") {
+		t.Errorf("job3=%+v, want failure naming the target size", finished["job3"])
+	}
+	missed := false
+	for _, e := range rec.Named(events.NameWarning) {
+		if msg := e.Data.(events.Message); msg.JobID == "job2" && strings.HasPrefix(msg.Message, "target size missed") {
+			missed = true
+		}
+	}
+	if !missed {
+		t.Error("missed target was not reported")
+	}
+}
+
+func TestManager_OutputVariants(t *testing.T) {
+	m, rec := newTestManager(t)
+	dir := t.TempDir()
+
+	req := testEncodeRequest(t, dir, "a.mp4", "b.mp4")
+	req.Profile.RateControl, req.Profile.RateValue = "qvbr", 28
+	req.Jobs[0].Variants = []OutputVariant{
+		{Name: "1080p", OutputRes: "1920x-2"},
+		{Name: "720p", OutputRes: "1280x-2", RateValue: 30, Suffix: "-hd"},
+	}
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second); !ok {
+		t.Fatal("session did not finish")
+	}
+
+	finished := finishedByJob(rec)
+	if len(finished) != 3 || finished["job1"].JobID != "" {
+		t.Fatalf("finished=%v, want job1 replaced by its variants", finished)
+	}
+	for _, want := range []struct{ id, parent, output string }{
+		{"job1_1080p", "job1", "a_encoded_1080p.mkv"},
+		{"job1_720p", "job1", "a_encoded-hd.mkv"},
+		{"job2", "", "b_encoded.mkv"},
+	} {
+		jf := finished[want.id]
+		if jf.Status != string(JobCompleted) || jf.ParentJobID != want.parent || !fileExists(filepath.Join(dir, want.output)) {
+			t.Errorf("%s=%+v, want %s under %q", want.id, jf, want.output, want.parent)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(config.LogsDir(), m.GetSessionID(), "job1_720p.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r logging.JobRecord
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.ParentJobID != "job1" || r.Variant != "720p" {
+		t.Errorf("record parent=%q variant=%q", r.ParentJobID, r.Variant)
+	}
+	// The revision is the base profile's; the record says what the variant changed.
+	if v := r.VariantOverrides; v == nil || v.OutputRes != "1280x-2" || v.RateValue != 30 {
+		t.Errorf("variant overrides=%+v", v)
+	}
+	if v := readJobRecord(t, m, "job2").VariantOverrides; v != nil {
+		t.Errorf("job2 variant overrides=%+v, want none", v)
+	}
+
+	grouped := false
+	for _, e := range rec.Named(events.NameJobProgress) {
+		p := e.Data.(events.JobProgress)
+		if p.ParentJobID == "" && p.GroupPercent != nil {
+			t.Errorf("%s: group_percent on a job without variants", p.JobID)
+		}
+		if p.GroupPercent != nil {
+			grouped = true
+			if *p.GroupPercent < 0 || *p.GroupPercent > 100 {
+				t.Errorf("%s: group_percent=%f", p.JobID, *p.GroupPercent)
+			}
+		}
+	}
+	if !grouped {
+		t.Error("variant progress carried no group_percent")
+	}
+}
+
+func TestManager_VariantsGetInputWarnings(t *testing.T) {
+	m, rec := newTestManager(t)
+	m.SetProfileSelector(extSelector{})
+	dir := t.TempDir()
+
+	req := testEncodeRequest(t, dir, "a.m2ts")
+	req.Jobs[0].Variants = []OutputVariant{{Name: "1080p"}, {Name: "720p"}}
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second); !ok {
+		t.Fatal("session did not finish")
+	}
+
+	got := map[string]bool{}
+	for _, e := range rec.Named(events.NameWarning) {
+		if msg := e.Data.(events.Message); strings.HasPrefix(msg.Message, "profile rules:") {
+			got[msg.JobID] = true
+		}
+	}
+	if len(got) != 2 || !got["job1_1080p"] || !got["job1_720p"] {
+		t.Errorf("selection warnings for %v, want each variant", got)
+	}
+}
+
+func TestExpandVariants(t *testing.T) {
+	base := profile.Profile{EncoderType: "nvencc", OutputRes: "3840x2160", RateValue: 25}
+	jobs := []JobInput{{JobID: "job1", InputPath: "a.mp4", Variants: []OutputVariant{{Name: "1080p", OutputRes: "1920x-2", RateValue: 27}}}}
+	out, err := expandVariants(jobs, base, "{name}.{ext}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0].JobID != "job1_1080p" || out[0].parentJobID != "job1" || out[0].Variants != nil {
+		t.Fatalf("out=%+v", out)
+	}
+	if p := out[0].Profile; p.OutputRes != "1920x-2" || p.RateValue != 27 || base.OutputRes != "3840x2160" {
+		t.Errorf("profile=%+v", p)
+	}
+	if tpl := out[0].Output.NameTemplate; tpl != "{name}_1080p.{ext}" {
+		t.Errorf("template=%q", tpl)
+	}
+
+	for _, variants := range [][]OutputVariant{
+		{{Name: "a b"}},
+		{{Name: "hd"}, {Name: "hd"}},
+		{{Name: "x", Suffix: "_hd"}, {Name: "hd"}},
+		{{Name: "hd", RateValue: -1}},
+	} {
+		jobs[0].Variants = variants
+		if _, err := expandVariants(jobs, base, ""); err == nil || !strings.HasPrefix(err.Error(), encoder.ErrValidation) {
+			t.Errorf("variants %+v: err=%v", variants, err)
+		}
+	}
+}
+
+// barsDetector reports letterbox bars for "bars" inputs, none for others
+// and fails for "nocrop" ones.
+type barsDetector struct{}
+
+func (barsDetector) DetectCrop(ctx context.Context, path string, media probe.MediaInfo) (probe.Crop, error) {
+	switch {
+	case strings.Contains(path, "nocrop"):
+		return probe.Crop{}, fmt.Errorf("cropdetect: no crop reported")
+	case strings.Contains(path, "bars"):
+		return probe.Crop{Top: 140, Bottom: 140, Width: 1920, Height: 1080, Samples: 8}, nil
+	}
+	return probe.Crop{Width: 1920, Height: 1080, Samples: 8}, nil
+}
+
+func readJobRecord(t *testing.T, m *Manager, jobID string) logging.JobRecord {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(config.LogsDir(), m.GetSessionID(), jobID+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r logging.JobRecord
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestManager_AutoCropApply(t *testing.T) {
+	m, rec := newTestManager(t)
+	m.SetMediaProber(durationProber{})
+	m.SetCropDetector(barsDetector{})
+	dir := t.TempDir()
+
+	req := testEncodeRequest(t, dir, "a_bars.mp4", "b.mp4", "c_nocrop.mp4", "d.mp4")
+	req.Profile.AutoCrop = "apply"
+	req.Jobs[3].Crop = &profile.FilterRect{Left: 2, Right: 2}
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second); !ok {
+		t.Fatal("session did not finish")
+	}
+
+	want := map[string]string{"job1": "applied", "job2": "none", "job3": "failed", "job4": "preset"}
+	for id, decision := range want {
+		c := readJobRecord(t, m, id).Crop
+		if c == nil || c.Decision != decision {
+			t.Errorf("%s crop=%+v, want %s", id, c, decision)
+		}
+	}
+	if c := readJobRecord(t, m, "job1").Crop; c.Applied == nil || *c.Applied != (logging.CropRect{Top: 140, Bottom: 140}) || c.Height != 1080 {
+		t.Errorf("job1 crop=%+v", c)
+	}
+	if finished := finishedByJob(rec); finished["job3"].Status != string(JobCompleted) {
+		t.Errorf("job3=%+v, want a failed detection to encode uncropped", finished["job3"])
+	}
+	warned := false
+	for _, e := range rec.Named(events.NameWarning) {
+		if msg := e.Data.(events.Message); msg.JobID == "job3" && strings.Contains(msg.Message, "uncropped") {
+			warned = true
+		}
+	}
+	if !warned {
+		t.Error("failed detection was not reported")
+	}
+
+	got := withCrop(profile.Profile{Filters: []profile.Filter{{Type: profile.FilterDeband}}}, profile.FilterRect{Top: 2})
+	if len(got.Filters) != 2 || got.Filters[0].Type != profile.FilterCrop {
+		t.Errorf("filters=%+v, want the crop first", got.Filters)
+	}
+}
+
+func TestManager_AutoCropConfirm(t *testing.T) {
+	m, rec := newTestManager(t)
+	m.SetMediaProber(durationProber{})
+	m.SetCropDetector(barsDetector{})
+	dir := t.TempDir()
+
+	req := testEncodeRequest(t, dir, "a_bars.mp4", "b_bars.mp4")
+	req.Profile.AutoCrop = "confirm"
+	req.AppConfigSnapshot.MaxConcurrentJobs = 1
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+
+	answers := []CropDecision{
+		{Decision: CropApply, Rect: &profile.FilterRect{Top: 138, Bottom: 138}},
+		{Decision: CropSkip},
+	}
+	for i, answer := range answers {
+		deadline := time.Now().Add(10 * time.Second)
+		for len(rec.Named(events.NameJobNeedsCrop)) <= i {
+			if time.Now().After(deadline) {
+				t.Fatalf("no crop prompt %d", i+1)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		ask := rec.Named(events.NameJobNeedsCrop)[i].Data.(events.JobNeedsCrop)
+		if ask.Top != 140 || ask.Height != 1080 {
+			t.Errorf("prompt=%+v", ask)
+		}
+		if err := m.ResolveCrop(ask.SessionID, ask.JobID, "maybe", nil); err == nil {
+			t.Error("expected error for an unknown decision")
+		}
+		if err := m.ResolveCrop(ask.SessionID, ask.JobID, answer.Decision, answer.Rect); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second); !ok {
+		t.Fatal("session did not finish")
+	}
+
+	if c := readJobRecord(t, m, "job1").Crop; c == nil || c.Decision != "adjusted" || c.Applied.Top != 138 || c.Detected.Top != 140 {
+		t.Errorf("job1 crop=%+v", c)
+	}
+	if jf := finishedByJob(rec)["job2"]; jf.Status != string(JobSkipped) || jf.ErrorMessage != "crop skipped by user" {
+		t.Errorf("job2=%+v, want skipped", jf)
+	}
+}
+
+func TestManager_AbortWhileWaitingForCrop(t *testing.T) {
+	m, rec := newTestManager(t)
+	m.SetMediaProber(durationProber{})
+	m.SetCropDetector(barsDetector{})
+	dir := t.TempDir()
+
+	req := testEncodeRequest(t, dir, "a_bars.mp4")
+	req.Profile.AutoCrop = "confirm"
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+	ev, ok := rec.WaitFor(events.NameJobNeedsCrop, 10*time.Second)
+	if !ok {
+		t.Fatal("no crop prompt")
+	}
+	if err := m.RequestAbort(ev.Data.(events.JobNeedsCrop).SessionID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.WaitFor(events.NameSessionFinished, 10*time.Second); !ok {
+		t.Fatal("session did not finish after abort")
+	}
+	if jf := finishedByJob(rec)["job1"]; jf.Status != string(JobCancelled) {
+		t.Errorf("job1=%+v, want cancelled", jf)
+	}
+}
+
+func TestManager_AutoCropConfirmUnattended(t *testing.T) {
+	m, rec := newTestManager(t)
+	m.SetMediaProber(durationProber{})
+	m.SetCropDetector(barsDetector{})
+	dir := t.TempDir()
+
+	req := testEncodeRequest(t, dir, "a_bars.mp4")
+	req.Profile.AutoCrop = "confirm"
+	req.AppConfigSnapshot.Unattended = true
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second); !ok {
+		t.Fatal("session did not finish")
+	}
+	if n := len(rec.Named(events.NameJobNeedsCrop)); n != 0 {
+		t.Errorf("%d prompts in an unattended session", n)
+	}
+	if c := readJobRecord(t, m, "job1").Crop; c == nil || c.Decision != "ignored" || c.Applied != nil {
+		t.Errorf("crop=%+v, want the detection recorded but not applied", c)
+	}
+}
+
+// hdrProber reports PQ HDR for "hdr" inputs and fails for "noprobe" ones.
+type hdrProber struct{}
+
+func (hdrProber) Probe(ctx context.Context, path string) (probe.MediaInfo, error) {
+	switch {
+	case strings.Contains(path, "noprobe"):
+		return probe.MediaInfo{}, fmt.Errorf("ffprobe: invalid data")
+	case strings.Contains(path, "hdr"):
+		return probe.MediaInfo{DurationSec: 10, HDR: true, ColorTransfer: "smpte2084", ColorPrimaries: "bt2020",
+			ColorSpace: "bt2020nc", MaxCLL: 1000, MaxFALL: 400}, nil
+	}
+	return probe.MediaInfo{DurationSec: 10, ColorTransfer: "bt709"}, nil
+}
+
+func TestManager_HDREnforce(t *testing.T) {
+	m, rec := newTestManager(t)
+	m.SetMediaProber(hdrProber{})
+	dir := t.TempDir()
+
+	req := testEncodeRequest(t, dir, "a_hdr.mp4", "b.mp4", "noprobe.mp4")
+	req.Profile.Codec, req.Profile.OutputDepth, req.Profile.HDRMode = "h264", 8, "enforce"
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second); !ok {
+		t.Fatal("session did not finish")
+	}
+
+	if h := readJobRecord(t, m, "job1").HDR; h == nil || h.Source != "pq" || h.Action != "upgraded" ||
+		h.Codec != "hevc" || h.OutputDepth != 10 || h.MaxCLL != "1000,400" {
+		t.Errorf("job1 hdr=%+v", h)
+	}
+	if h := readJobRecord(t, m, "job2").HDR; h == nil || h.Action != "none" || h.Codec != "h264" {
+		t.Errorf("job2 hdr=%+v", h)
+	}
+	if h := readJobRecord(t, m, "job3").HDR; h == nil || h.Error == "" {
+		t.Errorf("job3 hdr=%+v, want the probe error", h)
+	}
+	for id, f := range finishedByJob(rec) {
+		if f.Status != string(JobCompleted) {
+			t.Errorf("%s=%+v", id, f)
+		}
+	}
+	warned := false
+	for _, e := range rec.Named(events.NameWarning) {
+		if msg := e.Data.(events.Message); msg.JobID == "job1" && strings.Contains(msg.Message, "10-bit hevc") {
+			warned = true
+		}
+	}
+	if !warned {
+		t.Error("upgrade was not reported")
+	}
+}
+
+// streamsProber reports a Japanese and an English audio track, the
+// latter a commentary.
+type streamsProber struct{}
+
+func (streamsProber) Probe(ctx context.Context, path string) (probe.MediaInfo, error) {
+	return probe.MediaInfo{DurationSec: 10, Streams: []probe.Stream{
+		{Index: 0, Type: "video"},
+		{Index: 1, Type: "audio", Language: "jpn"},
+		{Index: 2, Type: "audio", Language: "eng", Title: "Commentary"},
+	}}, nil
+}
+
+func TestManager_TrackRules(t *testing.T) {
+	m, rec := newTestManager(t)
+	m.SetMediaProber(streamsProber{})
+	dir := t.TempDir()
+
+	req := testEncodeRequest(t, dir, "a.mp4")
+	if err := os.WriteFile(filepath.Join(dir, "a.jpn.srt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	req.Profile.AudioMode = "copy"
+	req.Profile.Tracks = &profile.TrackRules{DropCommentary: true, Sidecars: true}
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second); !ok {
+		t.Fatal("session did not finish")
+	}
+
+	found := false
+	for _, e := range rec.Named(events.NameJobLog) {
+		if e.Data.(events.JobLog).Line == "tracks: audio 1 copy, sidecar a.jpn.srt" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("track mapping was not logged")
+	}
+}
+
+// quietMeter measures audio track 1 at -31.42 LUFS and fails on others.
+type quietMeter struct{}
+
+func (quietMeter) MeasureLoudness(ctx context.Context, path string, track int) (probe.Loudness, error) {
+	if track != 1 {
+		return probe.Loudness{}, fmt.Errorf("loudnorm: track is silent")
+	}
+	return probe.Loudness{IntegratedLUFS: -31.42, TruePeakDBTP: -9.87, LRA: 6.1}, nil
+}
+
+func TestManager_LoudnessNormalization(t *testing.T) {
+	m, rec := newTestManager(t)
+	m.SetMediaProber(streamsProber{})
+	m.SetLoudnessMeter(quietMeter{})
+	dir := t.TempDir()
+
+	req := testEncodeRequest(t, dir, "a.mp4")
+	req.Profile.AudioMode, req.Profile.AudioBitrate = "aac", 192
+	req.Profile.Loudness = &profile.Loudness{TargetLUFS: -23, TruePeak: -1}
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second); !ok {
+		t.Fatal("session did not finish")
+	}
+
+	l := readJobRecord(t, m, "job1").Loudness
+	if l == nil || l.TargetLUFS != -23 || len(l.Tracks) != 2 {
+		t.Fatalf("loudness=%+v", l)
+	}
+	if tr := l.Tracks[0]; tr.Track != 1 || tr.MeasuredLUFS != -31.42 || tr.GainDB != 8.42 || tr.OutputLUFS != -23 || tr.PeakLimited {
+		t.Errorf("track 1=%+v", tr)
+	}
+	if tr := l.Tracks[1]; tr.Track != 2 || tr.Error == "" {
+		t.Errorf("track 2=%+v, want the measurement error", tr)
+	}
+	if f := finishedByJob(rec)["job1"]; f.Status != string(JobCompleted) {
+		t.Errorf("job1=%+v", f)
+	}
+}
+
+// countingProber counts the probes of each input and fails for "noprobe"
+// ones, otherwise acting as streamsProber.
+type countingProber struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (p *countingProber) Probe(ctx context.Context, path string) (probe.MediaInfo, error) {
+	p.mu.Lock()
+	p.calls[filepath.Base(path)]++
+	p.mu.Unlock()
+	if strings.Contains(path, "noprobe") {
+		return probe.MediaInfo{}, fmt.Errorf("ffprobe: invalid data")
+	}
+	return streamsProber{}.Probe(ctx, path)
+}
+
+func TestManager_ProbesInputOnce(t *testing.T) {
+	m, rec := newTestManager(t)
+	prober := &countingProber{calls: map[string]int{}}
+	m.SetMediaProber(prober)
+	m.SetLoudnessMeter(quietMeter{})
+	dir := t.TempDir()
+
+	req := testEncodeRequest(t, dir, "a.mp4", "noprobe.mp4")
+	req.Profile.AudioMode, req.Profile.AudioBitrate = "aac", 192
+	req.Profile.HDRMode = "enforce"
+	req.Profile.Tracks = &profile.TrackRules{}
+	req.Profile.Loudness = &profile.Loudness{TargetLUFS: -23, TruePeak: -1}
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second); !ok {
+		t.Fatal("session did not finish")
+	}
+
+	// One probe for the planners; the session ETA may add one in the
+	// background.
+	prober.mu.Lock()
+	for _, name := range []string{"a.mp4", "noprobe.mp4"} {
+		if n := prober.calls[name]; n < 1 || n > 2 {
+			t.Errorf("%s probed %d times, want once for the planners", name, n)
+		}
+	}
+	prober.mu.Unlock()
+	var warnings []string
+	for _, e := range rec.Named(events.NameWarning) {
+		if msg := e.Data.(events.Message); msg.JobID == "job2" {
+			warnings = append(warnings, msg.Message)
+		}
+	}
+	if len(warnings) != 1 || warnings[0] != "probe: ffprobe: invalid data; hdr, tracks, loudness without media info" {
+		t.Errorf("job2 warnings=%q, want one probe warning", warnings)
+	}
+	r := readJobRecord(t, m, "job2")
+	if r.HDR == nil || r.HDR.Error == "" || r.Loudness == nil || r.Loudness.Error == "" {
+		t.Errorf("job2 hdr=%+v loudness=%+v, want the probe error", r.HDR, r.Loudness)
+	}
+	for id, f := range finishedByJob(rec) {
+		if f.Status != string(JobCompleted) {
+			t.Errorf("%s=%+v", id, f)
+		}
+	}
+}
+
+// longProber reports every input as 20 minutes long, with a keyframe
+// every 2 s.
+type longProber struct{}
+
+func (longProber) Probe(ctx context.Context, path string) (probe.MediaInfo, error) {
+	return probe.MediaInfo{DurationSec: 1200}, nil
+}
+
+func (longProber) Keyframes(ctx context.Context, path string) ([]float64, error) {
+	var k []float64
+	for t := 0.0; t < 1200; t += 2 {
+		k = append(k, t)
+	}
+	return k, nil
+}
+
+func (longProber) SceneChanges(ctx context.Context, path string) ([]float64, error) {
+	return nil, fmt.Errorf("scene detection: not supported")
+}
+
+// catJoiner joins segments by concatenating their bytes.
+type catJoiner struct{}
+
+func (catJoiner) JoinSegments(ctx context.Context, p profile.Profile, segments []string, source, output string) error {
+	var joined []byte
+	for _, s := range segments {
+		data, err := os.ReadFile(s)
+		if err != nil {
+			return err
+		}
+		joined = append(joined, data...)
+	}
+	return os.WriteFile(output, joined, 0o644)
+}
+
+func TestManager_Chunks(t *testing.T) {
+	m, rec := newTestManager(t)
+	m.SetMediaProber(longProber{})
+	m.SetSplitFinder(longProber{})
+	m.SetSegmentJoiner(catJoiner{})
+	dir := t.TempDir()
+
+	req := testEncodeRequest(t, dir, "a.mp4", "b_fail.mp4")
+	req.Profile.Chunks = &profile.ChunkSettings{MinDurationSec: 600, SegmentSec: 300, Boundary: "scene", Retries: 1}
+	req.AppConfigSnapshot.MaxConcurrentJobs = 3
+	if err := os.WriteFile(filepath.Join(dir, "a.mp4.failonce"), []byte("seg02"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+	ev, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second)
+	if !ok {
+		t.Fatal("session did not finish")
+	}
+
+	// Segments are not counted as jobs, nor recorded on their own.
+	if snap := ev.Data.(events.SessionSnapshot); snap.TotalJobs != 2 || snap.CompletedJobs != 1 || snap.FailedJobs != 1 {
+		t.Errorf("snapshot=%+v, want the two jobs counted", snap)
+	}
+	if _, err := os.Stat(filepath.Join(config.LogsDir(), m.GetSessionID(), "job1_seg01.json")); !os.IsNotExist(err) {
+		t.Errorf("segment record: err=%v, want none", err)
+	}
+
+	finished := finishedByJob(rec)
+	if f := finished["job1"]; f.Status != string(JobCompleted) {
+		t.Fatalf("job1=%+v", f)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "a_encoded.mkv"))
+	if err != nil || string(data) != strings.Repeat("encoded", 4) {
+		t.Errorf("output=%q err=%v, want 4 joined segments", data, err)
+	}
+	for i := 1; i <= 4; i++ {
+		id := fmt.Sprintf("job1_seg%02d", i)
+		if f := finished[id]; f.Status != string(JobCompleted) || f.ParentJobID != "job1" || f.Segment != i {
+			t.Errorf("%s=%+v", id, f)
+		}
+	}
+	c := readJobRecord(t, m, "job1").Chunks
+	if c == nil || c.Boundary != "scene" || len(c.Segments) != 4 {
+		t.Fatalf("chunks=%+v", c)
+	}
+	if s := c.Segments[1]; s.Start != 300 || s.End != 600 || s.Attempts != 2 || s.Status != string(JobCompleted) {
+		t.Errorf("segment 2=%+v, want it retried once", s)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.chunks")); len(matches) != 0 {
+		t.Errorf("chunk folders left behind: %v", matches)
+	}
+
+	// A segment that keeps failing fails its job.
+	if f := finished["job2"]; f.Status != string(JobFailed) || !strings.HasPrefix(f.ErrorMessage, "segment 1 failed") {
+		t.Errorf("job2=%+v", f)
+	}
+	if fileExists(filepath.Join(dir, "b_fail_encoded.mkv")) {
+		t.Error("job2 has an output")
+	}
+
+	var retried, sceneFallback bool
+	for _, e := range rec.Named(events.NameWarning) {
+		msg := e.Data.(events.Message)
+		retried = retried || msg.JobID == "job1_seg02" && strings.Contains(msg.Message, "retrying (1/1)")
+		sceneFallback = sceneFallback || msg.JobID == "job1" && strings.Contains(msg.Message, "splitting at keyframes")
+	}
+	if !retried || !sceneFallback {
+		t.Errorf("retried=%t scene fallback=%t", retried, sceneFallback)
+	}
+	progressed := false
+	for _, e := range rec.Named(events.NameJobProgress) {
+		if p := e.Data.(events.JobProgress); p.JobID == "job1" && p.Percent != nil {
+			progressed = true
+		}
+	}
+	if !progressed {
+		t.Error("job1 reported no progress of its segments")
+	}
+}
+
+func TestSession_EstimateETA(t *testing.T) {
+	ptr := func(v float64) *float64 { return &v }
+	s := NewSession("s1", []JobInput{
+		{JobID: "run1", InputPath: "run1.mkv"},
+		{JobID: "run2", InputPath: "run2.mkv"},
+		{JobID: "p1", InputPath: "a.mkv"},
+		{JobID: "p2", InputPath: "b.mkv", Profile: &profile.Profile{ID: "slow"}},
+		{JobID: "p3", InputPath: "unknown.mkv"},
+		{JobID: "p4", InputPath: "a.mkv"},
+	}, "nvencc", AppConfigSnapshot{MaxConcurrentJobs: 2})
+	s.profile.ID = "fast"
+	s.eta = newETAEstimator(context.Background(), nil)
+	s.eta.media["a.mkv"] = inputMedia{durationSec: 60, fps: 25}
+	s.eta.media["b.mkv"] = inputMedia{durationSec: 120, fps: 25}
+	s.eta.history["slow"] = profileRate{fps: 50}
+
+	now := time.Now()
+	// run1 is half done after 100 s; run2's encoder expects 30 s more.
+	run1, run2 := s.nextQueued(), s.nextQueued()
+	run1.Status, run1.StartedAt, run1.percent, run1.fps = JobRunning, now.Add(-100*time.Second), 50, 100
+	run2.Status, run2.StartedAt, run2.etaSec, run2.fps = JobRunning, now, ptr(30), 100
+
+	// The workers are free after 100 and 30 s. p1 (1500 frames at the
+	// session's 100 fps, 15 s) and p2 (3000 frames at slow's past 50 fps,
+	// 60 s) follow run2, which leaves p4 to run1's worker; p3 cannot be
+	// estimated.
+	est := s.estimateLocked(now)
+	if est.sec == nil {
+		t.Fatal("no eta")
+	}
+	if math.Abs(*est.sec-115) > 0.01 {
+		t.Errorf("eta=%v, want 115", *est.sec)
+	}
+	if est.throughput != 200 || est.unestimated != 1 {
+		t.Errorf("throughput=%v unestimated=%d, want 200 and 1", est.throughput, est.unestimated)
+	}
+
+	// Stopping: only the running jobs remain.
+	s.State = StateStopping
+	if est := s.estimateLocked(now); est.sec == nil || math.Abs(*est.sec-100) > 0.01 {
+		t.Errorf("eta while stopping=%v, want 100", est.sec)
+	}
+	s.State = StateCompleted
+	if est := s.estimateLocked(now); est.sec != nil {
+		t.Errorf("eta after the session=%v", *est.sec)
+	}
+}
+
+func TestETAEstimator_LoadHistory(t *testing.T) {
+	logs := t.TempDir()
+	write := func(session, job string, r logging.JobRecord) {
+		dir := filepath.Join(logs, session)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		data, _ := json.Marshal(r)
+		if err := os.WriteFile(filepath.Join(dir, job+".json"), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("s_1_a", "j1", logging.JobRecord{Status: "completed", ProfileID: "p", AvgFPS: 100, InputSizeBytes: 1000, DurationSec: 10})
+	write("s_2_b", "j1", logging.JobRecord{Status: "completed", ProfileID: "p", AvgFPS: 200, InputSizeBytes: 3000, DurationSec: 10})
+	write("s_2_b", "j2", logging.JobRecord{Status: "failed", ProfileID: "p", AvgFPS: 10})
+	write("s_3_c", "j1", logging.JobRecord{Status: "completed", ProfileID: "p", AvgFPS: 1000})
+
+	e := newETAEstimator(context.Background(), nil)
+	e.loadHistory(logs, "s_3_c")
+	if r, ok := e.historyRate("p"); !ok || r.fps != 150 || r.bytesPerSec != 200 {
+		t.Errorf("rate=%+v, %t; want 150 fps and 200 B/s", r, ok)
+	}
+}
+
+func TestManager_SessionETA(t *testing.T) {
+	m, rec := newTestManager(t)
+	m.SetMediaProber(durationProber{})
+	dir := t.TempDir()
+
+	req := testEncodeRequest(t, dir, "a.mp4", "b.mp4", "c.mp4")
+	req.AppConfigSnapshot.MaxConcurrentJobs = 1
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second); !ok {
+		t.Fatal("session did not finish")
+	}
+
+	// Once a job is done, its speed estimates the rest.
+	estimated := false
+	for _, e := range rec.Named(events.NameSessionState) {
+		snap := e.Data.(events.SessionSnapshot)
+		if snap.CompletedJobs == 1 && snap.ETASec != nil && snap.ETAAt != "" {
+			estimated = true
+		}
+	}
+	if !estimated {
+		t.Error("no session_state with an ETA after the first job")
+	}
+	if r := readJobRecord(t, m, "job1"); r.AvgFPS != 120 || r.InputSizeBytes != 5 {
+		t.Errorf("record avg_fps=%v input_size_bytes=%d", r.AvgFPS, r.InputSizeBytes)
+	}
+}
+
+// memLedger is an EncodeLedger that fingerprints files by their whole
+// contents.
+type memLedger struct {
+	mu      sync.Mutex
+	inputs  map[string]EncodeRecord // by contents, profile ID and variant
+	outputs map[string]EncodeRecord // by contents
+}
+
+func newMemLedger() *memLedger {
+	return &memLedger{inputs: map[string]EncodeRecord{}, outputs: map[string]EncodeRecord{}}
+}
+
+func (l *memLedger) Lookup(path, profileID, variant string) (*EncodeRecord, bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if r, ok := l.outputs[string(data)]; ok {
+		return &r, true, nil
+	}
+	if r, ok := l.inputs[string(data)+"|"+profileID+"|"+variant]; ok {
+		return &r, false, nil
+	}
+	return nil, false, nil
+}
+
+func (l *memLedger) Record(r EncodeRecord) error {
+	in, err := os.ReadFile(r.InputPath)
+	if err != nil {
+		return err
+	}
+	out, err := os.ReadFile(r.OutputPath)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inputs[string(in)+"|"+r.ProfileID+"|"+r.Variant] = r
+	l.outputs[string(out)] = r
+	return nil
+}
+
+func TestManager_GracefulStopFinishesChunkedJob(t *testing.T) {
+	m, rec := newTestManager(t)
+	m.SetMediaProber(longProber{})
+	m.SetSplitFinder(longProber{})
+	m.SetSegmentJoiner(catJoiner{})
+	dir := t.TempDir()
+
+	req := testEncodeRequest(t, dir, "a_slow.mp4")
+	req.Profile.Chunks = &profile.ChunkSettings{MinDurationSec: 600, SegmentSec: 300}
+	req.AppConfigSnapshot.MaxConcurrentJobs = 2
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for !hasStarted(rec, "job1_seg01") {
+		if time.Now().After(deadline) {
+			t.Fatal("no segment started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	sessionID := m.GetSessionID()
+	if err := m.AppendJobs(sessionID, []JobInput{{JobID: "later", InputPath: filepath.Join(dir, "a_slow.mp4")}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RequestGracefulStop(sessionID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second); !ok {
+		t.Fatal("session did not finish")
+	}
+
+	finished := finishedByJob(rec)
+	if f := finished["job1"]; f.Status != string(JobCompleted) {
+		t.Errorf("job1=%+v, want the job in flight finished", f)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "a_slow_encoded.mkv"))
+	if err != nil || string(data) != strings.Repeat("encoded", 4) {
+		t.Errorf("output=%q err=%v, want 4 joined segments", data, err)
+	}
+	if f := finished["later"]; f.Status != string(JobSkipped) {
+		t.Errorf("later=%+v, want a new job skipped", f)
+	}
+}
+
+func hasStarted(rec *events.RecordingSink, jobID string) bool {
+	for _, e := range rec.Named(events.NameJobStarted) {
+		if e.Data.(events.JobStarted).JobID == jobID {
+			return true
+		}
+	}
+	return false
+}
+
+func TestManager_DuplicateInputs(t *testing.T) {
+	m, rec := newTestManager(t)
+	ledger := newMemLedger()
+	m.SetEncodeLedger(ledger)
+	dir := t.TempDir()
+
+	// First session: an input named like an output is skipped, the other
+	// one is encoded and recorded.
+	req := testEncodeRequest(t, dir, "a.mp4", "old_encoded.mp4")
+	req.Profile.ID = "p1"
+	req.AppConfigSnapshot.DuplicateInputs = "skip"
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second); !ok {
+		t.Fatal("session did not finish")
+	}
+	finished := finishedByJob(rec)
+	if finished["job1"].Status != string(JobCompleted) {
+		t.Errorf("job1 status=%s, want completed", finished["job1"].Status)
+	}
+	if jf := finished["job2"]; jf.Status != string(JobSkipped) || !strings.Contains(jf.ErrorMessage, "named like an Enque output") {
+		t.Errorf("job2 status=%s error=%q, want skipped by name", jf.Status, jf.ErrorMessage)
+	}
+	if len(ledger.inputs) != 1 {
+		t.Fatalf("ledger inputs=%v, want a.mp4", ledger.inputs)
+	}
+
+	// Second session: a renamed copy of a.mp4 and its renamed output are
+	// skipped; the copy is encoded with another profile.
+	rec.Reset()
+	if err := os.Rename(filepath.Join(dir, "a_encoded.mkv"), filepath.Join(dir, "renamed.mkv")); err != nil {
+		t.Fatal(err)
+	}
+	req = testEncodeRequest(t, dir, "copy.mp4", "other.mp4")
+	req.Jobs = append(req.Jobs, JobInput{JobID: "job3", InputPath: filepath.Join(dir, "renamed.mkv")})
+	req.Jobs[1].Profile = &profile.Profile{ID: "p2", EncoderType: "nvencc", OutputContainer: "mkv"}
+	req.Profile.ID = "p1"
+	req.AppConfigSnapshot.DuplicateInputs = "skip"
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second); !ok {
+		t.Fatal("session did not finish")
+	}
+	finished = finishedByJob(rec)
+	for jobID, want := range map[string]string{
+		"job1": "already encoded with this profile",
+		"job2": "",
+		"job3": "input is the output of job job1",
+	} {
+		jf := finished[jobID]
+		switch {
+		case want == "" && jf.Status != string(JobCompleted):
+			t.Errorf("%s status=%s error=%q, want completed", jobID, jf.Status, jf.ErrorMessage)
+		case want != "" && (jf.Status != string(JobSkipped) || !strings.Contains(jf.ErrorMessage, want)):
+			t.Errorf("%s status=%s error=%q, want skipped with %q", jobID, jf.Status, jf.ErrorMessage, want)
+		}
+	}
+	warned := map[string]bool{}
+	for _, e := range rec.Named(events.NameWarning) {
+		if msg := e.Data.(events.Message); strings.HasSuffix(msg.Message, "; skipping") {
+			warned[msg.JobID] = true
+		}
+	}
+	if !warned["job1"] || !warned["job3"] || len(warned) != 2 {
+		t.Errorf("skip warnings for %v, want job1 and job3", warned)
+	}
+
+	// Third session: duplicates, appended ones too, are only warned about.
+	rec.Reset()
+	req = testEncodeRequest(t, dir, "b_slow.mp4")
+	req.Profile.ID = "p1"
+	req.AppConfigSnapshot.DuplicateInputs = "warn"
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AppendJobs(m.GetSessionID(), []JobInput{{JobID: "again", InputPath: filepath.Join(dir, "copy.mp4")}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second); !ok {
+		t.Fatal("session did not finish")
+	}
+	finished = finishedByJob(rec)
+	for _, jobID := range []string{"job1", "again"} {
+		if jf := finished[jobID]; jf.Status != string(JobCompleted) {
+			t.Errorf("%s status=%s, want completed", jobID, jf.Status)
+		}
+		var warning string
+		for _, e := range rec.Named(events.NameWarning) {
+			if msg := e.Data.(events.Message); msg.JobID == jobID {
+				warning = msg.Message
+			}
+		}
+		if !strings.Contains(warning, "already encoded with this profile") || strings.Contains(warning, "skipping") {
+			t.Errorf("%s warning=%q", jobID, warning)
+		}
+	}
+
+	// Fourth session: each variant is checked and recorded on its own, so
+	// the earlier encode with the profile does not skip them; a second
+	// run of the ladder skips both.
+	for _, want := range []JobStatus{JobCompleted, JobSkipped} {
+		rec.Reset()
+		req = testEncodeRequest(t, dir, "ladder.mp4")
+		req.Profile.ID = "p1"
+		req.AppConfigSnapshot.DuplicateInputs = "skip"
+		req.Jobs[0].Variants = []OutputVariant{{Name: "1080p", OutputRes: "1920x-2"}, {Name: "720p", OutputRes: "1280x-2"}}
+		if err := m.StartEncode(req); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second); !ok {
+			t.Fatal("session did not finish")
+		}
+		finished = finishedByJob(rec)
+		for _, jobID := range []string{"job1_1080p", "job1_720p"} {
+			if jf := finished[jobID]; jf.Status != string(want) {
+				t.Errorf("%s status=%s error=%q, want %s", jobID, jf.Status, jf.ErrorMessage, want)
+			}
+		}
+	}
+	for _, variant := range []string{"1080p", "720p"} {
+		if r, ok := ledger.inputs["input|p1|"+variant]; !ok || r.JobID != "job1_"+variant {
+			t.Errorf("ledger %s=%+v, want its own entry", variant, r)
+		}
+	}
+}
+
+func TestManager_DuplicateInputsInBatch(t *testing.T) {
+	m, rec := newTestManager(t)
+	dir := t.TempDir()
+
+	req := testEncodeRequest(t, dir, "a.mp4", "c_x.mp4", "d_encoded_1080p.mp4")
+	req.Profile.ID = "p1"
+	req.AppConfigSnapshot.DuplicateInputs = "skip"
+	req.AppConfigSnapshot.MaxConcurrentJobs = 1
+	req.Jobs[1].Output = &OutputOverride{NameTemplate: "{name}_x.{ext}"}
+	req.Jobs[2].Variants = []OutputVariant{{Name: "1080p"}}
+	req.Jobs = append(req.Jobs, JobInput{JobID: "again", InputPath: req.Jobs[0].InputPath})
+	if err := m.StartEncode(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.WaitFor(events.NameSessionFinished, 30*time.Second); !ok {
+		t.Fatal("session did not finish")
+	}
+
+	finished := finishedByJob(rec)
+	for jobID, want := range map[string]string{
+		"job1":       "",
+		"job2":       "named like an Enque output",
+		"job3_1080p": "named like an Enque output",
+		"again":      "also encoded by job job1",
+	} {
+		jf := finished[jobID]
+		switch {
+		case want == "" && jf.Status != string(JobCompleted):
+			t.Errorf("%s status=%s error=%q, want completed", jobID, jf.Status, jf.ErrorMessage)
+		case want != "" && (jf.Status != string(JobSkipped) || !strings.Contains(jf.ErrorMessage, want)):
+			t.Errorf("%s status=%s error=%q, want skipped with %q", jobID, jf.Status, jf.ErrorMessage, want)
+		}
+	}
+}
+
+func TestOutputNamePattern(t *testing.T) {
+	tests := []struct {
+		template, name string
+		want           bool
+	}{
+		{"", "movie_encoded.mkv", true},
+		{"{name}_encoded.{ext}", "Movie_ENCODED.MP4", true},
+		{"{name}_encoded.{ext}", "movie_encoded_001.mkv", true},
+		{"{name}_encoded.{ext}", "movie.mkv", false},
+		{"{name}_encoded.{ext}", "my_encoded_video.mkv", false},
+		{"{name}_encoded.{ext}", "_encoded.mkv", false},
+		{"[HEVC] {name}.{ext}", "[HEVC] movie.mkv", true},
+		{"[HEVC] {name}.{ext}", "movie.mkv", false},
+		{"{name}.{ext}", "movie.mkv", false},
+	}
+	for _, tt := range tests {
+		re := outputNamePattern(tt.template)
+		if got := re != nil && re.MatchString(tt.name); got != tt.want {
+			t.Errorf("%q %q: got %v, want %v", tt.template, tt.name, got, tt.want)
+		}
+	}
+}
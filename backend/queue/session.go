@@ -1,9 +1,14 @@
 package queue
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
+	"github.com/yuta/enque/backend/config"
+	"github.com/yuta/enque/backend/encoder"
+	"github.com/yuta/enque/backend/events"
+	"github.com/yuta/enque/backend/logging"
 	"github.com/yuta/enque/backend/profile"
 )
 
@@ -42,8 +47,41 @@ type QueueJob struct {
 	ErrorMessage   string    `json:"error_message"`
 	TempOutputPath string    `json:"temp_output_path"`
 	FinalOutputPath string   `json:"final_output_path"`
+	TimeoutReason  string    `json:"timeout_reason,omitempty"`
+	ProfileID      string    `json:"profile_id,omitempty"`
+	// ParentJobID and Variant are set on the sub-jobs of a job with
+	// output variants.
+	ParentJobID string `json:"parent_job_id,omitempty"`
+	Variant     string `json:"variant,omitempty"`
+	// Segment is the 1-based chunk number of a segment of a chunked job;
+	// ParentJobID names the job.
+	Segment int `json:"segment,omitempty"`
+	// Crop is the black-bar detection of a job with auto_crop or a
+	// crop of its own, once it started.
+	Crop *logging.CropResult `json:"crop,omitempty"`
 	StartedAt      time.Time `json:"started_at"`
 	FinishedAt     time.Time `json:"finished_at"`
+
+	// Per-job overrides from JobInput; nil means the session defaults.
+	profile *profile.Profile
+	output  *OutputOverride
+	crop    *profile.FilterRect
+	// targetSize is the plan of a target-size job once it started.
+	targetSize *encoder.TargetSizePlan
+	// hdr is the HDR plan of a job with hdr_mode once it started.
+	hdr *logging.HDRResult
+	// loudness is the loudness normalization of a job once it ran.
+	loudness *logging.LoudnessResult
+	// variant is the output variant of a variant sub-job.
+	variant *OutputVariant
+	// chunks is set once a job is split into segments; segment is set on
+	// each of its segments.
+	chunks  *chunkState
+	segment *segmentState
+	// percent, fps and etaSec are the latest reported progress.
+	percent float64
+	fps     float64
+	etaSec  *float64
 }
 
 // EncodeRequest is the input from StartEncode (design doc 6.2).
@@ -54,9 +92,58 @@ type EncodeRequest struct {
 }
 
 // JobInput is a single job in the StartEncode request.
+// Profile and Output optionally override the session profile and output
+// settings for this job only (e.g. jobs added by a watch folder).
 type JobInput struct {
-	JobID     string `json:"job_id"`
-	InputPath string `json:"input_path"`
+	JobID     string           `json:"job_id"`
+	InputPath string           `json:"input_path"`
+	Profile   *profile.Profile `json:"profile,omitempty"`
+	Output    *OutputOverride  `json:"output,omitempty"`
+	// Variants fan the job out into one sub-job per output variant.
+	Variants []OutputVariant `json:"variants,omitempty"`
+	// Crop is a crop confirmed ahead (e.g. with DetectCrop); it replaces
+	// the detection of a profile with auto_crop.
+	Crop *profile.FilterRect `json:"crop,omitempty"`
+
+	// Set on the sub-jobs expanded from Variants, and on the segments of
+	// a chunked job.
+	parentJobID string
+	variant     *OutputVariant
+	segment     *segmentState
+}
+
+// OutputOverride replaces the non-empty output settings of the session
+// config snapshot for one job.
+type OutputOverride struct {
+	FolderMode    string `json:"output_folder_mode,omitempty"`
+	FolderPath    string `json:"output_folder_path,omitempty"`
+	NameTemplate  string `json:"output_name_template,omitempty"`
+	OverwriteMode string `json:"overwrite_mode,omitempty"`
+}
+
+func newQueueJob(j JobInput) *QueueJob {
+	job := &QueueJob{
+		JobID:     j.JobID,
+		InputPath: j.InputPath,
+		Status:    JobPending,
+		profile:   j.Profile,
+		output:    j.Output,
+		crop:      j.Crop,
+
+		ParentJobID: j.parentJobID,
+		variant:     j.variant,
+		segment:     j.segment,
+	}
+	if j.variant != nil {
+		job.Variant = j.variant.Name
+	}
+	if j.segment != nil {
+		job.Segment = j.segment.chunk.Index
+	}
+	if j.Profile != nil {
+		job.ProfileID = j.Profile.ID
+	}
+	return job
 }
 
 // AppConfigSnapshot captures config at encode start time.
@@ -75,6 +162,38 @@ type AppConfigSnapshot struct {
 	OutputContainer      string `json:"output_container"`
 	OverwriteMode        string `json:"overwrite_mode"`
 	NVEncCPath           string `json:"nvencc_path"`
+	FFprobePath          string `json:"ffprobe_path"`
+	FFmpegPath           string `json:"ffmpeg_path"`
+	// DuplicateInputs is what to do with added inputs that were already
+	// encoded with the same profile: "warn", "skip", or "allow" (also when
+	// empty).
+	DuplicateInputs string `json:"duplicate_inputs,omitempty"`
+	// Unattended sessions have nobody to answer prompts.
+	Unattended bool `json:"unattended,omitempty"`
+}
+
+// NewAppConfigSnapshot builds a snapshot from the persisted AppConfig, for
+// callers that start sessions without going through the frontend.
+func NewAppConfigSnapshot(cfg config.AppConfig) AppConfigSnapshot {
+	return AppConfigSnapshot{
+		MaxConcurrentJobs:    cfg.MaxConcurrentJobs,
+		OnError:              cfg.OnError,
+		DecoderFallback:      cfg.DecoderFallback,
+		KeepFailedTemp:       cfg.KeepFailedTemp,
+		NoOutputTimeoutSec:   cfg.NoOutputTimeoutSec,
+		NoProgressTimeoutSec: cfg.NoProgressTimeoutSec,
+		PostCompleteAction:   cfg.PostCompleteAction,
+		PostCompleteCommand:  cfg.PostCompleteCommand,
+		OutputFolderMode:     cfg.OutputFolderMode,
+		OutputFolderPath:     cfg.OutputFolderPath,
+		OutputNameTemplate:   cfg.OutputNameTemplate,
+		OutputContainer:      cfg.OutputContainer,
+		OverwriteMode:        cfg.OverwriteMode,
+		NVEncCPath:           cfg.NVEncCPath,
+		FFprobePath:          cfg.FFprobePath,
+		FFmpegPath:           cfg.FFmpegPath,
+		DuplicateInputs:      cfg.DuplicateInputs,
+	}
 }
 
 // Session manages state for a single encoding session.
@@ -90,10 +209,24 @@ type Session struct {
 	EncoderType    string
 	AppCfg         AppConfigSnapshot
 
+	// profile is the session profile, for expanding appended jobs.
+	profile profile.Profile
+	// eta estimates when the session finishes; nil until StartEncode
+	// sets it up.
+	eta *etaEstimator
+
 	// Skip set for individual job skipping
 	SkipSet map[string]bool
 
-	// Counters
+	// Dispatch state: jobs not yet handed to a worker, jobs handed out but
+	// not finished, and whether the dispatcher has stopped accepting jobs.
+	queued         []*QueueJob
+	inFlight       int
+	dispatchClosed bool
+	wake           chan struct{}
+
+	// Counters, of the jobs the user added: the segments of a chunked job
+	// are not counted
 	TotalJobs     int
 	CompletedJobs int
 	FailedJobs    int
@@ -106,24 +239,138 @@ type Session struct {
 func NewSession(id string, jobs []JobInput, encoderType string, appCfg AppConfigSnapshot) *Session {
 	queueJobs := make([]*QueueJob, len(jobs))
 	for i, j := range jobs {
-		queueJobs[i] = &QueueJob{
-			JobID:     j.JobID,
-			InputPath: j.InputPath,
-			Status:    JobPending,
-		}
+		queueJobs[i] = newQueueJob(j)
 	}
+	queued := make([]*QueueJob, len(queueJobs))
+	copy(queued, queueJobs)
 	return &Session{
 		ID:          id,
 		State:       StateRunning,
 		Jobs:        queueJobs,
 		StartedAt:   time.Now(),
-		TotalJobs:   len(jobs),
+		TotalJobs:   countJobs(queueJobs),
 		EncoderType: encoderType,
 		AppCfg:      appCfg,
 		SkipSet:     make(map[string]bool),
+		queued:      queued,
+		wake:        make(chan struct{}, 1),
 	}
 }
 
+// AppendJobs adds jobs to a running session. It fails once the session is
+// stopping or the dispatcher has already drained and closed.
+func (s *Session) AppendJobs(jobs []JobInput) ([]*QueueJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dispatchClosed || s.State != StateRunning {
+		return nil, fmt.Errorf("session %s is no longer accepting jobs", s.ID)
+	}
+	return s.appendLocked(jobs)
+}
+
+// appendSegments adds the segments of a chunked job in flight. Unlike
+// AppendJobs it accepts them while the session stops gracefully, as that
+// only keeps new jobs from starting.
+func (s *Session) appendSegments(jobs []JobInput) ([]*QueueJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dispatchClosed || s.State != StateRunning && s.State != StateStopping {
+		return nil, fmt.Errorf("session %s is no longer accepting jobs", s.ID)
+	}
+	return s.appendLocked(jobs)
+}
+
+func (s *Session) appendLocked(jobs []JobInput) ([]*QueueJob, error) {
+	for _, j := range jobs {
+		for _, existing := range s.Jobs {
+			if existing.JobID == j.JobID {
+				return nil, fmt.Errorf("duplicate job_id: %s", j.JobID)
+			}
+		}
+	}
+
+	added := make([]*QueueJob, len(jobs))
+	for i, j := range jobs {
+		added[i] = newQueueJob(j)
+	}
+	s.Jobs = append(s.Jobs, added...)
+	s.queued = append(s.queued, added...)
+	s.TotalJobs += countJobs(added)
+	s.signalLocked()
+	return added, nil
+}
+
+// countJobs counts jobs, leaving out the segments of chunked jobs.
+func countJobs(jobs []*QueueJob) int {
+	n := 0
+	for _, j := range jobs {
+		if j.segment == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// nextQueued pops the next job for dispatch, or returns nil if none is queued.
+func (s *Session) nextQueued() *QueueJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queued) == 0 {
+		return nil
+	}
+	job := s.queued[0]
+	s.queued = s.queued[1:]
+	s.inFlight++
+	return job
+}
+
+// releaseJob records that a worker is done with a dispatched job.
+func (s *Session) releaseJob() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight--
+	s.signalLocked()
+}
+
+// closeDispatchIfIdle closes dispatch when nothing is queued or in flight.
+// Once closed, AppendJobs is rejected.
+func (s *Session) closeDispatchIfIdle() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queued) == 0 && s.inFlight == 0 {
+		s.dispatchClosed = true
+	}
+	return s.dispatchClosed
+}
+
+func (s *Session) signalLocked() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// withLock runs fn while holding the session write lock. Workers use it to
+// mutate QueueJob fields that readers access through JobsSnapshot.
+func (s *Session) withLock(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn()
+}
+
+// JobsSnapshot returns copies of all jobs in session order.
+func (s *Session) JobsSnapshot() []QueueJob {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]QueueJob, len(s.Jobs))
+	for i, j := range s.Jobs {
+		out[i] = *j
+	}
+	return out
+}
+
 // RequestStop sets the stop flag (graceful).
 func (s *Session) RequestStop() {
 	s.mu.Lock()
@@ -182,6 +429,9 @@ func (s *Session) MarkJobStatus(jobID string, status JobStatus, exitCode *int, e
 			j.ExitCode = exitCode
 			j.ErrorMessage = errMsg
 			j.FinishedAt = time.Now()
+			if j.segment != nil {
+				break
+			}
 
 			switch status {
 			case JobCompleted:
@@ -222,7 +472,7 @@ func (s *Session) RunningJobs() int {
 func (s *Session) runningJobsLocked() int {
 	count := 0
 	for _, j := range s.Jobs {
-		if j.Status == JobRunning {
+		if j.Status == JobRunning && j.segment == nil {
 			count++
 		}
 	}
@@ -230,22 +480,31 @@ func (s *Session) runningJobsLocked() int {
 }
 
 // Snapshot returns session state for events.
-func (s *Session) Snapshot() map[string]interface{} {
+func (s *Session) Snapshot() events.SessionSnapshot {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return map[string]interface{}{
-		"session_id":      s.ID,
-		"state":           s.State,
-		"encoder_type":    s.EncoderType,
-		"started_at":      s.StartedAt.Format(time.RFC3339),
-		"total_jobs":      s.TotalJobs,
-		"completed_jobs":  s.CompletedJobs,
-		"running_jobs":    s.runningJobsLocked(),
-		"failed_jobs":     s.FailedJobs,
-		"cancelled_jobs":  s.CancelledJobs,
-		"timeout_jobs":    s.TimeoutJobs,
-		"skipped_jobs":    s.SkippedJobs,
-		"stop_requested":  s.StopRequested,
-		"abort_requested": s.AbortRequested,
+	snap := events.SessionSnapshot{
+		SessionID:      s.ID,
+		State:          string(s.State),
+		EncoderType:    s.EncoderType,
+		StartedAt:      s.StartedAt.Format(time.RFC3339),
+		TotalJobs:      s.TotalJobs,
+		CompletedJobs:  s.CompletedJobs,
+		RunningJobs:    s.runningJobsLocked(),
+		FailedJobs:     s.FailedJobs,
+		CancelledJobs:  s.CancelledJobs,
+		TimeoutJobs:    s.TimeoutJobs,
+		SkippedJobs:    s.SkippedJobs,
+		StopRequested:  s.StopRequested,
+		AbortRequested: s.AbortRequested,
+	}
+	now := time.Now()
+	est := s.estimateLocked(now)
+	if est.sec != nil {
+		snap.ETASec = est.sec
+		snap.ETAAt = now.Add(time.Duration(*est.sec * float64(time.Second))).Format(time.RFC3339)
 	}
+	snap.ThroughputFPS = est.throughput
+	snap.UnestimatedJobs = est.unestimated
+	return snap
 }
@@ -0,0 +1,132 @@
+package queue
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/yuta/enque/backend/encoder"
+	"github.com/yuta/enque/backend/profile"
+)
+
+// OutputVariant is one rendition of a job's input, e.g. one rung of an
+// encoding ladder. Zero fields keep the job's profile settings.
+type OutputVariant struct {
+	Name      string  `json:"name"`                 // e.g. "1080p"; also names the sub-job
+	Suffix    string  `json:"suffix,omitempty"`     // added to the output name; default "_" + name
+	OutputRes string  `json:"output_res,omitempty"` // e.g. "1920x-2"
+	RateValue float64 `json:"rate_value,omitempty"`
+}
+
+var variantNameRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// expandVariants replaces every job with variants by one sub-job per
+// variant. A sub-job's ID is the parent ID plus "_" and the variant name;
+// it encodes the job's profile (or sessionProfile) with the variant's
+// overrides, and names its output with the variant's suffix.
+func expandVariants(jobs []JobInput, sessionProfile profile.Profile, nameTemplate string) ([]JobInput, error) {
+	out := make([]JobInput, 0, len(jobs))
+	for _, j := range jobs {
+		if len(j.Variants) == 0 {
+			out = append(out, j)
+			continue
+		}
+		names := make(map[string]bool, len(j.Variants))
+		suffixes := make(map[string]bool, len(j.Variants))
+		for _, v := range j.Variants {
+			if !variantNameRe.MatchString(v.Name) {
+				return nil, fmt.Errorf("%s: job %s: variant name %q must be 1..32 letters, digits, '-' or '_'", encoder.ErrValidation, j.JobID, v.Name)
+			}
+			suffix := variantSuffix(v)
+			if names[v.Name] || suffixes[suffix] {
+				return nil, fmt.Errorf("%s: job %s: duplicate variant %q", encoder.ErrValidation, j.JobID, v.Name)
+			}
+			if v.RateValue < 0 {
+				return nil, fmt.Errorf("%s: job %s: variant %s: rate_value must be >= 0", encoder.ErrValidation, j.JobID, v.Name)
+			}
+			names[v.Name], suffixes[suffix] = true, true
+
+			base := sessionProfile
+			if j.Profile != nil {
+				base = *j.Profile
+			}
+			prof := applyVariant(base, v)
+
+			output := OutputOverride{}
+			if j.Output != nil {
+				output = *j.Output
+			}
+			tpl := nameTemplate
+			if output.NameTemplate != "" {
+				tpl = output.NameTemplate
+			}
+			output.NameTemplate = suffixTemplate(tpl, suffix)
+
+			out = append(out, JobInput{
+				JobID:       j.JobID + "_" + v.Name,
+				InputPath:   j.InputPath,
+				Profile:     &prof,
+				Output:      &output,
+				Crop:        j.Crop,
+				parentJobID: j.JobID,
+				variant:     &v,
+			})
+		}
+	}
+	return out, nil
+}
+
+// applyVariant returns p with the variant's overrides.
+func applyVariant(p profile.Profile, v OutputVariant) profile.Profile {
+	if v.OutputRes != "" {
+		p.OutputRes = v.OutputRes
+	}
+	if v.RateValue > 0 {
+		p.RateValue = v.RateValue
+	}
+	return p
+}
+
+func variantSuffix(v OutputVariant) string {
+	if v.Suffix != "" {
+		return v.Suffix
+	}
+	return "_" + v.Name
+}
+
+// suffixTemplate inserts suffix before the extension of an output name
+// template: "{name}_encoded.{ext}" becomes "{name}_encoded_1080p.{ext}".
+func suffixTemplate(tpl, suffix string) string {
+	if tpl == "" {
+		tpl = "{name}_encoded.{ext}"
+	}
+	if i := strings.LastIndex(tpl, ".{ext}"); i >= 0 {
+		return tpl[:i] + suffix + tpl[i:]
+	}
+	return tpl + suffix
+}
+
+// groupPercentLocked returns the combined progress of the sub-jobs of a
+// parent job: finished siblings count as done, pending ones as not
+// started. The caller holds the session lock.
+func (s *Session) groupPercentLocked(parentJobID string) float64 {
+	var sum float64
+	n := 0
+	for _, j := range s.Jobs {
+		if j.ParentJobID != parentJobID {
+			continue
+		}
+		n++
+		switch j.Status {
+		case JobPending:
+		case JobRunning:
+			sum += j.percent
+		default:
+			sum += 100
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
@@ -3,8 +3,10 @@ package queue
 import (
 	"context"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/yuta/enque/backend/config"
@@ -12,6 +14,7 @@ import (
 	"github.com/yuta/enque/backend/events"
 	"github.com/yuta/enque/backend/logging"
 	"github.com/yuta/enque/backend/metadata"
+	"github.com/yuta/enque/backend/probe"
 	"github.com/yuta/enque/backend/profile"
 )
 
@@ -28,8 +31,14 @@ type Worker struct {
 	prof          profile.Profile
 	appCfg        AppConfigSnapshot
 	encoderPath   string
+	prober        MediaProber
+	cropper       CropDetector
+	meter         LoudnessMeter
+	splitter      SplitFinder
+	joiner        SegmentJoiner
 	cancelJobFunc context.CancelFunc
-	cancelJobMu   chan struct{} // Protects cancelJobFunc access
+	cancelJobMu   chan struct{} // Protects cancelJobFunc and currentJobID access
+	currentJobID  string
 }
 
 // WorkerConfig holds dependencies for creating a Worker.
@@ -45,6 +54,11 @@ type WorkerConfig struct {
 	Profile     profile.Profile
 	AppConfig   AppConfigSnapshot
 	EncoderPath string
+	Prober      MediaProber
+	Cropper     CropDetector
+	Meter       LoudnessMeter
+	Splitter    SplitFinder
+	Joiner      SegmentJoiner
 }
 
 // NewWorker creates a worker with the given config.
@@ -61,6 +75,11 @@ func NewWorker(cfg WorkerConfig) *Worker {
 		prof:        cfg.Profile,
 		appCfg:      cfg.AppConfig,
 		encoderPath: cfg.EncoderPath,
+		prober:      cfg.Prober,
+		cropper:     cfg.Cropper,
+		meter:       cfg.Meter,
+		splitter:    cfg.Splitter,
+		joiner:      cfg.Joiner,
 		cancelJobMu: make(chan struct{}, 1),
 	}
 }
@@ -68,21 +87,61 @@ func NewWorker(cfg WorkerConfig) *Worker {
 // Run processes jobs from the channel until it's closed or the session stops.
 func (w *Worker) Run(ctx context.Context, jobs <-chan *QueueJob) {
 	for job := range jobs {
-		if w.session.IsStopping() || w.session.ShouldSkipJob(job.JobID) {
-			w.session.MarkJobStatus(job.JobID, JobSkipped, nil, "skipped by user")
-			w.emitJobFinished(job, JobSkipped, nil, "skipped by user")
-			continue
-		}
+		w.runJob(ctx, job)
+		w.session.releaseJob()
+	}
+}
 
-		w.executeJob(ctx, job)
+func (w *Worker) runJob(ctx context.Context, job *QueueJob) {
+	// A graceful stop keeps new jobs from starting; the segments of a job
+	// in flight still run, unless the session aborts or the job is skipped.
+	stopped := w.session.IsStopping()
+	if job.segment != nil {
+		stopped = w.session.IsAborting() || w.session.ShouldSkipJob(job.ParentJobID)
+	}
+	if stopped || w.session.ShouldSkipJob(job.JobID) {
+		w.session.MarkJobStatus(job.JobID, JobSkipped, nil, "skipped by user")
+		w.emitJobFinished(job, JobSkipped, nil, "skipped by user")
+		w.finishSegment(ctx, job)
+		return
+	}
+	if reason := w.checkInput(job); reason != "" {
+		w.session.MarkJobStatus(job.JobID, JobSkipped, nil, reason)
+		w.emitJobFinished(job, JobSkipped, nil, reason)
+		return
+	}
 
-		// Check on_error=stop policy
-		if job.Status == JobFailed && w.appCfg.OnError == "stop" {
-			w.session.RequestStop()
-		}
+	w.setCurrentJob(job.JobID)
+	defer w.setCurrentJob("")
+
+	w.executeJob(ctx, job)
+	w.finishSegment(ctx, job)
+
+	// Check on_error=stop policy
+	if w.jobStatus(job) == JobFailed && w.appCfg.OnError == "stop" {
+		w.session.RequestStop()
 	}
 }
 
+// CurrentJobID returns the ID of the job this worker is executing, if any.
+func (w *Worker) CurrentJobID() string {
+	w.cancelJobMu <- struct{}{}
+	defer func() { <-w.cancelJobMu }()
+	return w.currentJobID
+}
+
+func (w *Worker) setCurrentJob(jobID string) {
+	w.cancelJobMu <- struct{}{}
+	w.currentJobID = jobID
+	<-w.cancelJobMu
+}
+
+func (w *Worker) jobStatus(job *QueueJob) JobStatus {
+	var status JobStatus
+	w.session.withLock(func() { status = job.Status })
+	return status
+}
+
 // CancelCurrentJob cancels the currently running job on this worker.
 func (w *Worker) CancelCurrentJob() {
 	w.cancelJobMu <- struct{}{}
@@ -92,17 +151,52 @@ func (w *Worker) CancelCurrentJob() {
 	<-w.cancelJobMu
 }
 
-func (w *Worker) executeJob(ctx context.Context, job *QueueJob) {
-	// Resolve output paths
-	outputCfg := OutputConfig{
+// jobProfile returns the profile a job is encoded with.
+func (w *Worker) jobProfile(job *QueueJob) profile.Profile {
+	if job.profile != nil {
+		return *job.profile
+	}
+	return w.prof
+}
+
+// resolveOutput reserves the output paths of a job. A segment of a chunked
+// job writes to its own file in the job's chunk folder.
+func (w *Worker) resolveOutput(job *QueueJob, prof profile.Profile) (*ResolveResult, error) {
+	if seg := job.segment; seg != nil {
+		return &ResolveResult{TempPath: seg.path, FinalPath: seg.path}, nil
+	}
+	return w.resolver.Resolve(job.InputPath, w.outputConfig(job, prof))
+}
+
+// outputConfig merges the job's output override into the session settings.
+func (w *Worker) outputConfig(job *QueueJob, prof profile.Profile) OutputConfig {
+	cfg := OutputConfig{
 		FolderMode:    w.appCfg.OutputFolderMode,
 		FolderPath:    w.appCfg.OutputFolderPath,
 		NameTemplate:  w.appCfg.OutputNameTemplate,
-		Container:     w.prof.OutputContainer,
+		Container:     prof.OutputContainer,
 		OverwriteMode: w.appCfg.OverwriteMode,
 	}
+	if o := job.output; o != nil {
+		if o.FolderMode != "" {
+			cfg.FolderMode = o.FolderMode
+			cfg.FolderPath = o.FolderPath
+		}
+		if o.NameTemplate != "" {
+			cfg.NameTemplate = o.NameTemplate
+		}
+		if o.OverwriteMode != "" {
+			cfg.OverwriteMode = o.OverwriteMode
+		}
+	}
+	return cfg
+}
+
+func (w *Worker) executeJob(ctx context.Context, job *QueueJob) {
+	prof := w.jobProfile(job)
 
-	resolved, err := w.resolver.Resolve(job.InputPath, outputCfg)
+	// Resolve output paths
+	resolved, err := w.resolveOutput(job, prof)
 	if err != nil {
 		exitCode := -1
 		w.session.MarkJobStatus(job.JobID, JobSkipped, &exitCode, err.Error())
@@ -110,28 +204,31 @@ func (w *Worker) executeJob(ctx context.Context, job *QueueJob) {
 		return
 	}
 
-	job.TempOutputPath = resolved.TempPath
-	job.FinalOutputPath = resolved.FinalPath
-
 	// Get input file size
+	var inputSize int64
 	if info, err := os.Stat(job.InputPath); err == nil {
-		job.InputSizeBytes = info.Size()
+		inputSize = info.Size()
 	}
 
 	// Mark as running
-	job.Status = JobRunning
-	job.WorkerID = w.id
-	job.StartedAt = time.Now()
+	w.session.withLock(func() {
+		job.TempOutputPath = resolved.TempPath
+		job.FinalOutputPath = resolved.FinalPath
+		job.InputSizeBytes = inputSize
+		job.Status = JobRunning
+		job.WorkerID = w.id
+		job.StartedAt = time.Now()
+	})
 
 	w.emitJobStarted(job)
 
 	// Handle overwrite confirmation (ask mode)
 	if resolved.NeedsOverwrite {
 		// Emit event to frontend for user decision
-		w.emitter.JobNeedsOverwrite(map[string]interface{}{
-			"session_id":        w.session.ID,
-			"job_id":            job.JobID,
-			"final_output_path": resolved.FinalPath,
+		w.emitter.JobNeedsOverwrite(events.JobNeedsOverwrite{
+			SessionID:       w.session.ID,
+			JobID:           job.JobID,
+			FinalOutputPath: resolved.FinalPath,
 		})
 
 		// Wait for user response (10-minute timeout → skip)
@@ -155,8 +252,68 @@ func (w *Worker) executeJob(ctx context.Context, job *QueueJob) {
 		}
 	}
 
+	// Probe the input once for the planning steps below
+	var media probe.MediaInfo
+	var probeErr error
+	if steps := probeSteps(job, prof); len(steps) > 0 {
+		media, probeErr = w.probeInput(ctx, job, steps)
+	}
+
+	// Crop black bars
+	if prof.AutoCrop == "apply" || prof.AutoCrop == "confirm" || job.crop != nil {
+		var keep bool
+		prof, keep = w.autoCrop(ctx, job, prof, media, probeErr)
+		status, msg := JobSkipped, "crop skipped by user"
+		if ctx.Err() != nil {
+			keep, status, msg = false, JobCancelled, "cancelled while waiting for crop"
+		}
+		if !keep {
+			exitCode := -1
+			w.session.MarkJobStatus(job.JobID, status, &exitCode, msg)
+			w.emitJobFinished(job, status, &exitCode, msg)
+			w.resolver.Release(resolved.FinalPath)
+			return
+		}
+	}
+
+	// Match the profile to an HDR input
+	if prof.HDRMode != "" && prof.HDRMode != "off" {
+		prof, err = w.planHDR(job, prof, media, probeErr)
+	}
+
+	// Split long inputs into segments for the worker pool
+	var chunks []encoder.Chunk
+	if err == nil && prof.Chunks != nil {
+		chunks = w.planChunks(ctx, job, prof, media, probeErr)
+	}
+
+	// Map audio and subtitle tracks
+	if err == nil && prof.Tracks != nil {
+		prof = w.planTracks(job, prof, media, probeErr)
+	}
+
+	// Measure loudness for normalization
+	if err == nil && prof.Loudness != nil {
+		prof = w.normalizeLoudness(ctx, job, prof, media, probeErr)
+	}
+
+	// Turn a target size into bitrates for this input
+	if err == nil && prof.RateControl == encoder.RateControlTargetSize {
+		prof, err = w.planTargetSize(job, prof, media, probeErr)
+	}
+
+	// Queue the segments; the job finishes when they are joined
+	if err == nil && chunks != nil {
+		if err = w.splitJob(job, prof, resolved, chunks); err == nil {
+			return
+		}
+	}
+
 	// Build args
-	args, err := w.adapter.BuildArgs(w.prof, job.InputPath, resolved.TempPath)
+	var args []string
+	if err == nil {
+		args, err = w.adapter.BuildArgs(prof, job.InputPath, resolved.TempPath)
+	}
 	if err != nil {
 		exitCode := -1
 		w.session.MarkJobStatus(job.JobID, JobFailed, &exitCode, err.Error())
@@ -209,32 +366,38 @@ func (w *Worker) executeJob(ctx context.Context, job *QueueJob) {
 
 	// Handle result
 	status := w.determineJobStatus(result, jobCtx)
+	if result.TimedOut {
+		w.session.withLock(func() { job.TimeoutReason = result.TimeoutReason })
+	}
+	if job.segment != nil && w.retrySegment(job, status, resolved) {
+		return
+	}
 	w.session.MarkJobStatus(job.JobID, status, &result.ExitCode, result.ErrorMessage)
 
 	// Post-process
 	if status == JobCompleted {
-		w.postProcessSuccess(job, resolved)
+		w.postProcessSuccess(job, prof, resolved)
 	} else {
 		w.postProcessFailure(job, resolved, status)
 	}
 
 	// Try decoder fallback if applicable
 	if status == JobFailed && w.appCfg.DecoderFallback && w.adapter.SupportsDecoderFallback() {
-		if w.prof.Decoder == "avhw" {
-			w.retryWithFallback(ctx, job, resolved, logsDir)
+		if prof.Decoder == "avhw" {
+			w.retryWithFallback(ctx, job, prof, resolved, logsDir)
 			return
 		}
 	}
 
 	// Save job record
-	w.saveJobRecord(job, resolved, args, result, status, false, "")
+	w.saveJobRecord(job, prof, resolved, args, result, status, false, "")
 
 	w.emitJobFinished(job, status, &result.ExitCode, result.ErrorMessage)
 }
 
-func (w *Worker) retryWithFallback(ctx context.Context, job *QueueJob, resolved *ResolveResult, logsDir string) {
+func (w *Worker) retryWithFallback(ctx context.Context, job *QueueJob, prof profile.Profile, resolved *ResolveResult, logsDir string) {
 	// Build args with avsw decoder
-	overriddenProfile := w.prof
+	overriddenProfile := prof
 	overriddenProfile.Decoder = "avsw"
 
 	args, err := w.adapter.BuildArgs(overriddenProfile, job.InputPath, resolved.TempPath)
@@ -248,10 +411,10 @@ func (w *Worker) retryWithFallback(ctx context.Context, job *QueueJob, resolved
 	}
 	defer stderrWriter.Close()
 
-	w.emitter.Warning(map[string]interface{}{
-		"session_id": w.session.ID,
-		"job_id":     job.JobID,
-		"message":    "retrying with software decoder (avsw)",
+	w.emitter.Warning(events.Message{
+		SessionID: w.session.ID,
+		JobID:     job.JobID,
+		Message:   "retrying with software decoder (avsw)",
 	})
 
 	jobCtx, cancel := context.WithCancel(ctx)
@@ -275,15 +438,18 @@ func (w *Worker) retryWithFallback(ctx context.Context, job *QueueJob, resolved
 	)
 
 	status := w.determineJobStatus(result, jobCtx)
+	if result.TimedOut {
+		w.session.withLock(func() { job.TimeoutReason = result.TimeoutReason })
+	}
 	w.session.MarkJobStatus(job.JobID, status, &result.ExitCode, result.ErrorMessage)
 
 	if status == JobCompleted {
-		w.postProcessSuccess(job, resolved)
+		w.postProcessSuccess(job, prof, resolved)
 	} else {
 		w.postProcessFailure(job, resolved, status)
 	}
 
-	w.saveJobRecord(job, resolved, args, result, status, true, "avhw -> avsw fallback")
+	w.saveJobRecord(job, prof, resolved, args, result, status, true, "avhw -> avsw fallback")
 	w.emitJobFinished(job, status, &result.ExitCode, result.ErrorMessage)
 }
 
@@ -303,23 +469,24 @@ func (w *Worker) determineJobStatus(result encoder.RunResult, ctx context.Contex
 	return JobFailed
 }
 
-func (w *Worker) postProcessSuccess(job *QueueJob, resolved *ResolveResult) {
+func (w *Worker) postProcessSuccess(job *QueueJob, prof profile.Profile, resolved *ResolveResult) {
 	// Rename temp to final
 	if err := os.Rename(resolved.TempPath, resolved.FinalPath); err != nil {
-		job.ErrorMessage = fmt.Sprintf("rename temp to final: %v", err)
+		msg := fmt.Sprintf("rename temp to final: %v", err)
+		w.session.withLock(func() { job.ErrorMessage = msg })
 	}
 
 	// Remove from temp tracker
 	w.tempTracker.Remove(resolved.TempPath)
 
 	// Restore file time from input to output (Windows only)
-	if w.prof.RestoreFileTime {
+	if prof.RestoreFileTime {
 		if err := metadata.RestoreFileTimeIfNeeded(job.InputPath, resolved.FinalPath, true); err != nil {
 			// Non-fatal, just log warning
-			w.emitter.Warning(map[string]interface{}{
-				"session_id": w.session.ID,
-				"job_id":     job.JobID,
-				"message":    fmt.Sprintf("failed to restore file time: %v", err),
+			w.emitter.Warning(events.Message{
+				SessionID: w.session.ID,
+				JobID:     job.JobID,
+				Message:   fmt.Sprintf("failed to restore file time: %v", err),
 			})
 		}
 	}
@@ -335,11 +502,17 @@ func (w *Worker) postProcessFailure(job *QueueJob, resolved *ResolveResult, stat
 	w.resolver.Release(resolved.FinalPath)
 }
 
-func (w *Worker) saveJobRecord(job *QueueJob, resolved *ResolveResult, args []string, result encoder.RunResult, status JobStatus, retryApplied bool, retryDetail string) {
+func (w *Worker) saveJobRecord(job *QueueJob, prof profile.Profile, resolved *ResolveResult, args []string, result encoder.RunResult, status JobStatus, retryApplied bool, retryDetail string) {
+	// A chunked job writes one record, listing its segments.
+	if job.segment != nil {
+		return
+	}
 	logsDir := filepath.Join(config.LogsDir(), w.session.ID)
 	record := &logging.JobRecord{
 		SchemaVersion:     1,
 		JobID:             job.JobID,
+		ParentJobID:       job.ParentJobID,
+		Variant:           job.Variant,
 		SessionID:         w.session.ID,
 		InputPath:         job.InputPath,
 		OutputPath:        resolved.FinalPath,
@@ -352,10 +525,12 @@ func (w *Worker) saveJobRecord(job *QueueJob, resolved *ResolveResult, args []st
 		ErrorMessage:      result.ErrorMessage,
 		WorkerID:          w.id,
 		AppVersion:        config.AppVersion,
-		ProfileID:         w.prof.ID,
-		ProfileName:       w.prof.Name,
-		ProfileVersion:    w.prof.Version,
-		Device:            w.prof.Device,
+		ProfileID:         prof.ID,
+		ProfileName:       prof.Name,
+		ProfileVersion:    prof.Version,
+		ProfileRevision:   prof.Revision,
+		VariantOverrides:  variantOverrides(job.variant),
+		Device:            prof.Device,
 		MaxConcurrentJobs: w.appCfg.MaxConcurrentJobs,
 		UsedJobObject:     result.UsedJobObject,
 		StartedAt:         job.StartedAt.Format(time.RFC3339),
@@ -363,66 +538,367 @@ func (w *Worker) saveJobRecord(job *QueueJob, resolved *ResolveResult, args []st
 		DurationSec:       time.Since(job.StartedAt).Seconds(),
 		RetryApplied:      retryApplied,
 		RetryDetail:       retryDetail,
+		TargetSize:        w.targetSizeResult(job, resolved, status),
+	}
+	w.session.withLock(func() {
+		record.Crop, record.HDR, record.Loudness = job.Crop, job.hdr, job.loudness
+		if job.chunks != nil {
+			record.Chunks = job.chunks.result
+		}
+		record.AvgFPS, record.InputSizeBytes = job.fps, job.InputSizeBytes
+	})
+	if w.session.eta != nil {
+		if m, ok := w.session.eta.inputMedia(job.InputPath); ok {
+			record.InputDurationSec = m.durationSec
+		}
 	}
 	record.Save(logsDir)
 }
 
-// Event emission helpers
+// variantOverrides returns what a variant sub-job's variant changed in its
+// profile, or nil for other jobs.
+func variantOverrides(v *OutputVariant) *logging.VariantOverrides {
+	if v == nil {
+		return nil
+	}
+	return &logging.VariantOverrides{OutputRes: v.OutputRes, RateValue: v.RateValue}
+}
 
-func (w *Worker) emitJobStarted(job *QueueJob) {
-	w.emitter.JobStarted(map[string]interface{}{
-		"session_id":        w.session.ID,
-		"job_id":            job.JobID,
-		"input_path":        job.InputPath,
-		"input_size_bytes":  job.InputSizeBytes,
-		"worker_id":         w.id,
-		"temp_output_path":  job.TempOutputPath,
-		"final_output_path": job.FinalOutputPath,
-		"encoder_type":      w.adapter.Type(),
-	})
+// probeSteps names the planning steps of job that need media info of the
+// input.
+func probeSteps(job *QueueJob, prof profile.Profile) []string {
+	var steps []string
+	if job.crop == nil && (prof.AutoCrop == "apply" || prof.AutoCrop == "confirm") {
+		steps = append(steps, "auto crop")
+	}
+	if prof.HDRMode != "" && prof.HDRMode != "off" {
+		steps = append(steps, "hdr")
+	}
+	if prof.Chunks != nil && encoder.ChunksUnsupported(prof) == "" {
+		steps = append(steps, "chunks")
+	}
+	if prof.Tracks != nil {
+		steps = append(steps, "tracks")
+	}
+	if prof.Loudness != nil {
+		steps = append(steps, "loudness")
+	}
+	if prof.RateControl == encoder.RateControlTargetSize {
+		steps = append(steps, "target size")
+	}
+	return steps
 }
 
-func (w *Worker) emitJobProgress(job *QueueJob, progress encoder.Progress) {
-	data := map[string]interface{}{
-		"session_id": w.session.ID,
-		"job_id":     job.JobID,
-		"worker_id":  w.id,
+// probeInput probes the job's input for the given planning steps. A failed
+// probe is reported once here; the steps then fall back on their own.
+func (w *Worker) probeInput(ctx context.Context, job *QueueJob, steps []string) (probe.MediaInfo, error) {
+	var media probe.MediaInfo
+	err := fmt.Errorf("no media prober")
+	if w.prober != nil {
+		media, err = w.prober.Probe(ctx, job.InputPath)
+	}
+	if err != nil {
+		w.emitter.Warning(events.Message{SessionID: w.session.ID, JobID: job.JobID,
+			Message: fmt.Sprintf("probe: %v; %s without media info", err, strings.Join(steps, ", "))})
+	}
+	return media, err
+}
+
+// planTargetSize returns prof with its target size replaced by VBR or CBR
+// bitrates for the probed input. The plan is kept on the job for the job
+// record. Without media info the job fails.
+func (w *Worker) planTargetSize(job *QueueJob, prof profile.Profile, media probe.MediaInfo, probeErr error) (profile.Profile, error) {
+	if probeErr != nil {
+		return prof, fmt.Errorf("target size: %w", probeErr)
+	}
+	plan, err := encoder.PlanTargetSize(prof, media)
+	if err != nil {
+		return prof, fmt.Errorf("target size: %w", err)
+	}
+	w.session.withLock(func() { job.targetSize = &plan })
+
+	w.emitJobLog(job, fmt.Sprintf("target size %.1f MB over %.1f s: %s %d kbps (max %d kbps), audio %.0f kbps",
+		float64(plan.TargetBytes)/(1024*1024), plan.DurationSec, plan.Mode, plan.VideoKbps, plan.MaxKbps, plan.AudioKbps))
+	for _, note := range plan.Notes {
+		w.emitter.Warning(events.Message{SessionID: w.session.ID, JobID: job.JobID, Message: "target size: " + note})
+	}
+	return plan.Apply(prof), nil
+}
+
+// planHDR adapts prof to the HDR signal of the probed input as the
+// profile's hdr_mode asks. Without media info it encodes with prof
+// unchanged.
+func (w *Worker) planHDR(job *QueueJob, prof profile.Profile, media probe.MediaInfo, probeErr error) (profile.Profile, error) {
+	res := &logging.HDRResult{Action: "none", Codec: prof.Codec, OutputDepth: prof.OutputDepth}
+	defer w.session.withLock(func() { job.hdr = res })
+
+	if probeErr != nil {
+		res.Error = probeErr.Error()
+		return prof, nil
+	}
+	plan, err := encoder.PlanHDR(prof, media)
+	if err != nil {
+		res.Error = err.Error()
+		return prof, fmt.Errorf("hdr: %w", err)
 	}
-	if progress.Percent != nil {
-		data["percent"] = *progress.Percent
+	res.Source, res.Action, res.Codec, res.OutputDepth = plan.Source, plan.Action, plan.Codec, plan.OutputDepth
+	res.MasterDisplay, res.MaxCLL, res.Notes = plan.MasterDisplay, plan.MaxCLL, plan.Notes
+	if plan.Tonemap != nil {
+		res.Tonemap = strings.Join(plan.Tonemap.Args(), " ")
 	}
-	if progress.FPS != nil {
-		data["fps"] = *progress.FPS
+
+	if plan.Source != "" {
+		w.emitJobLog(job, fmt.Sprintf("hdr: %s input, %s (%d-bit %s)", plan.Source, plan.Action, plan.OutputDepth, plan.Codec))
+	}
+	for _, note := range plan.Notes {
+		w.emitter.Warning(events.Message{SessionID: w.session.ID, JobID: job.JobID, Message: "hdr: " + note})
+	}
+	return plan.Apply(prof), nil
+}
+
+// planTracks maps the tracks of the probed input with the profile's track
+// rules. Without media info it encodes with audio_mode and sub_copy.
+func (w *Worker) planTracks(job *QueueJob, prof profile.Profile, media probe.MediaInfo, probeErr error) profile.Profile {
+	if probeErr != nil {
+		return prof
 	}
-	if progress.BitrateKbps != nil {
-		data["bitrate_kbps"] = *progress.BitrateKbps
+	var sidecars []string
+	if prof.Tracks.Sidecars {
+		sidecars = encoder.FindSidecars(job.InputPath)
 	}
-	if progress.ETASec != nil {
-		data["eta_sec"] = *progress.ETASec
+	m, notes := encoder.PlanTracks(prof, media, sidecars)
+	for _, note := range notes {
+		w.emitter.Warning(events.Message{SessionID: w.session.ID, JobID: job.JobID, Message: "tracks: " + note})
 	}
+
+	var parts []string
+	for _, t := range m.Audio {
+		parts = append(parts, fmt.Sprintf("audio %d %s", t.Track, t.Codec))
+	}
+	for _, t := range m.Subs {
+		parts = append(parts, fmt.Sprintf("subtitle %d", t.Track))
+	}
+	for _, path := range m.Sidecars {
+		parts = append(parts, "sidecar "+filepath.Base(path))
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "no audio or subtitles")
+	}
+	w.emitJobLog(job, "tracks: "+strings.Join(parts, ", "))
+	prof.TrackMap = &m
+	return prof
+}
+
+// normalizeLoudness measures the audio tracks the job transcodes and sets
+// the gains that bring them to the profile's loudness target. Copied
+// tracks keep their level. A track that cannot be measured is encoded
+// unchanged, as is every track without media info.
+func (w *Worker) normalizeLoudness(ctx context.Context, job *QueueJob, prof profile.Profile, media probe.MediaInfo, probeErr error) profile.Profile {
+	target := *prof.Loudness
+	res := &logging.LoudnessResult{TargetLUFS: target.TargetLUFS, TruePeak: target.TruePeak}
+	defer w.session.withLock(func() { job.loudness = res })
+	warn := func(msg string) {
+		w.emitter.Warning(events.Message{SessionID: w.session.ID, JobID: job.JobID, Message: "loudness: " + msg})
+	}
+
+	if probeErr != nil {
+		res.Error = probeErr.Error()
+		return prof
+	}
+	if w.meter == nil {
+		res.Error = "no loudness measurement"
+		return prof
+	}
+
+	// Transcoded tracks by number; a track map names them, otherwise
+	// audio_mode applies to every track.
+	var tracks []int
+	copied := 0
+	if prof.TrackMap != nil {
+		for _, t := range prof.TrackMap.Audio {
+			if t.Codec == "copy" {
+				copied++
+			} else {
+				tracks = append(tracks, t.Track)
+			}
+		}
+	} else {
+		n := 0
+		for _, s := range media.Streams {
+			if s.Type == "audio" {
+				n++
+				tracks = append(tracks, n)
+			}
+		}
+		if prof.AudioMode != "aac" && prof.AudioMode != "opus" {
+			tracks, copied = nil, n
+		}
+	}
+	if copied > 0 {
+		warn(fmt.Sprintf("%d copied audio track(s) keep their level", copied))
+	}
+
+	gains := make(map[int]float64, len(tracks))
+	for _, n := range tracks {
+		m, err := w.meter.MeasureLoudness(ctx, job.InputPath, n)
+		if err != nil {
+			res.Tracks = append(res.Tracks, logging.LoudnessTrack{Track: n, Error: err.Error()})
+			warn(fmt.Sprintf("track %d: %v; level left unchanged", n, err))
+			continue
+		}
+		gain, limited := encoder.LoudnessGain(target, m)
+		gains[n] = gain
+		res.Tracks = append(res.Tracks, logging.LoudnessTrack{
+			Track:            n,
+			MeasuredLUFS:     m.IntegratedLUFS,
+			MeasuredTruePeak: m.TruePeakDBTP,
+			MeasuredLRA:      m.LRA,
+			GainDB:           gain,
+			OutputLUFS:       math.Round((m.IntegratedLUFS+gain)*100) / 100,
+			PeakLimited:      limited,
+		})
+		w.emitJobLog(job, fmt.Sprintf("loudness: track %d at %.1f LUFS, %.1f dBTP; gain %+.2f dB", n, m.IntegratedLUFS, m.TruePeakDBTP, gain))
+		if limited {
+			warn(fmt.Sprintf("track %d reaches %.1f LUFS only; its peaks limit the gain", n, m.IntegratedLUFS+gain))
+		}
+	}
+	prof.AudioGains = gains
+	return prof
+}
+
+// targetSizeResult compares a completed target-size encode with its plan
+// and warns when the output is larger than the target.
+func (w *Worker) targetSizeResult(job *QueueJob, resolved *ResolveResult, status JobStatus) *logging.TargetSizeResult {
+	var plan *encoder.TargetSizePlan
+	w.session.withLock(func() { plan = job.targetSize })
+	if plan == nil {
+		return nil
+	}
+	res := &logging.TargetSizeResult{
+		TargetBytes: plan.TargetBytes,
+		Mode:        plan.Mode,
+		DurationSec: plan.DurationSec,
+		VideoKbps:   plan.VideoKbps,
+		MaxKbps:     plan.MaxKbps,
+		AudioKbps:   plan.AudioKbps,
+	}
+	if status != JobCompleted {
+		return res
+	}
+	for _, path := range []string{resolved.FinalPath, resolved.TempPath} {
+		if info, err := os.Stat(path); err == nil {
+			res.OutputBytes = info.Size()
+			break
+		}
+	}
+	res.Hit = plan.Hit(res.OutputBytes)
+	res.DeviationPct = math.Round(float64(res.OutputBytes-plan.TargetBytes)/float64(plan.TargetBytes)*10000) / 100
+	if !res.Hit {
+		w.emitter.Warning(events.Message{
+			SessionID: w.session.ID,
+			JobID:     job.JobID,
+			Message:   fmt.Sprintf("target size missed: output is %.1f MB for a %.1f MB target (%+.2f%%)", float64(res.OutputBytes)/(1024*1024), float64(plan.TargetBytes)/(1024*1024), res.DeviationPct),
+		})
+	}
+	return res
+}
+
+// Event emission helpers
+
+func (w *Worker) emitJobStarted(job *QueueJob) {
+	w.emitter.JobStarted(events.JobStarted{
+		SessionID:       w.session.ID,
+		JobID:           job.JobID,
+		ParentJobID:     job.ParentJobID,
+		InputPath:       job.InputPath,
+		InputSizeBytes:  job.InputSizeBytes,
+		WorkerID:        w.id,
+		TempOutputPath:  job.TempOutputPath,
+		FinalOutputPath: job.FinalOutputPath,
+		EncoderType:     w.adapter.Type(),
+		Segment:         job.Segment,
+	})
+}
+
+func (w *Worker) emitJobProgress(job *QueueJob, progress encoder.Progress) {
+	data := events.JobProgress{
+		SessionID:   w.session.ID,
+		JobID:       job.JobID,
+		ParentJobID: job.ParentJobID,
+		WorkerID:    w.id,
+		Percent:     progress.Percent,
+		FPS:         progress.FPS,
+		BitrateKbps: progress.BitrateKbps,
+		ETASec:      progress.ETASec,
+	}
+	w.session.withLock(func() {
+		if progress.Percent != nil {
+			job.percent = *progress.Percent
+		}
+		if progress.FPS != nil {
+			job.fps = *progress.FPS
+		}
+		job.etaSec = progress.ETASec
+		if job.ParentJobID != "" {
+			group := w.session.groupPercentLocked(job.ParentJobID)
+			data.GroupPercent = &group
+		}
+	})
 	w.emitter.JobProgress(data)
+
+	// A chunked job progresses with its segments.
+	if seg := job.segment; seg != nil && data.GroupPercent != nil {
+		w.emitJobProgress(seg.parent, encoder.Progress{Percent: data.GroupPercent})
+	}
 }
 
 func (w *Worker) emitJobLog(job *QueueJob, line string) {
-	w.emitter.JobLog(map[string]interface{}{
-		"session_id": w.session.ID,
-		"job_id":     job.JobID,
-		"line":       line,
-		"ts":         time.Now().Format(time.RFC3339Nano),
+	w.emitter.JobLog(events.JobLog{
+		SessionID: w.session.ID,
+		JobID:     job.JobID,
+		Line:      line,
+		TS:        time.Now().Format(time.RFC3339Nano),
 	})
 }
 
 func (w *Worker) emitJobFinished(job *QueueJob, status JobStatus, exitCode *int, errMsg string) {
-	data := map[string]interface{}{
-		"session_id":        w.session.ID,
-		"job_id":            job.JobID,
-		"status":            string(status),
-		"error_message":     errMsg,
-		"temp_output_path":  job.TempOutputPath,
-		"final_output_path": job.FinalOutputPath,
+	var data events.JobFinished
+	w.session.withLock(func() {
+		data = events.JobFinished{
+			SessionID:       w.session.ID,
+			JobID:           job.JobID,
+			ParentJobID:     job.ParentJobID,
+			InputPath:       job.InputPath,
+			Status:          string(status),
+			ExitCode:        exitCode,
+			ErrorMessage:    errMsg,
+			TempOutputPath:  job.TempOutputPath,
+			FinalOutputPath: job.FinalOutputPath,
+			TimeoutReason:   job.TimeoutReason,
+			InputSizeBytes:  job.InputSizeBytes,
+			Segment:         job.Segment,
+		}
+		if !job.StartedAt.IsZero() {
+			data.DurationSec = time.Since(job.StartedAt).Seconds()
+		}
+	})
+	if status == JobCompleted {
+		if info, err := os.Stat(data.FinalOutputPath); err == nil {
+			data.OutputSizeBytes = info.Size()
+		}
 	}
-	if exitCode != nil {
-		data["exit_code"] = *exitCode
+	if status == JobCompleted && job.segment == nil {
+		w.manager.recordEncode(EncodeRecord{
+			InputPath:  job.InputPath,
+			OutputPath: data.FinalOutputPath,
+			ProfileID:  w.jobProfile(job).ID,
+			Variant:    job.Variant,
+			SessionID:  w.session.ID,
+			JobID:      job.JobID,
+			EncodedAt:  time.Now(),
+		})
 	}
 	w.emitter.JobFinished(data)
+	// Each finished job refines the session ETA.
+	w.emitter.SessionState(w.session.Snapshot())
 }
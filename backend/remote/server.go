@@ -0,0 +1,347 @@
+package remote
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yuta/enque/backend/config"
+	"github.com/yuta/enque/backend/encoder"
+	"github.com/yuta/enque/backend/events"
+	"github.com/yuta/enque/backend/profile"
+	"github.com/yuta/enque/backend/queue"
+)
+
+// Options configures a Server.
+type Options struct {
+	Addr     string
+	Token    string
+	Queue    *queue.Manager
+	Profiles *profile.Manager
+	Config   *config.Manager
+}
+
+// Server is the optional local HTTP API for remote monitoring and control.
+// Every endpoint requires the configured token, passed either as
+// "Authorization: Bearer <token>" or as a "token" query parameter
+// (EventSource clients cannot set headers).
+type Server struct {
+	opts   Options
+	stream *Stream
+
+	mu       sync.Mutex
+	httpSrv  *http.Server
+	listener net.Listener
+}
+
+// NewServer creates a server. Call Start to begin listening.
+func NewServer(opts Options) *Server {
+	return &Server{opts: opts, stream: NewStream()}
+}
+
+// Sink returns the event sink feeding the /events stream. Register it on the
+// emitter shared with the queue manager.
+func (s *Server) Sink() events.EventSink {
+	return s.stream
+}
+
+// Start binds the configured address and serves in the background.
+func (s *Server) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.httpSrv != nil {
+		return fmt.Errorf("remote API already running")
+	}
+
+	ln, err := net.Listen("tcp", s.opts.Addr)
+	if err != nil {
+		return fmt.Errorf("%s: listen %s: %w", encoder.ErrIO, s.opts.Addr, err)
+	}
+	s.listener = ln
+	s.httpSrv = &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go s.httpSrv.Serve(ln)
+	return nil
+}
+
+// Addr returns the bound address, or "" when not running.
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
+// Stop shuts the server down, closing open event streams.
+func (s *Server) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	srv := s.httpSrv
+	s.httpSrv = nil
+	s.listener = nil
+	s.mu.Unlock()
+
+	if srv == nil {
+		return nil
+	}
+	if err := srv.Shutdown(ctx); err != nil {
+		return srv.Close()
+	}
+	return nil
+}
+
+// Handler returns the API routes wrapped in token authentication.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/session", s.handleGetSession)
+	mux.HandleFunc("GET /api/v1/jobs", s.handleListJobs)
+	mux.HandleFunc("GET /api/v1/events", s.handleEvents)
+	mux.HandleFunc("POST /api/v1/session/start", s.handleStart)
+	mux.HandleFunc("POST /api/v1/session/stop", s.handleStop)
+	mux.HandleFunc("POST /api/v1/session/abort", s.handleAbort)
+	mux.HandleFunc("POST /api/v1/jobs", s.handleAppendJobs)
+	mux.HandleFunc("POST /api/v1/jobs/{id}/skip", s.handleSkipJob)
+	mux.HandleFunc("POST /api/v1/jobs/{id}/cancel", s.handleCancelJob)
+	return s.authenticate(mux)
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+			token = strings.TrimPrefix(h, "Bearer ")
+		}
+		if s.opts.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.Token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("invalid or missing token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleGetSession(w http.ResponseWriter, r *http.Request) {
+	session := s.opts.Queue.GetSession()
+	if session == nil {
+		writeError(w, http.StatusNotFound, errors.New("no session"))
+		return
+	}
+	writeJSON(w, http.StatusOK, session.Snapshot())
+}
+
+func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	jobs := s.opts.Queue.ListJobs()
+	if jobs == nil {
+		jobs = []queue.QueueJob{}
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// StartRequest is the body of POST /api/v1/session/start.
+// Either ProfileID or Profile selects the profile; Inputs is a shorthand for
+// Jobs with generated IDs. Settings not given here come from config.json.
+type StartRequest struct {
+	ProfileID        string           `json:"profile_id"`
+	Profile          *profile.Profile `json:"profile"`
+	Jobs             []queue.JobInput `json:"jobs"`
+	Inputs           []string         `json:"inputs"`
+	OutputFolderPath string           `json:"output_folder_path"`
+}
+
+func (s *Server) handleStart(w http.ResponseWriter, r *http.Request) {
+	var body StartRequest
+	if err := decodeBody(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var prof profile.Profile
+	switch {
+	case body.Profile != nil:
+		prof = *body.Profile
+	case body.ProfileID != "" && s.opts.Profiles != nil:
+		p, ok := s.opts.Profiles.Get(body.ProfileID)
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("profile not found: %s", body.ProfileID))
+			return
+		}
+		prof = p
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%s: profile_id or profile is required", encoder.ErrValidation))
+		return
+	}
+
+	cfg := config.Default()
+	if s.opts.Config != nil {
+		cfg = s.opts.Config.Get()
+	}
+	snapshot := queue.NewAppConfigSnapshot(cfg)
+	if body.OutputFolderPath != "" {
+		snapshot.OutputFolderMode = "specified"
+		snapshot.OutputFolderPath = body.OutputFolderPath
+	}
+	// Nobody is at the desk to answer an overwrite or crop prompt.
+	if snapshot.OverwriteMode == "ask" {
+		snapshot.OverwriteMode = "auto_rename"
+	}
+	snapshot.Unattended = true
+
+	req := queue.EncodeRequest{
+		Jobs:              jobsFromBody(body.Jobs, body.Inputs),
+		Profile:           prof,
+		AppConfigSnapshot: snapshot,
+	}
+	if len(req.Jobs) == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%s: jobs or inputs is required", encoder.ErrValidation))
+		return
+	}
+
+	if err := s.opts.Queue.StartEncode(req); err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, s.opts.Queue.GetSession().Snapshot())
+}
+
+// AppendRequest is the body of POST /api/v1/jobs.
+type AppendRequest struct {
+	Jobs   []queue.JobInput `json:"jobs"`
+	Inputs []string         `json:"inputs"`
+}
+
+func (s *Server) handleAppendJobs(w http.ResponseWriter, r *http.Request) {
+	var body AppendRequest
+	if err := decodeBody(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	jobs := jobsFromBody(body.Jobs, body.Inputs)
+	if err := s.opts.Queue.AppendJobs(s.opts.Queue.GetSessionID(), jobs); err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, jobs)
+}
+
+func (s *Server) handleStop(w http.ResponseWriter, r *http.Request) {
+	s.control(w, s.opts.Queue.RequestGracefulStop(s.opts.Queue.GetSessionID()))
+}
+
+func (s *Server) handleAbort(w http.ResponseWriter, r *http.Request) {
+	s.control(w, s.opts.Queue.RequestAbort(s.opts.Queue.GetSessionID()))
+}
+
+func (s *Server) handleSkipJob(w http.ResponseWriter, r *http.Request) {
+	s.control(w, s.opts.Queue.SkipJob(s.opts.Queue.GetSessionID(), r.PathValue("id")))
+}
+
+func (s *Server) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	s.control(w, s.opts.Queue.CancelJob(s.opts.Queue.GetSessionID(), r.PathValue("id")))
+}
+
+func (s *Server) control(w http.ResponseWriter, err error) {
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleEvents streams emitted events as Server-Sent Events. The current
+// session state is sent first so clients do not start blank.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming unsupported"))
+		return
+	}
+
+	ch := s.stream.subscribe()
+	defer s.stream.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if session := s.opts.Queue.GetSession(); session != nil {
+		if data, err := json.Marshal(session.Snapshot()); err == nil {
+			writeSSE(w, events.NameSessionState, data)
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case msg := <-ch:
+			writeSSE(w, msg.name, msg.data)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, name string, data []byte) {
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+}
+
+func jobsFromBody(jobs []queue.JobInput, inputs []string) []queue.JobInput {
+	out := append([]queue.JobInput(nil), jobs...)
+	for _, in := range inputs {
+		out = append(out, queue.JobInput{InputPath: in})
+	}
+	return out
+}
+
+func decodeBody(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<20))
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%s: %w", encoder.ErrValidation, err)
+	}
+	return nil
+}
+
+// statusFor maps error codes (design doc 6.3) onto HTTP status codes.
+func statusFor(err error) int {
+	msg := err.Error()
+	switch {
+	case strings.HasPrefix(msg, encoder.ErrValidation):
+		return http.StatusBadRequest
+	case strings.HasPrefix(msg, encoder.ErrSessionRunning):
+		return http.StatusConflict
+	case strings.HasPrefix(msg, encoder.ErrToolNotFound), strings.HasPrefix(msg, encoder.ErrEncoderNotImplemented):
+		return http.StatusUnprocessableEntity
+	case strings.Contains(msg, "not found"), strings.Contains(msg, "not running"):
+		return http.StatusNotFound
+	case strings.Contains(msg, "no longer accepting"):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
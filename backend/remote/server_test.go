@@ -0,0 +1,195 @@
+package remote
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yuta/enque/backend/config"
+	"github.com/yuta/enque/backend/encoder"
+	"github.com/yuta/enque/backend/encoder/nvencc"
+	"github.com/yuta/enque/backend/events"
+	"github.com/yuta/enque/backend/profile"
+	"github.com/yuta/enque/backend/queue"
+)
+
+const testToken = "0123456789abcdef"
+
+// newTestServer wires a Server to a real queue manager whose encoder path
+// does not exist, so started jobs fail fast without a GPU.
+func newTestServer(t *testing.T) (*httptest.Server, *events.RecordingSink) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("APPDATA", home)
+
+	cfgMgr := config.NewManager(filepath.Join(home, "config.json"))
+	if err := cfgMgr.Load(); err != nil {
+		t.Fatal(err)
+	}
+	cfg := cfgMgr.Get()
+	cfg.NVEncCPath = filepath.Join(home, "missing", "NVEncC64")
+	if err := cfgMgr.Save(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	profMgr := profile.NewManager(filepath.Join(home, "profiles.json"))
+	if err := profMgr.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	reg := encoder.NewRegistry()
+	reg.Register(&nvencc.NVEncCAdapter{})
+	rec := events.NewRecordingSink()
+	emitter := events.NewEmitter(rec)
+	qm := queue.NewManager(reg, emitter, nil)
+
+	srv := NewServer(Options{Token: testToken, Queue: qm, Profiles: profMgr, Config: cfgMgr})
+	emitter.AddSink(srv.Sink())
+
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	return ts, rec
+}
+
+func doRequest(t *testing.T, method, url, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestServer_RequiresToken(t *testing.T) {
+	ts, _ := newTestServer(t)
+
+	resp, err := http.Get(ts.URL + "/api/v1/jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("no token: status=%d, want 401", resp.StatusCode)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/v1/jobs?token=" + testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("query token: status=%d, want 200", resp.StatusCode)
+	}
+}
+
+func TestServer_NoSession(t *testing.T) {
+	ts, _ := newTestServer(t)
+
+	if resp := doRequest(t, "GET", ts.URL+"/api/v1/session", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET session: status=%d, want 404", resp.StatusCode)
+	}
+	if resp := doRequest(t, "POST", ts.URL+"/api/v1/session/stop", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("POST stop: status=%d, want 404", resp.StatusCode)
+	}
+	if resp := doRequest(t, "POST", ts.URL+"/api/v1/jobs", `{"inputs":["a.mp4"]}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("POST jobs: status=%d, want 404", resp.StatusCode)
+	}
+}
+
+func TestServer_StartValidation(t *testing.T) {
+	ts, _ := newTestServer(t)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"bad json", `{`, http.StatusBadRequest},
+		{"no profile", `{"inputs":["a.mp4"]}`, http.StatusBadRequest},
+		{"unknown profile", `{"profile_id":"nope","inputs":["a.mp4"]}`, http.StatusNotFound},
+		{"no inputs", `{"profile":{"encoder_type":"nvencc"}}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(t, "POST", ts.URL+"/api/v1/session/start", tt.body)
+			if resp.StatusCode != tt.want {
+				t.Errorf("status=%d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_StartStreamsEvents(t *testing.T) {
+	ts, rec := newTestServer(t)
+	dir := t.TempDir()
+
+	streamReq, _ := http.NewRequest("GET", ts.URL+"/api/v1/events?token="+testToken, nil)
+	streamResp, err := http.DefaultClient.Do(streamReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer streamResp.Body.Close()
+	if ct := streamResp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content-type=%q", ct)
+	}
+
+	body := `{"profile":{"encoder_type":"nvencc","codec":"hevc","rate_control":"qvbr","rate_value":28,"preset":"P4","output_depth":10},` +
+		`"inputs":["` + filepath.ToSlash(filepath.Join(dir, "a.mp4")) + `"]}`
+	resp := doRequest(t, "POST", ts.URL+"/api/v1/session/start", body)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("start status=%d", resp.StatusCode)
+	}
+	var snap events.SessionSnapshot
+	json.NewDecoder(resp.Body).Decode(&snap)
+	if snap.SessionID == "" || snap.TotalJobs != 1 {
+		t.Errorf("snapshot=%+v", snap)
+	}
+
+	seen := map[string]bool{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(streamResp.Body)
+		for scanner.Scan() {
+			if name, ok := strings.CutPrefix(scanner.Text(), "event: "); ok {
+				seen[name] = true
+				if name == events.NameSessionFinished {
+					return
+				}
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("did not receive session_finished over SSE")
+	}
+	for _, name := range []string{events.NameSessionStarted, events.NameJobFinished, events.NameSessionFinished} {
+		if !seen[name] {
+			t.Errorf("missing %s in stream", name)
+		}
+	}
+
+	jobs := doRequest(t, "GET", ts.URL+"/api/v1/jobs", "")
+	var list []queue.QueueJob
+	json.NewDecoder(jobs.Body).Decode(&list)
+	if len(list) != 1 || list[0].Status != queue.JobFailed {
+		t.Errorf("jobs=%+v, want one failed job", list)
+	}
+	if len(rec.Named(events.NameSessionFinished)) != 1 {
+		t.Error("recording sink should also see session_finished")
+	}
+}
@@ -0,0 +1,70 @@
+package remote
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// streamMessage is a pre-encoded event ready to be written to a client.
+type streamMessage struct {
+	name string
+	data []byte
+}
+
+// Stream broadcasts emitted events to connected SSE clients.
+// It implements events.EventSink. Slow clients drop events rather than
+// blocking the workers that emit them.
+type Stream struct {
+	mu      sync.Mutex
+	clients map[chan streamMessage]struct{}
+}
+
+// clientBuffer is the per-client backlog before events are dropped.
+const clientBuffer = 256
+
+// NewStream creates an empty broadcaster.
+func NewStream() *Stream {
+	return &Stream{clients: make(map[chan streamMessage]struct{})}
+}
+
+// Emit implements events.EventSink.
+func (s *Stream) Emit(name string, data interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.clients) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	msg := streamMessage{name: name, data: payload}
+	for ch := range s.clients {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+func (s *Stream) subscribe() chan streamMessage {
+	ch := make(chan streamMessage, clientBuffer)
+	s.mu.Lock()
+	s.clients[ch] = struct{}{}
+	s.mu.Unlock()
+	return ch
+}
+
+func (s *Stream) unsubscribe(ch chan streamMessage) {
+	s.mu.Lock()
+	delete(s.clients, ch)
+	s.mu.Unlock()
+}
+
+// Clients returns the number of connected clients.
+func (s *Stream) Clients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients)
+}
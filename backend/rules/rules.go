@@ -0,0 +1,276 @@
+// Package rules picks a profile for a file from the ordered profile rules
+// in the app config, and explains the choice.
+package rules
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/yuta/enque/backend/config"
+	"github.com/yuta/enque/backend/probe"
+)
+
+// Prober reads media properties. *probe.Prober implements it.
+type Prober interface {
+	Probe(ctx context.Context, path string) (probe.MediaInfo, error)
+}
+
+// Decision is the outcome of evaluating the rules for one file.
+type Decision struct {
+	InputPath string `json:"input_path"`
+	// ProfileID is the selected profile; empty keeps the session profile.
+	ProfileID string `json:"profile_id"`
+	// RuleIndex is the matching rule, or -1 when none matched.
+	RuleIndex int    `json:"rule_index"`
+	RuleName  string `json:"rule_name,omitempty"`
+	Fallback  bool   `json:"fallback"`
+	Reason    string `json:"reason"`
+	// Media is set when a rule needed probed properties.
+	Media      *probe.MediaInfo `json:"media,omitempty"`
+	ProbeError string           `json:"probe_error,omitempty"`
+	// Rules traces the rules evaluated up to and including the match.
+	Rules []RuleTrace `json:"rules"`
+}
+
+// RuleTrace explains one evaluated rule.
+type RuleTrace struct {
+	Index      int              `json:"index"`
+	Name       string           `json:"name"`
+	ProfileID  string           `json:"profile_id"`
+	Enabled    bool             `json:"enabled"`
+	Matched    bool             `json:"matched"`
+	Conditions []ConditionTrace `json:"conditions"`
+}
+
+// ConditionTrace explains one condition of a rule.
+type ConditionTrace struct {
+	Condition string `json:"condition"`
+	Actual    string `json:"actual"`
+	Matched   bool   `json:"matched"`
+}
+
+// Evaluate runs the rules against the file at path. All conditions of an
+// evaluated rule are traced, and the first matching rule wins. The file is
+// probed at most once, and only when a rule needs probed properties; if
+// probing fails those conditions do not match.
+func Evaluate(ctx context.Context, cfg config.ProfileRulesConfig, path string, prober Prober) Decision {
+	d := Decision{InputPath: path, RuleIndex: -1, Rules: []RuleTrace{}}
+	ev := &evaluator{ctx: ctx, path: path, prober: prober, decision: &d}
+
+	for i, r := range cfg.Rules {
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("rule %d", i+1)
+		}
+		rt := RuleTrace{Index: i, Name: name, ProfileID: r.ProfileID, Enabled: r.Enabled, Conditions: []ConditionTrace{}}
+		if !r.Enabled {
+			d.Rules = append(d.Rules, rt)
+			continue
+		}
+		rt.Matched = true
+		for _, c := range ev.conditions(r) {
+			rt.Conditions = append(rt.Conditions, c)
+			rt.Matched = rt.Matched && c.Matched
+		}
+		d.Rules = append(d.Rules, rt)
+		if rt.Matched {
+			d.ProfileID, d.RuleIndex, d.RuleName = r.ProfileID, i, name
+			d.Reason = fmt.Sprintf("rule %q matched", name)
+			return d
+		}
+	}
+
+	if cfg.DefaultProfileID != "" {
+		d.ProfileID, d.Fallback = cfg.DefaultProfileID, true
+		d.Reason = "no rule matched; using the rules default profile"
+	} else {
+		d.Reason = "no rule matched; keeping the session profile"
+	}
+	return d
+}
+
+type evaluator struct {
+	ctx      context.Context
+	path     string
+	prober   Prober
+	decision *Decision
+
+	statDone bool
+	size     int64
+	statErr  error
+	probed   bool
+}
+
+func (e *evaluator) stat() (int64, error) {
+	if !e.statDone {
+		e.statDone = true
+		fi, err := os.Stat(e.path)
+		if err == nil {
+			e.size = fi.Size()
+		}
+		e.statErr = err
+	}
+	return e.size, e.statErr
+}
+
+func (e *evaluator) media() *probe.MediaInfo {
+	if !e.probed {
+		e.probed = true
+		if e.prober == nil {
+			e.decision.ProbeError = "ffprobe not available"
+			return nil
+		}
+		info, err := e.prober.Probe(e.ctx, e.path)
+		if err != nil {
+			e.decision.ProbeError = err.Error()
+			return nil
+		}
+		e.decision.Media = &info
+	}
+	return e.decision.Media
+}
+
+// conditions evaluates every set condition of r.
+func (e *evaluator) conditions(r config.ProfileRule) []ConditionTrace {
+	var out []ConditionTrace
+	add := func(cond, actual string, ok bool) {
+		out = append(out, ConditionTrace{Condition: cond, Actual: actual, Matched: ok})
+	}
+
+	if len(r.Extensions) > 0 {
+		ext := strings.ToLower(filepath.Ext(e.path))
+		ok := slices.ContainsFunc(r.Extensions, func(want string) bool {
+			return normalizeExt(want) == ext
+		})
+		add("extension in "+strings.Join(r.Extensions, ", "), ext, ok)
+	}
+	if len(r.PathGlobs) > 0 {
+		ok := slices.ContainsFunc(r.PathGlobs, func(glob string) bool {
+			return MatchGlob(glob, e.path)
+		})
+		add("path matches "+strings.Join(r.PathGlobs, ", "), e.path, ok)
+	}
+	if r.MinSizeMB > 0 || r.MaxSizeMB > 0 {
+		cond := rangeText("size", r.MinSizeMB, r.MaxSizeMB, " MB")
+		if size, err := e.stat(); err != nil {
+			add(cond, "unknown: "+err.Error(), false)
+		} else {
+			mb := float64(size) / (1024 * 1024)
+			add(cond, fmt.Sprintf("%.1f MB", mb), inRange(mb, r.MinSizeMB, r.MaxSizeMB))
+		}
+	}
+
+	probed := func(cond string, check func(m *probe.MediaInfo) (string, bool)) {
+		m := e.media()
+		if m == nil {
+			add(cond, "unknown: "+e.decision.ProbeError, false)
+			return
+		}
+		actual, ok := check(m)
+		add(cond, actual, ok)
+	}
+	if r.MinWidth > 0 || r.MaxWidth > 0 {
+		probed(rangeText("width", float64(r.MinWidth), float64(r.MaxWidth), ""), func(m *probe.MediaInfo) (string, bool) {
+			return fmt.Sprint(m.Width), inRange(float64(m.Width), float64(r.MinWidth), float64(r.MaxWidth))
+		})
+	}
+	if r.MinHeight > 0 || r.MaxHeight > 0 {
+		probed(rangeText("height", float64(r.MinHeight), float64(r.MaxHeight), ""), func(m *probe.MediaInfo) (string, bool) {
+			return fmt.Sprint(m.Height), inRange(float64(m.Height), float64(r.MinHeight), float64(r.MaxHeight))
+		})
+	}
+	if len(r.Codecs) > 0 {
+		probed("codec in "+strings.Join(r.Codecs, ", "), func(m *probe.MediaInfo) (string, bool) {
+			return m.VideoCodec, slices.ContainsFunc(r.Codecs, func(c string) bool {
+				return strings.EqualFold(c, m.VideoCodec)
+			})
+		})
+	}
+	if r.HDR != nil {
+		probed(fmt.Sprintf("hdr = %t", *r.HDR), func(m *probe.MediaInfo) (string, bool) {
+			actual := fmt.Sprint(m.HDR)
+			if m.ColorTransfer != "" {
+				actual += " (" + m.ColorTransfer + ")"
+			}
+			return actual, m.HDR == *r.HDR
+		})
+	}
+	if r.MinFPS > 0 || r.MaxFPS > 0 {
+		probed(rangeText("fps", r.MinFPS, r.MaxFPS, ""), func(m *probe.MediaInfo) (string, bool) {
+			return fmt.Sprintf("%.3f", m.FPS), inRange(m.FPS, r.MinFPS, r.MaxFPS)
+		})
+	}
+	if len(r.BitDepths) > 0 {
+		want := make([]string, len(r.BitDepths))
+		for i, d := range r.BitDepths {
+			want[i] = fmt.Sprint(d)
+		}
+		probed("bit depth in "+strings.Join(want, ", "), func(m *probe.MediaInfo) (string, bool) {
+			return fmt.Sprint(m.BitDepth), slices.Contains(r.BitDepths, m.BitDepth)
+		})
+	}
+	return out
+}
+
+// MatchGlob reports whether path matches glob, case-insensitively, with
+// either slash as separator. A glob without a separator matches the file
+// name; otherwise it matches the whole path segment by segment, and "**"
+// matches any number of folders.
+func MatchGlob(glob, path string) bool {
+	glob = strings.ToLower(strings.ReplaceAll(glob, "\\", "/"))
+	path = strings.ToLower(strings.ReplaceAll(path, "\\", "/"))
+	if !strings.Contains(glob, "/") {
+		ok, _ := filepath.Match(glob, path[strings.LastIndex(path, "/")+1:])
+		return ok
+	}
+	return matchSegments(strings.Split(glob, "/"), strings.Split(path, "/"))
+}
+
+func matchSegments(glob, path []string) bool {
+	for len(glob) > 0 {
+		if glob[0] == "**" {
+			for i := 0; i <= len(path); i++ {
+				if matchSegments(glob[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(path) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(glob[0], path[0]); !ok {
+			return false
+		}
+		glob, path = glob[1:], path[1:]
+	}
+	return len(path) == 0
+}
+
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// inRange checks min <= v <= max; a zero bound is open.
+func inRange(v, min, max float64) bool {
+	return (min <= 0 || v >= min) && (max <= 0 || v <= max)
+}
+
+func rangeText(name string, min, max float64, unit string) string {
+	switch {
+	case min > 0 && max > 0:
+		return fmt.Sprintf("%s %g..%g%s", name, min, max, unit)
+	case min > 0:
+		return fmt.Sprintf("%s >= %g%s", name, min, unit)
+	default:
+		return fmt.Sprintf("%s <= %g%s", name, max, unit)
+	}
+}
@@ -0,0 +1,186 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yuta/enque/backend/config"
+	"github.com/yuta/enque/backend/probe"
+	"github.com/yuta/enque/backend/profile"
+)
+
+// fakeProber returns fixed media info and counts calls.
+type fakeProber struct {
+	info  probe.MediaInfo
+	err   error
+	calls int
+}
+
+func (f *fakeProber) Probe(ctx context.Context, path string) (probe.MediaInfo, error) {
+	f.calls++
+	return f.info, f.err
+}
+
+func boolPtr(v bool) *bool { return &v }
+
+func writeFile(t *testing.T, dir, name string, size int) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEvaluate_FirstMatchWins(t *testing.T) {
+	dir := t.TempDir()
+	uhd := &fakeProber{info: probe.MediaInfo{VideoCodec: "hevc", Width: 3840, Height: 2160, FPS: 23.976, BitDepth: 10, HDR: true, ColorTransfer: "smpte2084"}}
+	cfg := config.ProfileRulesConfig{
+		DefaultProfileID: "fallback",
+		Rules: []config.ProfileRule{
+			{Name: "disabled", ProfileID: "never", Extensions: []string{"mkv"}},
+			{Name: "broadcast", Enabled: true, ProfileID: "ts", Extensions: []string{".ts", ".m2ts"}},
+			{Name: "4K HDR", Enabled: true, ProfileID: "uhd-hdr", MinHeight: 2160, HDR: boolPtr(true), BitDepths: []int{10, 12}},
+			{Name: "anything", Enabled: true, ProfileID: "any"},
+		},
+	}
+
+	path := writeFile(t, dir, "movie.mkv", 10)
+	d := Evaluate(context.Background(), cfg, path, uhd)
+	if d.ProfileID != "uhd-hdr" || d.RuleIndex != 2 || d.RuleName != "4K HDR" || d.Fallback {
+		t.Fatalf("decision=%+v", d)
+	}
+	if len(d.Rules) != 3 || d.Rules[0].Enabled || d.Rules[1].Matched || !d.Rules[2].Matched {
+		t.Errorf("trace=%+v, want rules evaluated up to the match", d.Rules)
+	}
+	if c := d.Rules[1].Conditions[0]; c.Actual != ".mkv" || c.Matched {
+		t.Errorf("extension condition=%+v", c)
+	}
+	if len(d.Rules[2].Conditions) != 3 || d.Media == nil || uhd.calls != 1 {
+		t.Errorf("conditions=%+v media=%v probes=%d", d.Rules[2].Conditions, d.Media, uhd.calls)
+	}
+	if !strings.Contains(d.Reason, "4K HDR") {
+		t.Errorf("reason=%q", d.Reason)
+	}
+
+	// Rules that need no probed properties never run ffprobe.
+	ts := writeFile(t, dir, "rec.TS", 10)
+	quiet := &fakeProber{}
+	if d := Evaluate(context.Background(), cfg, ts, quiet); d.ProfileID != "ts" || quiet.calls != 0 || d.Media != nil {
+		t.Errorf("decision=%+v probes=%d", d, quiet.calls)
+	}
+}
+
+func TestEvaluate_FallbackAndProbeFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "clip.mp4", 2*1024*1024)
+	cfg := config.ProfileRulesConfig{
+		Rules: []config.ProfileRule{
+			{Enabled: true, ProfileID: "big", MinSizeMB: 5},
+			{Enabled: true, ProfileID: "h264", Codecs: []string{"H264"}},
+		},
+	}
+
+	failing := &fakeProber{err: errors.New("ffprobe: invalid data")}
+	d := Evaluate(context.Background(), cfg, path, failing)
+	if d.ProfileID != "" || d.RuleIndex != -1 || d.Fallback || !strings.Contains(d.Reason, "session profile") {
+		t.Fatalf("decision=%+v", d)
+	}
+	if d.ProbeError == "" || !strings.Contains(d.Rules[1].Conditions[0].Actual, "invalid data") {
+		t.Errorf("probe failure not explained: %+v", d)
+	}
+	if c := d.Rules[0].Conditions[0]; c.Condition != "size >= 5 MB" || c.Actual != "2.0 MB" {
+		t.Errorf("size condition=%+v", c)
+	}
+	if d.Rules[0].Name != "rule 1" {
+		t.Errorf("unnamed rule shown as %q", d.Rules[0].Name)
+	}
+
+	cfg.DefaultProfileID = "fallback"
+	if d := Evaluate(context.Background(), cfg, path, nil); d.ProfileID != "fallback" || !d.Fallback {
+		t.Errorf("decision=%+v, want fallback", d)
+	}
+
+	cfg.Rules[1].Codecs = []string{"h264"}
+	avc := &fakeProber{info: probe.MediaInfo{VideoCodec: "h264"}}
+	if d := Evaluate(context.Background(), cfg, path, avc); d.ProfileID != "h264" {
+		t.Errorf("decision=%+v, want codec rule", d)
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		glob, path string
+		want       bool
+	}{
+		{"*.ts", `D:\rec\anime\a.ts`, true},
+		{"*.TS", "/rec/a.ts", true},
+		{`D:\rec\**\*.ts`, `D:\rec\anime\2024\a.ts`, true},
+		{"d:/rec/**/*.ts", `D:\rec\a.ts`, true},
+		{"D:/rec/*/*.ts", `D:\rec\anime\2024\a.ts`, false},
+		{"**/anime/**", "/mnt/rec/anime/x/a.mkv", true},
+		{"**/anime/*", "/mnt/rec/drama/a.mkv", false},
+	}
+	for _, tt := range tests {
+		if got := MatchGlob(tt.glob, tt.path); got != tt.want {
+			t.Errorf("MatchGlob(%q, %q)=%t, want %t", tt.glob, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestSelector(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("APPDATA", home)
+
+	cfgMgr := config.NewManager(filepath.Join(home, "config.json"))
+	if err := cfgMgr.Load(); err != nil {
+		t.Fatal(err)
+	}
+	profMgr := profile.NewManager(filepath.Join(home, "profiles.json"))
+	if err := profMgr.Load(); err != nil {
+		t.Fatal(err)
+	}
+	preset := profMgr.List()[0]
+
+	cfg := cfgMgr.Get()
+	cfg.ProfileRules.Rules = []config.ProfileRule{
+		{Name: "ts", Enabled: true, ProfileID: preset.ID, Extensions: []string{".ts"}},
+		{Name: "gone", Enabled: true, ProfileID: "deleted", Extensions: []string{".mkv"}},
+	}
+	if err := cfgMgr.Save(cfg); err != nil {
+		t.Fatal(err)
+	}
+	sel := &Selector{Config: cfgMgr, Profiles: profMgr, NewProber: func(string) Prober { return &fakeProber{} }}
+
+	dir := t.TempDir()
+	ts := writeFile(t, dir, "a.ts", 1)
+	if p, _, err := sel.SelectProfile(ts); p != nil || err != nil {
+		t.Errorf("disabled rules selected %v, %v", p, err)
+	}
+	if d := sel.Explain(context.Background(), ts); d.ProfileID != preset.ID {
+		t.Errorf("explain must evaluate disabled rules: %+v", d)
+	}
+
+	cfg.ProfileRules.Enabled = true
+	if err := cfgMgr.Save(cfg); err != nil {
+		t.Fatal(err)
+	}
+	p, reason, err := sel.SelectProfile(ts)
+	if err != nil || p == nil || p.ID != preset.ID || !strings.Contains(reason, `"ts"`) {
+		t.Errorf("selected %v, %q, %v", p, reason, err)
+	}
+	if _, _, err := sel.SelectProfile(writeFile(t, dir, "b.mkv", 1)); err == nil {
+		t.Error("expected error for a rule naming a missing profile")
+	}
+	if p, _, err := sel.SelectProfile(writeFile(t, dir, "c.mp4", 1)); p != nil || err != nil {
+		t.Errorf("no match selected %v, %v", p, err)
+	}
+}
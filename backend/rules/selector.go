@@ -0,0 +1,52 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yuta/enque/backend/config"
+	"github.com/yuta/enque/backend/probe"
+	"github.com/yuta/enque/backend/profile"
+)
+
+// Selector picks profiles for added files from the current config. It
+// implements queue.ProfileSelector.
+type Selector struct {
+	Config   *config.Manager
+	Profiles *profile.Manager
+	// NewProber builds the prober for the configured ffprobe path;
+	// probe.New when nil.
+	NewProber func(ffprobePath string) Prober
+}
+
+// Explain evaluates the rules for path, whether or not they are enabled.
+func (s *Selector) Explain(ctx context.Context, path string) Decision {
+	cfg := s.Config.Get()
+	return Evaluate(ctx, cfg.ProfileRules, path, s.prober(cfg))
+}
+
+// SelectProfile returns the profile the rules choose for path and why. It
+// returns nil when the rules are disabled or leave the session profile in
+// place.
+func (s *Selector) SelectProfile(path string) (*profile.Profile, string, error) {
+	cfg := s.Config.Get()
+	if !cfg.ProfileRules.Enabled {
+		return nil, "", nil
+	}
+	d := Evaluate(context.Background(), cfg.ProfileRules, path, s.prober(cfg))
+	if d.ProfileID == "" {
+		return nil, d.Reason, nil
+	}
+	p, ok := s.Profiles.Get(d.ProfileID)
+	if !ok {
+		return nil, d.Reason, fmt.Errorf("profile not found: %s", d.ProfileID)
+	}
+	return &p, d.Reason, nil
+}
+
+func (s *Selector) prober(cfg config.AppConfig) Prober {
+	if s.NewProber != nil {
+		return s.NewProber(cfg.FFprobePath)
+	}
+	return probe.New(cfg.FFprobePath)
+}
@@ -0,0 +1,353 @@
+package sample
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/yuta/enque/backend/encoder"
+	"github.com/yuta/enque/backend/profile"
+)
+
+// CompareRequest asks for the same samples of each input to be encoded
+// with two profiles, A and B.
+type CompareRequest struct {
+	Inputs   []string        `json:"inputs"`
+	ProfileA profile.Profile `json:"profile_a"`
+	ProfileB profile.Profile `json:"profile_b"`
+	// Timestamps, Count, DurationSec and Metrics pick and score the
+	// samples of every input as in Request.
+	Timestamps  []float64 `json:"timestamps,omitempty"`
+	Count       int       `json:"count,omitempty"`
+	DurationSec float64   `json:"duration_sec,omitempty"`
+	Metrics     []string  `json:"metrics,omitempty"`
+	// Visual renders each pair of samples for viewing: "side_by_side"
+	// (A left, B right) or "difference" (mid grey where they match).
+	Visual string `json:"visual,omitempty"`
+	// OutputDir keeps the samples, in its a and b folders, and the visual
+	// videos. It is required for Visual.
+	OutputDir string `json:"output_dir,omitempty"`
+}
+
+// Comparison is the saved report of an A/B comparison.
+type Comparison struct {
+	ID        string          `json:"id"`
+	CreatedAt string          `json:"created_at"`
+	ProfileA  ComparedProfile `json:"profile_a"`
+	ProfileB  ComparedProfile `json:"profile_b"`
+	Inputs    []InputResult   `json:"inputs"`
+	// Table compares the totals of A and B over all inputs.
+	Table []TableRow `json:"table"`
+}
+
+// ComparedProfile links a comparison to a profile. Profile is the profile
+// as compared, which may since have been edited or never saved.
+type ComparedProfile struct {
+	ID      string          `json:"id,omitempty"`
+	Name    string          `json:"name"`
+	Profile profile.Profile `json:"profile"`
+}
+
+// InputResult holds the test encodes of one input with both profiles.
+type InputResult struct {
+	InputPath string  `json:"input_path"`
+	A         *Result `json:"a,omitempty"`
+	B         *Result `json:"b,omitempty"`
+	// Visuals are the rendered videos, one per pair of samples.
+	Visuals []string `json:"visuals,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// TableRow is one line of the comparison table. DiffPct is B relative to
+// A in percent; it is unset when either side has no value.
+type TableRow struct {
+	Metric  string   `json:"metric"`
+	A       *float64 `json:"a"`
+	B       *float64 `json:"b"`
+	DiffPct *float64 `json:"diff_pct"`
+}
+
+// VisualRenderer renders two encodes of the same clip into one video.
+// *Visualizer implements it.
+type VisualRenderer interface {
+	Render(ctx context.Context, mode, a, b, output string, width, height int) error
+}
+
+// Comparer runs A/B comparisons. A and B may share one Tester when both
+// profiles use the same encoder.
+type Comparer struct {
+	A, B *Tester
+	// Visuals is needed for CompareRequest.Visual.
+	Visuals VisualRenderer
+}
+
+// Run test-encodes each input with both profiles and tabulates the
+// results. An input that fails with either profile is reported in its
+// Error; Run fails when none compared, or when ctx is cancelled.
+func (c *Comparer) Run(ctx context.Context, req CompareRequest) (Comparison, error) {
+	if len(req.Inputs) == 0 {
+		return Comparison{}, fmt.Errorf("%s: inputs are required", encoder.ErrValidation)
+	}
+	switch req.Visual {
+	case "":
+	case "side_by_side", "difference":
+		if req.OutputDir == "" {
+			return Comparison{}, fmt.Errorf("%s: visual needs output_dir", encoder.ErrValidation)
+		}
+		if c.Visuals == nil {
+			return Comparison{}, fmt.Errorf("%s: visual needs ffmpeg", encoder.ErrValidation)
+		}
+	default:
+		return Comparison{}, fmt.Errorf("%s: unknown visual %q", encoder.ErrValidation, req.Visual)
+	}
+
+	report := Comparison{
+		ID:        uuid.New().String(),
+		CreatedAt: time.Now().Format(time.RFC3339),
+		ProfileA:  ComparedProfile{ID: req.ProfileA.ID, Name: req.ProfileA.Name, Profile: req.ProfileA},
+		ProfileB:  ComparedProfile{ID: req.ProfileB.ID, Name: req.ProfileB.Name, Profile: req.ProfileB},
+	}
+	compared := 0
+	for _, input := range req.Inputs {
+		ir := InputResult{InputPath: input}
+		a, err := c.A.Run(ctx, c.sampleRequest(req, input, req.ProfileA, "a"))
+		if err == nil {
+			ir.A = &a
+			var b Result
+			if b, err = c.B.Run(ctx, c.sampleRequest(req, input, req.ProfileB, "b")); err == nil {
+				ir.B = &b
+			}
+		}
+		if ctx.Err() != nil {
+			return Comparison{}, fmt.Errorf("compare: %w", ctx.Err())
+		}
+		if err != nil {
+			ir.Error = err.Error()
+		} else {
+			compared++
+			if req.Visual != "" {
+				ir.Visuals, err = c.render(ctx, req, input, *ir.A, *ir.B)
+				if err != nil {
+					ir.Error = err.Error()
+				}
+			}
+		}
+		report.Inputs = append(report.Inputs, ir)
+	}
+	if compared == 0 {
+		return report, fmt.Errorf("compare: %s", report.Inputs[0].Error)
+	}
+	report.Table = compareTable(report.Inputs)
+	return report, nil
+}
+
+func (c *Comparer) sampleRequest(req CompareRequest, input string, p profile.Profile, side string) Request {
+	r := Request{
+		InputPath:   input,
+		Profile:     p,
+		Timestamps:  req.Timestamps,
+		Count:       req.Count,
+		DurationSec: req.DurationSec,
+		Metrics:     req.Metrics,
+	}
+	if req.OutputDir != "" {
+		r.OutputDir = filepath.Join(req.OutputDir, side)
+	}
+	return r
+}
+
+// render renders each pair of samples that both encoded. The samples of
+// both sides start at the same times, as they are picked the same way.
+func (c *Comparer) render(ctx context.Context, req CompareRequest, input string, a, b Result) ([]string, error) {
+	media, err := c.A.Prober.Probe(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("visual: %w", err)
+	}
+	base := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+	var visuals []string
+	for i := range min(len(a.Samples), len(b.Samples)) {
+		sa, sb := a.Samples[i], b.Samples[i]
+		if sa.OutputPath == "" || sb.OutputPath == "" || sa.OutputSizeBytes == 0 || sb.OutputSizeBytes == 0 {
+			continue
+		}
+		out := filepath.Join(req.OutputDir, fmt.Sprintf("%s_sample%02d_%s.mp4", base, i+1, req.Visual))
+		if err := c.Visuals.Render(ctx, req.Visual, sa.OutputPath, sb.OutputPath, out, media.Width, media.Height); err != nil {
+			return visuals, fmt.Errorf("visual: %w", err)
+		}
+		visuals = append(visuals, out)
+	}
+	return visuals, nil
+}
+
+// compareTable totals the inputs that compared: estimated sizes and
+// encode times add up, speed and scores are averaged over the inputs.
+func compareTable(inputs []InputResult) []TableRow {
+	type side struct{ size, kbps, fps, encodeSec, ssim, vmaf, n, nSSIM, nVMAF float64 }
+	var a, b side
+	add := func(s *side, r *Result) {
+		s.size += float64(r.EstimatedSizeBytes)
+		s.encodeSec += r.EstimatedEncodeSec
+		s.kbps += r.BitrateKbps
+		s.fps += r.FPS
+		s.n++
+		if r.SSIM != nil {
+			s.ssim += *r.SSIM
+			s.nSSIM++
+		}
+		if r.VMAF != nil {
+			s.vmaf += *r.VMAF
+			s.nVMAF++
+		}
+	}
+	for _, ir := range inputs {
+		if ir.A != nil && ir.B != nil {
+			add(&a, ir.A)
+			add(&b, ir.B)
+		}
+	}
+	mean := func(sum, n float64) *float64 {
+		if n == 0 {
+			return nil
+		}
+		v := sum / n
+		return &v
+	}
+	row := func(metric string, va, vb *float64) TableRow {
+		r := TableRow{Metric: metric, A: va, B: vb}
+		if va != nil && vb != nil && *va != 0 {
+			d := (*vb - *va) / *va * 100
+			r.DiffPct = &d
+		}
+		return r
+	}
+	rows := []TableRow{
+		row("estimated_size_bytes", &a.size, &b.size),
+		row("bitrate_kbps", mean(a.kbps, a.n), mean(b.kbps, b.n)),
+		row("fps", mean(a.fps, a.n), mean(b.fps, b.n)),
+		row("estimated_encode_sec", &a.encodeSec, &b.encodeSec),
+	}
+	if a.nSSIM > 0 || b.nSSIM > 0 {
+		rows = append(rows, row("ssim", mean(a.ssim, a.nSSIM), mean(b.ssim, b.nSSIM)))
+	}
+	if a.nVMAF > 0 || b.nVMAF > 0 {
+		rows = append(rows, row("vmaf", mean(a.vmaf, a.nVMAF), mean(b.vmaf, b.nVMAF)))
+	}
+	return rows
+}
+
+// Save writes the report to dir as <id>.json.
+func (c *Comparison) Save(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create comparisons dir: %w", err)
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal comparison: %w", err)
+	}
+	path := filepath.Join(dir, c.ID+".json")
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return fmt.Errorf("write comparison: %w", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// ListComparisons returns the reports in dir, newest first. With a
+// profileID, only those comparing that profile are returned. Unreadable
+// files are skipped.
+func ListComparisons(dir, profileID string) ([]Comparison, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read comparisons dir: %w", err)
+	}
+	var out []Comparison
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		var c Comparison
+		if json.Unmarshal(data, &c) != nil {
+			continue
+		}
+		if profileID != "" && c.ProfileA.ID != profileID && c.ProfileB.ID != profileID {
+			continue
+		}
+		out = append(out, c)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].CreatedAt > out[j].CreatedAt })
+	return out, nil
+}
+
+// DeleteComparison removes the report with the given ID from dir.
+func DeleteComparison(dir, id string) error {
+	if id == "" || filepath.Base(id) != id {
+		return fmt.Errorf("%s: invalid comparison id %q", encoder.ErrValidation, id)
+	}
+	if err := os.Remove(filepath.Join(dir, id+".json")); err != nil {
+		return fmt.Errorf("delete comparison: %w", err)
+	}
+	return nil
+}
+
+// Visualizer renders comparison videos with ffmpeg.
+type Visualizer struct {
+	Path    string // ffmpeg executable; "ffmpeg" from PATH when empty
+	Timeout time.Duration
+}
+
+// NewVisualizer returns a Visualizer for the given ffmpeg path.
+func NewVisualizer(path string) *Visualizer {
+	return &Visualizer{Path: path, Timeout: 10 * time.Minute}
+}
+
+// Render writes the "side_by_side" or "difference" video of a and b to
+// output (see VisualArgs).
+func (v *Visualizer) Render(ctx context.Context, mode, a, b, output string, width, height int) error {
+	exe := v.Path
+	if exe == "" {
+		exe = "ffmpeg"
+	}
+	if v.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, v.Timeout)
+		defer cancel()
+	}
+	out, err := exec.CommandContext(ctx, exe, VisualArgs(mode, a, b, output, width, height)...).CombinedOutput()
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s: %w", mode, ctx.Err())
+	}
+	if err != nil {
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		return fmt.Errorf("%s: %w: %s", mode, err, lines[len(lines)-1])
+	}
+	return nil
+}
+
+// VisualArgs returns the ffmpeg arguments that render a and b, both scaled
+// to width x height, into one H.264 video: next to each other for
+// "side_by_side", or as their difference around mid grey for
+// "difference".
+func VisualArgs(mode, a, b, output string, width, height int) []string {
+	combine := "hstack=inputs=2"
+	if mode == "difference" {
+		combine = "blend=all_mode=grainextract"
+	}
+	prep := fmt.Sprintf("scale=%d:%d,format=yuv420p,setpts=PTS-STARTPTS", width, height)
+	filter := fmt.Sprintf("[0:v]%s[a];[1:v]%s[b];[a][b]%s", prep, prep, combine)
+	return []string{"-hide_banner", "-nostats", "-y", "-i", a, "-i", b,
+		"-filter_complex", filter, "-an", "-c:v", "libx264", "-crf", "18", "-preset", "fast", output}
+}
@@ -0,0 +1,109 @@
+package sample
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/yuta/enque/backend/profile"
+)
+
+type fakeVisuals struct{ calls []string }
+
+func (f *fakeVisuals) Render(ctx context.Context, mode, a, b, output string, width, height int) error {
+	f.calls = append(f.calls, fmt.Sprintf("%s %s %s %dx%d", mode, filepath.Base(a), filepath.Base(b), width, height))
+	return nil
+}
+
+func TestComparer_Run(t *testing.T) {
+	tester := newTester(t, &fakeQuality{})
+	vis := &fakeVisuals{}
+	c := &Comparer{A: tester, B: tester, Visuals: vis}
+	outDir := t.TempDir()
+	report, err := c.Run(context.Background(), CompareRequest{
+		Inputs:    []string{writeInput(t, "movie.mkv"), writeInput(t, "fail.mkv")},
+		ProfileA:  profile.Profile{ID: "pa", Name: "A", EncoderType: "nvencc", OutputContainer: "mkv", RateValue: 10},
+		ProfileB:  profile.Profile{ID: "pb", Name: "B", EncoderType: "nvencc", OutputContainer: "mkv", RateValue: 5},
+		Count:     2,
+		Metrics:   []string{"vmaf"},
+		Visual:    "side_by_side",
+		OutputDir: outDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Inputs) != 2 || report.Inputs[0].Error != "" || report.Inputs[1].Error == "" {
+		t.Fatalf("inputs=%+v, want the second failed", report.Inputs)
+	}
+	if want := []string{"side_by_side movie_sample01.mkv movie_sample01.mkv 1920x1080",
+		"side_by_side movie_sample02.mkv movie_sample02.mkv 1920x1080"}; !slices.Equal(vis.calls, want) {
+		t.Errorf("visuals=%v, want %v", vis.calls, want)
+	}
+	if got := report.Inputs[0].A.Samples[0].OutputPath; got != filepath.Join(outDir, "a", "movie_sample01.mkv") {
+		t.Errorf("A sample kept at %q", got)
+	}
+
+	rows := map[string]TableRow{}
+	for _, r := range report.Table {
+		rows[r.Metric] = r
+	}
+	size := rows["estimated_size_bytes"]
+	if *size.A != 600000 || *size.B != 300000 || *size.DiffPct != -50 {
+		t.Errorf("size row a=%v b=%v diff=%v", *size.A, *size.B, *size.DiffPct)
+	}
+	if r, ok := rows["vmaf"]; !ok || *r.A != 95 || *r.DiffPct != 0 {
+		t.Errorf("vmaf row=%+v", r)
+	}
+	if _, ok := rows["ssim"]; ok {
+		t.Error("ssim row without ssim scores")
+	}
+
+	// Reports are listed for either profile.
+	dir := t.TempDir()
+	if err := report.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[string]int{"pa": 1, "pb": 1, "other": 0, "": 1} {
+		got, err := ListComparisons(dir, id)
+		if err != nil || len(got) != want {
+			t.Errorf("list %q: %d reports, %v; want %d", id, len(got), err, want)
+		}
+	}
+	if err := DeleteComparison(dir, report.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteComparison(dir, "../x"); err == nil {
+		t.Error("expected an error for a path as id")
+	}
+	if got, _ := ListComparisons(dir, ""); len(got) != 0 {
+		t.Errorf("%d reports after delete", len(got))
+	}
+}
+
+func TestComparer_RunValidation(t *testing.T) {
+	c := &Comparer{A: newTester(t, nil)}
+	c.B = c.A
+	for _, req := range []CompareRequest{
+		{},
+		{Inputs: []string{"x.mkv"}, Visual: "side_by_side"},
+		{Inputs: []string{"x.mkv"}, Visual: "overlay", OutputDir: "out"},
+		{Inputs: []string{"x.mkv"}, Visual: "difference", OutputDir: "out"}, // no renderer
+	} {
+		if _, err := c.Run(context.Background(), req); err == nil {
+			t.Errorf("%+v: expected an error", req)
+		}
+	}
+}
+
+func TestVisualArgs(t *testing.T) {
+	args := VisualArgs("difference", "a.mkv", "b.mkv", "out.mp4", 1280, 720)
+	want := "[0:v]scale=1280:720,format=yuv420p,setpts=PTS-STARTPTS[a];[1:v]scale=1280:720,format=yuv420p,setpts=PTS-STARTPTS[b];[a][b]blend=all_mode=grainextract"
+	if i := slices.Index(args, "-filter_complex"); i < 0 || args[i+1] != want {
+		t.Errorf("args=%v", args)
+	}
+	if args[len(args)-1] != "out.mp4" {
+		t.Errorf("output=%q", args[len(args)-1])
+	}
+}
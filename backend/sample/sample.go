@@ -0,0 +1,407 @@
+// Package sample test-encodes short clips of an input with a profile, to
+// tune it before encoding whole files: it reports the clips' size, speed
+// and quality, and extrapolates them to the whole input.
+package sample
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yuta/enque/backend/encoder"
+	"github.com/yuta/enque/backend/probe"
+	"github.com/yuta/enque/backend/profile"
+)
+
+const (
+	DefaultCount       = 3
+	MaxCount           = 10
+	DefaultDurationSec = 10
+	MinDurationSec     = 2
+	MaxDurationSec     = 120
+)
+
+// Request asks for a test encode of InputPath with Profile, which need not
+// be saved.
+type Request struct {
+	InputPath string          `json:"input_path"`
+	Profile   profile.Profile `json:"profile"`
+	// Timestamps are the start times of the samples in seconds. When
+	// empty, Count samples are spread evenly over the input.
+	Timestamps  []float64 `json:"timestamps,omitempty"`
+	Count       int       `json:"count,omitempty"`        // DefaultCount when 0
+	DurationSec float64   `json:"duration_sec,omitempty"` // DefaultDurationSec when 0
+	// Metrics are the quality scores to compute: "ssim", "vmaf".
+	Metrics []string `json:"metrics,omitempty"`
+	// OutputDir keeps the encoded samples. When empty they are written to
+	// a temp dir and deleted.
+	OutputDir string `json:"output_dir,omitempty"`
+}
+
+// Sample is the result of one encoded clip.
+type Sample struct {
+	StartSec        float64  `json:"start_sec"`
+	DurationSec     float64  `json:"duration_sec"`
+	OutputPath      string   `json:"output_path,omitempty"` // only when kept
+	OutputSizeBytes int64    `json:"output_size_bytes"`
+	EncodeSec       float64  `json:"encode_sec"`
+	FPS             float64  `json:"fps"`
+	BitrateKbps     float64  `json:"bitrate_kbps"`
+	SSIM            *float64 `json:"ssim,omitempty"`
+	VMAF            *float64 `json:"vmaf,omitempty"`
+	Error           string   `json:"error,omitempty"`
+}
+
+// Result summarizes the samples and extrapolates them to the whole input.
+type Result struct {
+	InputPath        string   `json:"input_path"`
+	InputDurationSec float64  `json:"input_duration_sec"`
+	InputSizeBytes   int64    `json:"input_size_bytes"`
+	Samples          []Sample `json:"samples"`
+	// Totals and means over the samples that encoded.
+	OutputSizeBytes int64   `json:"output_size_bytes"`
+	FPS             float64 `json:"fps"`
+	BitrateKbps     float64 `json:"bitrate_kbps"`
+	// EstimatedSizeBytes and EstimatedEncodeSec are for encoding the whole
+	// input with the profile.
+	EstimatedSizeBytes int64    `json:"estimated_size_bytes"`
+	EstimatedEncodeSec float64  `json:"estimated_encode_sec"`
+	SSIM               *float64 `json:"ssim,omitempty"`
+	VMAF               *float64 `json:"vmaf,omitempty"`
+	Notes              []string `json:"notes,omitempty"`
+}
+
+// MediaProber reads the properties of an input. *probe.Prober implements it.
+type MediaProber interface {
+	Probe(ctx context.Context, path string) (probe.MediaInfo, error)
+}
+
+// KeyframeFinder lists the keyframes of part of an input.
+// *probe.SplitFinder implements it.
+type KeyframeFinder interface {
+	KeyframesBetween(ctx context.Context, path string, from, to float64) ([]float64, error)
+}
+
+// QualityMeter scores an encode against its source. *probe.QualityMeter
+// implements it.
+type QualityMeter interface {
+	Measure(ctx context.Context, metric, distorted, source string, start, duration float64, width, height int) (float64, error)
+}
+
+// Tester runs test encodes. It keeps no state between runs.
+type Tester struct {
+	Runner  *encoder.ProcessRunner
+	Adapter encoder.Adapter
+	Prober  MediaProber
+	// Keyframes, when set, moves sample starts back to a keyframe so that
+	// the encoder seeks exactly to them.
+	Keyframes KeyframeFinder
+	// Quality is needed for Request.Metrics.
+	Quality QualityMeter
+}
+
+// Run encodes the samples one after another. A sample that fails is
+// reported in its Error; Run fails only when no sample encoded, or when
+// ctx is cancelled.
+func (t *Tester) Run(ctx context.Context, req Request) (Result, error) {
+	if err := normalize(&req); err != nil {
+		return Result{}, err
+	}
+	if len(req.Metrics) > 0 && t.Quality == nil {
+		return Result{}, fmt.Errorf("%s: quality metrics need ffmpeg", encoder.ErrValidation)
+	}
+	media, err := t.Prober.Probe(ctx, req.InputPath)
+	if err != nil {
+		return Result{}, fmt.Errorf("test encode: %w", err)
+	}
+	if media.DurationSec <= 0 {
+		return Result{}, fmt.Errorf("test encode: input has no duration")
+	}
+	res := Result{InputPath: req.InputPath, InputDurationSec: media.DurationSec, InputSizeBytes: media.SizeBytes}
+	if info, err := os.Stat(req.InputPath); err == nil {
+		res.InputSizeBytes = info.Size()
+	}
+
+	prof, notes, err := prepare(req.Profile, media, req.InputPath)
+	if err != nil {
+		return Result{}, fmt.Errorf("test encode: %w", err)
+	}
+	res.Notes = notes
+
+	dir := req.OutputDir
+	if dir == "" {
+		if dir, err = os.MkdirTemp("", "enque-sample-"); err != nil {
+			return Result{}, fmt.Errorf("test encode: %w", err)
+		}
+		defer os.RemoveAll(dir)
+	} else if err := os.MkdirAll(dir, 0o755); err != nil {
+		return Result{}, fmt.Errorf("test encode: %w", err)
+	}
+
+	base := strings.TrimSuffix(filepath.Base(req.InputPath), filepath.Ext(req.InputPath))
+	ext := prof.OutputContainer
+	if ext == "" {
+		ext = "mkv"
+	}
+	for i, start := range sampleStarts(req, media.DurationSec) {
+		start = t.snap(ctx, req.InputPath, start)
+		out := filepath.Join(dir, fmt.Sprintf("%s_sample%02d.%s", base, i+1, ext))
+		s := t.encode(ctx, prof, req, media, start, out)
+		if ctx.Err() != nil {
+			return Result{}, fmt.Errorf("test encode: %w", ctx.Err())
+		}
+		if req.OutputDir == "" {
+			s.OutputPath = ""
+		}
+		res.Samples = append(res.Samples, s)
+	}
+	if !summarize(&res, media) {
+		return res, fmt.Errorf("test encode: %s", res.Samples[0].Error)
+	}
+	return res, nil
+}
+
+// normalize checks req and fills in its defaults.
+func normalize(req *Request) error {
+	if req.InputPath == "" {
+		return fmt.Errorf("%s: input_path is required", encoder.ErrValidation)
+	}
+	if req.DurationSec == 0 {
+		req.DurationSec = DefaultDurationSec
+	}
+	if req.DurationSec < MinDurationSec || req.DurationSec > MaxDurationSec {
+		return fmt.Errorf("%s: duration_sec must be %d-%d", encoder.ErrValidation, MinDurationSec, MaxDurationSec)
+	}
+	if len(req.Timestamps) > 0 {
+		req.Count = len(req.Timestamps)
+	} else if req.Count == 0 {
+		req.Count = DefaultCount
+	}
+	if req.Count < 1 || req.Count > MaxCount {
+		return fmt.Errorf("%s: at most %d samples", encoder.ErrValidation, MaxCount)
+	}
+	for _, ts := range req.Timestamps {
+		if ts < 0 {
+			return fmt.Errorf("%s: timestamps must not be negative", encoder.ErrValidation)
+		}
+	}
+	for _, m := range req.Metrics {
+		if m != "ssim" && m != "vmaf" {
+			return fmt.Errorf("%s: unknown metric %q", encoder.ErrValidation, m)
+		}
+	}
+	return nil
+}
+
+// prepare plans p for the input as a queued job would, except for what a
+// sample cannot do: crop detection and loudness are measured over the
+// whole input, and chunks are for long inputs.
+func prepare(p profile.Profile, media probe.MediaInfo, inputPath string) (profile.Profile, []string, error) {
+	var notes []string
+	p.Chunks = nil
+	p.RestoreFileTime = false
+	if p.AutoCrop != "" && p.AutoCrop != "off" {
+		p.AutoCrop = ""
+		notes = append(notes, "auto crop is not applied to samples")
+	}
+	if p.Loudness != nil {
+		p.Loudness = nil
+		notes = append(notes, "loudness normalization is not applied to samples")
+	}
+	if p.NVEncCAdvanced.Trim != "" || p.NVEncCAdvanced.Seek != "" || p.NVEncCAdvanced.SeekTo != "" {
+		notes = append(notes, "the profile's trim and seek are replaced by the sample times")
+	}
+	if p.HDRMode != "" && p.HDRMode != "off" {
+		plan, err := encoder.PlanHDR(p, media)
+		if err != nil {
+			return p, notes, fmt.Errorf("hdr: %w", err)
+		}
+		notes = append(notes, prefixed("hdr: ", plan.Notes)...)
+		p = plan.Apply(p)
+	}
+	if p.Tracks != nil {
+		var sidecars []string
+		if p.Tracks.Sidecars {
+			sidecars = encoder.FindSidecars(inputPath)
+		}
+		m, trackNotes := encoder.PlanTracks(p, media, sidecars)
+		notes = append(notes, prefixed("tracks: ", trackNotes)...)
+		p.TrackMap = &m
+	}
+	if p.RateControl == encoder.RateControlTargetSize {
+		plan, err := encoder.PlanTargetSize(p, media)
+		if err != nil {
+			return p, notes, fmt.Errorf("target size: %w", err)
+		}
+		notes = append(notes, prefixed("target size: ", plan.Notes)...)
+		p = plan.Apply(p)
+	}
+	return p, notes, nil
+}
+
+func prefixed(prefix string, notes []string) []string {
+	out := make([]string, len(notes))
+	for i, n := range notes {
+		out[i] = prefix + n
+	}
+	return out
+}
+
+// sampleStarts returns the requested start times, or Count times spread
+// evenly over the input, each leaving room for a whole sample.
+func sampleStarts(req Request, duration float64) []float64 {
+	last := math.Max(0, duration-req.DurationSec)
+	if len(req.Timestamps) > 0 {
+		starts := make([]float64, len(req.Timestamps))
+		for i, ts := range req.Timestamps {
+			starts[i] = math.Min(ts, last)
+		}
+		return starts
+	}
+	if last == 0 {
+		return []float64{0}
+	}
+	starts := make([]float64, req.Count)
+	for i := range starts {
+		starts[i] = last * float64(i+1) / float64(req.Count+1)
+	}
+	return starts
+}
+
+// snap moves start back to the keyframe at or before it, within ten
+// seconds. It returns start unchanged when there is none.
+func (t *Tester) snap(ctx context.Context, path string, start float64) float64 {
+	if t.Keyframes == nil || start == 0 {
+		return start
+	}
+	keyframes, err := t.Keyframes.KeyframesBetween(ctx, path, math.Max(0, start-10), start+0.001)
+	if err != nil {
+		return start
+	}
+	for i := len(keyframes) - 1; i >= 0; i-- {
+		if k := keyframes[i]; k <= start+0.001 && k >= start-10 {
+			return math.Max(0, k)
+		}
+	}
+	return start
+}
+
+// encode encodes the clip of the input from start into out.
+func (t *Tester) encode(ctx context.Context, p profile.Profile, req Request, media probe.MediaInfo, start float64, out string) Sample {
+	s := Sample{StartSec: start, DurationSec: math.Min(req.DurationSec, media.DurationSec-start), OutputPath: out}
+	adv := &p.NVEncCAdvanced
+	adv.Trim, adv.Seek, adv.SeekTo = "", "", ""
+	if start > 0 {
+		adv.Seek = encoder.FormatSeek(start)
+	}
+	if start+req.DurationSec < media.DurationSec {
+		adv.SeekTo = encoder.FormatSeek(start + req.DurationSec)
+	}
+	args, err := t.Adapter.BuildArgs(p, req.InputPath, out)
+	if err != nil {
+		s.Error = err.Error()
+		return s
+	}
+
+	var lastLine string
+	began := time.Now()
+	result := t.Runner.Run(ctx, args, nil, nil, func(line string) {
+		if strings.TrimSpace(line) != "" {
+			lastLine = line
+		}
+		// Every line, not the throttled progress callback: the last
+		// figures are the averages over the whole clip.
+		if pr := t.Adapter.ParseProgress(line); pr.Percent != nil {
+			if pr.FPS != nil {
+				s.FPS = *pr.FPS
+			}
+			if pr.BitrateKbps != nil {
+				s.BitrateKbps = *pr.BitrateKbps
+			}
+		}
+	})
+	s.EncodeSec = time.Since(began).Seconds()
+	if result.ExitCode != 0 {
+		s.Error = result.ErrorMessage
+		if lastLine != "" {
+			s.Error += ": " + lastLine
+		}
+		return s
+	}
+	info, err := os.Stat(out)
+	if err != nil {
+		s.Error = err.Error()
+		return s
+	}
+	s.OutputSizeBytes = info.Size()
+	if s.FPS == 0 && media.FPS > 0 && s.EncodeSec > 0 {
+		s.FPS = s.DurationSec * media.FPS / s.EncodeSec
+	}
+	if s.BitrateKbps == 0 && s.DurationSec > 0 {
+		s.BitrateKbps = float64(s.OutputSizeBytes) * 8 / 1000 / s.DurationSec
+	}
+
+	for _, metric := range req.Metrics {
+		score, err := t.Quality.Measure(ctx, metric, out, req.InputPath, start, s.DurationSec, media.Width, media.Height)
+		if err != nil {
+			s.Error = err.Error()
+			continue
+		}
+		switch metric {
+		case "ssim":
+			s.SSIM = &score
+		case "vmaf":
+			s.VMAF = &score
+		}
+	}
+	return s
+}
+
+// summarize totals the samples that encoded into res and extrapolates
+// them to the input. It reports whether any sample encoded.
+func summarize(res *Result, media probe.MediaInfo) bool {
+	var seconds, encodeSec, fps, ssim, vmaf float64
+	var n, nSSIM, nVMAF int
+	for _, s := range res.Samples {
+		if s.OutputSizeBytes == 0 {
+			continue
+		}
+		n++
+		res.OutputSizeBytes += s.OutputSizeBytes
+		seconds += s.DurationSec
+		encodeSec += s.EncodeSec
+		fps += s.FPS
+		if s.SSIM != nil {
+			ssim += *s.SSIM
+			nSSIM++
+		}
+		if s.VMAF != nil {
+			vmaf += *s.VMAF
+			nVMAF++
+		}
+	}
+	if n == 0 || seconds == 0 {
+		return false
+	}
+	res.FPS = fps / float64(n)
+	res.BitrateKbps = float64(res.OutputSizeBytes) * 8 / 1000 / seconds
+	res.EstimatedSizeBytes = int64(float64(res.OutputSizeBytes) / seconds * res.InputDurationSec)
+	if res.FPS > 0 && media.FPS > 0 {
+		res.EstimatedEncodeSec = res.InputDurationSec * media.FPS / res.FPS
+	} else {
+		res.EstimatedEncodeSec = encodeSec / seconds * res.InputDurationSec
+	}
+	if nSSIM > 0 {
+		v := ssim / float64(nSSIM)
+		res.SSIM = &v
+	}
+	if nVMAF > 0 {
+		v := vmaf / float64(nVMAF)
+		res.VMAF = &v
+	}
+	return true
+}
@@ -0,0 +1,253 @@
+package sample
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/yuta/enque/backend/encoder"
+	"github.com/yuta/enque/backend/probe"
+	"github.com/yuta/enque/backend/profile"
+)
+
+// The test binary doubles as a fake encoder: when ENQUE_FAKE_ENCODER is set
+// it prints a progress line and writes 1000 bytes (or --rate times 100)
+// per second of the clip between --seek and --seekto (to 60s) to the -o
+// file. Inputs whose name contains "fail" exit with code 3.
+func TestMain(m *testing.M) {
+	if os.Getenv("ENQUE_FAKE_ENCODER") == "1" {
+		os.Exit(runFakeEncoder(os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+func runFakeEncoder(args []string) int {
+	var input, output string
+	from, to, rate := 0.0, 60.0, 10.0
+	for i := 0; i < len(args)-1; i++ {
+		switch args[i] {
+		case "-i":
+			input = args[i+1]
+		case "-o":
+			output = args[i+1]
+		case "--seek":
+			from = parseSeek(args[i+1])
+		case "--seekto":
+			to = parseSeek(args[i+1])
+		case "--rate":
+			rate, _ = strconv.ParseFloat(args[i+1], 64)
+		}
+	}
+	fmt.Fprintln(os.Stderr, "[50.0%] 100 frames: 200.00 fps, 4000 kbps")
+	fmt.Fprintln(os.Stderr, "[100.0%] 240 frames: 240.00 fps, 4200 kbps")
+	if strings.Contains(filepath.Base(input), "fail") {
+		fmt.Fprintln(os.Stderr, "error: simulated failure")
+		return 3
+	}
+	if err := os.WriteFile(output, make([]byte, int((to-from)*rate*100)), 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func parseSeek(s string) float64 {
+	var h, m int
+	var sec float64
+	fmt.Sscanf(s, "%d:%d:%f", &h, &m, &sec)
+	return float64(h*3600+m*60) + sec
+}
+
+type fakeAdapter struct{}
+
+var fakeProgressRe = regexp.MustCompile(`\[(\d+\.?\d*)%\].*?(\d+\.?\d*) fps, (\d+) kbps`)
+
+func (a *fakeAdapter) Type() string { return "nvencc" }
+func (a *fakeAdapter) BuildArgs(p profile.Profile, input, output string) ([]string, error) {
+	args := []string{"-i", input, "-o", output}
+	if p.NVEncCAdvanced.Seek != "" {
+		args = append(args, "--seek", p.NVEncCAdvanced.Seek)
+	}
+	if p.NVEncCAdvanced.SeekTo != "" {
+		args = append(args, "--seekto", p.NVEncCAdvanced.SeekTo)
+	}
+	if p.RateValue > 0 {
+		args = append(args, "--rate", strconv.FormatFloat(p.RateValue, 'f', -1, 64))
+	}
+	return args, nil
+}
+func (a *fakeAdapter) ParseProgress(line string) encoder.Progress {
+	m := fakeProgressRe.FindStringSubmatch(line)
+	if m == nil {
+		return encoder.Progress{RawLine: line}
+	}
+	pct, _ := strconv.ParseFloat(m[1], 64)
+	fps, _ := strconv.ParseFloat(m[2], 64)
+	kbps, _ := strconv.ParseFloat(m[3], 64)
+	return encoder.Progress{Percent: &pct, FPS: &fps, BitrateKbps: &kbps, RawLine: line}
+}
+func (a *fakeAdapter) SupportsDecoderFallback() bool { return false }
+
+type fakeProber struct{ media probe.MediaInfo }
+
+func (f fakeProber) Probe(ctx context.Context, path string) (probe.MediaInfo, error) {
+	return f.media, nil
+}
+
+// fakeKeyframes has a keyframe every 4 seconds.
+type fakeKeyframes struct{}
+
+func (fakeKeyframes) KeyframesBetween(ctx context.Context, path string, from, to float64) ([]float64, error) {
+	var ks []float64
+	for k := math.Floor(from/4) * 4; k <= to; k += 4 {
+		ks = append(ks, k)
+	}
+	return ks, nil
+}
+
+type fakeQuality struct{ calls []string }
+
+func (f *fakeQuality) Measure(ctx context.Context, metric, distorted, source string, start, duration float64, width, height int) (float64, error) {
+	f.calls = append(f.calls, fmt.Sprintf("%s %.0f+%.0f %dx%d", metric, start, duration, width, height))
+	if metric == "vmaf" {
+		return 95, nil
+	}
+	return 0.98, nil
+}
+
+func newTester(t *testing.T, q QualityMeter) *Tester {
+	t.Helper()
+	t.Setenv("ENQUE_FAKE_ENCODER", "1")
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	adapter := &fakeAdapter{}
+	media := probe.MediaInfo{DurationSec: 600, FPS: 24, Width: 1920, Height: 1080}
+	return &Tester{
+		Runner:    encoder.NewProcessRunner(exe, adapter, 0, 0),
+		Adapter:   adapter,
+		Prober:    fakeProber{media},
+		Keyframes: fakeKeyframes{},
+		Quality:   q,
+	}
+}
+
+func writeInput(t *testing.T, name string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte("input"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTester_Run(t *testing.T) {
+	q := &fakeQuality{}
+	tester := newTester(t, q)
+	outDir := t.TempDir()
+	res, err := tester.Run(context.Background(), Request{
+		InputPath:  writeInput(t, "movie.mkv"),
+		Profile:    profile.Profile{EncoderType: "nvencc", OutputContainer: "mp4"},
+		Timestamps: []float64{0, 101, 595},
+		Metrics:    []string{"ssim"},
+		OutputDir:  outDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Samples) != 3 {
+		t.Fatalf("samples=%d, want 3", len(res.Samples))
+	}
+	// 101 snaps back to the keyframe at 100; 595 is moved back to leave
+	// room for a whole sample, then snapped to 588.
+	for i, want := range []float64{0, 100, 588} {
+		s := res.Samples[i]
+		if s.Error != "" {
+			t.Fatalf("sample %d: %s", i, s.Error)
+		}
+		if s.StartSec != want || s.DurationSec != 10 {
+			t.Errorf("sample %d at %v+%v, want %v+10", i, s.StartSec, s.DurationSec, want)
+		}
+		if s.OutputSizeBytes != 10000 || s.FPS != 240 || s.BitrateKbps != 4200 {
+			t.Errorf("sample %d: size=%d fps=%v kbps=%v", i, s.OutputSizeBytes, s.FPS, s.BitrateKbps)
+		}
+		if want := filepath.Join(outDir, fmt.Sprintf("movie_sample%02d.mp4", i+1)); s.OutputPath != want || !exists(want) {
+			t.Errorf("sample %d output %q, want kept %q", i, s.OutputPath, want)
+		}
+	}
+	if res.EstimatedSizeBytes != 600000 {
+		t.Errorf("estimated size=%d, want 600000", res.EstimatedSizeBytes)
+	}
+	// 600 s at 24 fps encoded at 240 fps.
+	if res.EstimatedEncodeSec != 60 {
+		t.Errorf("estimated time=%v, want 60", res.EstimatedEncodeSec)
+	}
+	if res.SSIM == nil || *res.SSIM != 0.98 || res.VMAF != nil {
+		t.Errorf("ssim=%v vmaf=%v", res.SSIM, res.VMAF)
+	}
+	if want := "ssim 100+10 1920x1080"; len(q.calls) != 3 || q.calls[1] != want {
+		t.Errorf("quality calls=%v, want the second %q", q.calls, want)
+	}
+}
+
+func TestTester_RunDefaults(t *testing.T) {
+	tester := newTester(t, nil)
+	res, err := tester.Run(context.Background(), Request{
+		InputPath: writeInput(t, "movie.mkv"),
+		Profile: profile.Profile{EncoderType: "nvencc", OutputContainer: "mkv",
+			AutoCrop: "apply", Chunks: &profile.ChunkSettings{}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Three samples over the 590 s that leave room for one: 147.5, 295
+	// and 442.5, snapped to keyframes.
+	var starts []float64
+	for _, s := range res.Samples {
+		starts = append(starts, s.StartSec)
+		if s.OutputPath != "" {
+			t.Errorf("temp sample output %q reported", s.OutputPath)
+		}
+	}
+	if fmt.Sprint(starts) != "[144 292 440]" {
+		t.Errorf("starts=%v", starts)
+	}
+	if len(res.Notes) != 1 || !strings.Contains(res.Notes[0], "auto crop") {
+		t.Errorf("notes=%v", res.Notes)
+	}
+}
+
+func TestTester_RunFailures(t *testing.T) {
+	tester := newTester(t, nil)
+	_, err := tester.Run(context.Background(), Request{
+		InputPath: writeInput(t, "fail.mkv"),
+		Profile:   profile.Profile{EncoderType: "nvencc"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "simulated failure") {
+		t.Errorf("err=%v, want the encoder's last line", err)
+	}
+
+	for _, req := range []Request{
+		{InputPath: "x.mkv", DurationSec: 1},
+		{InputPath: "x.mkv", Count: MaxCount + 1},
+		{InputPath: "x.mkv", Timestamps: []float64{-1}},
+		{InputPath: "x.mkv", Metrics: []string{"psnr"}},
+		{InputPath: "x.mkv", Metrics: []string{"vmaf"}}, // no quality meter
+	} {
+		if _, err := tester.Run(context.Background(), req); err == nil || !strings.HasPrefix(err.Error(), encoder.ErrValidation) {
+			t.Errorf("%+v: err=%v, want %s", req, err, encoder.ErrValidation)
+		}
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
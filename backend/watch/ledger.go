@@ -0,0 +1,167 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yuta/enque/backend/queue"
+)
+
+// maxLedgerEntries bounds the ledger file; the oldest entries are dropped.
+const maxLedgerEntries = 20000
+
+// maxAttempts is how often a file whose job did not complete is enqueued
+// again before the watcher gives up on that version of it.
+const maxAttempts = 3
+
+// StatusOutput marks a ledger entry for a file Enque wrote itself, so a
+// watch folder that is also the output folder does not re-encode it.
+const StatusOutput = "output"
+
+// LedgerEntry records one processed file.
+type LedgerEntry struct {
+	Path        string    `json:"path"`
+	SizeBytes   int64     `json:"size_bytes"`
+	ModTime     time.Time `json:"mod_time"`
+	Status      string    `json:"status"` // job status, or "output"
+	JobID       string    `json:"job_id,omitempty"`
+	OutputPath  string    `json:"output_path,omitempty"`
+	Attempts    int       `json:"attempts,omitempty"` // jobs of this version that did not complete
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+type ledgerFile struct {
+	Version int           `json:"version"`
+	Entries []LedgerEntry `json:"entries"`
+}
+
+// Ledger remembers processed files across restarts (runtime/watch_ledger.json).
+type Ledger struct {
+	mu       sync.Mutex
+	filePath string
+	entries  map[string]LedgerEntry
+}
+
+// LoadLedger reads the ledger at filePath. A missing file yields an empty
+// ledger; a corrupt file is moved aside.
+func LoadLedger(filePath string) (*Ledger, error) {
+	l := &Ledger{filePath: filePath, entries: make(map[string]LedgerEntry)}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return l, nil
+		}
+		return nil, fmt.Errorf("read watch ledger: %w", err)
+	}
+
+	var lf ledgerFile
+	if err := json.Unmarshal(data, &lf); err != nil {
+		os.Rename(filePath, filePath+fmt.Sprintf(".broken.%d", time.Now().Unix()))
+		return l, nil
+	}
+	for _, e := range lf.Entries {
+		l.entries[ledgerKey(e.Path)] = e
+	}
+	return l, nil
+}
+
+// Seen reports whether path was already processed in this exact version
+// (same size and modification time), or is an output Enque produced. A
+// version whose job failed, timed out, was cancelled or skipped is not
+// processed until maxAttempts jobs did not complete.
+func (l *Ledger) Seen(path string, size int64, modTime time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.entries[ledgerKey(path)]
+	if !ok {
+		return false
+	}
+	if e.Status == StatusOutput {
+		return true
+	}
+	return e.SizeBytes == size && e.ModTime.Equal(modTime) &&
+		(e.Status == string(queue.JobCompleted) || e.Attempts >= maxAttempts)
+}
+
+// failedAttempts returns how many jobs of this version of path did not
+// complete.
+func (l *Ledger) failedAttempts(path string, size int64, modTime time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.entries[ledgerKey(path)]
+	if !ok || e.SizeBytes != size || !e.ModTime.Equal(modTime) {
+		return 0
+	}
+	return e.Attempts
+}
+
+// Record stores entries and persists the ledger.
+func (l *Ledger) Record(entries ...LedgerEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, e := range entries {
+		if e.ProcessedAt.IsZero() {
+			e.ProcessedAt = time.Now()
+		}
+		l.entries[ledgerKey(e.Path)] = e
+	}
+	return l.saveLocked()
+}
+
+// Len returns the number of entries.
+func (l *Ledger) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries)
+}
+
+// saveLocked writes the ledger atomically. Caller must hold mu.
+func (l *Ledger) saveLocked() error {
+	lf := ledgerFile{Version: 1, Entries: make([]LedgerEntry, 0, len(l.entries))}
+	for _, e := range l.entries {
+		lf.Entries = append(lf.Entries, e)
+	}
+	sort.Slice(lf.Entries, func(i, j int) bool {
+		return lf.Entries[i].ProcessedAt.After(lf.Entries[j].ProcessedAt)
+	})
+	if len(lf.Entries) > maxLedgerEntries {
+		for _, e := range lf.Entries[maxLedgerEntries:] {
+			delete(l.entries, ledgerKey(e.Path))
+		}
+		lf.Entries = lf.Entries[:maxLedgerEntries]
+	}
+
+	data, err := json.MarshalIndent(lf, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal watch ledger: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(l.filePath), 0o755); err != nil {
+		return fmt.Errorf("create dir: %w", err)
+	}
+	tmpPath := l.filePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return fmt.Errorf("write watch ledger: %w", err)
+	}
+	if err := os.Rename(tmpPath, l.filePath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("rename watch ledger: %w", err)
+	}
+	return nil
+}
+
+// ledgerKey normalizes a path for lookups (Windows paths are case-insensitive).
+func ledgerKey(path string) string {
+	key := filepath.Clean(path)
+	if runtime.GOOS == "windows" {
+		key = strings.ToLower(key)
+	}
+	return key
+}
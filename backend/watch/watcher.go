@@ -0,0 +1,366 @@
+// Package watch polls configured inbox folders and turns new, stable files
+// into jobs of the running session, or starts a session for them.
+package watch
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/yuta/enque/backend/config"
+	"github.com/yuta/enque/backend/encoder"
+	"github.com/yuta/enque/backend/events"
+	"github.com/yuta/enque/backend/logging"
+	"github.com/yuta/enque/backend/profile"
+	"github.com/yuta/enque/backend/queue"
+)
+
+// Queue is the subset of queue.Manager the watcher needs.
+type Queue interface {
+	GetSessionID() string
+	AppendJobs(sessionID string, jobs []queue.JobInput) error
+	StartEncode(req queue.EncodeRequest) error
+}
+
+// Options configures a Service.
+type Options struct {
+	Queue        Queue
+	Profiles     *profile.Manager
+	Config       *config.Manager
+	Ledger       *Ledger
+	Logger       *logging.AppLogger
+	PollInterval time.Duration // default 5s
+}
+
+type candidate struct {
+	size    int64
+	modTime time.Time
+	since   time.Time // first seen with this size and mtime
+}
+
+type pendingJob struct {
+	key     string
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// Service watches folders by polling. It implements events.EventSink to
+// learn when its jobs finish, and records them in the ledger then.
+type Service struct {
+	opts Options
+
+	mu         sync.Mutex
+	folders    []config.WatchFolderConfig
+	candidates map[string]*candidate
+	enqueued   map[string]bool       // ledger key -> job not finished yet
+	pending    map[string]pendingJob // job ID -> source file
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewService creates a service. Call SetFolders and Start to begin watching.
+func NewService(opts Options) *Service {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 5 * time.Second
+	}
+	return &Service{
+		opts:       opts,
+		candidates: make(map[string]*candidate),
+		enqueued:   make(map[string]bool),
+		pending:    make(map[string]pendingJob),
+	}
+}
+
+// SetFolders replaces the watched folder configuration.
+func (s *Service) SetFolders(folders []config.WatchFolderConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.folders = append([]config.WatchFolderConfig(nil), folders...)
+}
+
+// Start begins polling in the background.
+func (s *Service) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.loop(s.stop, s.done)
+}
+
+// Stop ends polling and waits for an in-progress scan to finish.
+func (s *Service) Stop() {
+	s.mu.Lock()
+	stop, done := s.stop, s.done
+	s.stop, s.done = nil, nil
+	s.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+func (s *Service) loop(stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(s.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.Scan(time.Now())
+		}
+	}
+}
+
+// Scan polls every enabled folder once and enqueues files that have been
+// stable long enough.
+func (s *Service) Scan(now time.Time) {
+	s.mu.Lock()
+	folders := s.folders
+	s.mu.Unlock()
+
+	seen := make(map[string]bool)
+	for _, wf := range folders {
+		if !wf.Enabled {
+			continue
+		}
+		ready := s.scanFolder(wf, now, seen)
+		if len(ready) > 0 {
+			s.enqueue(wf, ready)
+		}
+	}
+
+	// Forget candidates that disappeared or whose folder is gone.
+	s.mu.Lock()
+	for key := range s.candidates {
+		if !seen[key] {
+			delete(s.candidates, key)
+		}
+	}
+	s.mu.Unlock()
+}
+
+func (s *Service) scanFolder(wf config.WatchFolderConfig, now time.Time, seen map[string]bool) []pendingJob {
+	var ready []pendingJob
+	stable := time.Duration(wf.StableSec) * time.Second
+
+	walk := func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != wf.Path && !wf.Recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !Matches(wf, d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		key := ledgerKey(path)
+		seen[key] = true
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.enqueued[key] || s.opts.Ledger.Seen(path, info.Size(), info.ModTime()) {
+			return nil
+		}
+		c := s.candidates[key]
+		if c == nil || c.size != info.Size() || !c.modTime.Equal(info.ModTime()) {
+			s.candidates[key] = &candidate{size: info.Size(), modTime: info.ModTime(), since: now}
+			return nil
+		}
+		if now.Sub(c.since) < stable || hasWriter(path) {
+			return nil
+		}
+		ready = append(ready, pendingJob{key: key, path: path, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	}
+
+	if err := filepath.WalkDir(wf.Path, walk); err != nil {
+		s.logWarn("watch folder %q: %v", wf.Path, err)
+	}
+	return ready
+}
+
+// Matches reports whether a file name is picked up by the folder's
+// include/exclude patterns. Enque temp files never match.
+func Matches(wf config.WatchFolderConfig, name string) bool {
+	if strings.Contains(name, ".tmp.") {
+		return false
+	}
+	lower := strings.ToLower(name)
+	for _, pat := range wf.ExcludePatterns {
+		if ok, _ := filepath.Match(strings.ToLower(pat), lower); ok {
+			return false
+		}
+	}
+	if len(wf.Patterns) == 0 {
+		return true
+	}
+	for _, pat := range wf.Patterns {
+		if ok, _ := filepath.Match(strings.ToLower(pat), lower); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueue appends the files to the running session, or starts a new
+// session for them. On failure the files are picked up again by a later scan.
+func (s *Service) enqueue(wf config.WatchFolderConfig, files []pendingJob) {
+	cfg := s.opts.Config.Get()
+	profileID := wf.ProfileID
+	if profileID == "" {
+		profileID = cfg.DefaultProfileID
+	}
+	prof, ok := s.opts.Profiles.Get(profileID)
+	if !ok {
+		s.logWarn("watch folder %q: profile not found: %q", wf.Path, profileID)
+		return
+	}
+
+	var output *queue.OutputOverride
+	if wf.OutputFolderMode != "" || wf.OutputNameTemplate != "" {
+		output = &queue.OutputOverride{
+			FolderMode:   wf.OutputFolderMode,
+			FolderPath:   wf.OutputFolderPath,
+			NameTemplate: wf.OutputNameTemplate,
+		}
+	}
+
+	// Without a folder profile, enabled profile rules pick one per file
+	// when the queue adds the jobs.
+	useRules := wf.ProfileID == "" && cfg.ProfileRules.Enabled
+
+	jobs := make([]queue.JobInput, len(files))
+	for i, f := range files {
+		jobs[i] = queue.JobInput{
+			JobID:     fmt.Sprintf("w_%d_%s", time.Now().UnixMilli(), uuid.New().String()[:8]),
+			InputPath: f.path,
+			Output:    output,
+		}
+		if !useRules {
+			p := prof
+			jobs[i].Profile = &p
+		}
+	}
+
+	// Register before submitting: a short job may finish before submit returns.
+	s.mu.Lock()
+	for i, f := range files {
+		s.enqueued[f.key] = true
+		s.pending[jobs[i].JobID] = f
+		delete(s.candidates, f.key)
+	}
+	s.mu.Unlock()
+
+	if err := s.submit(cfg, prof, jobs); err != nil {
+		s.mu.Lock()
+		for i, f := range files {
+			delete(s.enqueued, f.key)
+			delete(s.pending, jobs[i].JobID)
+		}
+		s.mu.Unlock()
+		s.logWarn("watch folder %q: enqueue %d file(s): %v", wf.Path, len(jobs), err)
+		return
+	}
+	s.logInfo("watch folder %q: enqueued %d file(s)", wf.Path, len(jobs))
+}
+
+func (s *Service) submit(cfg config.AppConfig, prof profile.Profile, jobs []queue.JobInput) error {
+	if id := s.opts.Queue.GetSessionID(); id != "" {
+		err := s.opts.Queue.AppendJobs(id, jobs)
+		if err == nil || strings.HasPrefix(err.Error(), encoder.ErrValidation) {
+			return err
+		}
+		// The session is finished or winding down; try a new one.
+	}
+
+	snapshot := queue.NewAppConfigSnapshot(cfg)
+	// Nobody may be at the desk to answer an overwrite or crop prompt.
+	if snapshot.OverwriteMode == "ask" {
+		snapshot.OverwriteMode = "auto_rename"
+	}
+	snapshot.Unattended = true
+	return s.opts.Queue.StartEncode(queue.EncodeRequest{
+		Jobs:              jobs,
+		Profile:           prof,
+		AppConfigSnapshot: snapshot,
+	})
+}
+
+// Emit implements events.EventSink. Finished watch jobs are recorded in the
+// ledger; every completed output is recorded so it is never picked up. A
+// job that did not complete counts an attempt, and the file is enqueued
+// again, once stable_sec passed, until maxAttempts.
+func (s *Service) Emit(name string, data interface{}) {
+	d, ok := data.(events.JobFinished)
+	if !ok {
+		return
+	}
+
+	var entries []LedgerEntry
+	s.mu.Lock()
+	if p, ok := s.pending[d.JobID]; ok {
+		delete(s.pending, d.JobID)
+		delete(s.enqueued, p.key)
+		e := LedgerEntry{
+			Path:       p.path,
+			SizeBytes:  p.size,
+			ModTime:    p.modTime,
+			Status:     d.Status,
+			JobID:      d.JobID,
+			OutputPath: d.FinalOutputPath,
+		}
+		if d.Status != string(queue.JobCompleted) {
+			e.Attempts = s.opts.Ledger.failedAttempts(p.path, p.size, p.modTime) + 1
+			if e.Attempts < maxAttempts {
+				s.logWarn("watch: %s %s (attempt %d of %d); retrying", p.path, d.Status, e.Attempts, maxAttempts)
+			} else {
+				s.logWarn("watch: %s %s %d times; giving up until it changes", p.path, d.Status, e.Attempts)
+			}
+		}
+		entries = append(entries, e)
+	}
+	s.mu.Unlock()
+
+	if d.Status == string(queue.JobCompleted) && d.FinalOutputPath != "" {
+		entries = append(entries, LedgerEntry{Path: d.FinalOutputPath, Status: StatusOutput, JobID: d.JobID})
+	}
+	if len(entries) == 0 {
+		return
+	}
+	if err := s.opts.Ledger.Record(entries...); err != nil {
+		s.logWarn("watch ledger: %v", err)
+	}
+}
+
+func (s *Service) logInfo(msg string, args ...interface{}) {
+	if s.opts.Logger != nil {
+		s.opts.Logger.Info(msg, args...)
+	}
+}
+
+func (s *Service) logWarn(msg string, args ...interface{}) {
+	if s.opts.Logger != nil {
+		s.opts.Logger.Warn(msg, args...)
+	}
+}
@@ -0,0 +1,281 @@
+package watch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yuta/enque/backend/config"
+	"github.com/yuta/enque/backend/events"
+	"github.com/yuta/enque/backend/profile"
+	"github.com/yuta/enque/backend/queue"
+)
+
+type fakeQueue struct {
+	sessionID string
+	appendErr error
+	started   []queue.EncodeRequest
+	appended  [][]queue.JobInput
+}
+
+func (q *fakeQueue) GetSessionID() string { return q.sessionID }
+
+func (q *fakeQueue) AppendJobs(sessionID string, jobs []queue.JobInput) error {
+	if q.appendErr != nil {
+		return q.appendErr
+	}
+	q.appended = append(q.appended, jobs)
+	return nil
+}
+
+func (q *fakeQueue) StartEncode(req queue.EncodeRequest) error {
+	q.started = append(q.started, req)
+	q.sessionID = "s1"
+	return nil
+}
+
+type fixture struct {
+	svc     *Service
+	queue   *fakeQueue
+	inbox   string
+	ledger  string
+	profMgr *profile.Manager
+	cfgMgr  *config.Manager
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	dir := t.TempDir()
+	f := &fixture{
+		queue:   &fakeQueue{},
+		inbox:   filepath.Join(dir, "inbox"),
+		ledger:  filepath.Join(dir, "runtime", "watch_ledger.json"),
+		profMgr: profile.NewManager(filepath.Join(dir, "profiles.json")),
+		cfgMgr:  config.NewManager(filepath.Join(dir, "config.json")),
+	}
+	if err := os.MkdirAll(f.inbox, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.profMgr.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.cfgMgr.Load(); err != nil {
+		t.Fatal(err)
+	}
+	f.svc = f.newService(t)
+	return f
+}
+
+func (f *fixture) newService(t *testing.T) *Service {
+	t.Helper()
+	ledger, err := LoadLedger(f.ledger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := NewService(Options{Queue: f.queue, Profiles: f.profMgr, Config: f.cfgMgr, Ledger: ledger})
+	svc.SetFolders([]config.WatchFolderConfig{{
+		Enabled:          true,
+		Path:             f.inbox,
+		Patterns:         []string{"*.mp4"},
+		ProfileID:        f.profMgr.List()[0].ID,
+		OutputFolderMode: "specified",
+		OutputFolderPath: filepath.Join(filepath.Dir(f.inbox), "out"),
+		StableSec:        10,
+	}})
+	return svc
+}
+
+func (f *fixture) write(t *testing.T, name, content string) string {
+	t.Helper()
+	p := filepath.Join(f.inbox, name)
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestService_EnqueuesStableFiles(t *testing.T) {
+	f := newFixture(t)
+	in := f.write(t, "clip.mp4", "data")
+	f.write(t, "notes.txt", "ignored")
+
+	t0 := time.Now()
+	f.svc.Scan(t0)
+	f.svc.Scan(t0.Add(9 * time.Second))
+	if len(f.queue.started) != 0 {
+		t.Fatal("file enqueued before the stability window elapsed")
+	}
+
+	f.svc.Scan(t0.Add(10 * time.Second))
+	if len(f.queue.started) != 1 {
+		t.Fatalf("StartEncode called %d times, want 1", len(f.queue.started))
+	}
+	req := f.queue.started[0]
+	if len(req.Jobs) != 1 || req.Jobs[0].InputPath != in {
+		t.Fatalf("jobs=%+v, want only %s", req.Jobs, in)
+	}
+	job := req.Jobs[0]
+	if job.Profile == nil || job.Profile.ID != f.profMgr.List()[0].ID {
+		t.Errorf("job profile=%v, want the folder profile", job.Profile)
+	}
+	if job.Output == nil || job.Output.FolderMode != "specified" {
+		t.Errorf("job output=%+v, want folder output settings", job.Output)
+	}
+	if req.AppConfigSnapshot.OverwriteMode != "auto_rename" {
+		t.Errorf("overwrite_mode=%q, want ask mapped to auto_rename", req.AppConfigSnapshot.OverwriteMode)
+	}
+
+	// Already enqueued: later scans must not enqueue it again.
+	f.svc.Scan(t0.Add(30 * time.Second))
+	if len(f.queue.started)+len(f.queue.appended) != 1 {
+		t.Error("file enqueued twice")
+	}
+}
+
+func TestService_SizeChangeRestartsWindow(t *testing.T) {
+	f := newFixture(t)
+	f.write(t, "growing.mp4", "a")
+
+	t0 := time.Now()
+	f.svc.Scan(t0)
+	f.write(t, "growing.mp4", "abc")
+	f.svc.Scan(t0.Add(10 * time.Second))
+	if len(f.queue.started) != 0 {
+		t.Fatal("file enqueued while still growing")
+	}
+	f.svc.Scan(t0.Add(20 * time.Second))
+	if len(f.queue.started) != 1 {
+		t.Fatal("file not enqueued once stable")
+	}
+}
+
+func TestService_AppendsToRunningSession(t *testing.T) {
+	f := newFixture(t)
+	f.queue.sessionID = "running"
+	f.write(t, "a.mp4", "data")
+
+	t0 := time.Now()
+	f.svc.Scan(t0)
+	f.svc.Scan(t0.Add(10 * time.Second))
+	if len(f.queue.appended) != 1 || len(f.queue.started) != 0 {
+		t.Fatalf("appended=%d started=%d, want 1/0", len(f.queue.appended), len(f.queue.started))
+	}
+
+	// A finished session rejects appends; a new one is started instead.
+	f2 := newFixture(t)
+	f2.queue.sessionID = "finished"
+	f2.queue.appendErr = errors.New("session finished is no longer accepting jobs")
+	f2.write(t, "b.mp4", "data")
+	f2.svc.Scan(t0)
+	f2.svc.Scan(t0.Add(10 * time.Second))
+	if len(f2.queue.started) != 1 {
+		t.Fatalf("started=%d, want 1", len(f2.queue.started))
+	}
+}
+
+func TestService_LedgerSurvivesRestart(t *testing.T) {
+	f := newFixture(t)
+	in := f.write(t, "a.mp4", "data")
+
+	t0 := time.Now()
+	f.svc.Scan(t0)
+	f.svc.Scan(t0.Add(10 * time.Second))
+	job := f.queue.started[0].Jobs[0]
+
+	// The output lands in the watched folder too.
+	out := f.write(t, "a_encoded.mp4", "encoded")
+	f.svc.Emit(events.NameJobFinished, events.JobFinished{
+		JobID:           job.JobID,
+		InputPath:       in,
+		Status:          "completed",
+		FinalOutputPath: out,
+	})
+
+	f.queue = &fakeQueue{}
+	restarted := f.newService(t)
+	restarted.Scan(t0.Add(time.Minute))
+	restarted.Scan(t0.Add(2 * time.Minute))
+	if len(f.queue.started) != 0 {
+		t.Fatalf("processed file or own output re-enqueued after restart: %+v", f.queue.started)
+	}
+
+	// A replaced file with the same name is a new file.
+	f.write(t, "a.mp4", "new camera dump")
+	restarted.Scan(t0.Add(3 * time.Minute))
+	restarted.Scan(t0.Add(4 * time.Minute))
+	if len(f.queue.started) != 1 {
+		t.Error("replaced file was not enqueued")
+	}
+}
+
+func TestMatches(t *testing.T) {
+	wf := config.WatchFolderConfig{Patterns: []string{"*.MP4", "*.mkv"}, ExcludePatterns: []string{"*_encoded.*"}}
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"clip.mp4", true},
+		{"clip.MKV", true},
+		{"clip.mov", false},
+		{"clip_encoded.mp4", false},
+		{"clip.j_1_abc.tmp.mp4", false},
+	}
+	for _, tt := range tests {
+		if got := Matches(wf, tt.name); got != tt.want {
+			t.Errorf("Matches(%q)=%v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if !Matches(config.WatchFolderConfig{}, "anything.bin") {
+		t.Error("empty patterns must match all files")
+	}
+}
+
+func TestService_RetriesJobsThatDidNotComplete(t *testing.T) {
+	f := newFixture(t)
+	in := f.write(t, "a.mp4", "data")
+
+	t0 := time.Now()
+	f.svc.Scan(t0)
+	f.svc.Scan(t0.Add(10 * time.Second))
+	enqueued := func() []queue.JobInput {
+		jobs := []queue.JobInput{}
+		for _, req := range f.queue.started {
+			jobs = append(jobs, req.Jobs...)
+		}
+		for _, a := range f.queue.appended {
+			jobs = append(jobs, a...)
+		}
+		return jobs
+	}
+	fail := func(status string) {
+		t.Helper()
+		jobs := enqueued()
+		f.svc.Emit(events.NameJobFinished, events.JobFinished{JobID: jobs[len(jobs)-1].JobID, InputPath: in, Status: status})
+	}
+
+	// A failed job is retried once the file is stable again, after a
+	// restart too.
+	fail("failed")
+	f.svc.Scan(t0.Add(20 * time.Second))
+	f.svc.Scan(t0.Add(30 * time.Second))
+	if n := len(enqueued()); n != 2 {
+		t.Fatalf("enqueued %d times, want a retry after the failure", n)
+	}
+	fail("cancelled")
+	restarted := f.newService(t)
+	restarted.Scan(t0.Add(time.Minute))
+	restarted.Scan(t0.Add(2 * time.Minute))
+	if n := len(enqueued()); n != 3 {
+		t.Fatalf("enqueued %d times, want a retry after the restart", n)
+	}
+
+	// The third attempt that does not complete is the last.
+	restarted.Emit(events.NameJobFinished, events.JobFinished{JobID: enqueued()[2].JobID, InputPath: in, Status: "timeout"})
+	restarted.Scan(t0.Add(3 * time.Minute))
+	restarted.Scan(t0.Add(4 * time.Minute))
+	if n := len(enqueued()); n != 3 {
+		t.Errorf("enqueued %d times, want no more than %d attempts", n, maxAttempts)
+	}
+}
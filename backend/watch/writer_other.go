@@ -0,0 +1,9 @@
+//go:build !windows
+
+package watch
+
+// hasWriter has no portable equivalent outside Windows (no mandatory
+// locks); the size/mtime stability window is the only signal there.
+func hasWriter(path string) bool {
+	return false
+}
@@ -0,0 +1,23 @@
+//go:build windows
+
+package watch
+
+import "syscall"
+
+const errorSharingViolation syscall.Errno = 32
+
+// hasWriter reports whether another process holds the file open for
+// writing: opening it while denying write sharing fails with a sharing
+// violation in that case.
+func hasWriter(path string) bool {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return false
+	}
+	h, err := syscall.CreateFile(p, syscall.GENERIC_READ, syscall.FILE_SHARE_READ, nil, syscall.OPEN_EXISTING, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		return err == errorSharingViolation
+	}
+	syscall.CloseHandle(h)
+	return false
+}
@@ -106,6 +106,9 @@ function App() {
         output_name_template: outputSettings.outputNameTemplate,
         overwrite_mode: outputSettings.overwriteMode,
         nvencc_path: config.nvencc_path,
+        ffprobe_path: config.ffprobe_path,
+        ffmpeg_path: config.ffmpeg_path,
+        duplicate_inputs: config.duplicate_inputs,
       },
     };
 
@@ -0,0 +1,78 @@
+import { useState } from "react";
+import { useTranslation } from "react-i18next";
+import { Crop } from "lucide-react";
+import type { CropRect, CropRequest } from "@/stores/encodeStore";
+
+interface CropDialogProps {
+  request: CropRequest;
+  onApply: (rect: CropRect) => void;
+  onIgnore: () => void;
+  onSkip: () => void;
+}
+
+const SIDES = ["left", "top", "right", "bottom"] as const;
+
+export function CropDialog({ request, onApply, onIgnore, onSkip }: CropDialogProps) {
+  const { t } = useTranslation();
+  const [rect, setRect] = useState<CropRect>(request.rect);
+
+  const width = request.width - rect.left - rect.right;
+  const height = request.height - rect.top - rect.bottom;
+  const valid = SIDES.every((s) => rect[s] >= 0 && rect[s] % 2 === 0) && width > 0 && height > 0;
+
+  return (
+    <div className="dialog-overlay">
+      <div className="dialog-panel w-[480px]">
+        <div className="dialog-header">
+          <div className="flex items-center gap-2.5">
+            <Crop size={16} style={{ color: '#fbbf24' }} />
+            <h2 className="text-sm font-display font-semibold" style={{ color: '#e8e6e3' }}>
+              {t("encode.cropTitle")}
+            </h2>
+          </div>
+        </div>
+        <div className="p-5">
+          <p className="text-xs mb-3" style={{ color: '#9d9da7' }}>{t("encode.cropMsg")}</p>
+          <p
+            className="text-xs font-mono rounded-lg p-3 mb-3 break-all"
+            style={{
+              background: 'rgba(10, 10, 15, 0.8)',
+              color: '#9d9da7',
+              border: '1px solid rgba(255,255,255,0.04)',
+            }}
+          >
+            {request.inputPath}
+          </p>
+          <div className="flex items-center gap-2">
+            {SIDES.map((side) => (
+              <input
+                key={side}
+                type="number"
+                title={side}
+                value={rect[side]}
+                min={0}
+                step={2}
+                onChange={(e) => setRect({ ...rect, [side]: Number(e.target.value) })}
+                className="w-16 form-input font-mono"
+              />
+            ))}
+            <span className="text-xs font-mono" style={{ color: '#9d9da7' }}>
+              {t("encode.cropResult", { width, height })}
+            </span>
+          </div>
+        </div>
+        <div className="dialog-footer">
+          <button onClick={onSkip} className="btn-secondary">
+            {t("encode.skipFile")}
+          </button>
+          <button onClick={onIgnore} className="btn-secondary">
+            {t("encode.cropIgnore")}
+          </button>
+          <button onClick={() => onApply(rect)} disabled={!valid} className="btn-warning">
+            {t("encode.cropApply")}
+          </button>
+        </div>
+      </div>
+    </div>
+  );
+}
@@ -10,6 +10,13 @@ interface EncodeControlsProps {
 export function EncodeControls({ onStop, onAbort }: EncodeControlsProps) {
   const { t } = useTranslation();
   const sessionState = useEncodeStore((s) => s.sessionState);
+  const sessionEta = useEncodeStore((s) => s.sessionEta);
+
+  const formatRemaining = (sec: number) => {
+    const h = Math.floor(sec / 3600);
+    const m = Math.floor((sec % 3600) / 60);
+    return h > 0 ? `${h}h ${m}m` : `${Math.max(m, 1)}m`;
+  };
 
   return (
     <div className="flex items-center gap-3 px-5 py-3" style={{ borderTop: '1px solid rgba(255,255,255,0.06)', background: 'rgba(18, 18, 26, 0.5)' }}>
@@ -35,6 +42,15 @@ export function EncodeControls({ onStop, onAbort }: EncodeControlsProps) {
           {t("encode.abortingMsg")}
         </span>
       )}
+      {sessionEta && (sessionState === "running" || sessionState === "stopping") && (
+        <span className="ml-auto text-xs font-display" style={{ color: '#9ca3af' }}>
+          {t("encode.sessionEta", {
+            time: new Date(sessionEta.etaAt).toLocaleTimeString([], { hour: "2-digit", minute: "2-digit" }),
+            remaining: formatRemaining(sessionEta.etaSec),
+          })}
+          {sessionEta.throughputFps ? ` · ${t("encode.throughput", { fps: sessionEta.throughputFps.toFixed(0) })}` : ""}
+        </span>
+      )}
     </div>
   );
 }
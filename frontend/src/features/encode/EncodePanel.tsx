@@ -1,11 +1,12 @@
 import { useState } from "react";
 import { useTranslation } from "react-i18next";
-import { useEncodeStore } from "@/stores/encodeStore";
+import { useEncodeStore, type CropRect } from "@/stores/encodeStore";
 import { OverallProgress } from "./OverallProgress";
 import { JobProgressList } from "./JobProgressList";
 import { LogViewer } from "./LogViewer";
 import { EncodeControls } from "./EncodeControls";
 import { OverwriteDialog } from "./OverwriteDialog";
+import { CropDialog } from "./CropDialog";
 import { SessionSummary } from "./SessionSummary";
 import * as api from "@/lib/api";
 
@@ -16,8 +17,10 @@ export function EncodePanel() {
   const sessionState = useEncodeStore((s) => s.sessionState);
   const sessionSummary = useEncodeStore((s) => s.sessionSummary);
   const overwriteRequest = useEncodeStore((s) => s.overwriteRequest);
+  const cropRequest = useEncodeStore((s) => s.cropRequest);
   const resetSession = useEncodeStore((s) => s.resetSession);
   const clearOverwriteRequest = useEncodeStore((s) => s.clearOverwriteRequest);
+  const clearCropRequest = useEncodeStore((s) => s.clearCropRequest);
 
   const handleStop = async () => {
     if (sessionId) {
@@ -52,6 +55,13 @@ export function EncodePanel() {
     }
   };
 
+  const handleCrop = async (decision: string, rect: CropRect | null = null) => {
+    if (cropRequest) {
+      await api.resolveCrop(cropRequest.sessionId, cropRequest.jobId, decision, rect);
+      clearCropRequest();
+    }
+  };
+
   const handleDismissSummary = () => {
     resetSession();
   };
@@ -104,6 +114,16 @@ export function EncodePanel() {
         />
       )}
 
+      {cropRequest && !overwriteRequest && (
+        <CropDialog
+          key={cropRequest.jobId}
+          request={cropRequest}
+          onApply={(rect) => handleCrop("apply", rect)}
+          onIgnore={() => handleCrop("ignore")}
+          onSkip={() => handleCrop("skip")}
+        />
+      )}
+
       {sessionSummary && (sessionState === "completed" || sessionState === "aborted") && (
         <SessionSummary summary={sessionSummary} onDismiss={handleDismissSummary} />
       )}
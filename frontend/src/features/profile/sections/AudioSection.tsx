@@ -1,5 +1,8 @@
 import { useTranslation } from "react-i18next";
-import { useProfileStore } from "@/stores/profileStore";
+import { useProfileStore, type TrackRules } from "@/stores/profileStore";
+
+const splitLanguages = (v: string) =>
+  v.split(/[\s,]+/).map((s) => s.trim().toLowerCase()).filter(Boolean);
 
 export function AudioSection() {
   const { t } = useTranslation();
@@ -7,6 +10,9 @@ export function AudioSection() {
   if (!p) return null;
 
   const isPreset = p.is_preset;
+  const tracks = p.tracks ?? null;
+  const updateTracks = (patch: Partial<TrackRules>) =>
+    update({ tracks: { ...(tracks ?? {}), ...patch } });
 
   return (
     <section>
@@ -42,6 +48,122 @@ export function AudioSection() {
             />
           </div>
         )}
+
+        <div className="flex items-center gap-2">
+          <label className="flex items-center gap-2 text-xs cursor-pointer w-28" style={{ color: '#9d9da7' }}>
+            <input
+              type="checkbox"
+              checked={!!p.loudness}
+              onChange={(e) => update({ loudness: e.target.checked ? { target_lufs: -23, true_peak: -1 } : null })}
+              disabled={isPreset}
+              className="rounded"
+            />
+            {t("profile.loudness")}
+          </label>
+          {p.loudness && (
+            <>
+              <input
+                type="number"
+                value={p.loudness.target_lufs}
+                onChange={(e) => update({ loudness: { ...p.loudness!, target_lufs: Number(e.target.value) } })}
+                disabled={isPreset}
+                min={-70}
+                max={-5}
+                step={0.5}
+                className="w-20 form-input font-mono"
+              />
+              <span className="text-xs" style={{ color: '#9d9da7' }}>LUFS</span>
+              <input
+                type="number"
+                value={p.loudness.true_peak}
+                onChange={(e) => update({ loudness: { ...p.loudness!, true_peak: Number(e.target.value) } })}
+                disabled={isPreset}
+                min={-9}
+                max={0}
+                step={0.5}
+                className="w-20 form-input font-mono"
+              />
+              <span className="text-xs" style={{ color: '#9d9da7' }}>dBTP</span>
+            </>
+          )}
+        </div>
+
+        <label className="flex items-center gap-2 text-xs cursor-pointer" style={{ color: '#9d9da7' }}>
+          <input
+            type="checkbox"
+            checked={tracks !== null}
+            onChange={(e) => update({ tracks: e.target.checked ? {} : null })}
+            disabled={isPreset}
+            className="rounded"
+          />
+          {t("profile.trackRules")}
+        </label>
+
+        {tracks && (
+          <>
+            <div className="flex items-center gap-2">
+              <label className="form-label w-28">{t("profile.audioLanguages")}</label>
+              <input
+                type="text"
+                key={`${p.id}-audio_languages`}
+                defaultValue={(tracks.audio_languages ?? []).join(", ")}
+                onBlur={(e) => updateTracks({ audio_languages: splitLanguages(e.target.value) })}
+                disabled={isPreset}
+                placeholder="jpn, eng"
+                className="w-40 form-input font-mono"
+              />
+            </div>
+            <div className="flex items-center gap-2">
+              <label className="form-label w-28">{t("profile.otherAudio")}</label>
+              <select
+                value={tracks.other_audio ?? ""}
+                onChange={(e) => updateTracks({ other_audio: e.target.value })}
+                disabled={isPreset}
+                className="form-input"
+              >
+                <option value="">{t("profile.sameAsAudioMode")}</option>
+                <option value="copy">Copy</option>
+                <option value="aac">AAC</option>
+                <option value="opus">Opus</option>
+                <option value="none">{t("profile.dropTrack")}</option>
+              </select>
+            </div>
+            <div className="flex items-center gap-2">
+              <label className="form-label w-28">{t("profile.subLanguages")}</label>
+              <input
+                type="text"
+                key={`${p.id}-sub_languages`}
+                defaultValue={(tracks.sub_languages ?? []).join(", ")}
+                onBlur={(e) => updateTracks({ sub_languages: splitLanguages(e.target.value) })}
+                disabled={isPreset}
+                placeholder="jpn"
+                className="w-40 form-input font-mono"
+              />
+            </div>
+            <div className="flex items-center gap-5 pt-1">
+              <label className="flex items-center gap-2 text-xs cursor-pointer" style={{ color: '#9d9da7' }}>
+                <input
+                  type="checkbox"
+                  checked={!!tracks.drop_commentary}
+                  onChange={(e) => updateTracks({ drop_commentary: e.target.checked })}
+                  disabled={isPreset}
+                  className="rounded"
+                />
+                {t("profile.dropCommentary")}
+              </label>
+              <label className="flex items-center gap-2 text-xs cursor-pointer" style={{ color: '#9d9da7' }}>
+                <input
+                  type="checkbox"
+                  checked={!!tracks.sidecars}
+                  onChange={(e) => updateTracks({ sidecars: e.target.checked })}
+                  disabled={isPreset}
+                  className="rounded"
+                />
+                {t("profile.sidecars")}
+              </label>
+            </div>
+          </>
+        )}
       </div>
     </section>
   );
@@ -6,6 +6,8 @@ const transferOpts = ["auto", "bt709", "smpte2084", "arib-std-b67", "smpte240m",
 const colorprimOpts = ["auto", "bt709", "bt2020", "smpte240m", "smpte431", "smpte432"];
 const colorrangeOpts = ["auto", "limited", "full"];
 const dhdrOpts = ["off", "copy"];
+const hdrModeOpts = ["off", "warn", "enforce", "tonemap"];
+const tonemapOpts = ["hable", "mobius", "reinhard", "bt2390"];
 
 export function ColorSection() {
   const { t } = useTranslation();
@@ -20,6 +22,8 @@ export function ColorSection() {
     { label: "Color Prim", field: "colorprim" as const, opts: colorprimOpts },
     { label: "Color Range", field: "colorrange" as const, opts: colorrangeOpts },
     { label: "HDR10+", field: "dhdr10_info" as const, opts: dhdrOpts },
+    { label: "HDR Input", field: "hdr_mode" as const, opts: hdrModeOpts },
+    { label: "Tone Map", field: "tonemap" as const, opts: tonemapOpts },
   ];
 
   return (
@@ -32,7 +36,7 @@ export function ColorSection() {
           <div key={field} className="flex items-center gap-2">
             <label className="form-label w-28">{label}</label>
             <select
-              value={p[field]}
+              value={p[field] || opts[0]}
               onChange={(e) => update({ [field]: e.target.value })}
               disabled={isPreset}
               className="form-input"
@@ -69,6 +69,53 @@ export function SpeedSection() {
             ))}
           </select>
         </div>
+
+        <div className="flex items-center gap-2">
+          <label className="flex items-center gap-2 text-xs cursor-pointer w-28" style={{ color: '#9d9da7' }}>
+            <input
+              type="checkbox"
+              checked={!!p.chunks}
+              onChange={(e) => update({ chunks: e.target.checked ? { segment_sec: 300, retries: 1 } : null })}
+              disabled={isPreset}
+              className="rounded"
+            />
+            {t("profile.chunks")}
+          </label>
+          {p.chunks && (
+            <>
+              <select
+                value={p.chunks.boundary || "keyframe"}
+                onChange={(e) => update({ chunks: { ...p.chunks!, boundary: e.target.value } })}
+                disabled={isPreset}
+                className="form-input"
+              >
+                <option value="keyframe">{t("profile.chunkBoundaryKeyframe")}</option>
+                <option value="scene">{t("profile.chunkBoundaryScene")}</option>
+              </select>
+              <span className="text-xs" style={{ color: '#9d9da7' }}>{t("profile.chunkSegment")}</span>
+              <input
+                type="number"
+                value={p.chunks.segment_sec ?? 300}
+                onChange={(e) => update({ chunks: { ...p.chunks!, segment_sec: Number(e.target.value) } })}
+                disabled={isPreset}
+                min={30}
+                max={3600}
+                step={30}
+                className="w-20 form-input font-mono"
+              />
+              <span className="text-xs" style={{ color: '#9d9da7' }}>{t("profile.chunkRetries")}</span>
+              <input
+                type="number"
+                value={p.chunks.retries ?? 0}
+                onChange={(e) => update({ chunks: { ...p.chunks!, retries: Number(e.target.value) } })}
+                disabled={isPreset}
+                min={0}
+                max={5}
+                className="w-14 form-input font-mono"
+              />
+            </>
+          )}
+        </div>
       </div>
     </section>
   );
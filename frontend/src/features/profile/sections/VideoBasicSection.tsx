@@ -42,6 +42,7 @@ export function VideoBasicSection() {
             {["qvbr", "cqp", "cbr", "vbr"].map((rc) => (
               <option key={rc} value={rc}>{rc.toUpperCase()}</option>
             ))}
+            <option value="target_size">Target Size (MB)</option>
           </select>
           <input
             type="number"
@@ -50,6 +51,17 @@ export function VideoBasicSection() {
             disabled={isPreset}
             className="w-20 form-input font-mono"
           />
+          {p.rate_control === "target_size" && (
+            <select
+              value={p.target_size_mode || "vbr"}
+              onChange={(e) => update({ target_size_mode: e.target.value })}
+              disabled={isPreset}
+              className="form-input"
+            >
+              <option value="vbr">VBR</option>
+              <option value="cbr">CBR</option>
+            </select>
+          )}
         </div>
 
         <div className="flex items-center gap-2">
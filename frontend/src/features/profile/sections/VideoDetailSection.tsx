@@ -39,6 +39,20 @@ export function VideoDetailSection() {
           </div>
         ))}
 
+        <div className="flex items-center gap-2">
+          <label className="form-label w-28">Auto Crop</label>
+          <select
+            value={p.auto_crop || "off"}
+            onChange={(e) => update({ auto_crop: e.target.value === "off" ? "" : e.target.value })}
+            disabled={isPreset}
+            className="form-input"
+          >
+            <option value="off">{t("profile.autoCropOff")}</option>
+            <option value="apply">{t("profile.autoCropApply")}</option>
+            <option value="confirm">{t("profile.autoCropConfirm")}</option>
+          </select>
+        </div>
+
         <div className="flex items-center gap-5 pt-1">
           <label className="flex items-center gap-2 text-xs cursor-pointer" style={{ color: '#9d9da7' }}>
             <input
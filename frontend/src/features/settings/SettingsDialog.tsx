@@ -80,6 +80,19 @@ export function SettingsDialog({ open, onClose }: SettingsDialogProps) {
                 </select>
               </div>
 
+              <div className="flex items-center gap-2">
+                <label className="form-label w-28">{t("settings.duplicateInputs")}</label>
+                <select
+                  value={config.duplicate_inputs}
+                  onChange={(e) => updateConfig({ duplicate_inputs: e.target.value })}
+                  className="form-input"
+                >
+                  <option value="warn">{t("settings.duplicateWarn")}</option>
+                  <option value="skip">{t("settings.duplicateSkip")}</option>
+                  <option value="allow">{t("settings.duplicateAllow")}</option>
+                </select>
+              </div>
+
               <label className="flex items-center gap-2 text-xs cursor-pointer" style={{ color: '#9d9da7' }}>
                 <input
                   type="checkbox"
@@ -1,6 +1,8 @@
 // Wails binding call wrappers.
 // Calls are routed to Go backend via Wails v2 runtime bindings.
 
+import type { CropRect } from "@/stores/encodeStore";
+
 // eslint-disable-next-line @typescript-eslint/no-explicit-any
 function getApp(): any {
   // eslint-disable-next-line @typescript-eslint/no-explicit-any
@@ -67,6 +69,15 @@ export async function resolveOverwrite(sessionId: string, jobId: string, decisio
   return getApp().ResolveOverwrite(sessionId, jobId, decision);
 }
 
+export async function resolveCrop(
+  sessionId: string,
+  jobId: string,
+  decision: string,
+  rect: CropRect | null,
+): Promise<void> {
+  return getApp().ResolveCrop(sessionId, jobId, decision, rect);
+}
+
 export async function listTempArtifacts(): Promise<string[]> {
   return getApp().ListTempArtifacts();
 }
@@ -79,6 +90,26 @@ export async function getCommandPreview(profile: unknown, inputPath: string, out
   return getApp().GetCommandPreview(JSON.stringify(profile), inputPath, outputPath);
 }
 
+export async function testEncode(request: unknown): Promise<unknown> {
+  return getApp().TestEncode(JSON.stringify(request));
+}
+
+export async function cancelTestEncode(): Promise<void> {
+  return getApp().CancelTestEncode();
+}
+
+export async function compareProfiles(request: unknown): Promise<unknown> {
+  return getApp().CompareProfiles(JSON.stringify(request));
+}
+
+export async function listComparisons(profileId: string): Promise<unknown[]> {
+  return getApp().ListComparisons(profileId);
+}
+
+export async function deleteComparison(id: string): Promise<void> {
+  return getApp().DeleteComparison(id);
+}
+
 export async function openFileDialog(): Promise<string[]> {
   return getApp().OpenFileDialog();
 }
@@ -10,6 +10,7 @@ export const EventNames = {
   JOB_PROGRESS: "enque:job_progress",
   JOB_LOG: "enque:job_log",
   JOB_NEEDS_OVERWRITE: "enque:job_needs_overwrite",
+  JOB_NEEDS_CROP: "enque:job_needs_crop",
   JOB_FINISHED: "enque:job_finished",
   SESSION_STATE: "enque:session_state",
   SESSION_FINISHED: "enque:session_finished",
@@ -50,6 +51,10 @@ export function registerEventListeners() {
     store().onJobNeedsOverwrite(data);
   });
 
+  eventsOn(EventNames.JOB_NEEDS_CROP, (data: Record<string, unknown>) => {
+    store().onJobNeedsCrop(data);
+  });
+
   eventsOn(EventNames.JOB_FINISHED, (data: Record<string, unknown>) => {
     store().onJobFinished(data);
   });
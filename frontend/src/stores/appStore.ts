@@ -30,6 +30,7 @@ export interface AppConfig {
   overwrite_mode: string;
   language: string;
   default_profile_id: string;
+  duplicate_inputs: string;
 }
 
 export interface DetectionResult {
@@ -29,12 +29,34 @@ export interface SessionSummary {
   skippedJobs: number;
 }
 
+export interface SessionETA {
+  etaSec: number;
+  etaAt: string;
+  throughputFps?: number;
+}
+
 export interface OverwriteRequest {
   sessionId: string;
   jobId: string;
   outputPath: string;
 }
 
+export interface CropRect {
+  left: number;
+  top: number;
+  right: number;
+  bottom: number;
+}
+
+export interface CropRequest {
+  sessionId: string;
+  jobId: string;
+  inputPath: string;
+  rect: CropRect;
+  width: number;
+  height: number;
+}
+
 const MAX_LOG_LINES = 2000;
 
 interface EncodeState {
@@ -43,7 +65,9 @@ interface EncodeState {
   jobProgress: Record<string, JobProgress>;
   jobLogs: Record<string, string[]>;
   sessionSummary: SessionSummary | null;
+  sessionEta: SessionETA | null;
   overwriteRequest: OverwriteRequest | null;
+  cropRequest: CropRequest | null;
   warnings: string[];
 
   // Actions
@@ -57,9 +81,11 @@ interface EncodeState {
   onSessionState: (data: Record<string, unknown>) => void;
   onSessionFinished: (data: Record<string, unknown>) => void;
   onJobNeedsOverwrite: (data: Record<string, unknown>) => void;
+  onJobNeedsCrop: (data: Record<string, unknown>) => void;
   onWarning: (data: Record<string, unknown>) => void;
   skipPendingJob: (jobId: string) => void;
   clearOverwriteRequest: () => void;
+  clearCropRequest: () => void;
   resetSession: () => void;
 }
 
@@ -69,7 +95,9 @@ export const useEncodeStore = create<EncodeState>((set) => ({
   jobProgress: {},
   jobLogs: {},
   sessionSummary: null,
+  sessionEta: null,
   overwriteRequest: null,
+  cropRequest: null,
   warnings: [],
 
   setSessionState: (sessionState) => set({ sessionState }),
@@ -90,7 +118,9 @@ export const useEncodeStore = create<EncodeState>((set) => ({
       jobProgress: s.jobProgress,
       jobLogs: {},
       sessionSummary: null,
+      sessionEta: null,
       overwriteRequest: null,
+      cropRequest: null,
       warnings: [],
     })),
 
@@ -167,11 +197,20 @@ export const useEncodeStore = create<EncodeState>((set) => ({
     else if (state === "aborting") sessionState = "aborting";
     else if (state === "completed") sessionState = "completed";
     else if (state === "aborted") sessionState = "aborted";
-    set({ sessionState });
+    const sessionEta =
+      data.eta_sec != null
+        ? {
+            etaSec: data.eta_sec as number,
+            etaAt: data.eta_at as string,
+            throughputFps: data.throughput_fps as number | undefined,
+          }
+        : null;
+    set({ sessionState, sessionEta });
   },
 
   onSessionFinished: (data) =>
     set({
+      sessionEta: null,
       sessionState: (data.state as string) === "aborted" ? "aborted" : "completed",
       sessionSummary: {
         sessionId: data.session_id as string,
@@ -194,6 +233,23 @@ export const useEncodeStore = create<EncodeState>((set) => ({
       },
     }),
 
+  onJobNeedsCrop: (data) =>
+    set({
+      cropRequest: {
+        sessionId: data.session_id as string,
+        jobId: data.job_id as string,
+        inputPath: data.input_path as string,
+        rect: {
+          left: data.left as number,
+          top: data.top as number,
+          right: data.right as number,
+          bottom: data.bottom as number,
+        },
+        width: data.width as number,
+        height: data.height as number,
+      },
+    }),
+
   onWarning: (data) =>
     set((s) => ({
       warnings: [...s.warnings, data.message as string].slice(-50),
@@ -213,6 +269,8 @@ export const useEncodeStore = create<EncodeState>((set) => ({
 
   clearOverwriteRequest: () => set({ overwriteRequest: null }),
 
+  clearCropRequest: () => set({ cropRequest: null }),
+
   resetSession: () =>
     set({
       sessionId: "",
@@ -220,7 +278,9 @@ export const useEncodeStore = create<EncodeState>((set) => ({
       jobProgress: {},
       jobLogs: {},
       sessionSummary: null,
+      sessionEta: null,
       overwriteRequest: null,
+      cropRequest: null,
       warnings: [],
     }),
 }));
@@ -37,6 +37,45 @@ export interface NVEncCAdvanced {
   output_thread: number | null;
 }
 
+export interface FilterRect {
+  left: number;
+  top: number;
+  right: number;
+  bottom: number;
+}
+
+export interface Filter {
+  type: string;
+  disabled?: boolean;
+  method?: string;
+  rect?: FilterRect;
+  params?: Record<string, string>;
+}
+
+export interface TrackRules {
+  audio_languages?: string[];
+  drop_commentary?: boolean;
+  first_audio?: string;
+  other_audio?: string;
+  default_audio?: string;
+  sub_languages?: string[];
+  default_sub?: string;
+  forced_sub?: string;
+  sidecars?: boolean;
+}
+
+export interface Loudness {
+  target_lufs: number;
+  true_peak: number;
+}
+
+export interface ChunkSettings {
+  min_duration_sec?: number;
+  segment_sec?: number;
+  boundary?: string;
+  retries?: number;
+}
+
 export interface Profile {
   id: string;
   version: number;
@@ -47,6 +86,7 @@ export interface Profile {
   codec: string;
   rate_control: string;
   rate_value: number;
+  target_size_mode?: string;
   preset: string;
   output_depth: number;
   multipass: string;
@@ -57,17 +97,24 @@ export interface Profile {
   gop_len: number | null;
   aq: boolean;
   aq_temporal: boolean;
+  filters?: Filter[];
+  auto_crop?: string;
   split_enc: string;
   parallel: string;
   decoder: string;
   device: string;
+  chunks?: ChunkSettings | null;
   audio_mode: string;
   audio_bitrate: number;
+  tracks?: TrackRules | null;
+  loudness?: Loudness | null;
   colormatrix: string;
   transfer: string;
   colorprim: string;
   colorrange: string;
   dhdr10_info: string;
+  hdr_mode?: string;
+  tonemap?: string;
   metadata_copy: boolean;
   video_metadata_copy: boolean;
   audio_metadata_copy: boolean;
@@ -2,18 +2,26 @@ package main
 
 import (
 	"embed"
+	"os"
 
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
 	"github.com/wailsapp/wails/v2/pkg/options/assetserver"
 
 	"github.com/yuta/enque/backend/app"
+	"github.com/yuta/enque/backend/cli"
 )
 
 //go:embed all:frontend/dist
 var assets embed.FS
 
 func main() {
+	// Subcommands (enque encode, profiles, detect) run headless.
+	if len(os.Args) > 1 && cli.IsCommand(os.Args[1]) {
+		cli.AttachConsole()
+		os.Exit(cli.Run(os.Args[1:], cli.Env{}))
+	}
+
 	a := app.New()
 
 	err := wails.Run(&options.App{